@@ -3,10 +3,12 @@ package imagor
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"io"
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,12 +25,21 @@ const (
 	BlobTypeWEBP
 	BlobTypeAVIF
 	BlobTypeTIFF
+	BlobTypeSVG
+	BlobTypeMP4
+	BlobTypeWEBM
+	BlobTypeJXL
+	BlobTypeHEIF
+	BlobTypePDF
+	BlobTypeBMP
+	BlobTypeJP2
 )
 
 // Stat image attributes
 type Stat struct {
 	ModifiedTime time.Time
 	Size         int64
+	ETag         string
 }
 
 // Meta image attributes
@@ -39,6 +50,14 @@ type Meta struct {
 	Height      int    `json:"height"`
 	Orientation int    `json:"orientation"`
 	Pages       int    `json:"pages"`
+	BlurHash    string `json:"blurhash,omitempty"`
+	ThumbHash   string `json:"thumbhash,omitempty"`
+
+	DominantColor string   `json:"dominant_color,omitempty"`
+	Palette       []string `json:"palette,omitempty"`
+
+	// SourceETag ETag of the source image recorded with the result for ETag check
+	SourceETag string `json:"source_etag,omitempty"`
 }
 
 type Blob struct {
@@ -52,6 +71,7 @@ type Blob struct {
 
 	blobType    BlobType
 	contentType string
+	etag        atomic.Value
 
 	Meta *Meta
 }
@@ -85,15 +105,33 @@ func NewEmptyBlob() *Blob {
 	return &Blob{}
 }
 
+// TransparentPixel 1x1 transparent PNG
+var TransparentPixel = []byte("\x89\x50\x4E\x47\x0D\x0A\x1A\x0A\x00\x00\x00\x0D\x49\x48\x44\x52\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1F\x15\xC4\x89\x00\x00\x00\x0E\x49\x44\x41\x54\x78\xDA\x62\x62\x60\x60\x60\x00\x0C\x00\x00\x0F\x00\x03\xB1\x88\xF4\x0F\x00\x00\x00\x00\x49\x45\x4E\x44\xAE\x42\x60\x82")
+
 var jpegHeader = []byte("\xFF\xD8\xFF")
 var gifHeader = []byte("\x47\x49\x46")
 var webpHeader = []byte("\x57\x45\x42\x50")
 var pngHeader = []byte("\x89\x50\x4E\x47")
+var pdfHeader = []byte("%PDF-")
 
 // https://github.com/strukturag/libheif/blob/master/libheif/heif.cc
 var ftyp = []byte("ftyp")
 var avif = []byte("avif")
 
+var webmHeader = []byte("\x1A\x45\xDF\xA3")
+
+// JPEG XL bare codestream and ISOBMFF container signatures
+var jxlCodestream = []byte("\xFF\x0A")
+var jxlContainer = []byte("\x00\x00\x00\x0CJXL \x0D\x0A\x87\x0A")
+
+// JPEG 2000 JP2 container and bare J2K codestream signatures
+var jp2Container = []byte("\x00\x00\x00\x0CjP  \x0D\x0A\x87\x0A")
+var j2kCodestream = []byte("\xFF\x4F\xFF\x51")
+
+// BMP file header signature followed by reserved zero bytes
+var bmpHeader = []byte("BM")
+var bmpReserved = []byte("\x00\x00\x00\x00")
+
 var tifII = []byte("\x49\x49\x2A\x00")
 var tifMM = []byte("\x4D\x4D\x00\x2A")
 
@@ -159,8 +197,24 @@ func (b *Blob) init() {
 				b.blobType = BlobTypeWEBP
 			} else if bytes.Equal(b.buf[4:8], ftyp) && bytes.Equal(b.buf[8:12], avif) {
 				b.blobType = BlobTypeAVIF
+			} else if bytes.Equal(b.buf[4:8], ftyp) && heifBlobType(b.buf) != BlobTypeUnknown {
+				b.blobType = heifBlobType(b.buf)
+			} else if bytes.Equal(b.buf[4:8], ftyp) && isMP4Brand(b.buf[8:12]) {
+				b.blobType = BlobTypeMP4
+			} else if bytes.Equal(b.buf[:4], webmHeader) {
+				b.blobType = BlobTypeWEBM
+			} else if bytes.Equal(b.buf[:2], jxlCodestream) || bytes.Equal(b.buf[:12], jxlContainer) {
+				b.blobType = BlobTypeJXL
 			} else if bytes.Equal(b.buf[:4], tifII) || bytes.Equal(b.buf[:4], tifMM) {
 				b.blobType = BlobTypeTIFF
+			} else if bytes.Equal(b.buf[:5], pdfHeader) {
+				b.blobType = BlobTypePDF
+			} else if bytes.Equal(b.buf[:12], jp2Container) || bytes.Equal(b.buf[:4], j2kCodestream) {
+				b.blobType = BlobTypeJP2
+			} else if bytes.Equal(b.buf[:2], bmpHeader) && bytes.Equal(b.buf[6:10], bmpReserved) {
+				b.blobType = BlobTypeBMP
+			} else if isSVG(b.buf) {
+				b.blobType = BlobTypeSVG
 			}
 		}
 		switch b.blobType {
@@ -176,17 +230,68 @@ func (b *Blob) init() {
 			b.contentType = "image/avif"
 		case BlobTypeTIFF:
 			b.contentType = "image/tiff"
+		case BlobTypeSVG:
+			b.contentType = "image/svg+xml"
+		case BlobTypeMP4:
+			b.contentType = "video/mp4"
+		case BlobTypeWEBM:
+			b.contentType = "video/webm"
+		case BlobTypeJXL:
+			b.contentType = "image/jxl"
+		case BlobTypeHEIF:
+			b.contentType = "image/heif"
+		case BlobTypePDF:
+			b.contentType = "application/pdf"
+		case BlobTypeBMP:
+			b.contentType = "image/bmp"
+		case BlobTypeJP2:
+			b.contentType = "image/jp2"
 		default:
 			b.contentType = http.DetectContentType(b.buf)
 		}
 	})
 }
 
+// heifBlobType HEIF by ftyp major brand e.g. heic of iPhone photos,
+// or AVIF by compatible brands of the generic mif1 and msf1 brands
+func heifBlobType(buf []byte) BlobType {
+	switch string(buf[8:12]) {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis":
+		return BlobTypeHEIF
+	case "mif1", "msf1":
+		size := int(binary.BigEndian.Uint32(buf[:4]))
+		if size > len(buf) {
+			size = len(buf)
+		}
+		for i := 16; i+4 <= size; i += 4 {
+			if bytes.Equal(buf[i:i+4], avif) {
+				return BlobTypeAVIF
+			}
+		}
+		return BlobTypeHEIF
+	}
+	return BlobTypeUnknown
+}
+
+func isMP4Brand(brand []byte) bool {
+	switch string(brand) {
+	case "isom", "iso2", "iso5", "iso6", "mp41", "mp42", "avc1", "dash":
+		return true
+	}
+	return false
+}
+
 func (b *Blob) IsEmpty() bool {
 	b.init()
 	return b.blobType == BlobTypeEmpty
 }
 
+// Size size of blob in bytes reported by its reader, 0 if unknown
+func (b *Blob) Size() int64 {
+	b.init()
+	return b.size
+}
+
 func (b *Blob) SupportsAnimation() bool {
 	b.init()
 	return b.blobType == BlobTypeGIF || b.blobType == BlobTypeWEBP
@@ -210,6 +315,19 @@ func (b *Blob) ContentType() string {
 	return b.contentType
 }
 
+// SetETag sets ETag of the source image as reported by origin,
+// e.g. by loader reader upon response
+func (b *Blob) SetETag(etag string) {
+	b.etag.Store(etag)
+}
+
+// ETag of the source image reported by origin, empty if unknown
+func (b *Blob) ETag() string {
+	b.init()
+	etag, _ := b.etag.Load().(string)
+	return etag
+}
+
 func (b *Blob) NewReader() (reader io.ReadCloser, size int64, err error) {
 	b.init()
 	b.onceReader.Do(func() {
@@ -1,9 +1,11 @@
 package imagor
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"image/png"
 	"io"
 	"os"
 	"testing"
@@ -55,6 +57,12 @@ func TestBlobTypes(t *testing.T) {
 			contentType: "image/avif",
 			bytesType:   BlobTypeAVIF,
 		},
+		{
+			name:        "svg",
+			path:        "sample.svg",
+			contentType: "image/svg+xml",
+			bytesType:   BlobTypeSVG,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -121,3 +129,84 @@ func TestNewEmptyBlob(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, buf)
 }
+
+func TestTransparentPixel(t *testing.T) {
+	b := NewBlobFromBytes(TransparentPixel)
+	assert.Equal(t, BlobTypePNG, b.BlobType())
+	img, err := png.Decode(bytes.NewReader(TransparentPixel))
+	require.NoError(t, err)
+	assert.Equal(t, 1, img.Bounds().Dx())
+	assert.Equal(t, 1, img.Bounds().Dy())
+	_, _, _, a := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0), a)
+}
+
+func TestVideoBlobTypes(t *testing.T) {
+	pad := bytes.Repeat([]byte{0}, 32)
+	b := NewBlobFromBytes(append([]byte("\x00\x00\x00\x1Cftypiso5\x00\x00\x02\x00"), pad...))
+	assert.Equal(t, BlobTypeMP4, b.BlobType())
+	assert.Equal(t, "video/mp4", b.ContentType())
+	assert.False(t, b.SupportsAnimation())
+
+	b = NewBlobFromBytes(append([]byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01"), pad...))
+	assert.Equal(t, BlobTypeWEBM, b.BlobType())
+	assert.Equal(t, "video/webm", b.ContentType())
+
+	b = NewBlobFromBytes(append([]byte("\x00\x00\x00\x1Cftypheic\x00\x00\x00\x00"), pad...))
+	assert.NotEqual(t, BlobTypeMP4, b.BlobType())
+}
+
+func TestHEIFBlobType(t *testing.T) {
+	pad := bytes.Repeat([]byte{0}, 32)
+	b := NewBlobFromBytes(append([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), pad...))
+	assert.Equal(t, BlobTypeHEIF, b.BlobType())
+	assert.Equal(t, "image/heif", b.ContentType())
+
+	b = NewBlobFromBytes(append([]byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1heic"), pad...))
+	assert.Equal(t, BlobTypeHEIF, b.BlobType())
+
+	b = NewBlobFromBytes(append([]byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1avif"), pad...))
+	assert.Equal(t, BlobTypeAVIF, b.BlobType())
+	assert.Equal(t, "image/avif", b.ContentType())
+}
+
+func TestPDFBlobType(t *testing.T) {
+	b := NewBlobFromBytes([]byte("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n1 0 obj\n<< /Type /Catalog >>\nendobj\n"))
+	assert.Equal(t, BlobTypePDF, b.BlobType())
+	assert.Equal(t, "application/pdf", b.ContentType())
+	assert.False(t, b.SupportsAnimation())
+}
+
+func TestBMPBlobType(t *testing.T) {
+	pad := bytes.Repeat([]byte{0}, 32)
+	b := NewBlobFromBytes(append([]byte("BM\x36\x00\x0C\x00\x00\x00\x00\x00\x36\x00\x00\x00"), pad...))
+	assert.Equal(t, BlobTypeBMP, b.BlobType())
+	assert.Equal(t, "image/bmp", b.ContentType())
+
+	b = NewBlobFromBytes(append([]byte("BMW is not a bitmap"), pad...))
+	assert.NotEqual(t, BlobTypeBMP, b.BlobType())
+}
+
+func TestJP2BlobType(t *testing.T) {
+	pad := bytes.Repeat([]byte{0}, 32)
+	b := NewBlobFromBytes(append([]byte("\x00\x00\x00\x0CjP  \x0D\x0A\x87\x0A\x00\x00\x00\x14ftypjp2 "), pad...))
+	assert.Equal(t, BlobTypeJP2, b.BlobType())
+	assert.Equal(t, "image/jp2", b.ContentType())
+
+	b = NewBlobFromBytes(append([]byte("\xFF\x4F\xFF\x51\x00\x2F"), pad...))
+	assert.Equal(t, BlobTypeJP2, b.BlobType())
+	assert.Equal(t, "image/jp2", b.ContentType())
+	assert.False(t, b.SupportsAnimation())
+}
+
+func TestJXLBlobType(t *testing.T) {
+	pad := bytes.Repeat([]byte{0}, 32)
+	b := NewBlobFromBytes(append([]byte("\xFF\x0A\xFA\x1F"), pad...))
+	assert.Equal(t, BlobTypeJXL, b.BlobType())
+	assert.Equal(t, "image/jxl", b.ContentType())
+
+	b = NewBlobFromBytes(append([]byte("\x00\x00\x00\x0CJXL \x0D\x0A\x87\x0A\x00\x00\x00\x14ftypjxl "), pad...))
+	assert.Equal(t, BlobTypeJXL, b.BlobType())
+	assert.Equal(t, "image/jxl", b.ContentType())
+	assert.False(t, b.SupportsAnimation())
+}
@@ -0,0 +1,103 @@
+package imagor
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes image into BlurHash string of x by y components, 1 to 9 each.
+// Image is expected to be small e.g. 32px thumbnail, as encoding is O(pixels * components)
+func BlurHash(img image.Image, x, y int) string {
+	if x < 1 || x > 9 || y < 1 || y > 9 {
+		return ""
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return ""
+	}
+	// linear rgb of pixels
+	pixels := make([][3]float64, w*h)
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			r, g, b, _ := img.At(bounds.Min.X+px, bounds.Min.Y+py).RGBA()
+			pixels[py*w+px] = [3]float64{
+				sRGBToLinear(r >> 8), sRGBToLinear(g >> 8), sRGBToLinear(b >> 8),
+			}
+		}
+	}
+	factors := make([][3]float64, 0, x*y)
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			var f [3]float64
+			for py := 0; py < h; py++ {
+				for px := 0; px < w; px++ {
+					basis := math.Cos(math.Pi*float64(i*px)/float64(w)) *
+						math.Cos(math.Pi*float64(j*py)/float64(h))
+					p := pixels[py*w+px]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+			scale := norm / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+	var sb strings.Builder
+	encode83(&sb, (x-1)+(y-1)*9, 1)
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		var actualMax float64
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		encode83(&sb, quantisedMax, 1)
+	} else {
+		encode83(&sb, 0, 1)
+	}
+	encode83(&sb, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		encode83(&sb, quantiseAC(f[0], maxValue)*19*19+quantiseAC(f[1], maxValue)*19+quantiseAC(f[2], maxValue), 2)
+	}
+	return sb.String()
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		sb.WriteByte(base83[digit])
+	}
+}
+
+func quantiseAC(v, maxValue float64) int {
+	v /= maxValue
+	q := math.Floor(math.Copysign(math.Sqrt(math.Abs(v)), v)*9 + 9.5)
+	return int(math.Max(0, math.Min(18, q)))
+}
+
+func sRGBToLinear(c uint32) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
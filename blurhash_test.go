@@ -0,0 +1,33 @@
+package imagor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestBlurHash(t *testing.T) {
+	white := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(white, white.Rect, image.White, image.Point{}, draw.Src)
+	hash := BlurHash(white, 4, 3)
+	assert.Len(t, hash, 4+2*4*3)
+	assert.Equal(t, "L", hash[:1], "size flag of 4x3")
+	assert.Equal(t, "TSUA", hash[2:6], "DC of white")
+	assert.Equal(t, "00TSUA", BlurHash(white, 1, 1))
+
+	gradient := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 16; y++ {
+			gradient.Set(x, y, color.NRGBA{R: uint8(x * 8), G: 100, B: 255 - uint8(x*8), A: 255})
+		}
+	}
+	hash = BlurHash(gradient, 5, 4)
+	assert.Len(t, hash, 4+2*5*4)
+	assert.NotEqual(t, "0", hash[1:2], "non-zero AC components")
+
+	assert.Empty(t, BlurHash(white, 0, 3))
+	assert.Empty(t, BlurHash(white, 4, 10))
+	assert.Empty(t, BlurHash(image.NewNRGBA(image.Rect(0, 0, 0, 0)), 4, 3))
+}
@@ -3,18 +3,41 @@ package main
 import (
 	"github.com/cshum/imagor/config"
 	"github.com/cshum/imagor/config/awsconfig"
+	"github.com/cshum/imagor/config/ffmpegconfig"
 	"github.com/cshum/imagor/config/gcloudconfig"
-	"github.com/cshum/imagor/config/vipsconfig"
+	"github.com/cshum/imagor/config/grpcconfig"
+	"github.com/cshum/imagor/config/r2config"
+	"github.com/cshum/imagor/config/stdconfig"
 	"os"
 )
 
 func main() {
-	var server = config.CreateServer(
-		os.Args[1:],
-		vipsconfig.WithVips,
+	var funcs = []config.Func{
+		ffmpegconfig.WithFFmpeg,
+	}
+	funcs = append(funcs, vipsFuncs...)
+	funcs = append(funcs,
+		stdconfig.WithStd,
 		awsconfig.WithAWS,
 		gcloudconfig.WithGCloud,
+		r2config.WithR2,
+		grpcconfig.WithGRPCLoader,
 	)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if res, err := config.Migrate(os.Args[2:], funcs...); err != nil || res.Failed > 0 {
+				os.Exit(1)
+			}
+			return
+		case "warm":
+			if res, err := config.Warm(os.Args[2:], funcs...); err != nil || res.Failed > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	var server = config.CreateServer(os.Args[1:], funcs...)
 	if server != nil {
 		server.Run()
 	}
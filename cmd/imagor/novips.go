@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package main
+
+import (
+	"github.com/cshum/imagor/config"
+)
+
+var vipsFuncs []config.Func
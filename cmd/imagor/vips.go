@@ -0,0 +1,14 @@
+//go:build cgo
+
+package main
+
+import (
+	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/config/vipsconfig"
+)
+
+// vips processor requires cgo and libvips,
+// builds with CGO_ENABLED=0 fall back to the pure Go processor
+var vipsFuncs = []config.Func{
+	vipsconfig.WithVips,
+}
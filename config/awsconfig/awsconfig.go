@@ -5,9 +5,15 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/cshum/imagor/prewarm"
 	"github.com/cshum/imagor/storage/s3storage"
 	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
 func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
@@ -24,6 +30,18 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"S3 force the request to use path-style addressing s3.amazonaws.com/bucket/key, instead of bucket.s3.amazonaws.com/key")
 		s3SafeChars = fs.String("s3-safe-chars", "",
 			"S3 safe characters to be excluded from image key escape")
+		s3MultipartThreshold = fs.Int64("s3-multipart-threshold", 5<<20,
+			"S3 Storage object size in bytes from which multipart upload is used, streaming from the image instead of buffering in memory")
+		s3MultipartPartSize = fs.Int64("s3-multipart-part-size", 5<<20,
+			"S3 Storage multipart upload part size in bytes, minimum 5MB")
+		s3MultipartConcurrency = fs.Int("s3-multipart-concurrency", 5,
+			"S3 Storage number of parts uploaded concurrently per multipart upload")
+		awsSecretsManagerSecretId = fs.String("aws-secrets-manager-secret-id", "",
+			"AWS Secrets Manager secret ID of the secret key for signing Imagor URL. Overrides imagor-secret if set")
+		awsCredentialsSecretId = fs.String("aws-credentials-secret-id", "",
+			"AWS Secrets Manager secret ID of JSON with AccessKeyId and SecretAccessKey for S3 and SQS, retrieved by aws-access-key-id. Rotated keys are picked up on refresh or on auth errors")
+		awsCredentialsRefreshInterval = fs.Duration("aws-credentials-refresh-interval", time.Minute*5,
+			"AWS Secrets Manager credentials refresh interval")
 
 		s3LoaderBucket = fs.String("s3-loader-bucket", "",
 			"S3 Bucket for S3 Loader. Enable S3 Loader only if this value present")
@@ -31,6 +49,12 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"Base directory for S3 Loader")
 		s3LoaderPathPrefix = fs.String("s3-loader-path-prefix", "",
 			"Base path prefix for S3 Loader")
+		s3LoaderEndpoint = fs.String("s3-loader-endpoint", "",
+			"Optional S3 Endpoint for S3 Loader to override s3-endpoint")
+		s3LoaderRegion = fs.String("s3-loader-region", "",
+			"Optional AWS Region for S3 Loader to override aws-region")
+		s3LoaderForcePathStyle = fs.Bool("s3-loader-force-path-style", false,
+			"S3 Loader force path-style addressing")
 
 		s3StorageBucket = fs.String("s3-storage-bucket", "",
 			"S3 Bucket for S3 Storage. Enable S3 Storage only if this value present")
@@ -38,6 +62,12 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"Base directory for S3 Storage")
 		s3StoragePathPrefix = fs.String("s3-storage-path-prefix", "",
 			"Base path prefix for S3 Storage")
+		s3StorageEndpoint = fs.String("s3-storage-endpoint", "",
+			"Optional S3 Endpoint for S3 Storage to override s3-endpoint")
+		s3StorageRegion = fs.String("s3-storage-region", "",
+			"Optional AWS Region for S3 Storage to override aws-region")
+		s3StorageForcePathStyle = fs.Bool("s3-storage-force-path-style", false,
+			"S3 Storage force path-style addressing")
 		s3StorageACL = fs.String("s3-storage-acl", "public-read",
 			"Upload ACL for S3 Storage")
 		s3StorageExpiration = fs.Duration("s3-storage-expiration", 0,
@@ -49,11 +79,43 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"Base directory for S3 Result Storage")
 		s3ResultStoragePathPrefix = fs.String("s3-result-storage-path-prefix", "",
 			"Base path prefix for S3 Result Storage")
+		s3ResultStorageEndpoint = fs.String("s3-result-storage-endpoint", "",
+			"Optional S3 Endpoint for S3 Result Storage to override s3-endpoint")
+		s3ResultStorageRegion = fs.String("s3-result-storage-region", "",
+			"Optional AWS Region for S3 Result Storage to override aws-region")
+		s3ResultStorageForcePathStyle = fs.Bool("s3-result-storage-force-path-style", false,
+			"S3 Result Storage force path-style addressing")
 		s3ResultStorageACL = fs.String("s3-result-storage-acl", "public-read",
 			"Upload ACL for S3 Result Storage")
 		s3ResultStorageExpiration = fs.Duration("s3-result-storage-expiration", 0,
 			"S3 Result Storage expiration duration e.g. 24h. Default no expiration")
 
+		s3MetaStorageBucket = fs.String("s3-meta-storage-bucket", "",
+			"S3 Bucket for S3 Meta Storage. Enable S3 Meta Storage only if this value present")
+		s3MetaStorageBaseDir = fs.String("s3-meta-storage-base-dir", "",
+			"Base directory for S3 Meta Storage")
+		s3MetaStoragePathPrefix = fs.String("s3-meta-storage-path-prefix", "",
+			"Base path prefix for S3 Meta Storage")
+		s3MetaStorageEndpoint = fs.String("s3-meta-storage-endpoint", "",
+			"Optional S3 Endpoint for S3 Meta Storage to override s3-endpoint")
+		s3MetaStorageRegion = fs.String("s3-meta-storage-region", "",
+			"Optional AWS Region for S3 Meta Storage to override aws-region")
+		s3MetaStorageForcePathStyle = fs.Bool("s3-meta-storage-force-path-style", false,
+			"S3 Meta Storage force path-style addressing")
+		s3MetaStorageACL = fs.String("s3-meta-storage-acl", "public-read",
+			"Upload ACL for S3 Meta Storage")
+		s3MetaStorageExpiration = fs.Duration("s3-meta-storage-expiration", 0,
+			"S3 Meta Storage expiration duration e.g. 24h. Default no expiration")
+
+		sqsPrewarmQueueURL = fs.String("sqs-prewarm-queue-url", "",
+			"SQS queue URL of S3 object created event notifications, for pre-generating presets of new images. Requires sqs-prewarm-presets")
+		sqsPrewarmPresets = fs.String("sqs-prewarm-presets", "",
+			"Imagor params to be pre-generated for new images in csv e.g. fit-in/200x200,filters:format(webp)")
+		sqsPrewarmTrimPrefix = fs.String("sqs-prewarm-trim-prefix", "",
+			"Prefix trimmed from S3 object keys of events to form image keys, e.g. base directory of loader bucket")
+		sqsPrewarmConcurrency = fs.Int("sqs-prewarm-concurrency", 4,
+			"Number of SQS messages to be processed concurrently")
+
 		_, _ = cb()
 	)
 	return func(app *imagor.Imagor) {
@@ -72,15 +134,61 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			if err != nil {
 				panic(err)
 			}
+			// storageSess of S3 and SQS, which may use rotated credentials from Secrets Manager
+			storageSess := sess
+			if *awsCredentialsSecretId != "" {
+				creds := credentials.NewCredentials(&secretsManagerCredentials{
+					client:   secretsmanager.New(sess),
+					secretId: *awsCredentialsSecretId,
+					refresh:  *awsCredentialsRefreshInterval,
+				})
+				storageSess = sess.Copy(aws.NewConfig().WithCredentials(creds))
+				storageSess.Handlers.Complete.PushBack(expireOnAuthError(creds))
+			}
+			// sessionWith overrides endpoint, region and path-style of the shared session per storage,
+			// e.g. loading from AWS S3 while storing results on MinIO
+			sessionWith := func(endpoint, region string, forcePathStyle bool) *session.Session {
+				if endpoint == "" && region == "" && !forcePathStyle {
+					return storageSess
+				}
+				cfg := aws.NewConfig()
+				if endpoint != "" {
+					cfg.WithEndpoint(endpoint)
+				}
+				if region != "" {
+					cfg.WithRegion(region)
+				}
+				if forcePathStyle {
+					cfg.WithS3ForcePathStyle(true)
+				}
+				return storageSess.Copy(cfg)
+			}
+			if *awsSecretsManagerSecretId != "" {
+				// signer options from imagor config
+				signerType, _ := lookupFlag(fs, "imagor-signer-type").(string)
+				signerTruncate, _ := lookupFlag(fs, "imagor-signer-truncate").(int)
+				interval, _ := lookupFlag(fs, "imagor-secret-refresh-interval").(time.Duration)
+				grace, _ := lookupFlag(fs, "imagor-secret-rotation-grace").(time.Duration)
+				var provider = newSecretsManagerProvider(sess, *awsSecretsManagerSecretId, interval)
+				if grace > 0 {
+					provider = imagorpath.NewRotationSecretProvider(provider, grace)
+				}
+				app.Signer = config.NewSigner(signerType, signerTruncate, provider)
+			}
 			if *s3StorageBucket != "" {
 				// activate S3 Storage only if bucket config presents
 				app.Storages = append(app.Storages,
-					s3storage.New(sess, *s3StorageBucket,
+					s3storage.New(
+						sessionWith(*s3StorageEndpoint, *s3StorageRegion, *s3StorageForcePathStyle),
+						*s3StorageBucket,
 						s3storage.WithPathPrefix(*s3StoragePathPrefix),
 						s3storage.WithBaseDir(*s3StorageBaseDir),
 						s3storage.WithACL(*s3StorageACL),
 						s3storage.WithSafeChars(*s3SafeChars),
 						s3storage.WithExpiration(*s3StorageExpiration),
+						s3storage.WithMultipartThreshold(*s3MultipartThreshold),
+						s3storage.WithMultipartPartSize(*s3MultipartPartSize),
+						s3storage.WithMultipartConcurrency(*s3MultipartConcurrency),
 					),
 				)
 			}
@@ -88,10 +196,15 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 				// activate S3 Loader only if bucket config presents
 				if *s3LoaderPathPrefix != *s3StoragePathPrefix ||
 					*s3LoaderBucket != *s3StorageBucket ||
-					*s3LoaderBaseDir != *s3StorageBaseDir {
+					*s3LoaderBaseDir != *s3StorageBaseDir ||
+					*s3LoaderEndpoint != *s3StorageEndpoint ||
+					*s3LoaderRegion != *s3StorageRegion ||
+					*s3LoaderForcePathStyle != *s3StorageForcePathStyle {
 					// create another loader if different from storage
 					app.Loaders = append(app.Loaders,
-						s3storage.New(sess, *s3LoaderBucket,
+						s3storage.New(
+							sessionWith(*s3LoaderEndpoint, *s3LoaderRegion, *s3LoaderForcePathStyle),
+							*s3LoaderBucket,
 							s3storage.WithPathPrefix(*s3LoaderPathPrefix),
 							s3storage.WithBaseDir(*s3LoaderBaseDir),
 							s3storage.WithSafeChars(*s3SafeChars),
@@ -102,15 +215,45 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			if *s3ResultStorageBucket != "" {
 				// activate S3 ResultStorage only if bucket config presents
 				app.ResultStorages = append(app.ResultStorages,
-					s3storage.New(sess, *s3ResultStorageBucket,
+					s3storage.New(
+						sessionWith(*s3ResultStorageEndpoint, *s3ResultStorageRegion, *s3ResultStorageForcePathStyle),
+						*s3ResultStorageBucket,
 						s3storage.WithPathPrefix(*s3ResultStoragePathPrefix),
 						s3storage.WithBaseDir(*s3ResultStorageBaseDir),
 						s3storage.WithACL(*s3ResultStorageACL),
 						s3storage.WithSafeChars(*s3SafeChars),
 						s3storage.WithExpiration(*s3ResultStorageExpiration),
+						s3storage.WithMultipartThreshold(*s3MultipartThreshold),
+						s3storage.WithMultipartPartSize(*s3MultipartPartSize),
+						s3storage.WithMultipartConcurrency(*s3MultipartConcurrency),
 					),
 				)
 			}
+			if *s3MetaStorageBucket != "" {
+				// activate S3 Meta Storage only if bucket config presents
+				app.MetaStorages = append(app.MetaStorages,
+					s3storage.New(
+						sessionWith(*s3MetaStorageEndpoint, *s3MetaStorageRegion, *s3MetaStorageForcePathStyle),
+						*s3MetaStorageBucket,
+						s3storage.WithPathPrefix(*s3MetaStoragePathPrefix),
+						s3storage.WithBaseDir(*s3MetaStorageBaseDir),
+						s3storage.WithACL(*s3MetaStorageACL),
+						s3storage.WithSafeChars(*s3SafeChars),
+						s3storage.WithExpiration(*s3MetaStorageExpiration),
+						s3storage.WithMultipartThreshold(*s3MultipartThreshold),
+						s3storage.WithMultipartPartSize(*s3MultipartPartSize),
+						s3storage.WithMultipartConcurrency(*s3MultipartConcurrency),
+					),
+				)
+			}
+			if *sqsPrewarmQueueURL != "" && strings.TrimSpace(*sqsPrewarmPresets) != "" {
+				// activate SQS pre-warm consumer only if queue URL and presets present
+				app.Workers = append(app.Workers, prewarm.New(
+					app, prewarm.NewSQSQueue(storageSess, *sqsPrewarmQueueURL), strings.Split(*sqsPrewarmPresets, ","),
+					prewarm.WithTrimPrefix(*sqsPrewarmTrimPrefix),
+					prewarm.WithConcurrency(*sqsPrewarmConcurrency),
+				))
+			}
 		}
 	}
 }
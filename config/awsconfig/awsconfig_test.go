@@ -1,11 +1,16 @@
 package awsconfig
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/config"
 	"github.com/cshum/imagor/storage/s3storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestS3Loader(t *testing.T) {
@@ -48,6 +53,10 @@ func TestS3Storage(t *testing.T) {
 		"-s3-result-storage-bucket", "b",
 		"-s3-result-storage-base-dir", "bar",
 		"-s3-result-storage-path-prefix", "bcda",
+
+		"-s3-meta-storage-bucket", "c",
+		"-s3-meta-storage-base-dir", "meta",
+		"-s3-meta-storage-acl", "private",
 	}, WithAWS)
 	app := srv.App.(*imagor.Imagor)
 	assert.Equal(t, 1, len(app.Loaders))
@@ -62,4 +71,87 @@ func TestS3Storage(t *testing.T) {
 	assert.Equal(t, "/bar/", resultStorage.BaseDir)
 	assert.Equal(t, "/bcda/", resultStorage.PathPrefix)
 	assert.Equal(t, "!", resultStorage.SafeChars)
+
+	metaStorage := app.MetaStorages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "c", metaStorage.Bucket)
+	assert.Equal(t, "/meta/", metaStorage.BaseDir)
+	assert.Equal(t, "private", metaStorage.ACL)
+}
+
+func TestS3EndpointOverride(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-aws-region", "us-east-1",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+
+		"-s3-loader-bucket", "a",
+		"-s3-storage-bucket", "a",
+
+		"-s3-result-storage-bucket", "b",
+		"-s3-result-storage-endpoint", "http://minio:9000",
+		"-s3-result-storage-region", "local",
+		"-s3-result-storage-force-path-style",
+	}, WithAWS)
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 1, len(app.Loaders))
+	storage := app.Storages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "", aws.StringValue(storage.S3.Config.Endpoint))
+	assert.Equal(t, "us-east-1", aws.StringValue(storage.S3.Config.Region))
+	assert.False(t, aws.BoolValue(storage.S3.Config.S3ForcePathStyle))
+
+	resultStorage := app.ResultStorages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "http://minio:9000", aws.StringValue(resultStorage.S3.Config.Endpoint))
+	assert.Equal(t, "local", aws.StringValue(resultStorage.S3.Config.Region))
+	assert.True(t, aws.BoolValue(resultStorage.S3.Config.S3ForcePathStyle))
+}
+
+type fakeSecretValueGetter struct {
+	secret string
+	calls  int
+}
+
+func (f *fakeSecretValueGetter) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	f.calls++
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(f.secret)}, nil
+}
+
+func TestSecretsManagerCredentials(t *testing.T) {
+	client := &fakeSecretValueGetter{secret: `{"AccessKeyId":"a","SecretAccessKey":"b"}`}
+	p := &secretsManagerCredentials{client: client, secretId: "creds", refresh: time.Hour}
+	assert.True(t, p.IsExpired())
+	v, err := p.Retrieve()
+	require.NoError(t, err)
+	assert.Equal(t, "a", v.AccessKeyID)
+	assert.Equal(t, "b", v.SecretAccessKey)
+	assert.False(t, p.IsExpired())
+
+	client.secret = `{"aws_access_key_id":"c","aws_secret_access_key":"d","aws_session_token":"e"}`
+	v, err = p.Retrieve()
+	require.NoError(t, err)
+	assert.Equal(t, "c", v.AccessKeyID)
+	assert.Equal(t, "d", v.SecretAccessKey)
+	assert.Equal(t, "e", v.SessionToken)
+
+	client.secret = `{"foo":"bar"}`
+	_, err = p.Retrieve()
+	assert.Error(t, err)
+
+	p.refresh = 0
+	client.secret = `{"AccessKeyId":"a","SecretAccessKey":"b"}`
+	_, err = p.Retrieve()
+	require.NoError(t, err)
+	assert.True(t, p.IsExpired())
+	assert.Equal(t, 4, client.calls)
+}
+
+func TestCredentialsSecret(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-aws-region", "asdf",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+		"-aws-credentials-secret-id", "imagor/s3",
+		"-s3-loader-bucket", "a",
+	}, WithAWS)
+	app := srv.App.(*imagor.Imagor)
+	assert.IsType(t, &s3storage.S3Storage{}, app.Loaders[0])
 }
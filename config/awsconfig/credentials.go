@@ -0,0 +1,100 @@
+package awsconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"sync"
+	"time"
+)
+
+const secretsManagerProviderName = "SecretsManagerProvider"
+
+type secretValueGetter interface {
+	GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// secretsManagerCredentials credentials provider of access keys in AWS Secrets Manager secret JSON,
+// re-retrieved every refresh interval such that rotated keys are picked up
+type secretsManagerCredentials struct {
+	client   secretValueGetter
+	secretId string
+	refresh  time.Duration
+
+	mu     sync.Mutex
+	expiry time.Time
+}
+
+// secretCredentials accepts key names of both Secrets Manager rotation templates and AWS CLI
+type secretCredentials struct {
+	AccessKeyId        string `json:"AccessKeyId"`
+	SecretAccessKey    string `json:"SecretAccessKey"`
+	SessionToken       string `json:"SessionToken"`
+	CLIAccessKeyId     string `json:"aws_access_key_id"`
+	CLISecretAccessKey string `json:"aws_secret_access_key"`
+	CLISessionToken    string `json:"aws_session_token"`
+}
+
+func (p *secretsManagerCredentials) Retrieve() (credentials.Value, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	out, err := p.client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.secretId),
+	})
+	if err != nil {
+		return credentials.Value{ProviderName: secretsManagerProviderName}, err
+	}
+	if out.SecretString == nil {
+		return credentials.Value{ProviderName: secretsManagerProviderName},
+			errors.New("secretsmanager: secret string not found")
+	}
+	var c secretCredentials
+	if err := json.Unmarshal([]byte(*out.SecretString), &c); err != nil {
+		return credentials.Value{ProviderName: secretsManagerProviderName}, err
+	}
+	v := credentials.Value{
+		AccessKeyID:     c.AccessKeyId,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		ProviderName:    secretsManagerProviderName,
+	}
+	if v.AccessKeyID == "" {
+		v.AccessKeyID, v.SecretAccessKey, v.SessionToken =
+			c.CLIAccessKeyId, c.CLISecretAccessKey, c.CLISessionToken
+	}
+	if v.AccessKeyID == "" || v.SecretAccessKey == "" {
+		return credentials.Value{ProviderName: secretsManagerProviderName},
+			errors.New("secretsmanager: access key not found in secret")
+	}
+	p.mu.Lock()
+	p.expiry = time.Now().Add(p.refresh)
+	p.mu.Unlock()
+	return v, nil
+}
+
+func (p *secretsManagerCredentials) IsExpired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !time.Now().Before(p.expiry)
+}
+
+// expireOnAuthError expires credentials on errors caused by rotated keys,
+// such that the next request retrieves the current keys without waiting for refresh
+func expireOnAuthError(creds *credentials.Credentials) func(r *request.Request) {
+	return func(r *request.Request) {
+		var e awserr.Error
+		if r.Error == nil || !errors.As(r.Error, &e) {
+			return
+		}
+		switch e.Code() {
+		case "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken",
+			"InvalidClientTokenId", "UnrecognizedClientException":
+			creds.Expire()
+		}
+	}
+}
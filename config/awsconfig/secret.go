@@ -0,0 +1,40 @@
+package awsconfig
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/cshum/imagor/imagorpath"
+	"time"
+)
+
+// newSecretsManagerProvider secret provider from AWS Secrets Manager secret string
+func newSecretsManagerProvider(sess *session.Session, secretId string, ttl time.Duration) imagorpath.SecretProvider {
+	client := secretsmanager.New(sess)
+	return imagorpath.NewCachedSecretProvider(func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		out, err := client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(secretId),
+		})
+		if err != nil {
+			return "", err
+		}
+		if out.SecretString == nil {
+			return "", errors.New("secretsmanager: secret string not found")
+		}
+		return *out.SecretString, nil
+	}, ttl)
+}
+
+func lookupFlag(fs *flag.FlagSet, name string) interface{} {
+	if f := fs.Lookup(name); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			return getter.Get()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/b2storage"
+	"go.uber.org/zap"
+	"time"
+)
+
+func withB2(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		b2KeyID = fs.String("b2-key-id", "",
+			"Backblaze B2 application key ID")
+		b2ApplicationKey = fs.String("b2-application-key", "",
+			"Backblaze B2 application key")
+		b2SafeChars = fs.String("b2-safe-chars", "",
+			"B2 safe characters to be excluded from image key escape")
+		b2HardDelete = fs.Bool("b2-hard-delete", false,
+			"B2 delete all file versions on delete, instead of hiding files for bucket lifecycle rules to clean up")
+
+		b2LoaderBucket = fs.String("b2-loader-bucket", "",
+			"B2 Bucket for B2 Loader. Enable B2 Loader only if this value present")
+		b2LoaderBaseDir = fs.String("b2-loader-base-dir", "",
+			"Base directory for B2 Loader")
+		b2LoaderPathPrefix = fs.String("b2-loader-path-prefix", "",
+			"Base path prefix for B2 Loader")
+
+		b2StorageBucket = fs.String("b2-storage-bucket", "",
+			"B2 Bucket for B2 Storage. Enable B2 Storage only if this value present")
+		b2StorageBaseDir = fs.String("b2-storage-base-dir", "",
+			"Base directory for B2 Storage")
+		b2StoragePathPrefix = fs.String("b2-storage-path-prefix", "",
+			"Base path prefix for B2 Storage")
+		b2StorageExpiration = fs.Duration("b2-storage-expiration", 0,
+			"B2 Storage expiration duration e.g. 24h. Default no expiration")
+
+		b2ResultStorageBucket = fs.String("b2-result-storage-bucket", "",
+			"B2 Bucket for B2 Result Storage. Enable B2 Result Storage only if this value present")
+		b2ResultStorageBaseDir = fs.String("b2-result-storage-base-dir", "",
+			"Base directory for B2 Result Storage. Target of bucket lifecycle rules as file name prefix")
+		b2ResultStoragePathPrefix = fs.String("b2-result-storage-path-prefix", "",
+			"Base path prefix for B2 Result Storage")
+		b2ResultStorageExpiration = fs.Duration("b2-result-storage-expiration", 0,
+			"B2 Result Storage expiration duration e.g. 24h. Default no expiration")
+
+		_, _ = cb()
+	)
+	newB2Storage := func(bucket, baseDir, prefix string, exp time.Duration) *b2storage.B2Storage {
+		return b2storage.New(*b2KeyID, *b2ApplicationKey, bucket,
+			b2storage.WithBaseDir(baseDir),
+			b2storage.WithPathPrefix(prefix),
+			b2storage.WithSafeChars(*b2SafeChars),
+			b2storage.WithExpiration(exp),
+			b2storage.WithHardDelete(*b2HardDelete),
+		)
+	}
+	return func(o *imagor.Imagor) {
+		if *b2StorageBucket != "" {
+			// activate B2 Storage only if bucket config presents
+			o.Storages = append(o.Storages,
+				newB2Storage(*b2StorageBucket, *b2StorageBaseDir, *b2StoragePathPrefix, *b2StorageExpiration))
+		}
+		if *b2LoaderBucket != "" {
+			// activate B2 Loader only if bucket config presents
+			if *b2StorageBucket != *b2LoaderBucket ||
+				*b2StorageBaseDir != *b2LoaderBaseDir ||
+				*b2StoragePathPrefix != *b2LoaderPathPrefix {
+				// create another loader if different from storage
+				o.Loaders = append(o.Loaders,
+					newB2Storage(*b2LoaderBucket, *b2LoaderBaseDir, *b2LoaderPathPrefix, 0))
+			}
+		}
+		if *b2ResultStorageBucket != "" {
+			// activate B2 Result Storage only if bucket config presents
+			o.ResultStorages = append(o.ResultStorages,
+				newB2Storage(*b2ResultStorageBucket, *b2ResultStorageBaseDir, *b2ResultStoragePathPrefix, *b2ResultStorageExpiration))
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
 	"flag"
 	"fmt"
 	"github.com/cshum/imagor"
@@ -11,6 +12,8 @@ import (
 	"github.com/cshum/imagor/server"
 	"github.com/peterbourgon/ff/v3"
 	"go.uber.org/zap"
+	"net/http"
+	"os"
 	"runtime"
 	"strings"
 	"time"
@@ -18,7 +21,25 @@ import (
 
 var baseConfig = []Func{
 	withFileSystem,
+	withFTP,
+	withSFTP,
+	withWebDAV,
+	withB2,
+	withRedis,
+	withMemcached,
+	withMemory,
+	withKafkaPrewarm,
+	withOCILoader,
+	withSMBLoader,
+	withDataLoader,
+	withExecLoader,
 	withHTTPLoader,
+	withLoaderRoutes,
+	withLoadRetry,
+	withResultStorageFailover,
+	withResultStorageGzip,
+	withResultStorageDedup,
+	withResultStorageKeyTemplate,
 }
 
 func NewImagor(
@@ -33,6 +54,14 @@ func NewImagor(
 			"Output WebP format automatically if browser supports")
 		imagorAutoAVIF = fs.Bool("imagor-auto-avif", false,
 			"Output AVIF format automatically if browser supports (experimental)")
+		imagorAutoJXL = fs.Bool("imagor-auto-jxl", false,
+			"Output JPEG XL format automatically if browser supports (experimental)")
+		imagorAutoFormatPriority = fs.String("imagor-auto-format-priority", "jxl,avif,webp",
+			"Imagor auto format negotiation priority in comma separated format")
+		imagorAutoQualityHints = fs.Bool("imagor-auto-quality-hints", false,
+			"Imagor apply Save-Data and ECT client hints to quality(auto)")
+		imagorDPRClientHints = fs.Bool("imagor-dpr-client-hints", false,
+			"Imagor apply Sec-CH-DPR or DPR client hints as default dpr(n) that multiplies requested dimensions")
 		imagorRequestTimeout = fs.Duration("imagor-request-timeout",
 			time.Second*30, "Timeout for performing Imagor request")
 		imagorLoadTimeout = fs.Duration("imagor-load-timeout",
@@ -43,6 +72,34 @@ func NewImagor(
 			time.Second*20, "Timeout for image processing")
 		imagorBasePathRedirect = fs.String("imagor-base-path-redirect", "",
 			"URL to redirect for Imagor / base path e.g. https://www.google.com")
+		imagorFaviconFile = fs.String("imagor-favicon-file", "",
+			"File path of favicon.ico content. Responds empty 200 for favicon.ico if not set")
+		imagorWebhookPath = fs.String("imagor-webhook-path", "",
+			"Imagor source change webhook endpoint path e.g. /webhook. Requires imagor-webhook-secret")
+		imagorWebhookSecret = fs.String("imagor-webhook-secret", "",
+			"Imagor webhook secret for verifying HMAC-SHA256 request body signature of X-Imagor-Signature header")
+		imagorWebhookPresets = fs.String("imagor-webhook-presets", "",
+			"Imagor params to be re-generated on source change in csv e.g. fit-in/200x200,filters:format(webp)")
+		imagorUploadPath = fs.String("imagor-upload-path", "",
+			"Imagor upload endpoint path e.g. /upload, accepting PUT or POST multipart to /upload/{key}. Requires imagor-upload-secret")
+		imagorUploadSecret = fs.String("imagor-upload-secret", "",
+			"Imagor upload secret for verifying one-time upload tokens of X-Imagor-Upload-Token header or token query")
+		imagorUploadMaxSize = fs.Int64("imagor-upload-max-size", 32<<20,
+			"Imagor upload maximum request body size in bytes, applies regardless of upload token max size")
+		imagorSweepInterval = fs.Duration("imagor-sweep-interval", 0,
+			"Imagor interval of deleting expired results from result storages with expiration that support listing e.g. file, S3, B2. Default disabled")
+		imagorRobotsTxtFile = fs.String("imagor-robots-txt-file", "",
+			"File path of robots.txt content. Responds empty 200 for robots.txt if not set")
+		imagorNotFoundPixel = fs.Bool("imagor-not-found-pixel", false,
+			"Imagor responds not found source with 1x1 transparent PNG instead of 404")
+		imagorNotFoundPlaceholderFile = fs.String("imagor-not-found-placeholder-file", "",
+			"File path of placeholder image that Imagor responds for not found source instead of 404")
+		imagorResultKeyNamespace = fs.String("imagor-result-key-namespace", "",
+			"Imagor result key namespace prefix, bump to invalidate previous results. auto derives from Imagor and processor versions")
+		imagorResultKeyType = fs.String("imagor-result-key-type", "",
+			"Imagor result key type sha1 or sha256 digest of params for short storage keys. Default path based keys")
+		imagorResultKeyShard = fs.Int("imagor-result-key-shard", 0,
+			"Imagor digest result key shard depth, splitting leading digest into 2 characters directories e.g. 2 becomes ab/cd/abcd...")
 		imagorBaseParams = fs.String("imagor-base-params", "",
 			"Imagor endpoint base params that applies to all resulting images e.g. fitlers:watermark(example.jpg)")
 		imagorProcessConcurrency = fs.Int64("imagor-process-concurrency",
@@ -51,33 +108,124 @@ func NewImagor(
 			time.Hour*24*7, "Imagor HTTP Cache-Control header TTL for successful image response")
 		imagorCacheHeaderSWR = fs.Duration("imagor-cache-header-swr",
 			time.Hour*24, "Imagor HTTP Cache-Control header stale-while-revalidate for successful image response")
+		imagorCacheHeaderSIE = fs.Duration("imagor-cache-header-sie",
+			0, "Imagor HTTP Cache-Control header stale-if-error for successful image response")
+		imagorCacheHeaderMinTTL = fs.Duration("imagor-cache-header-min-ttl",
+			0, "Imagor minimum HTTP Cache-Control header TTL overridden by expire(seconds) filter")
+		imagorCacheHeaderMaxTTL = fs.Duration("imagor-cache-header-max-ttl",
+			0, "Imagor maximum HTTP Cache-Control header TTL overridden by expire(seconds) filter. Default no limit")
+		imagorSurrogateKeyHeader = fs.String("imagor-surrogate-key-header", "",
+			"Imagor response header for source image key for CDN tag based purging e.g. Surrogate-Key, Cache-Tag")
+		imagorSurrogateKeyTags = fs.String("imagor-surrogate-key-tags", "",
+			"Imagor additional surrogate keys in comma separated format e.g. tenant name")
 		imagorCacheHeaderNoCache = fs.Bool("imagor-cache-header-no-cache",
 			false, "Imagor HTTP Cache-Control header no-cache for successful image response")
 		imagorModifiedTimeCheck = fs.Bool("imagor-modified-time-check", false,
 			"Check modified time of result image against the source image. This eliminates stale result but require more lookups")
+		imagorETagCheck = fs.Bool("imagor-etag-check", false,
+			"With imagor-modified-time-check, also check source ETag recorded with result against origin via conditional request")
+		imagorMaxFilters = fs.Int("imagor-max-filters", 0,
+			"Imagor maximum number of filters per request. Default no limit")
+		imagorMaxBlur = fs.Float64("imagor-max-blur", 0,
+			"Imagor maximum cumulative blur radius per request. Default no limit")
+		imagorMaxWatermarks = fs.Int("imagor-max-watermarks", 0,
+			"Imagor maximum number of watermarks per request. Default no limit")
+		imagorMaxLoads = fs.Int("imagor-max-loads", 0,
+			"Imagor maximum number of nested image loads e.g. watermark images per request. Default no limit")
+		imagorMaxNestedDepth = fs.Int("imagor-max-nested-depth", 0,
+			"Imagor maximum depth of signed imagor path used as image source of another request. Default 0 disables nested paths")
+		imagorMaxPathLength = fs.Int("imagor-max-path-length", 0,
+			"Imagor maximum URL path length, responds 414 if exceeded. Default no limit")
+		imagorMaxImageLength = fs.Int("imagor-max-image-length", 0,
+			"Imagor maximum decoded image URL length, responds 400 if exceeded. Default no limit")
+		imagorMaxFilterArgsLength = fs.Int("imagor-max-filter-args-length", 0,
+			"Imagor maximum filter arguments length, responds 400 if exceeded. Default no limit")
+		imagorUnsafeCIDRs = fs.String("imagor-unsafe-cidrs", "",
+			"Restrict unsafe mode to client IP within CIDRs in comma separated format e.g. 127.0.0.1/32,10.0.0.0/8")
+		imagorUnsafePathPrefixes = fs.String("imagor-unsafe-path-prefixes", "",
+			"Restrict unsafe mode to image path prefixes in comma separated format e.g. debug/,tmp/")
+		imagorEnforcedWatermark = fs.String("imagor-enforced-watermark", "",
+			"Imagor watermark filter arguments enforced to all requests unless exempted e.g. logo.png,repeat,bottom,10")
+		imagorEnforcedWatermarkExemptHeader = fs.String("imagor-enforced-watermark-exempt-header", "",
+			"Request header that exempts enforced watermark e.g. X-Imagor-Key")
+		imagorEnforcedWatermarkExemptValue = fs.String("imagor-enforced-watermark-exempt-value", "",
+			"Required value of exempt header. Any non-empty value exempts if not set")
+		imagorValidateFilters = fs.Bool("imagor-validate-filters", false,
+			"Imagor validate and normalize built-in filter arguments, responds 400 if invalid")
+		imagorSanitizeSVG = fs.Bool("imagor-sanitize-svg", false,
+			"Imagor sanitize SVG served without rasterization, stripping scripts, event handlers and external references")
 		imagorDisableErrorBody      = fs.Bool("imagor-disable-error-body", false, "Imagor disable response body on error")
 		imagorDisableParamsEndpoint = fs.Bool("imagor-disable-params-endpoint", false, "Imagor disable /params endpoint")
 		imagorSignerType            = fs.String("imagor-signer-type", "sha1", "Imagor URL signature hasher type sha1 or sha256")
 		imagorSignerTruncate        = fs.Int("imagor-signer-truncate", 0, "Imagor URL signature truncate at length")
 
+		imagorSecretFile = fs.String("imagor-secret-file", "",
+			"File path of secret key for signing Imagor URL. File is re-read on change")
+		imagorSecretVaultAddr = fs.String("imagor-secret-vault-addr", "",
+			"HashiCorp Vault address for retrieving secret key for signing Imagor URL e.g. https://vault:8200")
+		imagorSecretVaultToken = fs.String("imagor-secret-vault-token", "",
+			"HashiCorp Vault token")
+		imagorSecretVaultPath = fs.String("imagor-secret-vault-path", "",
+			"HashiCorp Vault KV secret path e.g. secret/data/imagor")
+		imagorSecretVaultField = fs.String("imagor-secret-vault-field", "secret",
+			"HashiCorp Vault KV secret field")
+		imagorSecretRefreshInterval = fs.Duration("imagor-secret-refresh-interval", time.Second*30,
+			"Refresh interval for secret key from file or external secret provider")
+		imagorSecretRotationGrace = fs.Duration("imagor-secret-rotation-grace", 0,
+			"Grace period accepting URLs signed with the previous secret key after secret rotation from file or external secret provider")
+
 		options, logger, isDebug = applyFuncs(fs, cb, append(funcs, baseConfig...)...)
 
-		alg = sha1.New
+		provider imagorpath.SecretProvider
 	)
 
-	if strings.ToLower(*imagorSignerType) == "sha256" {
-		alg = sha256.New
-	} else if strings.ToLower(*imagorSignerType) == "sha512" {
-		alg = sha512.New
+	if *imagorSecretVaultAddr != "" {
+		provider = imagorpath.NewVaultSecretProvider(
+			*imagorSecretVaultAddr, *imagorSecretVaultToken,
+			*imagorSecretVaultPath, *imagorSecretVaultField,
+			*imagorSecretRefreshInterval)
+	} else if *imagorSecretFile != "" {
+		provider = imagorpath.NewFileSecretProvider(
+			*imagorSecretFile, *imagorSecretRefreshInterval)
+	} else {
+		provider = imagorpath.StaticSecret(*imagorSecret)
+	}
+
+	if *imagorSecretRotationGrace > 0 {
+		if _, ok := provider.(imagorpath.StaticSecret); !ok {
+			provider = imagorpath.NewRotationSecretProvider(provider, *imagorSecretRotationGrace)
+		}
+	}
+
+	// signer goes first such that config funcs may override with other secret providers
+	options = append([]imagor.Option{imagor.WithSigner(
+		NewSigner(*imagorSignerType, *imagorSignerTruncate, provider),
+	)}, options...)
+
+	if *imagorNotFoundPlaceholderFile != "" {
+		options = append(options, imagor.WithNotFoundPlaceholder(readFile(*imagorNotFoundPlaceholderFile)))
+	} else if *imagorNotFoundPixel {
+		options = append(options, imagor.WithNotFoundPlaceholder(imagor.TransparentPixel))
+	}
+	if *imagorResultKeyType != "" {
+		options = append(options, imagor.WithResultKey(
+			NewResultKey(*imagorResultKeyType, *imagorResultKeyShard)))
+	}
+	if *imagorValidateFilters {
+		options = append(options, imagor.WithFilterSchemas(imagorpath.DefaultFilterSchemas))
 	}
 
 	return imagor.New(append(
 		options,
-		imagor.WithSigner(imagorpath.NewHMACSigner(
-			alg, *imagorSignerTruncate, *imagorSecret,
-		)),
 		imagor.WithBasePathRedirect(*imagorBasePathRedirect),
+		imagor.WithFavicon(readFile(*imagorFaviconFile)),
+		imagor.WithRobotsTxt(readFile(*imagorRobotsTxtFile)),
+		imagor.WithWebhook(*imagorWebhookPath, *imagorWebhookSecret, strings.Split(*imagorWebhookPresets, ",")...),
+		imagor.WithUpload(*imagorUploadPath, *imagorUploadSecret),
+		imagor.WithUploadMaxSize(*imagorUploadMaxSize),
+		imagor.WithSweepInterval(*imagorSweepInterval),
 		imagor.WithBaseParams(*imagorBaseParams),
+		imagor.WithResultKeyNamespace(*imagorResultKeyNamespace),
 		imagor.WithRequestTimeout(*imagorRequestTimeout),
 		imagor.WithLoadTimeout(*imagorLoadTimeout),
 		imagor.WithSaveTimeout(*imagorSaveTimeout),
@@ -85,23 +233,108 @@ func NewImagor(
 		imagor.WithProcessConcurrency(*imagorProcessConcurrency),
 		imagor.WithCacheHeaderTTL(*imagorCacheHeaderTTL),
 		imagor.WithCacheHeaderSWR(*imagorCacheHeaderSWR),
+		imagor.WithCacheHeaderSIE(*imagorCacheHeaderSIE),
+		imagor.WithCacheHeaderMinTTL(*imagorCacheHeaderMinTTL),
+		imagor.WithCacheHeaderMaxTTL(*imagorCacheHeaderMaxTTL),
 		imagor.WithCacheHeaderNoCache(*imagorCacheHeaderNoCache),
+		imagor.WithSurrogateKeyHeader(*imagorSurrogateKeyHeader, newStaticKeys(*imagorSurrogateKeyTags)),
 		imagor.WithAutoWebP(*imagorAutoWebP),
 		imagor.WithAutoAVIF(*imagorAutoAVIF),
+		imagor.WithAutoJXL(*imagorAutoJXL),
+		imagor.WithAutoFormatPriority(strings.Split(*imagorAutoFormatPriority, ",")...),
+		imagor.WithAutoQualityHints(*imagorAutoQualityHints),
+		imagor.WithDPRClientHints(*imagorDPRClientHints),
 		imagor.WithModifiedTimeCheck(*imagorModifiedTimeCheck),
+		imagor.WithETagCheck(*imagorETagCheck),
 		imagor.WithDisableErrorBody(*imagorDisableErrorBody),
 		imagor.WithDisableParamsEndpoint(*imagorDisableParamsEndpoint),
+		imagor.WithSanitizeSVG(*imagorSanitizeSVG),
+		imagor.WithMaxFilters(*imagorMaxFilters),
+		imagor.WithMaxBlur(*imagorMaxBlur),
+		imagor.WithMaxWatermarks(*imagorMaxWatermarks),
+		imagor.WithMaxLoads(*imagorMaxLoads),
+		imagor.WithMaxNestedDepth(*imagorMaxNestedDepth),
+		imagor.WithMaxPathLength(*imagorMaxPathLength),
+		imagor.WithMaxImageLength(*imagorMaxImageLength),
+		imagor.WithMaxFilterArgsLength(*imagorMaxFilterArgsLength),
 		imagor.WithUnsafe(*imagorUnsafe),
+		imagor.WithUnsafeCIDRs(strings.Split(*imagorUnsafeCIDRs, ",")...),
+		imagor.WithUnsafePathPrefixes(strings.Split(*imagorUnsafePathPrefixes, ",")...),
+		imagor.WithEnforcedWatermark(*imagorEnforcedWatermark, newHeaderExempt(
+			*imagorEnforcedWatermarkExemptHeader, *imagorEnforcedWatermarkExemptValue)),
 		imagor.WithLogger(logger),
 		imagor.WithDebug(isDebug),
 	)...)
 }
 
+// newHeaderExempt exempts requests from enforced watermark by header,
+// matching value if specified, otherwise any non-empty header value
+func newHeaderExempt(header, value string) func(r *http.Request) bool {
+	if header == "" {
+		return nil
+	}
+	return func(r *http.Request) bool {
+		v := r.Header.Get(header)
+		if value == "" {
+			return v != ""
+		}
+		return subtle.ConstantTimeCompare([]byte(v), []byte(value)) == 1
+	}
+}
+
+func readFile(path string) []byte {
+	if path == "" {
+		return nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func newStaticKeys(tags string) func(r *http.Request, p imagorpath.Params) []string {
+	var keys []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			keys = append(keys, tag)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return func(_ *http.Request, _ imagorpath.Params) []string {
+		return keys
+	}
+}
+
+// NewSigner creates HMAC signer by signer type sha1, sha256 or sha512
+func NewSigner(signerType string, truncate int, provider imagorpath.SecretProvider) imagorpath.Signer {
+	var alg = sha1.New
+	if strings.ToLower(signerType) == "sha256" {
+		alg = sha256.New
+	} else if strings.ToLower(signerType) == "sha512" {
+		alg = sha512.New
+	}
+	if secret, ok := provider.(imagorpath.StaticSecret); ok {
+		return imagorpath.NewHMACSigner(alg, truncate, string(secret))
+	}
+	return imagorpath.NewHMACSignerWithProvider(alg, truncate, provider)
+}
+
+// NewResultKey digest result key of type sha1 or sha256
+func NewResultKey(resultKeyType string, shard int) imagor.ResultKey {
+	var alg = sha1.New
+	if strings.ToLower(resultKeyType) == "sha256" {
+		alg = sha256.New
+	}
+	return imagorpath.NewDigestResultKey(alg, shard)
+}
+
 func CreateServer(args []string, funcs ...Func) (srv *server.Server) {
 	var (
 		fs     = flag.NewFlagSet("imagor", flag.ExitOnError)
 		logger *zap.Logger
-		err    error
 		app    *imagor.Imagor
 
 		debug        = fs.Bool("debug", false, "Debug mode")
@@ -121,27 +354,18 @@ func CreateServer(args []string, funcs ...Func) (srv *server.Server) {
 			"Enable strip query string redirection")
 		serverAccessLog = fs.Bool("server-access-log", false,
 			"Enable server access log")
+		serverHealthCheck = fs.Bool("server-health-check", false,
+			"Enable /healthcheck to check reachability of loaders and storages, responds 503 if any is unreachable")
+		serverSecurityHeaders = fs.Bool("server-security-headers", false,
+			"Enable security headers X-Content-Type-Options, Content-Security-Policy and Cross-Origin-Resource-Policy")
+		serverContentSecurityPolicy = fs.String("server-content-security-policy", "",
+			"Content-Security-Policy header value for security headers (default \"default-src 'none'; style-src 'unsafe-inline'; sandbox\")")
+		serverCrossOriginResourcePolicy = fs.String("server-cross-origin-resource-policy", "",
+			"Cross-Origin-Resource-Policy header value for security headers (default \"cross-origin\")")
 	)
 
 	app = NewImagor(fs, func() (*zap.Logger, bool) {
-		if err = ff.Parse(fs, args,
-			ff.WithEnvVars(),
-			ff.WithConfigFileFlag("config"),
-			ff.WithIgnoreUndefined(true),
-			ff.WithAllowMissingConfigFile(true),
-			ff.WithConfigFileParser(ff.EnvParser),
-		); err != nil {
-			panic(err)
-		}
-		if *debug {
-			if logger, err = zap.NewDevelopment(); err != nil {
-				panic(err)
-			}
-		} else {
-			if logger, err = zap.NewProduction(); err != nil {
-				panic(err)
-			}
-		}
+		logger = parseFlags(fs, args, debug)
 		return logger, *debug
 	}, funcs...)
 
@@ -161,8 +385,35 @@ func CreateServer(args []string, funcs ...Func) (srv *server.Server) {
 		server.WithPathPrefix(*serverPathPrefix),
 		server.WithCORS(*serverCORS),
 		server.WithStripQueryString(*serverStripQueryString),
+		server.WithContentSecurityPolicy(*serverContentSecurityPolicy),
+		server.WithCrossOriginResourcePolicy(*serverCrossOriginResourcePolicy),
+		server.WithSecurityHeaders(*serverSecurityHeaders),
 		server.WithAccessLog(*serverAccessLog),
+		server.WithHealthCheck(*serverHealthCheck),
 		server.WithLogger(logger),
 		server.WithDebug(*debug),
 	)
 }
+
+func parseFlags(fs *flag.FlagSet, args []string, debug *bool) (logger *zap.Logger) {
+	var err error
+	if err = ff.Parse(fs, args,
+		ff.WithEnvVars(),
+		ff.WithConfigFileFlag("config"),
+		ff.WithIgnoreUndefined(true),
+		ff.WithAllowMissingConfigFile(true),
+		ff.WithConfigFileParser(ff.EnvParser),
+	); err != nil {
+		panic(err)
+	}
+	if *debug {
+		if logger, err = zap.NewDevelopment(); err != nil {
+			panic(err)
+		}
+	} else {
+		if logger, err = zap.NewProduction(); err != nil {
+			panic(err)
+		}
+	}
+	return
+}
@@ -2,10 +2,33 @@ package config
 
 import (
 	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/cshum/imagor/loader/dataloader"
+	"github.com/cshum/imagor/loader/execloader"
 	"github.com/cshum/imagor/loader/httploader"
+	"github.com/cshum/imagor/loader/ociloader"
+	"github.com/cshum/imagor/loader/retryloader"
+	"github.com/cshum/imagor/loader/routeloader"
+	"github.com/cshum/imagor/loader/smbloader"
+	"github.com/cshum/imagor/prewarm"
+	"github.com/cshum/imagor/storage/b2storage"
+	"github.com/cshum/imagor/storage/dedupstorage"
 	"github.com/cshum/imagor/storage/filestorage"
+	"github.com/cshum/imagor/storage/ftpstorage"
+	"github.com/cshum/imagor/storage/gzipstorage"
+	"github.com/cshum/imagor/storage/memcachedstorage"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"github.com/cshum/imagor/storage/redisstorage"
+	"github.com/cshum/imagor/storage/sftpstorage"
+	"github.com/cshum/imagor/storage/templatestorage"
+	"github.com/cshum/imagor/storage/webdavstorage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -53,6 +76,19 @@ func TestBasic(t *testing.T) {
 		"-imagor-base-params", "fitlers:watermark(example.jpg)",
 		"-imagor-cache-header-ttl", "169h",
 		"-imagor-cache-header-swr", "167h",
+		"-imagor-cache-header-sie", "48h",
+		"-imagor-max-filters", "10",
+		"-imagor-max-blur", "20.5",
+		"-imagor-max-watermarks", "2",
+		"-imagor-max-loads", "3",
+		"-imagor-max-path-length", "2048",
+		"-imagor-max-image-length", "1024",
+		"-imagor-max-filter-args-length", "256",
+		"-imagor-unsafe-cidrs", "127.0.0.1/32,10.0.0.0/8",
+		"-imagor-unsafe-path-prefixes", "debug/",
+		"-imagor-validate-filters",
+		"-imagor-surrogate-key-header", "Surrogate-Key",
+		"-imagor-surrogate-key-tags", "foo,bar",
 		"-http-loader-insecure-skip-verify-transport",
 	})
 	app := srv.App.(*imagor.Imagor)
@@ -68,10 +104,23 @@ func TestBasic(t *testing.T) {
 	assert.Equal(t, time.Second*7, app.LoadTimeout)
 	assert.Equal(t, time.Second*19, app.ProcessTimeout)
 	assert.Equal(t, int64(199), app.ProcessConcurrency)
+	assert.Equal(t, 10, app.MaxFilters)
+	assert.Equal(t, 20.5, app.MaxBlur)
+	assert.Equal(t, 2, app.MaxWatermarks)
+	assert.Equal(t, 3, app.MaxLoads)
+	assert.Equal(t, 2048, app.MaxPathLength)
+	assert.Equal(t, 1024, app.MaxImageLength)
+	assert.Equal(t, 256, app.MaxFilterArgsLength)
+	assert.Len(t, app.UnsafeCIDRs, 2)
+	assert.Equal(t, []string{"debug/"}, app.UnsafePathPrefixes)
+	assert.NotEmpty(t, app.FilterSchemas)
+	assert.Equal(t, "Surrogate-Key", app.SurrogateKeyHeader)
+	assert.Equal(t, []string{"foo", "bar"}, app.SurrogateKeys(nil, imagorpath.Params{}))
 	assert.Equal(t, "https://www.google.com", app.BasePathRedirect)
 	assert.Equal(t, "fitlers:watermark(example.jpg)/", app.BaseParams)
 	assert.Equal(t, time.Hour*169, app.CacheHeaderTTL)
 	assert.Equal(t, time.Hour*167, app.CacheHeaderSWR)
+	assert.Equal(t, time.Hour*48, app.CacheHeaderSIE)
 
 	httpLoader := app.Loaders[0].(*httploader.HTTPLoader)
 	assert.True(t, httpLoader.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
@@ -96,6 +145,128 @@ func TestSignerAlgorithm(t *testing.T) {
 	assert.Equal(t, "Kmml5ejnmsn7M7TszYkeM2j5G3bpI7mp", app.Signer.Sign("bar"))
 }
 
+func TestResultKey(t *testing.T) {
+	srv := CreateServer([]string{})
+	app := srv.App.(*imagor.Imagor)
+	assert.Nil(t, app.ResultKey)
+
+	srv = CreateServer([]string{
+		"-imagor-result-key-type", "sha256",
+		"-imagor-result-key-shard", "2",
+	})
+	app = srv.App.(*imagor.Imagor)
+	key := app.ResultKey.Generate(imagorpath.Parse("fit-in/100x100/filters:format(webp)/foo.jpg"))
+	assert.Regexp(t, "^[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{64}\\.webp$", key)
+	assert.Equal(t, key[0:2]+key[3:5], key[6:10])
+}
+
+func TestResultStorageKeyTemplate(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-result-storage-base-dir", "./foo",
+		"-imagor-result-storage-key-template", "results/{year}/{key}.{ext}",
+	})
+	app := srv.App.(*imagor.Imagor)
+	storage := app.ResultStorages[0].(*templatestorage.TemplateStorage)
+	assert.Equal(t, "results/{year}/{key}.{ext}", storage.Template)
+	assert.IsType(t, &filestorage.FileStorage{}, storage.Storage)
+}
+
+func TestResultStorageGzip(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-result-storage-base-dir", "./foo",
+		"-imagor-result-storage-gzip",
+		"-imagor-result-storage-gzip-level", "9",
+		"-imagor-result-storage-gzip-encoding", "zstd",
+		"-imagor-result-storage-key-template", "results/{key}",
+	})
+	app := srv.App.(*imagor.Imagor)
+	storage := app.ResultStorages[0].(*templatestorage.TemplateStorage).Storage.(*gzipstorage.GzipStorage)
+	assert.Equal(t, 9, storage.Level)
+	assert.Equal(t, "zstd", storage.Encoding)
+	assert.IsType(t, &filestorage.FileStorage{}, storage.Storage)
+}
+
+func TestResultStorageDedup(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-result-storage-base-dir", "./foo",
+		"-file-result-storage-path-prefix", "/results/",
+		"-imagor-result-storage-dedup",
+		"-imagor-result-storage-gzip",
+	})
+	app := srv.App.(*imagor.Imagor)
+	storage := app.ResultStorages[0].(*dedupstorage.DedupStorage)
+	assert.Equal(t, "dedup", storage.HashPrefix)
+	assert.Equal(t, "results", storage.PathPrefix)
+	assert.IsType(t, &gzipstorage.GzipStorage{}, storage.Storage)
+}
+
+func TestResultStorageFailover(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-result-storage-base-dir", "./foo",
+		"-ftp-addr", "ftp.example.com:21",
+		"-ftp-result-storage-base-dir", "/results",
+		"-imagor-result-storage-priority", "ftp-result-storage",
+		"-imagor-result-storage-repair",
+		"-imagor-result-storage-redirect",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.True(t, app.ResultStorageRepair)
+	assert.True(t, app.ResultStorageRedirect)
+	require.Len(t, app.ResultStorages, 2)
+	assert.IsType(t, &ftpstorage.FTPStorage{}, app.ResultStorages[0])
+	assert.IsType(t, &filestorage.FileStorage{}, app.ResultStorages[1])
+
+	assert.Panics(t, func() {
+		CreateServer([]string{
+			"-file-result-storage-base-dir", "./foo",
+			"-imagor-result-storage-priority", "s3-result-storage",
+		})
+	})
+}
+
+func TestSecretFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(file, []byte("foo\n"), 0600))
+	srv := CreateServer([]string{
+		"-imagor-secret", "abcd",
+		"-imagor-secret-file", file,
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, "RrTsWGEXFU2s1J1mTl1j_ciO-1E=", app.Signer.Sign("bar"))
+}
+
+func TestSecretRotationGrace(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(file, []byte("foo\n"), 0600))
+	srv := CreateServer([]string{
+		"-imagor-secret-file", file,
+		"-imagor-secret-refresh-interval", "0",
+		"-imagor-secret-rotation-grace", "1h",
+	})
+	app := srv.App.(*imagor.Imagor)
+	oldHash := app.Signer.Sign("bar")
+	assert.Equal(t, "RrTsWGEXFU2s1J1mTl1j_ciO-1E=", oldHash)
+
+	require.NoError(t, os.WriteFile(file, []byte("baz\n"), 0600))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+	assert.NotEqual(t, oldHash, app.Signer.Sign("bar"))
+	assert.True(t, imagorpath.Verify(app.Signer, "bar", app.Signer.Sign("bar")))
+	assert.True(t, imagorpath.Verify(app.Signer, "bar", oldHash))
+}
+
+func TestFaviconFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "favicon.ico")
+	require.NoError(t, os.WriteFile(file, []byte("icon"), 0600))
+	srv := CreateServer([]string{
+		"-imagor-favicon-file", file,
+	})
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/favicon.ico", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "image/x-icon", w.Header().Get("Content-Type"))
+	assert.Equal(t, "icon", w.Body.String())
+}
+
 func TestCacheHeaderNoCache(t *testing.T) {
 	srv := CreateServer([]string{"-imagor-cache-header-no-cache"})
 	app := srv.App.(*imagor.Imagor)
@@ -133,6 +304,9 @@ func TestFileStorage(t *testing.T) {
 
 		"-file-result-storage-base-dir", "./bar",
 		"-file-result-storage-path-prefix", "bcda",
+
+		"-file-meta-storage-base-dir", "./meta",
+		"-file-meta-storage-path-prefix", "cdef",
 	})
 	app := srv.App.(*imagor.Imagor)
 	assert.Equal(t, 1, len(app.Loaders))
@@ -145,4 +319,388 @@ func TestFileStorage(t *testing.T) {
 	assert.Equal(t, "./bar", resultStorage.BaseDir)
 	assert.Equal(t, "/bcda/", resultStorage.PathPrefix)
 	assert.Equal(t, "!", resultStorage.SafeChars)
+
+	metaStorage := app.MetaStorages[0].(*filestorage.FileStorage)
+	assert.Equal(t, "./meta", metaStorage.BaseDir)
+	assert.Equal(t, "/cdef/", metaStorage.PathPrefix)
+	assert.Equal(t, "!", metaStorage.SafeChars)
+}
+
+func TestFTPStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-ftp-addr", "ftp.example.com:21",
+		"-ftp-username", "user",
+		"-ftp-password", "pass",
+		"-ftp-max-idle-conns", "2",
+
+		"-ftp-storage-base-dir", "/foo",
+		"-ftp-storage-path-prefix", "abcd",
+		"-ftp-loader-base-dir", "/bar",
+
+		"-ftp-result-storage-base-dir", "/result",
+	})
+	app := srv.App.(*imagor.Imagor)
+	storage := app.Storages[0].(*ftpstorage.FTPStorage)
+	assert.Equal(t, "ftp.example.com:21", storage.Addr)
+	assert.Equal(t, "user", storage.Username)
+	assert.Equal(t, "pass", storage.Password)
+	assert.Equal(t, 2, storage.MaxIdleConns)
+	assert.Equal(t, "/foo", storage.BaseDir)
+	assert.Equal(t, "/abcd/", storage.PathPrefix)
+
+	loader := app.Loaders[0].(*ftpstorage.FTPStorage)
+	assert.Equal(t, "/bar", loader.BaseDir)
+	assert.Equal(t, "/", loader.PathPrefix)
+
+	resultStorage := app.ResultStorages[0].(*ftpstorage.FTPStorage)
+	assert.Equal(t, "/result", resultStorage.BaseDir)
+}
+
+func TestSFTPStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-sftp-addr", "sftp.example.com:22",
+		"-sftp-username", "user",
+		"-sftp-password", "pass",
+		"-sftp-host-key", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDDiAQyDN5yAe4DNktNiaXBJZC5sSE5/l6W9bN95ieuY",
+		"-sftp-max-idle-conns", "2",
+
+		"-sftp-storage-base-dir", "/foo",
+		"-sftp-storage-path-prefix", "abcd",
+		"-sftp-loader-base-dir", "/bar",
+
+		"-sftp-result-storage-base-dir", "/result",
+		"-sftp-result-storage-expiration", "24h",
+	})
+	app := srv.App.(*imagor.Imagor)
+	storage := app.Storages[0].(*sftpstorage.SFTPStorage)
+	assert.Equal(t, "sftp.example.com:22", storage.Addr)
+	assert.Equal(t, "user", storage.Username)
+	assert.Equal(t, "pass", storage.Password)
+	assert.Equal(t, 2, storage.MaxIdleConns)
+	assert.NotNil(t, storage.HostKeyCallback)
+	assert.Equal(t, "/foo", storage.BaseDir)
+	assert.Equal(t, "/abcd/", storage.PathPrefix)
+
+	loader := app.Loaders[0].(*sftpstorage.SFTPStorage)
+	assert.Equal(t, "/bar", loader.BaseDir)
+	assert.Equal(t, "/", loader.PathPrefix)
+
+	resultStorage := app.ResultStorages[0].(*sftpstorage.SFTPStorage)
+	assert.Equal(t, "/result", resultStorage.BaseDir)
+	assert.Equal(t, time.Hour*24, resultStorage.Expiration)
+
+	assert.Panics(t, func() {
+		CreateServer([]string{
+			"-sftp-addr", "sftp.example.com:22",
+			"-sftp-host-key", "invalid",
+			"-sftp-storage-base-dir", "/foo",
+		})
+	})
+}
+
+func TestWebDAVStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-webdav-username", "user",
+		"-webdav-password", "pass",
+
+		"-webdav-storage-base-url", "https://example.com/dav/foo",
+		"-webdav-storage-path-prefix", "abcd",
+		"-webdav-loader-base-url", "https://example.com/dav/foo",
+		"-webdav-loader-path-prefix", "abcd",
+
+		"-webdav-result-storage-base-url", "https://example.com/dav/bar",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 1, len(app.Loaders))
+	storage := app.Storages[0].(*webdavstorage.WebDAVStorage)
+	assert.Equal(t, "https://example.com/dav/foo", storage.BaseURL.String())
+	assert.Equal(t, "/abcd/", storage.PathPrefix)
+	assert.Equal(t, "user", storage.Username)
+	assert.Equal(t, "pass", storage.Password)
+
+	resultStorage := app.ResultStorages[0].(*webdavstorage.WebDAVStorage)
+	assert.Equal(t, "https://example.com/dav/bar", resultStorage.BaseURL.String())
+}
+
+func TestB2Storage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-b2-key-id", "key-id",
+		"-b2-application-key", "app-key",
+		"-b2-hard-delete",
+
+		"-b2-storage-bucket", "foo",
+		"-b2-storage-base-dir", "images",
+		"-b2-loader-bucket", "foo",
+		"-b2-loader-base-dir", "images",
+
+		"-b2-result-storage-bucket", "bar",
+		"-b2-result-storage-base-dir", "results",
+		"-b2-result-storage-expiration", "168h",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 1, len(app.Loaders))
+	storage := app.Storages[0].(*b2storage.B2Storage)
+	assert.Equal(t, "foo", storage.Bucket)
+	assert.Equal(t, "/images", storage.BaseDir)
+	assert.True(t, storage.HardDelete)
+
+	resultStorage := app.ResultStorages[0].(*b2storage.B2Storage)
+	assert.Equal(t, "bar", resultStorage.Bucket)
+	assert.Equal(t, "/results", resultStorage.BaseDir)
+	assert.Equal(t, time.Hour*168, resultStorage.Expiration)
+}
+
+func TestRedisResultStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-redis-result-storage-addr", "localhost:6379",
+		"-redis-result-storage-password", "pass",
+		"-redis-result-storage-db", "2",
+		"-redis-result-storage-ttl", "1h",
+	})
+	app := srv.App.(*imagor.Imagor)
+	resultStorage := app.ResultStorages[0].(*redisstorage.RedisStorage)
+	assert.Equal(t, "localhost:6379", resultStorage.Addr)
+	assert.Equal(t, "pass", resultStorage.Password)
+	assert.Equal(t, 2, resultStorage.DB)
+	assert.Equal(t, "imagor:", resultStorage.Prefix)
+	assert.Equal(t, time.Hour, resultStorage.TTL)
+	assert.Equal(t, int64(1<<20), resultStorage.MaxSize)
+}
+
+func TestKafkaPrewarm(t *testing.T) {
+	srv := CreateServer([]string{
+		"-kafka-prewarm-brokers", "localhost:9092,localhost:9093",
+		"-kafka-prewarm-topic", "uploads",
+		"-kafka-prewarm-presets", "fit-in/200x200,filters:format(webp)",
+		"-kafka-prewarm-trim-prefix", "images",
+	})
+	app := srv.App.(*imagor.Imagor)
+	require.Len(t, app.Workers, 1)
+	w := app.Workers[0].(*prewarm.Warmer)
+	assert.Equal(t, []string{"fit-in/200x200", "filters:format(webp)"}, w.Presets)
+	assert.Equal(t, "images/", w.TrimPrefix)
+	queue := w.Queue.(*prewarm.KafkaQueue)
+	cfg := queue.Reader.Config()
+	assert.Equal(t, []string{"localhost:9092", "localhost:9093"}, cfg.Brokers)
+	assert.Equal(t, "uploads", cfg.Topic)
+	assert.Equal(t, "imagor-prewarm", cfg.GroupID)
+	assert.NoError(t, queue.Close())
+
+	srv = CreateServer([]string{
+		"-kafka-prewarm-brokers", "localhost:9092",
+		"-kafka-prewarm-topic", "uploads",
+	})
+	assert.Empty(t, srv.App.(*imagor.Imagor).Workers)
+}
+
+func TestMemcachedResultStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-result-storage-base-dir", "./bar",
+		"-memcached-result-storage-addr", "localhost:11211",
+		"-memcached-result-storage-ttl", "1h",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.ResultStorages))
+	resultStorage := app.ResultStorages[0].(*memcachedstorage.MemcachedStorage)
+	assert.Equal(t, "localhost:11211", resultStorage.Addr)
+	assert.Equal(t, "imagor:", resultStorage.Prefix)
+	assert.Equal(t, time.Hour, resultStorage.TTL)
+	assert.Equal(t, 32, resultStorage.MaxChunks)
+	assert.IsType(t, &filestorage.FileStorage{}, app.ResultStorages[1])
+}
+
+func TestMemoryResultStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-memcached-result-storage-addr", "localhost:11211",
+		"-memory-result-storage-max-size", "1000000",
+		"-memory-result-storage-max-item-size", "1000",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.ResultStorages))
+	resultStorage := app.ResultStorages[0].(*memorystorage.MemoryStorage)
+	assert.Equal(t, int64(1000000), resultStorage.MaxSize)
+	assert.Equal(t, int64(1000), resultStorage.MaxItemSize)
+	assert.IsType(t, &memcachedstorage.MemcachedStorage{}, app.ResultStorages[1])
+}
+
+func TestOCILoader(t *testing.T) {
+	srv := CreateServer([]string{
+		"-oci-loader-allowed-registries", "ghcr.io, *.pkg.dev",
+		"-oci-loader-username", "user",
+		"-oci-loader-password", "pass",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.Loaders))
+	loader := app.Loaders[0].(*ociloader.OCILoader)
+	assert.Equal(t, []string{"ghcr.io", "*.pkg.dev"}, loader.AllowedRegistries)
+	assert.Equal(t, "user", loader.Username)
+	assert.Equal(t, "pass", loader.Password)
+	assert.IsType(t, &httploader.HTTPLoader{}, app.Loaders[1])
+}
+
+func TestSMBLoader(t *testing.T) {
+	srv := CreateServer([]string{
+		"-smb-addr", "fileserver",
+		"-smb-share", "images",
+		"-smb-username", "user",
+		"-smb-password", "pass",
+		"-smb-domain", "CORP",
+		"-smb-loader-base-dir", "archive",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.Loaders))
+	loader := app.Loaders[0].(*smbloader.SMBLoader)
+	assert.Equal(t, "fileserver:445", loader.Addr)
+	assert.Equal(t, "images", loader.Share)
+	assert.Equal(t, "user", loader.Username)
+	assert.Equal(t, "pass", loader.Password)
+	assert.Equal(t, "CORP", loader.Domain)
+	assert.Equal(t, "/archive", loader.BaseDir)
+	assert.IsType(t, &httploader.HTTPLoader{}, app.Loaders[1])
+}
+
+func TestDataLoader(t *testing.T) {
+	srv := CreateServer([]string{
+		"-data-loader-enable",
+		"-data-loader-max-allowed-size", "1000",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.Loaders))
+	loader := app.Loaders[0].(*dataloader.DataLoader)
+	assert.Equal(t, 1000, loader.MaxAllowedSize)
+	assert.IsType(t, &httploader.HTTPLoader{}, app.Loaders[1])
+}
+
+func TestExecLoader(t *testing.T) {
+	srv := CreateServer([]string{
+		"-exec-loader-command", "dam-cli export {key}",
+		"-exec-loader-path-prefix", "dam:",
+		"-exec-loader-env", "DAM_TOKEN=abc,DAM_REGION=eu",
+		"-exec-loader-timeout", "5s",
+		"-exec-loader-max-allowed-size", "1000",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.Loaders))
+	loader := app.Loaders[0].(*execloader.ExecLoader)
+	assert.Equal(t, []string{"dam-cli", "export", "{key}"}, loader.Args)
+	assert.Equal(t, "dam:", loader.PathPrefix)
+	assert.Equal(t, []string{"DAM_TOKEN=abc", "DAM_REGION=eu"}, loader.Env)
+	assert.Equal(t, time.Second*5, loader.Timeout)
+	assert.Equal(t, 1000, loader.MaxAllowedSize)
+	assert.IsType(t, &httploader.HTTPLoader{}, app.Loaders[1])
+}
+
+func TestLoaderRoutes(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-loader-base-dir", "./foo",
+		"-imagor-loader-routes", "uploads/*=file-loader, *=http-loader",
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 1, len(app.Loaders))
+	loader := app.Loaders[0].(*routeloader.RouteLoader)
+	assert.Equal(t, 2, len(loader.Routes))
+	l, ok := loader.Match("uploads/a.jpg")
+	assert.True(t, ok)
+	assert.IsType(t, &filestorage.FileStorage{}, l)
+	l, ok = loader.Match("https://example.com/a.jpg")
+	assert.True(t, ok)
+	assert.IsType(t, &httploader.HTTPLoader{}, l)
+
+	assert.Panics(t, func() {
+		CreateServer([]string{"-imagor-loader-routes", "*=s3-loader"})
+	})
+	assert.Panics(t, func() {
+		CreateServer([]string{"-imagor-loader-routes", "http-loader"})
+	})
+}
+
+func TestLoadRetry(t *testing.T) {
+	srv := CreateServer([]string{
+		"-file-storage-base-dir", "./foo",
+		"-imagor-load-retry-max-attempts", "4",
+		"-imagor-load-retry-backoff", "50ms",
+	})
+	app := srv.App.(*imagor.Imagor)
+	loader := app.Loaders[0].(*retryloader.RetryLoader)
+	assert.Equal(t, 4, loader.MaxAttempts)
+	assert.Equal(t, time.Millisecond*50, loader.Backoff)
+	assert.Equal(t, time.Second*2, loader.MaxBackoff)
+	assert.IsType(t, &httploader.HTTPLoader{}, loader.Loader)
+	storage := app.Storages[0].(*retryloader.RetryStorage)
+	assert.IsType(t, &filestorage.FileStorage{}, storage.Storage)
+	assert.Equal(t, 4, storage.Retry.MaxAttempts)
+}
+
+func TestMigrate(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+	dstDir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "a.jpg"), []byte("foo"), 0666))
+
+	res, err := Migrate([]string{
+		"-file-result-storage-base-dir", srcDir,
+		"-file-storage-base-dir", dstDir,
+		"-from", "file-result-storage",
+		"-to", "file-storage",
+		"-checkpoint", filepath.Join(dstDir, ".checkpoint"),
+		"-imagor-load-retry-max-attempts", "2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Copied)
+	_, err = os.Stat(filepath.Join(dstDir, ".checkpoint"))
+	assert.True(t, os.IsNotExist(err))
+	buf, err := ioutil.ReadFile(filepath.Join(dstDir, "a.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	_, err = Migrate([]string{
+		"-file-storage-base-dir", dstDir,
+		"-from", "s3-result-storage",
+		"-to", "file-storage",
+	})
+	assert.Error(t, err)
+}
+
+func TestWarm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+	resultDir := filepath.Join(dir, "result")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.jpg"), []byte("foo"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.jpg"), []byte("bar"), 0666))
+	urls := filepath.Join(dir, "urls.txt")
+	require.NoError(t, ioutil.WriteFile(urls, []byte("a.jpg\n# comment\nb.jpg\n"), 0666))
+	presets := filepath.Join(dir, "presets.txt")
+	require.NoError(t, ioutil.WriteFile(presets, []byte("thumb fit-in/200x200\nhero 1200x600/smart\n"), 0666))
+
+	res, err := Warm([]string{
+		"-file-loader-base-dir", dir,
+		"-file-result-storage-base-dir", resultDir,
+		"-urls", urls,
+		"-preset-file", presets,
+		"-presets", "thumb,hero,raw=filters:quality(80)",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &WarmResult{Warmed: 6}, res)
+	buf, err := ioutil.ReadFile(filepath.Join(resultDir, "fit-in/200x200/a.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+	_, err = os.Stat(filepath.Join(resultDir, "1200x600/smart/b.jpg"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(resultDir, "filters%3Aquality%2880%29/b.jpg"))
+	assert.NoError(t, err)
+
+	_, err = Warm([]string{
+		"-file-loader-base-dir", dir,
+		"-file-result-storage-base-dir", resultDir,
+		"-urls", urls,
+		"-presets", "thumb",
+	})
+	assert.Error(t, err)
+
+	_, err = Warm([]string{
+		"-urls", urls,
+		"-presets", "raw=fit-in/100x100",
+	})
+	assert.Error(t, err)
 }
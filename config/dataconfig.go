@@ -0,0 +1,28 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/dataloader"
+	"go.uber.org/zap"
+)
+
+func withDataLoader(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		dataLoaderEnable = fs.Bool("data-loader-enable", false,
+			"Enable Data Loader that decodes data:image/... URI embedded in image path")
+		dataLoaderMaxAllowedSize = fs.Int("data-loader-max-allowed-size", 0,
+			"Data Loader maximum allowed size in bytes for decoded images if set")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *dataLoaderEnable {
+			o.Loaders = append(o.Loaders,
+				dataloader.New(
+					dataloader.WithMaxAllowedSize(*dataLoaderMaxAllowedSize),
+				),
+			)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/dedupstorage"
+	"go.uber.org/zap"
+	"reflect"
+)
+
+func withResultStorageDedup(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		resultStorageDedup = fs.Bool("imagor-result-storage-dedup", false,
+			"Imagor result storage deduplication, storing identical results of different params once by content hash")
+		resultStorageDedupPrefix = fs.String("imagor-result-storage-dedup-prefix", "dedup",
+			"Imagor result storage key prefix of deduplicated content objects")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if !*resultStorageDedup {
+			return
+		}
+		for i, storage := range o.ResultStorages {
+			o.ResultStorages[i] = dedupstorage.New(storage,
+				dedupstorage.WithHashPrefix(*resultStorageDedupPrefix),
+				dedupstorage.WithPathPrefix(storagePathPrefix(storage)))
+		}
+	}
+}
+
+// storagePathPrefix path prefix of underlying storage e.g. file or S3 storage,
+// such that keys outside of it are rejected
+func storagePathPrefix(s imagor.Storage) string {
+	v := reflect.Indirect(reflect.ValueOf(unwrapStorage(s)))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := v.FieldByName("PathPrefix"); f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/execloader"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+func withExecLoader(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		execLoaderCommand = fs.String("exec-loader-command", "",
+			"Exec Loader command template that writes image to stdout, with {key} substituted by image key e.g. dam-cli export {key}. Enable Exec Loader only if this value present")
+		execLoaderPathPrefix = fs.String("exec-loader-path-prefix", "",
+			"Exec Loader handles only image keys with path prefix, trimmed before substitution")
+		execLoaderEnv = fs.String("exec-loader-env", "",
+			"Exec Loader additional environment variables in comma separated KEY=value format")
+		execLoaderTimeout = fs.Duration("exec-loader-timeout", time.Second*30,
+			"Exec Loader maximum duration of command execution")
+		execLoaderMaxAllowedSize = fs.Int("exec-loader-max-allowed-size", 0,
+			"Exec Loader maximum allowed size in bytes for loading images if set")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *execLoaderCommand != "" {
+			// activate Exec Loader only if command config presents
+			o.Loaders = append(o.Loaders,
+				execloader.New(*execLoaderCommand,
+					execloader.WithPathPrefix(*execLoaderPathPrefix),
+					execloader.WithEnv(strings.Split(*execLoaderEnv, ",")...),
+					execloader.WithTimeout(*execLoaderTimeout),
+					execloader.WithMaxAllowedSize(*execLoaderMaxAllowedSize),
+				),
+			)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cshum/imagor"
+	"go.uber.org/zap"
+	"strings"
+)
+
+func withResultStorageFailover(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		resultStoragePriority = fs.String("imagor-result-storage-priority", "",
+			"Imagor result storages in order of priority in comma separated format e.g. redis-result-storage,s3-result-storage. Results are read from the first available, unlisted result storages follow in configured order")
+		resultStorageRepair = fs.Bool("imagor-result-storage-repair", false,
+			"Imagor result storage repair, copying results served by fallback result storage back into higher priority result storages")
+		resultStorageRedirect = fs.Bool("imagor-result-storage-redirect", false,
+			"Imagor result storage redirect, redirecting clients to URL of the result storage serving the result e.g. S3 presigned URL or R2 public URL")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		o.ResultStorageRepair = *resultStorageRepair
+		o.ResultStorageRedirect = *resultStorageRedirect
+		if *resultStoragePriority == "" {
+			return
+		}
+		var ordered []imagor.Storage
+		used := map[int]bool{}
+		for _, name := range strings.Split(*resultStoragePriority, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			i := indexOfResultStorage(o.ResultStorages, name)
+			if i < 0 {
+				panic(fmt.Errorf("imagor: result storage priority not found: %s", name))
+			}
+			if !used[i] {
+				used[i] = true
+				ordered = append(ordered, o.ResultStorages[i])
+			}
+		}
+		for i, storage := range o.ResultStorages {
+			if !used[i] {
+				ordered = append(ordered, storage)
+			}
+		}
+		o.ResultStorages = ordered
+	}
+}
+
+// indexOfResultStorage index of result storage referenced by <type>-result-storage e.g. s3-result-storage
+func indexOfResultStorage(storages []imagor.Storage, name string) int {
+	for i, s := range storages {
+		if storageType(unwrapStorage(s))+"-result-storage" == name {
+			return i
+		}
+	}
+	return -1
+}
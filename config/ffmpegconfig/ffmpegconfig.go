@@ -0,0 +1,32 @@
+package ffmpegconfig
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/processor/ffmpegprocessor"
+	"go.uber.org/zap"
+)
+
+// WithFFmpeg ffmpeg processor for MP4/WebM output of animated images.
+// Must be registered before vips processor
+func WithFFmpeg(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		ffmpegBinary = fs.String("ffmpeg-binary", "",
+			"FFmpeg binary path for converting animated GIF and WebP into MP4 or WebM by format(mp4) or format(webm). Disabled if not set")
+		ffmpegMaxDuration = fs.Duration("ffmpeg-max-duration", 0,
+			"FFmpeg maximum duration of output video. Default no limit")
+
+		logger, isDebug = cb()
+	)
+	if *ffmpegBinary == "" {
+		return imagor.WithProcessors()
+	}
+	return imagor.WithProcessors(
+		ffmpegprocessor.New(
+			ffmpegprocessor.WithBinary(*ffmpegBinary),
+			ffmpegprocessor.WithMaxDuration(*ffmpegMaxDuration),
+			ffmpegprocessor.WithLogger(logger),
+			ffmpegprocessor.WithDebug(isDebug),
+		),
+	)
+}
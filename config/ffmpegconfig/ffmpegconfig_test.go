@@ -0,0 +1,25 @@
+package ffmpegconfig
+
+import (
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/processor/ffmpegprocessor"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWithFFmpeg(t *testing.T) {
+	srv := config.CreateServer([]string{}, WithFFmpeg)
+	app := srv.App.(*imagor.Imagor)
+	assert.Empty(t, app.Processors)
+
+	srv = config.CreateServer([]string{
+		"-ffmpeg-binary", "/usr/local/bin/ffmpeg",
+		"-ffmpeg-max-duration", "10s",
+	}, WithFFmpeg)
+	app = srv.App.(*imagor.Imagor)
+	processor := app.Processors[0].(*ffmpegprocessor.FFmpegProcessor)
+	assert.Equal(t, "/usr/local/bin/ffmpeg", processor.Binary)
+	assert.Equal(t, time.Second*10, processor.MaxDuration)
+}
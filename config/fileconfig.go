@@ -38,6 +38,17 @@ func withFileSystem(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Opti
 		fileResultStorageExpiration = fs.Duration("file-result-storage-expiration", 0,
 			"File Result Storage expiration duration e.g. 24h. Default no expiration")
 
+		fileMetaStorageBaseDir = fs.String("file-meta-storage-base-dir", "",
+			"Base directory for File Meta Storage. Enable File Meta Storage only if this value present")
+		fileMetaStoragePathPrefix = fs.String("file-meta-storage-path-prefix", "",
+			"Base path prefix for File Meta Storage")
+		fileMetaStorageMkdirPermission = fs.String("file-meta-storage-mkdir-permission", "0755",
+			"File Meta Storage mkdir permission")
+		fileMetaStorageWritePermission = fs.String("file-meta-storage-write-permission", "0666",
+			"File Meta Storage write permission")
+		fileMetaStorageExpiration = fs.Duration("file-meta-storage-expiration", 0,
+			"File Meta Storage expiration duration e.g. 24h. Default no expiration")
+
 		_, _ = cb()
 	)
 	return func(o *imagor.Imagor) {
@@ -81,6 +92,18 @@ func withFileSystem(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Opti
 				),
 			)
 		}
-
+		if *fileMetaStorageBaseDir != "" {
+			// activate File Meta Storage only if base dir config presents
+			o.MetaStorages = append(o.MetaStorages,
+				filestorage.New(
+					*fileMetaStorageBaseDir,
+					filestorage.WithPathPrefix(*fileMetaStoragePathPrefix),
+					filestorage.WithMkdirPermission(*fileMetaStorageMkdirPermission),
+					filestorage.WithWritePermission(*fileMetaStorageWritePermission),
+					filestorage.WithSafeChars(*fileSafeChars),
+					filestorage.WithExpiration(*fileMetaStorageExpiration),
+				),
+			)
+		}
 	}
 }
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"crypto/tls"
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/ftpstorage"
+	"go.uber.org/zap"
+	"net"
+	"time"
+)
+
+func withFTP(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		ftpAddr = fs.String("ftp-addr", "",
+			"FTP server address e.g. ftp.example.com:21. Enable FTP Loader and Storages only if this value present")
+		ftpUsername = fs.String("ftp-username", "",
+			"FTP username. Login as anonymous if not set")
+		ftpPassword = fs.String("ftp-password", "",
+			"FTP password")
+		ftpTimeout = fs.Duration("ftp-timeout", time.Second*30,
+			"FTP connection timeout")
+		ftpMaxIdleConns = fs.Int("ftp-max-idle-conns", 4,
+			"FTP maximum idle connections kept in pool per loader or storage")
+		ftpSafeChars = fs.String("ftp-safe-chars", "",
+			"FTP safe characters to be excluded from image key escape")
+		ftpTLS = fs.Bool("ftp-tls", false,
+			"FTP over TLS via explicit AUTH TLS")
+		ftpTLSImplicit = fs.Bool("ftp-tls-implicit", false,
+			"FTP over implicit TLS, typically on port 990")
+		ftpTLSInsecureSkipVerify = fs.Bool("ftp-tls-insecure-skip-verify", false,
+			"FTP over TLS skips server certificate verification")
+
+		ftpLoaderBaseDir = fs.String("ftp-loader-base-dir", "",
+			"Base directory for FTP Loader. Enable FTP Loader only if this value present")
+		ftpLoaderPathPrefix = fs.String("ftp-loader-path-prefix", "",
+			"Base path prefix for FTP Loader")
+
+		ftpStorageBaseDir = fs.String("ftp-storage-base-dir", "",
+			"Base directory for FTP Storage. Enable FTP Storage only if this value present")
+		ftpStoragePathPrefix = fs.String("ftp-storage-path-prefix", "",
+			"Base path prefix for FTP Storage")
+		ftpStorageExpiration = fs.Duration("ftp-storage-expiration", 0,
+			"FTP Storage expiration duration e.g. 24h. Default no expiration")
+
+		ftpResultStorageBaseDir = fs.String("ftp-result-storage-base-dir", "",
+			"Base directory for FTP Result Storage. Enable FTP Result Storage only if this value present")
+		ftpResultStoragePathPrefix = fs.String("ftp-result-storage-path-prefix", "",
+			"Base path prefix for FTP Result Storage")
+		ftpResultStorageExpiration = fs.Duration("ftp-result-storage-expiration", 0,
+			"FTP Result Storage expiration duration e.g. 24h. Default no expiration")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *ftpAddr == "" {
+			return
+		}
+		var tlsConfig *tls.Config
+		if *ftpTLS || *ftpTLSImplicit {
+			host, _, _ := net.SplitHostPort(*ftpAddr)
+			tlsConfig = &tls.Config{
+				ServerName:         host,
+				InsecureSkipVerify: *ftpTLSInsecureSkipVerify,
+			}
+		}
+		newFTPStorage := func(baseDir, prefix string, exp time.Duration) *ftpstorage.FTPStorage {
+			return ftpstorage.New(*ftpAddr,
+				ftpstorage.WithCredentials(*ftpUsername, *ftpPassword),
+				ftpstorage.WithBaseDir(baseDir),
+				ftpstorage.WithPathPrefix(prefix),
+				ftpstorage.WithSafeChars(*ftpSafeChars),
+				ftpstorage.WithTimeout(*ftpTimeout),
+				ftpstorage.WithMaxIdleConns(*ftpMaxIdleConns),
+				ftpstorage.WithExpiration(exp),
+				ftpstorage.WithTLS(tlsConfig, *ftpTLSImplicit),
+			)
+		}
+		if *ftpStorageBaseDir != "" {
+			// activate FTP Storage only if base dir config presents
+			o.Storages = append(o.Storages,
+				newFTPStorage(*ftpStorageBaseDir, *ftpStoragePathPrefix, *ftpStorageExpiration))
+		}
+		if *ftpLoaderBaseDir != "" {
+			// activate FTP Loader only if base dir config presents
+			if *ftpStorageBaseDir != *ftpLoaderBaseDir ||
+				*ftpStoragePathPrefix != *ftpLoaderPathPrefix {
+				// create another loader if different from storage
+				o.Loaders = append(o.Loaders,
+					newFTPStorage(*ftpLoaderBaseDir, *ftpLoaderPathPrefix, 0))
+			}
+		}
+		if *ftpResultStorageBaseDir != "" {
+			// activate FTP Result Storage only if base dir config presents
+			o.ResultStorages = append(o.ResultStorages,
+				newFTPStorage(*ftpResultStorageBaseDir, *ftpResultStoragePathPrefix, *ftpResultStorageExpiration))
+		}
+	}
+}
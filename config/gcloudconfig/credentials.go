@@ -0,0 +1,111 @@
+package gcloudconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var secretManagerBaseURL = "https://secretmanager.googleapis.com/v1/"
+
+// secretTokenSource token source of service account key JSON in Google Secret Manager,
+// re-accessed every refresh interval or on token errors such that rotated keys are picked up
+type secretTokenSource struct {
+	access         func(ctx context.Context) ([]byte, error)
+	newTokenSource func(ctx context.Context, json []byte) (oauth2.TokenSource, error)
+	refresh        time.Duration
+
+	mu     sync.Mutex
+	ts     oauth2.TokenSource
+	expiry time.Time
+}
+
+func newSecretTokenSource(client *http.Client, name string, refresh time.Duration, scopes ...string) *secretTokenSource {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	return &secretTokenSource{
+		access: func(ctx context.Context) ([]byte, error) {
+			return accessSecretVersion(ctx, client, name)
+		},
+		newTokenSource: func(ctx context.Context, json []byte) (oauth2.TokenSource, error) {
+			creds, err := google.CredentialsFromJSON(ctx, json, scopes...)
+			if err != nil {
+				return nil, err
+			}
+			return oauth2.ReuseTokenSource(nil, creds.TokenSource), nil
+		},
+		refresh: refresh,
+	}
+}
+
+func (s *secretTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ts == nil || !time.Now().Before(s.expiry) {
+		if err := s.reload(); err != nil && s.ts == nil {
+			return nil, err
+		}
+	}
+	token, err := s.ts.Token()
+	if err != nil {
+		// key may have been rotated and revoked before refresh
+		if err2 := s.reload(); err2 != nil {
+			return nil, err
+		}
+		return s.ts.Token()
+	}
+	return token, nil
+}
+
+func (s *secretTokenSource) reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	buf, err := s.access(ctx)
+	if err != nil {
+		return err
+	}
+	ts, err := s.newTokenSource(ctx, buf)
+	if err != nil {
+		return err
+	}
+	s.ts = ts
+	s.expiry = time.Now().Add(s.refresh)
+	return nil
+}
+
+// accessSecretVersion accesses secret version payload by Secret Manager REST API
+func accessSecretVersion(ctx context.Context, client *http.Client, name string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretManagerBaseURL+name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("secretmanager: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var res struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(res.Payload.Data)
+}
@@ -7,12 +7,19 @@ import (
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/storage/gcloudstorage"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"time"
 )
 
 func WithGCloud(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 	var (
 		gcloudSafeChars = fs.String("gcloud-safe-chars", "",
 			"Google Cloud safe characters to be excluded from image key escape")
+		gcloudCredentialsSecret = fs.String("gcloud-credentials-secret", "",
+			"Google Secret Manager secret of service account key JSON for Google Cloud Storage e.g. projects/my-project/secrets/imagor-sa, accessed by default credentials. Rotated keys are picked up on refresh or on token errors")
+		gcloudCredentialsRefreshInterval = fs.Duration("gcloud-credentials-refresh-interval", time.Minute*5,
+			"Google Secret Manager credentials refresh interval")
 
 		gcloudLoaderBucket = fs.String("gcloud-loader-bucket", "",
 			"Bucket name for Google Cloud Storage Loader. Enable Google Cloud Loader only if this value present")
@@ -43,13 +50,34 @@ func WithGCloud(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 		gcloudResultStorageExpiration = fs.Duration("gcloud-result-storage-expiration", 0,
 			"Google Cloud Result Storage expiration duration e.g. 24h. Default no expiration")
 
+		gcloudMetaStorageBucket = fs.String("gcloud-meta-storage-bucket", "",
+			"Bucket name for Google Cloud Meta Storage. Enable Google Cloud Meta Storage only if this value present")
+		gcloudMetaStorageBaseDir = fs.String("gcloud-meta-storage-base-dir", "",
+			"Base directory for Google Cloud Meta Storage")
+		gcloudMetaStoragePathPrefix = fs.String("gcloud-meta-storage-path-prefix", "",
+			"Base path prefix for Google Cloud Meta Storage")
+		gcloudMetaStorageACL = fs.String("gcloud-meta-storage-acl", "",
+			"Upload ACL for Google Cloud Meta Storage")
+		gcloudMetaStorageExpiration = fs.Duration("gcloud-meta-storage-expiration", 0,
+			"Google Cloud Meta Storage expiration duration e.g. 24h. Default no expiration")
+
 		_, _ = cb()
 	)
 	return func(app *imagor.Imagor) {
-		if *gcloudStorageBucket != "" || *gcloudLoaderBucket != "" || *gcloudResultStorageBucket != "" {
+		if *gcloudStorageBucket != "" || *gcloudLoaderBucket != "" ||
+			*gcloudResultStorageBucket != "" || *gcloudMetaStorageBucket != "" {
 			// Activate the session, will panic if credentials are missing
 			// Google cloud uses credentials from GOOGLE_APPLICATION_CREDENTIALS env file
-			gcloudClient, err := storage.NewClient(context.Background())
+			var opts []option.ClientOption
+			if *gcloudCredentialsSecret != "" {
+				client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/cloud-platform")
+				if err != nil {
+					panic(err)
+				}
+				opts = append(opts, option.WithTokenSource(newSecretTokenSource(
+					client, *gcloudCredentialsSecret, *gcloudCredentialsRefreshInterval, storage.ScopeFullControl)))
+			}
+			gcloudClient, err := storage.NewClient(context.Background(), opts...)
 			if err != nil {
 				panic(err)
 			}
@@ -93,6 +121,18 @@ func WithGCloud(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 					),
 				)
 			}
+			if *gcloudMetaStorageBucket != "" {
+				// activate Google Cloud Meta Storage only if bucket config presents
+				app.MetaStorages = append(app.MetaStorages,
+					gcloudstorage.New(gcloudClient, *gcloudMetaStorageBucket,
+						gcloudstorage.WithPathPrefix(*gcloudMetaStoragePathPrefix),
+						gcloudstorage.WithBaseDir(*gcloudMetaStorageBaseDir),
+						gcloudstorage.WithACL(*gcloudMetaStorageACL),
+						gcloudstorage.WithSafeChars(*gcloudSafeChars),
+						gcloudstorage.WithExpiration(*gcloudMetaStorageExpiration),
+					),
+				)
+			}
 		}
 	}
 }
@@ -1,13 +1,22 @@
 package gcloudconfig
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/config"
 	"github.com/cshum/imagor/storage/gcloudstorage"
 	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func fakeGCSServer() *fakestorage.Server {
@@ -74,3 +83,59 @@ func TestGCSStorage(t *testing.T) {
 	assert.Equal(t, "/bcda/", resultStorage.PathPrefix)
 	assert.Equal(t, "!", resultStorage.SafeChars)
 }
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+func TestSecretTokenSource(t *testing.T) {
+	key := "key-1"
+	var accessed int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessed++
+		if r.URL.Path != "/projects/p/secrets/sa/versions/latest:access" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"payload":{"data":"%s"}}`, base64.StdEncoding.EncodeToString([]byte(key)))
+	}))
+	defer ts.Close()
+	secretManagerBaseURL = ts.URL + "/"
+
+	revoked := map[string]bool{}
+	s := newSecretTokenSource(ts.Client(), "projects/p/secrets/sa", time.Hour)
+	s.newTokenSource = func(ctx context.Context, json []byte) (oauth2.TokenSource, error) {
+		key := string(json)
+		return tokenSourceFunc(func() (*oauth2.Token, error) {
+			if revoked[key] {
+				return nil, errors.New("invalid_grant")
+			}
+			return &oauth2.Token{AccessToken: "token-of-" + key}, nil
+		}), nil
+	}
+	token, err := s.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-of-key-1", token.AccessToken)
+	_, _ = s.Token()
+	assert.Equal(t, 1, accessed)
+
+	// rotated, old key revoked before refresh
+	key = "key-2"
+	revoked["key-1"] = true
+	token, err = s.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-of-key-2", token.AccessToken)
+	assert.Equal(t, 2, accessed)
+
+	// refresh interval elapsed
+	key = "key-3"
+	s.expiry = time.Now()
+	token, err = s.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-of-key-3", token.AccessToken)
+
+	_, err = newSecretTokenSource(ts.Client(), "projects/p/secrets/foo", time.Hour).Token()
+	assert.Error(t, err)
+}
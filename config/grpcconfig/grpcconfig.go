@@ -0,0 +1,71 @@
+package grpcconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/grpcloader"
+	"go.uber.org/zap"
+	"os"
+)
+
+func WithGRPCLoader(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		grpcLoaderAddr = fs.String("grpc-loader-addr", "",
+			"gRPC Loader target address of asset service e.g. assets.internal:443. Enable gRPC Loader only if this value present")
+		grpcLoaderInsecure = fs.Bool("grpc-loader-insecure", false,
+			"gRPC Loader use plaintext transport without TLS")
+		grpcLoaderTLSCAFile = fs.String("grpc-loader-tls-ca-file", "",
+			"gRPC Loader CA certificate file for verifying server certificate. Default system roots")
+		grpcLoaderTLSCertFile = fs.String("grpc-loader-tls-cert-file", "",
+			"gRPC Loader client certificate file for mTLS")
+		grpcLoaderTLSKeyFile = fs.String("grpc-loader-tls-key-file", "",
+			"gRPC Loader client key file for mTLS")
+		grpcLoaderMaxAllowedSize = fs.Int64("grpc-loader-max-allowed-size", 0,
+			"gRPC Loader maximum allowed size in bytes for loading images if set")
+
+		_, _ = cb()
+	)
+	return func(app *imagor.Imagor) {
+		if *grpcLoaderAddr == "" {
+			return
+		}
+		tlsConfig, err := newTLSConfig(*grpcLoaderTLSCAFile, *grpcLoaderTLSCertFile, *grpcLoaderTLSKeyFile)
+		if err != nil {
+			panic(err)
+		}
+		// gRPC Loader placed before other loaders,
+		// such that image keys are not attempted by HTTP Loader
+		app.Loaders = append([]imagor.Loader{
+			grpcloader.New(*grpcLoaderAddr,
+				grpcloader.WithTLSConfig(tlsConfig),
+				grpcloader.WithInsecure(*grpcLoaderInsecure),
+				grpcloader.WithMaxAllowedSize(*grpcLoaderMaxAllowedSize),
+			),
+		}, app.Loaders...)
+	}
+}
+
+func newTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("grpc-loader-tls-ca-file: no certificates found")
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
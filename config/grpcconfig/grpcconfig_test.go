@@ -0,0 +1,36 @@
+package grpcconfig
+
+import (
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/loader/grpcloader"
+	"github.com/cshum/imagor/loader/httploader"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithGRPCLoader(t *testing.T) {
+	srv := config.CreateServer([]string{}, WithGRPCLoader)
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 1, len(app.Loaders))
+
+	srv = config.CreateServer([]string{
+		"-grpc-loader-addr", "assets.internal:443",
+		"-grpc-loader-max-allowed-size", "1000",
+	}, WithGRPCLoader)
+	app = srv.App.(*imagor.Imagor)
+	assert.Equal(t, 2, len(app.Loaders))
+	loader := app.Loaders[0].(*grpcloader.GRPCLoader)
+	assert.Equal(t, "assets.internal:443", loader.Addr)
+	assert.Equal(t, int64(1000), loader.MaxAllowedSize)
+	assert.False(t, loader.Insecure)
+	assert.NotNil(t, loader.TLSConfig)
+	assert.IsType(t, &httploader.HTTPLoader{}, app.Loaders[1])
+
+	assert.Panics(t, func() {
+		config.CreateServer([]string{
+			"-grpc-loader-addr", "assets.internal:443",
+			"-grpc-loader-tls-ca-file", "./non-exists.pem",
+		}, WithGRPCLoader)
+	})
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/gzipstorage"
+	"go.uber.org/zap"
+)
+
+func withResultStorageGzip(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		resultStorageGzip = fs.Bool("imagor-result-storage-gzip", false,
+			"Imagor result storage gzip compression of compressible results e.g. SVG, PNG, TIFF, with transparent decompression on load")
+		resultStorageGzipEncoding = fs.String("imagor-result-storage-gzip-encoding", "gzip",
+			"Imagor result storage compression encoding, either gzip or zstd")
+		resultStorageGzipLevel = fs.Int("imagor-result-storage-gzip-level", 6,
+			"Imagor result storage gzip compression level from 1 best speed to 9 best compression")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if !*resultStorageGzip {
+			return
+		}
+		for i, storage := range o.ResultStorages {
+			o.ResultStorages[i] = gzipstorage.New(storage,
+				gzipstorage.WithEncoding(*resultStorageGzipEncoding),
+				gzipstorage.WithLevel(*resultStorageGzipLevel))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/prewarm"
+	"go.uber.org/zap"
+	"strings"
+)
+
+func withKafkaPrewarm(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		kafkaPrewarmBrokers = fs.String("kafka-prewarm-brokers", "",
+			"Kafka broker addresses in csv e.g. localhost:9092, for pre-generating presets of new images. Requires kafka-prewarm-topic and kafka-prewarm-presets")
+		kafkaPrewarmTopic = fs.String("kafka-prewarm-topic", "",
+			"Kafka topic of object created events, either S3 event notifications or plain object keys")
+		kafkaPrewarmGroupID = fs.String("kafka-prewarm-group-id", "imagor-prewarm",
+			"Kafka consumer group ID")
+		kafkaPrewarmPresets = fs.String("kafka-prewarm-presets", "",
+			"Imagor params to be pre-generated for new images in csv e.g. fit-in/200x200,filters:format(webp)")
+		kafkaPrewarmTrimPrefix = fs.String("kafka-prewarm-trim-prefix", "",
+			"Prefix trimmed from object keys of events to form image keys, e.g. base directory of loader bucket")
+		kafkaPrewarmConcurrency = fs.Int("kafka-prewarm-concurrency", 4,
+			"Number of Kafka messages to be processed concurrently")
+
+		_, _ = cb()
+	)
+	return func(app *imagor.Imagor) {
+		if *kafkaPrewarmBrokers == "" || *kafkaPrewarmTopic == "" ||
+			strings.TrimSpace(*kafkaPrewarmPresets) == "" {
+			return
+		}
+		// activate Kafka pre-warm consumer only if brokers, topic and presets present
+		app.Workers = append(app.Workers, prewarm.New(
+			app, prewarm.NewKafkaQueue(
+				strings.Split(*kafkaPrewarmBrokers, ","), *kafkaPrewarmTopic, *kafkaPrewarmGroupID),
+			strings.Split(*kafkaPrewarmPresets, ","),
+			prewarm.WithTrimPrefix(*kafkaPrewarmTrimPrefix),
+			prewarm.WithConcurrency(*kafkaPrewarmConcurrency),
+		))
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memcachedstorage"
+	"go.uber.org/zap"
+	"time"
+)
+
+func withMemcached(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		memcachedResultStorageAddr = fs.String("memcached-result-storage-addr", "",
+			"Memcached address for Memcached Result Storage e.g. localhost:11211. Enable Memcached Result Storage only if this value present")
+		memcachedResultStoragePrefix = fs.String("memcached-result-storage-prefix", "imagor:",
+			"Memcached Result Storage key prefix")
+		memcachedResultStorageTTL = fs.Duration("memcached-result-storage-ttl", time.Hour*24,
+			"Memcached Result Storage TTL of cached results")
+		memcachedResultStorageMaxChunks = fs.Int("memcached-result-storage-max-chunks", 32,
+			"Memcached Result Storage maximum number of 1MB chunks per result. Larger results are not cached")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *memcachedResultStorageAddr != "" {
+			// activate Memcached Result Storage only if address config presents,
+			// placed in front of other result storages for hot caching
+			o.ResultStorages = append([]imagor.Storage{
+				memcachedstorage.New(*memcachedResultStorageAddr,
+					memcachedstorage.WithPrefix(*memcachedResultStoragePrefix),
+					memcachedstorage.WithTTL(*memcachedResultStorageTTL),
+					memcachedstorage.WithMaxChunks(*memcachedResultStorageMaxChunks),
+				),
+			}, o.ResultStorages...)
+		}
+	}
+}
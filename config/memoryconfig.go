@@ -0,0 +1,34 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"go.uber.org/zap"
+)
+
+func withMemory(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		memoryResultStorageMaxSize = fs.Int64("memory-result-storage-max-size", 0,
+			"In-memory LRU Result Storage maximum total bytes. Enable Memory Result Storage only if this value present")
+		memoryResultStorageMaxItemSize = fs.Int64("memory-result-storage-max-item-size", 1<<20,
+			"In-memory LRU Result Storage maximum bytes per result. Larger results are not cached")
+		memoryResultStorageExpiration = fs.Duration("memory-result-storage-expiration", 0,
+			"In-memory LRU Result Storage expiration duration e.g. 1h. Default no expiration")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *memoryResultStorageMaxSize > 0 {
+			// activate Memory Result Storage only if max size config presents,
+			// placed as the first result storage
+			o.ResultStorages = append([]imagor.Storage{
+				memorystorage.New(
+					memorystorage.WithMaxSize(*memoryResultStorageMaxSize),
+					memorystorage.WithMaxItemSize(*memoryResultStorageMaxItemSize),
+					memorystorage.WithExpiration(*memoryResultStorageExpiration),
+				),
+			}, o.ResultStorages...)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/retryloader"
+	"github.com/cshum/imagor/migrate"
+	"github.com/cshum/imagor/storage/dedupstorage"
+	"github.com/cshum/imagor/storage/gzipstorage"
+	"github.com/cshum/imagor/storage/templatestorage"
+	"go.uber.org/zap"
+	"reflect"
+	"strings"
+)
+
+// Migrate imagor migrate subcommand, copies images from one configured storage to another.
+// Storages are referenced by <type>-<role> e.g. file-result-storage, s3-storage, gcloud-loader
+func Migrate(args []string, funcs ...Func) (res *migrate.Result, err error) {
+	var (
+		fs     = flag.NewFlagSet("imagor migrate", flag.ExitOnError)
+		logger *zap.Logger
+
+		debug = fs.Bool("debug", false, "Debug mode")
+		_     = fs.String("config", ".env", "Retrieve configuration from the given file")
+
+		from = fs.String("from", "",
+			"Source storage to migrate from e.g. file-result-storage")
+		to = fs.String("to", "",
+			"Target storage to migrate to e.g. s3-result-storage")
+		prefix = fs.String("prefix", "",
+			"Migrate only images under key prefix")
+		concurrency = fs.Int("concurrency", 10,
+			"Number of images to be copied concurrently")
+		overwrite = fs.Bool("overwrite", false,
+			"Overwrite images that already exist in target storage. By default existing images are skipped for resume")
+		checkpoint = fs.String("checkpoint", "",
+			"Checkpoint file recording migration progress, such that resumed runs skip migrated images without looking them up")
+	)
+
+	app := NewImagor(fs, func() (*zap.Logger, bool) {
+		logger = parseFlags(fs, args, debug)
+		return logger, *debug
+	}, funcs...)
+
+	defer func() {
+		if err != nil {
+			logger.Error("migrate", zap.Error(err))
+		}
+	}()
+
+	storages := namedStorages(app)
+	src, ok := storages[*from]
+	if !ok {
+		return nil, fmt.Errorf("imagor: migrate source storage not found: %s", *from)
+	}
+	dst, ok := storages[*to]
+	if !ok {
+		return nil, fmt.Errorf("imagor: migrate target storage not found: %s", *to)
+	}
+	if src == dst {
+		return nil, fmt.Errorf("imagor: migrate source and target are the same storage: %s", *from)
+	}
+	res, err = migrate.New(
+		migrate.WithPrefix(*prefix),
+		migrate.WithConcurrency(*concurrency),
+		migrate.WithOverwrite(*overwrite),
+		migrate.WithCheckpoint(*checkpoint),
+		migrate.WithLogger(logger),
+	).Run(context.Background(), src, dst)
+	if res != nil {
+		logger.Info("migrate",
+			zap.String("from", *from), zap.String("to", *to),
+			zap.Int64("copied", res.Copied),
+			zap.Int64("skipped", res.Skipped),
+			zap.Int64("failed", res.Failed),
+			zap.Int64("resumed", res.Resumed))
+	}
+	return
+}
+
+func namedStorages(app *imagor.Imagor) map[string]imagor.Storage {
+	m := map[string]imagor.Storage{}
+	add := func(role string, s imagor.Storage) {
+		s = unwrapStorage(s)
+		name := storageType(s) + "-" + role
+		if _, exists := m[name]; !exists {
+			m[name] = s
+		}
+	}
+	for _, s := range app.Storages {
+		add("storage", s)
+	}
+	for _, s := range app.ResultStorages {
+		add("result-storage", s)
+	}
+	for _, l := range app.Loaders {
+		if r, ok := l.(*retryloader.RetryLoader); ok {
+			l = r.Loader
+		}
+		if s, ok := l.(imagor.Storage); ok {
+			add("loader", s)
+		}
+	}
+	return m
+}
+
+// unwrapStorage underlying storage of wrappers configured for serving,
+// such that migration works on storages directly
+func unwrapStorage(s imagor.Storage) imagor.Storage {
+	for {
+		switch w := s.(type) {
+		case *retryloader.RetryStorage:
+			s = w.Storage
+		case *templatestorage.TemplateStorage:
+			s = w.Storage
+		case *gzipstorage.GzipStorage:
+			s = w.Storage
+		case *dedupstorage.DedupStorage:
+			s = w.Storage
+		default:
+			return s
+		}
+	}
+}
+
+// storageType derives storage type from type name e.g. FileStorage -> file
+func storageType(s interface{}) string {
+	t := reflect.TypeOf(s)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.ToLower(strings.TrimSuffix(t.Name(), "Storage"))
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/ociloader"
+	"go.uber.org/zap"
+)
+
+func withOCILoader(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		ociLoaderAllowedRegistries = fs.String("oci-loader-allowed-registries", "",
+			"OCI Loader allowed container registry hosts in comma separated format e.g. ghcr.io,*.pkg.dev. Enable OCI Loader only if this value present")
+		ociLoaderUsername = fs.String("oci-loader-username", "",
+			"OCI Loader registry username")
+		ociLoaderPassword = fs.String("oci-loader-password", "",
+			"OCI Loader registry password or access token")
+		ociLoaderInsecure = fs.Bool("oci-loader-insecure", false,
+			"OCI Loader use plain HTTP for registries")
+		ociLoaderMaxAllowedSize = fs.Int64("oci-loader-max-allowed-size", 0,
+			"OCI Loader maximum allowed size in bytes for loading images if set")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *ociLoaderAllowedRegistries != "" {
+			// activate OCI Loader only if allowed registries config presents
+			o.Loaders = append(o.Loaders,
+				ociloader.New(
+					ociloader.WithAllowedRegistries(*ociLoaderAllowedRegistries),
+					ociloader.WithCredentials(*ociLoaderUsername, *ociLoaderPassword),
+					ociloader.WithInsecure(*ociLoaderInsecure),
+					ociloader.WithMaxAllowedSize(*ociLoaderMaxAllowedSize),
+				),
+			)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package r2config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/s3storage"
+	"go.uber.org/zap"
+)
+
+// WithR2 Cloudflare R2 loader, storage and result storage.
+// R2 is S3 compatible but does not support ACL, and requires account specific endpoint
+func WithR2(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		r2AccountId = fs.String("r2-account-id", "",
+			"Cloudflare R2 Account ID. Required if using R2 Loader or Storage")
+		r2AccessKeyId = fs.String("r2-access-key-id", "",
+			"Cloudflare R2 Access Key ID. Required if using R2 Loader or Storage")
+		r2SecretAccessKey = fs.String("r2-secret-access-key", "",
+			"Cloudflare R2 Secret Access Key. Required if using R2 Loader or Storage")
+		r2Endpoint = fs.String("r2-endpoint", "",
+			"Optional R2 Endpoint to override default https://<account-id>.r2.cloudflarestorage.com")
+		r2SafeChars = fs.String("r2-safe-chars", "",
+			"R2 safe characters to be excluded from image key escape")
+		r2PresignExpiration = fs.Duration("r2-presign-expiration", 0,
+			"R2 presigned URL expiration duration (default 15m)")
+
+		r2LoaderBucket = fs.String("r2-loader-bucket", "",
+			"R2 Bucket for R2 Loader. Enable R2 Loader only if this value present")
+		r2LoaderBaseDir = fs.String("r2-loader-base-dir", "",
+			"Base directory for R2 Loader")
+		r2LoaderPathPrefix = fs.String("r2-loader-path-prefix", "",
+			"Base path prefix for R2 Loader")
+
+		r2StorageBucket = fs.String("r2-storage-bucket", "",
+			"R2 Bucket for R2 Storage. Enable R2 Storage only if this value present")
+		r2StorageBaseDir = fs.String("r2-storage-base-dir", "",
+			"Base directory for R2 Storage")
+		r2StoragePathPrefix = fs.String("r2-storage-path-prefix", "",
+			"Base path prefix for R2 Storage")
+		r2StoragePublicURL = fs.String("r2-storage-public-url", "",
+			"Public URL of R2 Storage bucket e.g. https://pub-xxx.r2.dev. Presigned URL is used if not set")
+		r2StorageExpiration = fs.Duration("r2-storage-expiration", 0,
+			"R2 Storage expiration duration e.g. 24h. Default no expiration")
+
+		r2ResultStorageBucket = fs.String("r2-result-storage-bucket", "",
+			"R2 Bucket for R2 Result Storage. Enable R2 Result Storage only if this value present")
+		r2ResultStorageBaseDir = fs.String("r2-result-storage-base-dir", "",
+			"Base directory for R2 Result Storage")
+		r2ResultStoragePathPrefix = fs.String("r2-result-storage-path-prefix", "",
+			"Base path prefix for R2 Result Storage")
+		r2ResultStoragePublicURL = fs.String("r2-result-storage-public-url", "",
+			"Public URL of R2 Result Storage bucket e.g. https://pub-xxx.r2.dev. Presigned URL is used if not set")
+		r2ResultStorageExpiration = fs.Duration("r2-result-storage-expiration", 0,
+			"R2 Result Storage expiration duration e.g. 24h. Default no expiration")
+
+		_, _ = cb()
+	)
+	return func(app *imagor.Imagor) {
+		if *r2AccountId == "" || *r2AccessKeyId == "" || *r2SecretAccessKey == "" {
+			return
+		}
+		endpoint := *r2Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.r2.cloudflarestorage.com", *r2AccountId)
+		}
+		// activate R2 Session only if credentials present
+		sess, err := session.NewSession(&aws.Config{
+			Endpoint:         aws.String(endpoint),
+			Region:           aws.String("auto"),
+			S3ForcePathStyle: aws.Bool(true),
+			Credentials: credentials.NewStaticCredentials(
+				*r2AccessKeyId, *r2SecretAccessKey, ""),
+		})
+		if err != nil {
+			panic(err)
+		}
+		if *r2StorageBucket != "" {
+			// activate R2 Storage only if bucket config presents
+			app.Storages = append(app.Storages,
+				s3storage.New(sess, *r2StorageBucket,
+					s3storage.WithPathPrefix(*r2StoragePathPrefix),
+					s3storage.WithBaseDir(*r2StorageBaseDir),
+					s3storage.WithoutACL(),
+					s3storage.WithSafeChars(*r2SafeChars),
+					s3storage.WithExpiration(*r2StorageExpiration),
+					s3storage.WithPublicURL(*r2StoragePublicURL),
+					s3storage.WithPresignExpiration(*r2PresignExpiration),
+				),
+			)
+		}
+		if *r2LoaderBucket != "" {
+			// activate R2 Loader only if bucket config presents
+			if *r2LoaderPathPrefix != *r2StoragePathPrefix ||
+				*r2LoaderBucket != *r2StorageBucket ||
+				*r2LoaderBaseDir != *r2StorageBaseDir {
+				// create another loader if different from storage
+				app.Loaders = append(app.Loaders,
+					s3storage.New(sess, *r2LoaderBucket,
+						s3storage.WithPathPrefix(*r2LoaderPathPrefix),
+						s3storage.WithBaseDir(*r2LoaderBaseDir),
+						s3storage.WithSafeChars(*r2SafeChars),
+					),
+				)
+			}
+		}
+		if *r2ResultStorageBucket != "" {
+			// activate R2 Result Storage only if bucket config presents
+			app.ResultStorages = append(app.ResultStorages,
+				s3storage.New(sess, *r2ResultStorageBucket,
+					s3storage.WithPathPrefix(*r2ResultStoragePathPrefix),
+					s3storage.WithBaseDir(*r2ResultStorageBaseDir),
+					s3storage.WithoutACL(),
+					s3storage.WithSafeChars(*r2SafeChars),
+					s3storage.WithExpiration(*r2ResultStorageExpiration),
+					s3storage.WithPublicURL(*r2ResultStoragePublicURL),
+					s3storage.WithPresignExpiration(*r2PresignExpiration),
+				),
+			)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package r2config
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/storage/s3storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestR2Storage(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-r2-account-id", "myaccount",
+		"-r2-access-key-id", "asdf",
+		"-r2-secret-access-key", "asdf",
+		"-r2-safe-chars", "!",
+		"-r2-presign-expiration", "1h",
+
+		"-r2-loader-bucket", "a",
+		"-r2-loader-base-dir", "foo",
+		"-r2-loader-path-prefix", "abcd",
+		"-r2-storage-bucket", "a",
+		"-r2-storage-base-dir", "foo",
+		"-r2-storage-path-prefix", "abcd",
+
+		"-r2-result-storage-bucket", "b",
+		"-r2-result-storage-base-dir", "bar",
+		"-r2-result-storage-path-prefix", "bcda",
+		"-r2-result-storage-public-url", "https://pub-xxx.r2.dev/",
+	}, WithR2)
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, 1, len(app.Loaders))
+	storage := app.Storages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "a", storage.Bucket)
+	assert.Equal(t, "/foo/", storage.BaseDir)
+	assert.Equal(t, "/abcd/", storage.PathPrefix)
+	assert.Equal(t, "!", storage.SafeChars)
+	assert.Equal(t, "", storage.ACL)
+	assert.Equal(t, time.Hour, storage.PresignExpiration)
+
+	resultStorage := app.ResultStorages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "b", resultStorage.Bucket)
+	assert.Equal(t, "/bar/", resultStorage.BaseDir)
+	assert.Equal(t, "/bcda/", resultStorage.PathPrefix)
+	assert.Equal(t, "", resultStorage.ACL)
+	u, err := resultStorage.URL(context.Background(), "/bcda/fit-in/abc.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "https://pub-xxx.r2.dev/bar/fit-in/abc.jpg", u)
+}
+
+func TestR2NoCredentials(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-r2-storage-bucket", "a",
+	}, WithR2)
+	app := srv.App.(*imagor.Imagor)
+	assert.Empty(t, app.Storages)
+}
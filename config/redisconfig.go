@@ -0,0 +1,42 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/redisstorage"
+	"go.uber.org/zap"
+	"time"
+)
+
+func withRedis(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		redisResultStorageAddr = fs.String("redis-result-storage-addr", "",
+			"Redis address for Redis Result Storage e.g. localhost:6379. Enable Redis Result Storage only if this value present")
+		redisResultStoragePassword = fs.String("redis-result-storage-password", "",
+			"Redis Result Storage password")
+		redisResultStorageDB = fs.Int("redis-result-storage-db", 0,
+			"Redis Result Storage database number")
+		redisResultStoragePrefix = fs.String("redis-result-storage-prefix", "imagor:",
+			"Redis Result Storage key prefix")
+		redisResultStorageTTL = fs.Duration("redis-result-storage-ttl", time.Hour*24,
+			"Redis Result Storage TTL of cached results")
+		redisResultStorageMaxSize = fs.Int64("redis-result-storage-max-size", 1<<20,
+			"Redis Result Storage maximum value size in bytes. Larger results are not cached")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *redisResultStorageAddr != "" {
+			// activate Redis Result Storage only if address config presents
+			o.ResultStorages = append(o.ResultStorages,
+				redisstorage.New(*redisResultStorageAddr,
+					redisstorage.WithPassword(*redisResultStoragePassword),
+					redisstorage.WithDB(*redisResultStorageDB),
+					redisstorage.WithPrefix(*redisResultStoragePrefix),
+					redisstorage.WithTTL(*redisResultStorageTTL),
+					redisstorage.WithMaxSize(*redisResultStorageMaxSize),
+				),
+			)
+		}
+	}
+}
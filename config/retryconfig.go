@@ -0,0 +1,37 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/retryloader"
+	"go.uber.org/zap"
+	"time"
+)
+
+func withLoadRetry(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		loadRetryMaxAttempts = fs.Int("imagor-load-retry-max-attempts", 1,
+			"Imagor maximum attempts of loading source image from loaders and storages on transient errors e.g. 502, 503, connection reset. Default 1 without retry")
+		loadRetryBackoff = fs.Duration("imagor-load-retry-backoff", time.Millisecond*100,
+			"Imagor delay before the first load retry, doubled for every subsequent retry with jitter")
+		loadRetryMaxBackoff = fs.Duration("imagor-load-retry-max-backoff", time.Second*2,
+			"Imagor maximum delay between load retries")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *loadRetryMaxAttempts <= 1 {
+			return
+		}
+		options := []retryloader.Option{
+			retryloader.WithMaxAttempts(*loadRetryMaxAttempts),
+			retryloader.WithBackoff(*loadRetryBackoff, *loadRetryMaxBackoff),
+		}
+		for i, loader := range o.Loaders {
+			o.Loaders[i] = retryloader.New(loader, options...)
+		}
+		for i, storage := range o.Storages {
+			o.Storages[i] = retryloader.NewStorage(storage, options...)
+		}
+	}
+}
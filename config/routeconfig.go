@@ -0,0 +1,56 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/routeloader"
+	"go.uber.org/zap"
+	"strings"
+)
+
+func withLoaderRoutes(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		loaderRoutes = fs.String("imagor-loader-routes", "",
+			"Imagor loader routing rules of pattern=loader in comma separated format, first match wins e.g. cdn.example.com/*=s3-loader,*=http-loader. Loaders are tried in order if not set")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *loaderRoutes == "" {
+			return
+		}
+		loaders := namedLoaders(o)
+		var routes []routeloader.Route
+		for _, rule := range strings.Split(*loaderRoutes, ",") {
+			if rule = strings.TrimSpace(rule); rule == "" {
+				continue
+			}
+			pattern, name, ok := strings.Cut(rule, "=")
+			if !ok {
+				panic(fmt.Errorf("imagor: invalid loader route: %s", rule))
+			}
+			loader, ok := loaders[strings.TrimSpace(name)]
+			if !ok {
+				panic(fmt.Errorf("imagor: loader route target not found: %s", name))
+			}
+			routes = append(routes, routeloader.Route{
+				Pattern: strings.TrimSpace(pattern),
+				Loader:  loader,
+			})
+		}
+		o.Loaders = []imagor.Loader{routeloader.New(routes...)}
+	}
+}
+
+// namedLoaders loaders referenced by <type>-loader e.g. http-loader, s3-loader, file-loader
+func namedLoaders(app *imagor.Imagor) map[string]imagor.Loader {
+	m := map[string]imagor.Loader{}
+	for _, l := range app.Loaders {
+		name := strings.TrimSuffix(storageType(l), "loader") + "-loader"
+		if _, exists := m[name]; !exists {
+			m[name] = l
+		}
+	}
+	return m
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/sftpstorage"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"time"
+)
+
+func withSFTP(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		sftpAddr = fs.String("sftp-addr", "",
+			"SFTP server address e.g. sftp.example.com:22. Enable SFTP Loader and Storages only if this value present")
+		sftpUsername = fs.String("sftp-username", "",
+			"SFTP username")
+		sftpPassword = fs.String("sftp-password", "",
+			"SFTP password")
+		sftpPrivateKeyFile = fs.String("sftp-private-key-file", "",
+			"SFTP PEM encoded private key file for public key authentication")
+		sftpKnownHostsFile = fs.String("sftp-known-hosts-file", "",
+			"SFTP known_hosts file for verifying server host key")
+		sftpHostKey = fs.String("sftp-host-key", "",
+			"SFTP server host public key in authorized_keys format e.g. ssh-ed25519 AAAA..., alternative to sftp-known-hosts-file")
+		sftpTimeout = fs.Duration("sftp-timeout", time.Second*30,
+			"SFTP connection timeout")
+		sftpMaxIdleConns = fs.Int("sftp-max-idle-conns", 4,
+			"SFTP maximum idle connections kept in pool per loader or storage")
+		sftpSafeChars = fs.String("sftp-safe-chars", "",
+			"SFTP safe characters to be excluded from image key escape")
+
+		sftpLoaderBaseDir = fs.String("sftp-loader-base-dir", "",
+			"Base directory for SFTP Loader. Enable SFTP Loader only if this value present")
+		sftpLoaderPathPrefix = fs.String("sftp-loader-path-prefix", "",
+			"Base path prefix for SFTP Loader")
+
+		sftpStorageBaseDir = fs.String("sftp-storage-base-dir", "",
+			"Base directory for SFTP Storage. Enable SFTP Storage only if this value present")
+		sftpStoragePathPrefix = fs.String("sftp-storage-path-prefix", "",
+			"Base path prefix for SFTP Storage")
+		sftpStorageExpiration = fs.Duration("sftp-storage-expiration", 0,
+			"SFTP Storage expiration duration e.g. 24h. Default no expiration")
+
+		sftpResultStorageBaseDir = fs.String("sftp-result-storage-base-dir", "",
+			"Base directory for SFTP Result Storage. Enable SFTP Result Storage only if this value present")
+		sftpResultStoragePathPrefix = fs.String("sftp-result-storage-path-prefix", "",
+			"Base path prefix for SFTP Result Storage")
+		sftpResultStorageExpiration = fs.Duration("sftp-result-storage-expiration", 0,
+			"SFTP Result Storage expiration duration e.g. 24h. Default no expiration")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *sftpAddr == "" {
+			return
+		}
+		var hostKeyCallback ssh.HostKeyCallback
+		if *sftpHostKey != "" {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(*sftpHostKey))
+			if err != nil {
+				panic(err)
+			}
+			hostKeyCallback = ssh.FixedHostKey(key)
+		} else if *sftpKnownHostsFile != "" {
+			var err error
+			if hostKeyCallback, err = knownhosts.New(*sftpKnownHostsFile); err != nil {
+				panic(err)
+			}
+		}
+		privateKey := readFile(*sftpPrivateKeyFile)
+		newSFTPStorage := func(baseDir, prefix string, exp time.Duration) *sftpstorage.SFTPStorage {
+			return sftpstorage.New(*sftpAddr,
+				sftpstorage.WithCredentials(*sftpUsername, *sftpPassword),
+				sftpstorage.WithPrivateKey(privateKey),
+				sftpstorage.WithHostKeyCallback(hostKeyCallback),
+				sftpstorage.WithBaseDir(baseDir),
+				sftpstorage.WithPathPrefix(prefix),
+				sftpstorage.WithSafeChars(*sftpSafeChars),
+				sftpstorage.WithTimeout(*sftpTimeout),
+				sftpstorage.WithMaxIdleConns(*sftpMaxIdleConns),
+				sftpstorage.WithExpiration(exp),
+			)
+		}
+		if *sftpStorageBaseDir != "" {
+			// activate SFTP Storage only if base dir config presents
+			o.Storages = append(o.Storages,
+				newSFTPStorage(*sftpStorageBaseDir, *sftpStoragePathPrefix, *sftpStorageExpiration))
+		}
+		if *sftpLoaderBaseDir != "" {
+			// activate SFTP Loader only if base dir config presents
+			if *sftpStorageBaseDir != *sftpLoaderBaseDir ||
+				*sftpStoragePathPrefix != *sftpLoaderPathPrefix {
+				// create another loader if different from storage
+				o.Loaders = append(o.Loaders,
+					newSFTPStorage(*sftpLoaderBaseDir, *sftpLoaderPathPrefix, 0))
+			}
+		}
+		if *sftpResultStorageBaseDir != "" {
+			// activate SFTP Result Storage only if base dir config presents
+			o.ResultStorages = append(o.ResultStorages,
+				newSFTPStorage(*sftpResultStorageBaseDir, *sftpResultStoragePathPrefix, *sftpResultStorageExpiration))
+		}
+	}
+}
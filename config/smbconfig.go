@@ -0,0 +1,52 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/smbloader"
+	"go.uber.org/zap"
+	"time"
+)
+
+func withSMBLoader(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		smbAddr = fs.String("smb-addr", "",
+			"SMB file server address e.g. fileserver:445. Enable SMB Loader only if this value and SMB share present")
+		smbShare = fs.String("smb-share", "",
+			"SMB share name e.g. images")
+		smbUsername = fs.String("smb-username", "",
+			"SMB username")
+		smbPassword = fs.String("smb-password", "",
+			"SMB password")
+		smbDomain = fs.String("smb-domain", "",
+			"SMB domain or workgroup of username")
+		smbTimeout = fs.Duration("smb-timeout", time.Second*30,
+			"SMB connection timeout")
+		smbMaxIdleConns = fs.Int("smb-max-idle-conns", 4,
+			"SMB maximum idle connections kept in pool")
+		smbSafeChars = fs.String("smb-safe-chars", "",
+			"SMB safe characters to be excluded from image key escape")
+		smbLoaderBaseDir = fs.String("smb-loader-base-dir", "",
+			"Base directory within SMB share for SMB Loader")
+		smbLoaderPathPrefix = fs.String("smb-loader-path-prefix", "",
+			"Base path prefix for SMB Loader")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *smbAddr == "" || *smbShare == "" {
+			return
+		}
+		o.Loaders = append(o.Loaders,
+			smbloader.New(*smbAddr, *smbShare,
+				smbloader.WithCredentials(*smbUsername, *smbPassword),
+				smbloader.WithDomain(*smbDomain),
+				smbloader.WithBaseDir(*smbLoaderBaseDir),
+				smbloader.WithPathPrefix(*smbLoaderPathPrefix),
+				smbloader.WithSafeChars(*smbSafeChars),
+				smbloader.WithTimeout(*smbTimeout),
+				smbloader.WithMaxIdleConns(*smbMaxIdleConns),
+			),
+		)
+	}
+}
@@ -0,0 +1,40 @@
+package stdconfig
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/processor/stdprocessor"
+	"go.uber.org/zap"
+)
+
+// WithStd pure Go processor for JPEG, PNG and GIF without libvips.
+// Registered after vips processor as fallback
+func WithStd(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		stdDisable = fs.Bool("std-disable", false,
+			"Disable pure Go fallback processor, used for JPEG, PNG and GIF when libvips is not available")
+		stdMaxWidth = fs.Int("std-max-width", 0,
+			"Pure Go processor max image width")
+		stdMaxHeight = fs.Int("std-max-height", 0,
+			"Pure Go processor max image height")
+		stdMaxResolution = fs.Int("std-max-resolution", 0,
+			"Pure Go processor max image resolution")
+		stdMaxAnimationFrames = fs.Int("std-max-animation-frames", -1,
+			"Pure Go processor maximum number of animated GIF frames to be loaded. Set 1 to disable animation, -1 for unlimited")
+
+		logger, isDebug = cb()
+	)
+	if *stdDisable {
+		return imagor.WithProcessors()
+	}
+	return imagor.WithProcessors(
+		stdprocessor.New(
+			stdprocessor.WithMaxWidth(*stdMaxWidth),
+			stdprocessor.WithMaxHeight(*stdMaxHeight),
+			stdprocessor.WithMaxResolution(*stdMaxResolution),
+			stdprocessor.WithMaxAnimationFrames(*stdMaxAnimationFrames),
+			stdprocessor.WithLogger(logger),
+			stdprocessor.WithDebug(isDebug),
+		),
+	)
+}
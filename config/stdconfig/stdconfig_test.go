@@ -0,0 +1,30 @@
+package stdconfig
+
+import (
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/processor/stdprocessor"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithStd(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-std-disable",
+	}, WithStd)
+	app := srv.App.(*imagor.Imagor)
+	assert.Empty(t, app.Processors)
+
+	srv = config.CreateServer([]string{
+		"-std-max-width", "1000",
+		"-std-max-height", "800",
+		"-std-max-resolution", "500000",
+		"-std-max-animation-frames", "5",
+	}, WithStd)
+	app = srv.App.(*imagor.Imagor)
+	processor := app.Processors[0].(*stdprocessor.StdProcessor)
+	assert.Equal(t, 1000, processor.MaxWidth)
+	assert.Equal(t, 800, processor.MaxHeight)
+	assert.Equal(t, 500000, processor.MaxResolution)
+	assert.Equal(t, 5, processor.MaxAnimationFrames)
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/templatestorage"
+	"go.uber.org/zap"
+)
+
+func withResultStorageKeyTemplate(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		resultStorageKeyTemplate = fs.String("imagor-result-storage-key-template", "",
+			"Imagor result storage key template with placeholders {key}, {ext}, {year}, {month}, {day}, {hour} e.g. results/{year}/{month}/{key}.{ext}")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *resultStorageKeyTemplate == "" {
+			return
+		}
+		for i, storage := range o.ResultStorages {
+			o.ResultStorages[i] = templatestorage.New(storage, *resultStorageKeyTemplate)
+		}
+	}
+}
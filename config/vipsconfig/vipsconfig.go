@@ -13,6 +13,8 @@ func WithVips(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"VIPS disable blur operations for vips processor")
 		vipsMaxAnimationFrames = fs.Int("vips-max-animation-frames", -1,
 			"VIPS maximum number of animation frames to be loaded. Set 1 to disable animation, -1 for unlimited")
+		vipsCollapseAnimation = fs.Bool("vips-collapse-animation", false,
+			"VIPS collapse animated image into a still of the first frame when frames exceed -vips-max-animation-frames, instead of keeping the first frames")
 		vipsDisableFilters = fs.String("vips-disable-filters", "",
 			"VIPS disable filters by csv e.g. blur,watermark,rgb")
 		vipsMaxFilterOps = fs.Int("vips-max-filter-ops", -1,
@@ -33,12 +35,63 @@ func WithVips(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"VIPS max image resolution")
 		vipsMozJPEG = fs.Bool("vips-mozjpeg", false,
 			"VIPS enable maximum compression with MozJPEG. Requires mozjpeg to be installed")
+		vipsAvifSpeed = fs.Int("vips-avif-speed", -1,
+			"VIPS AVIF encoder speed 0-9, higher is faster with larger output. Overridden by speed(n) filter. Default libvips speed if not set")
+		vipsAvifQuality = fs.Int("vips-avif-quality", 0,
+			"VIPS AVIF default quality if quality(n) filter is not specified")
+		vipsSvgDPI = fs.Int("vips-svg-dpi", 0,
+			"VIPS default render density of SVG sources, limited by max width, height and resolution. Overridden by dpi(n) filter. SVG is rendered at the target size if not set")
+		vipsAutoQualityDSSIM = fs.Float64("vips-auto-quality-dssim", 0,
+			"VIPS target DSSIM of quality(auto), which searches the lowest quality within the target e.g. 0.0015, trading CPU for smaller output. Heuristic quality if not set")
+		vipsSmartCrop = fs.String("vips-smart-crop", "attention",
+			"VIPS saliency strategy of smart crop: attention or entropy")
+		vipsFaceDetectorURL = fs.String("vips-face-detector-url", "",
+			"VIPS face detection service URL for smart crop, which accepts JPEG by POST and responds JSON array of {left,top,right,bottom} regions")
+		vipsUpscalerURL = fs.String("vips-upscaler-url", "",
+			"VIPS upscaling service URL e.g. Real-ESRGAN sidecar for enlargements, which accepts PNG by POST with scale query param and responds the enlarged image")
+		vipsUpscaleFactor = fs.Float64("vips-upscale-factor", 2,
+			"VIPS minimum enlargement factor that upscaling service is applied")
+		vipsRemoveBgURL = fs.String("vips-remove-bg-url", "",
+			"VIPS background removal service URL for remove_bg filter e.g. rembg, which accepts PNG by POST and responds foreground mask or cutout image")
+		vipsFontDir = fs.String("vips-font-dir", "",
+			"VIPS directory of TTF or OTF fonts for label filter, looked up by file name. Fonts not found are loaded as image key through loaders and storages")
+		vipsPreserveDepth = fs.Bool("vips-preserve-depth", false,
+			"VIPS keep 16-bit and HDR depth for output formats that support it e.g. PNG, TIFF, instead of flattening to 8-bit")
+		vipsStripMetadata = fs.Bool("vips-strip-metadata", false,
+			"VIPS strip EXIF, XMP and IPTC metadata of all outputs, same as strip_exif() filter. EXIF orientation is applied before stripping. Metadata are preserved if not set")
+		vipsStripICC = fs.Bool("vips-strip-icc", false,
+			"VIPS strip ICC profile of all outputs, same as strip_icc() filter. ICC profile is preserved if not set")
+		vipsEmbedSRGB = fs.Bool("vips-embed-srgb", false,
+			"VIPS embed compact sRGB profile in outputs converted from CMYK or ICC tagged sources. Converted outputs are untagged sRGB if not set")
+		vipsProgressive = fs.Bool("vips-progressive", false,
+			"VIPS encode progressive JPEG and interlaced PNG by default. Overridden by progressive(false) filter")
+		vipsLinear = fs.Bool("vips-linear", false,
+			"VIPS resample in linear light for gamma correct resizing. Slower as shrink-on-load is not applied")
+		vipsRawDecoder = fs.String("vips-raw-decoder", "",
+			"VIPS camera RAW decoder binary e.g. dcraw, dcraw_emu of libraw. Enables decoding of CR2, NEF, ARW, DNG etc")
+		vipsJxlDecoder = fs.String("vips-jxl-decoder", "",
+			"VIPS JPEG XL decoder binary i.e. djxl of libjxl. Enables decoding of JPEG XL")
+		vipsJxlEncoder = fs.String("vips-jxl-encoder", "",
+			"VIPS JPEG XL encoder binary i.e. cjxl of libjxl. Enables format(jxl) and -imagor-auto-jxl output")
 
 		logger, isDebug = cb()
+		detector        vipsprocessor.Detector
+		upscaler        vipsprocessor.Upscaler
+		segmenter       vipsprocessor.Segmenter
 	)
+	if *vipsFaceDetectorURL != "" {
+		detector = &vipsprocessor.HTTPDetector{URL: *vipsFaceDetectorURL}
+	}
+	if *vipsUpscalerURL != "" {
+		upscaler = &vipsprocessor.HTTPUpscaler{URL: *vipsUpscalerURL}
+	}
+	if *vipsRemoveBgURL != "" {
+		segmenter = &vipsprocessor.HTTPSegmenter{URL: *vipsRemoveBgURL}
+	}
 	return imagor.WithProcessors(
 		vipsprocessor.New(
 			vipsprocessor.WithMaxAnimationFrames(*vipsMaxAnimationFrames),
+			vipsprocessor.WithCollapseAnimation(*vipsCollapseAnimation),
 			vipsprocessor.WithDisableBlur(*vipsDisableBlur),
 			vipsprocessor.WithDisableFilters(*vipsDisableFilters),
 			vipsprocessor.WithConcurrency(*vipsConcurrency),
@@ -50,6 +103,25 @@ func WithVips(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			vipsprocessor.WithMaxHeight(*vipsMaxHeight),
 			vipsprocessor.WithMaxResolution(*vipsMaxResolution),
 			vipsprocessor.WithMozJPEG(*vipsMozJPEG),
+			vipsprocessor.WithAvifSpeed(*vipsAvifSpeed),
+			vipsprocessor.WithAvifQuality(*vipsAvifQuality),
+			vipsprocessor.WithSvgDPI(*vipsSvgDPI),
+			vipsprocessor.WithAutoQualityDSSIM(*vipsAutoQualityDSSIM),
+			vipsprocessor.WithSmartCrop(*vipsSmartCrop),
+			vipsprocessor.WithDetector(detector),
+			vipsprocessor.WithUpscaler(upscaler),
+			vipsprocessor.WithUpscaleFactor(*vipsUpscaleFactor),
+			vipsprocessor.WithSegmenter(segmenter),
+			vipsprocessor.WithFontDir(*vipsFontDir),
+			vipsprocessor.WithRawDecoder(*vipsRawDecoder),
+			vipsprocessor.WithJxlDecoder(*vipsJxlDecoder),
+			vipsprocessor.WithJxlEncoder(*vipsJxlEncoder),
+			vipsprocessor.WithPreserveDepth(*vipsPreserveDepth),
+			vipsprocessor.WithStripMetadata(*vipsStripMetadata),
+			vipsprocessor.WithStripICC(*vipsStripICC),
+			vipsprocessor.WithEmbedSRGB(*vipsEmbedSRGB),
+			vipsprocessor.WithProgressive(*vipsProgressive),
+			vipsprocessor.WithLinear(*vipsLinear),
 			vipsprocessor.WithLogger(logger),
 			vipsprocessor.WithDebug(isDebug),
 		),
@@ -4,6 +4,7 @@ import (
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/config"
 	"github.com/cshum/imagor/processor/vipsprocessor"
+	"github.com/davidbyttow/govips/v2/vips"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -11,10 +12,44 @@ import (
 func TestWithVips(t *testing.T) {
 	srv := config.CreateServer([]string{
 		"-vips-max-animation-frames", "167",
+		"-vips-collapse-animation",
+		"-vips-avif-speed", "7",
+		"-vips-avif-quality", "45",
+		"-vips-svg-dpi", "300",
+		"-vips-auto-quality-dssim", "0.002",
+		"-vips-smart-crop", "entropy",
+		"-vips-face-detector-url", "http://detector:8080/faces",
+		"-vips-upscaler-url", "http://upscaler:8080/upscale",
+		"-vips-upscale-factor", "3",
+		"-vips-remove-bg-url", "http://rembg:7000/api/remove",
+		"-vips-font-dir", "./fonts",
+		"-vips-jxl-decoder", "djxl",
+		"-vips-jxl-encoder", "cjxl",
+		"-vips-strip-metadata",
+		"-vips-strip-icc",
+		"-vips-embed-srgb",
+		"-vips-progressive",
 		"-vips-disable-filters", "blur,watermark,rgb",
 	}, WithVips)
 	app := srv.App.(*imagor.Imagor)
 	processor := app.Processors[0].(*vipsprocessor.VipsProcessor)
 	assert.Equal(t, 167, processor.MaxAnimationFrames)
+	assert.True(t, processor.CollapseAnimation)
+	assert.Equal(t, 7, processor.AvifSpeed)
+	assert.Equal(t, 45, processor.AvifQuality)
+	assert.Equal(t, 300, processor.SvgDPI)
+	assert.Equal(t, 0.002, processor.AutoQualityDSSIM)
+	assert.Equal(t, vips.InterestingEntropy, processor.SmartCrop)
+	assert.Equal(t, &vipsprocessor.HTTPDetector{URL: "http://detector:8080/faces"}, processor.Detector)
+	assert.Equal(t, &vipsprocessor.HTTPUpscaler{URL: "http://upscaler:8080/upscale"}, processor.Upscaler)
+	assert.Equal(t, 3.0, processor.UpscaleFactor)
+	assert.Equal(t, &vipsprocessor.HTTPSegmenter{URL: "http://rembg:7000/api/remove"}, processor.Segmenter)
+	assert.Equal(t, "./fonts", processor.FontDir)
+	assert.Equal(t, "djxl", processor.JxlDecoder)
+	assert.Equal(t, "cjxl", processor.JxlEncoder)
+	assert.True(t, processor.StripMetadata)
+	assert.True(t, processor.StripICC)
+	assert.True(t, processor.EmbedSRGB)
+	assert.True(t, processor.Progressive)
 	assert.Equal(t, []string{"blur", "watermark", "rgb"}, processor.DisableFilters)
 }
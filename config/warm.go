@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// WarmResult cache warming counters
+type WarmResult struct {
+	Warmed int64
+	Failed int64
+}
+
+// Warm imagor warm subcommand, pre-populates result storages
+// by processing every source image in the urls file with every preset
+func Warm(args []string, funcs ...Func) (res *WarmResult, err error) {
+	var (
+		fs     = flag.NewFlagSet("imagor warm", flag.ExitOnError)
+		logger *zap.Logger
+
+		debug = fs.Bool("debug", false, "Debug mode")
+		_     = fs.String("config", ".env", "Retrieve configuration from the given file")
+
+		urlsFile = fs.String("urls", "",
+			"File of source images to be warmed, one image per line")
+		presets = fs.String("presets", "",
+			"Presets to be applied to each image in csv. Accept preset names from preset file, or name=params e.g. thumb=fit-in/200x200")
+		presetFile = fs.String("preset-file", "",
+			"File of preset definitions, one preset per line in format of: name params")
+		accept = fs.String("accept", "",
+			"Accept header for warming requests e.g. image/webp for imagor-auto-webp variants")
+		concurrency = fs.Int("concurrency", 10,
+			"Number of images to be processed concurrently")
+	)
+
+	app := NewImagor(fs, func() (*zap.Logger, bool) {
+		logger = parseFlags(fs, args, debug)
+		return logger, *debug
+	}, funcs...)
+
+	defer func() {
+		if err != nil {
+			logger.Error("warm", zap.Error(err))
+		}
+	}()
+	if len(app.ResultStorages) == 0 {
+		return nil, errors.New("imagor: warm requires result storage")
+	}
+	defs, err := parsePresets(*presets, *presetFile)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := readLines(*urlsFile)
+	if err != nil {
+		return nil, err
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+
+	ctx := context.Background()
+	if err = app.Startup(ctx); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = app.Shutdown(ctx)
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		sema = make(chan struct{}, *concurrency)
+	)
+	res = &WarmResult{}
+	for _, image := range urls {
+		for _, params := range defs {
+			path := strings.Trim(params+"/"+image, "/")
+			sema <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sema
+					wg.Done()
+				}()
+				if err := warm(ctx, app, path, *accept); err != nil {
+					atomic.AddInt64(&res.Failed, 1)
+					logger.Warn("warm", zap.String("path", path), zap.Error(err))
+				} else {
+					atomic.AddInt64(&res.Warmed, 1)
+					logger.Debug("warm", zap.String("path", path))
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	logger.Info("warm",
+		zap.Int64("warmed", res.Warmed),
+		zap.Int64("failed", res.Failed))
+	return
+}
+
+func warm(ctx context.Context, app *imagor.Imagor, path, accept string) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return err
+	}
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	p := imagorpath.Parse(app.Signer.Sign(path) + "/" + path)
+	_, err = app.Do(r, p)
+	return err
+}
+
+// parsePresets resolves preset params from csv of preset names or name=params
+func parsePresets(presets, presetFile string) (defs []string, err error) {
+	var named = map[string]string{}
+	var order []string
+	if presetFile != "" {
+		lines, err := readLines(presetFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			if name, params, ok := strings.Cut(line, " "); ok {
+				named[name] = strings.TrimSpace(params)
+				order = append(order, name)
+			}
+		}
+	}
+	if strings.TrimSpace(presets) == "" {
+		for _, name := range order {
+			defs = append(defs, named[name])
+		}
+	}
+	for _, preset := range strings.Split(presets, ",") {
+		preset = strings.TrimSpace(preset)
+		if preset == "" {
+			continue
+		}
+		if name, params, ok := strings.Cut(preset, "="); ok && name != "" {
+			defs = append(defs, params)
+		} else if params, ok := named[preset]; ok {
+			defs = append(defs, params)
+		} else {
+			return nil, fmt.Errorf("imagor: warm preset not found: %s", preset)
+		}
+	}
+	if len(defs) == 0 {
+		return nil, errors.New("imagor: warm requires presets")
+	}
+	return
+}
+
+// readLines reads non-empty lines excluding # comments
+func readLines(filename string) (lines []string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"flag"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/webdavstorage"
+	"go.uber.org/zap"
+	"net/url"
+	"time"
+)
+
+func withWebDAV(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		webdavUsername = fs.String("webdav-username", "",
+			"WebDAV basic auth username")
+		webdavPassword = fs.String("webdav-password", "",
+			"WebDAV basic auth password")
+		webdavBearerToken = fs.String("webdav-bearer-token", "",
+			"WebDAV bearer token. Takes precedence over basic auth if present")
+		webdavSafeChars = fs.String("webdav-safe-chars", "",
+			"WebDAV safe characters to be excluded from image key escape")
+
+		webdavLoaderBaseURL = fs.String("webdav-loader-base-url", "",
+			"Base URL for WebDAV Loader e.g. https://cloud.example.com/remote.php/dav/files/user. Enable WebDAV Loader only if this value present")
+		webdavLoaderPathPrefix = fs.String("webdav-loader-path-prefix", "",
+			"Base path prefix for WebDAV Loader")
+
+		webdavStorageBaseURL = fs.String("webdav-storage-base-url", "",
+			"Base URL for WebDAV Storage. Enable WebDAV Storage only if this value present")
+		webdavStoragePathPrefix = fs.String("webdav-storage-path-prefix", "",
+			"Base path prefix for WebDAV Storage")
+		webdavStorageExpiration = fs.Duration("webdav-storage-expiration", 0,
+			"WebDAV Storage expiration duration e.g. 24h. Default no expiration")
+
+		webdavResultStorageBaseURL = fs.String("webdav-result-storage-base-url", "",
+			"Base URL for WebDAV Result Storage. Enable WebDAV Result Storage only if this value present")
+		webdavResultStoragePathPrefix = fs.String("webdav-result-storage-path-prefix", "",
+			"Base path prefix for WebDAV Result Storage")
+		webdavResultStorageExpiration = fs.Duration("webdav-result-storage-expiration", 0,
+			"WebDAV Result Storage expiration duration e.g. 24h. Default no expiration")
+
+		_, _ = cb()
+	)
+	newWebDAVStorage := func(baseURL, prefix string, exp time.Duration) *webdavstorage.WebDAVStorage {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			panic(err)
+		}
+		return webdavstorage.New(u,
+			webdavstorage.WithBasicAuth(*webdavUsername, *webdavPassword),
+			webdavstorage.WithBearerToken(*webdavBearerToken),
+			webdavstorage.WithPathPrefix(prefix),
+			webdavstorage.WithSafeChars(*webdavSafeChars),
+			webdavstorage.WithExpiration(exp),
+		)
+	}
+	return func(o *imagor.Imagor) {
+		if *webdavStorageBaseURL != "" {
+			// activate WebDAV Storage only if base URL config presents
+			o.Storages = append(o.Storages,
+				newWebDAVStorage(*webdavStorageBaseURL, *webdavStoragePathPrefix, *webdavStorageExpiration))
+		}
+		if *webdavLoaderBaseURL != "" {
+			// activate WebDAV Loader only if base URL config presents
+			if *webdavStorageBaseURL != *webdavLoaderBaseURL ||
+				*webdavStoragePathPrefix != *webdavLoaderPathPrefix {
+				// create another loader if different from storage
+				o.Loaders = append(o.Loaders,
+					newWebDAVStorage(*webdavLoaderBaseURL, *webdavLoaderPathPrefix, 0))
+			}
+		}
+		if *webdavResultStorageBaseURL != "" {
+			// activate WebDAV Result Storage only if base URL config presents
+			o.ResultStorages = append(o.ResultStorages,
+				newWebDAVStorage(*webdavResultStorageBaseURL, *webdavResultStoragePathPrefix, *webdavResultStorageExpiration))
+		}
+	}
+}
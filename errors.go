@@ -16,11 +16,16 @@ var (
 	ErrInvalid               = NewError("invalid", http.StatusBadRequest)
 	ErrMethodNotAllowed      = NewError("method not allowed", http.StatusMethodNotAllowed)
 	ErrSignatureMismatch     = NewError("url signature mismatch", http.StatusForbidden)
+	ErrUnauthorized          = NewError("unauthorized", http.StatusUnauthorized)
 	ErrTimeout               = NewError("timeout", http.StatusRequestTimeout)
 	ErrExpired               = NewError("expired", http.StatusGone)
 	ErrUnsupportedFormat     = NewError("unsupported format", http.StatusNotAcceptable)
 	ErrMaxSizeExceeded       = NewError("maximum size exceeded", http.StatusBadRequest)
+	ErrRequestTooLarge       = NewError("request entity too large", http.StatusRequestEntityTooLarge)
 	ErrMaxResolutionExceeded = NewError("maximum resolution exceeded", http.StatusUnprocessableEntity)
+	ErrTooComplex            = NewError("request too complex", http.StatusBadRequest)
+	ErrURITooLong            = NewError("uri too long", http.StatusRequestURITooLong)
+	ErrParamsTooLong         = NewError("params too long", http.StatusBadRequest)
 	ErrInternal              = NewError("internal error", http.StatusInternalServerError)
 )
 
@@ -0,0 +1,72 @@
+package imagor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// HealthChecker optional loader and storage interface reporting
+// whether the underlying origin or bucket is reachable
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// Health checks loaders and storages that implement HealthChecker concurrently,
+// returns error describing the unreachable ones
+func (app *Imagor) Health(ctx context.Context) error {
+	if app.LoadTimeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, app.LoadTimeout)
+		defer cancel()
+	}
+	var names []string
+	var checkers []HealthChecker
+	add := func(role string, v interface{}) {
+		checker, ok := v.(HealthChecker)
+		if !ok {
+			return
+		}
+		for _, c := range checkers {
+			if isSameInstance(c, checker) {
+				return
+			}
+		}
+		names = append(names, fmt.Sprintf("%s %s", role, getType(v)))
+		checkers = append(checkers, checker)
+	}
+	for _, loader := range app.Loaders {
+		add("loader", loader)
+	}
+	for _, storage := range app.Storages {
+		add("storage", storage)
+	}
+	for _, storage := range app.ResultStorages {
+		add("result-storage", storage)
+	}
+	for _, storage := range app.MetaStorages {
+		add("meta-storage", storage)
+	}
+	errs := make([]error, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func(i int, checker HealthChecker) {
+			defer wg.Done()
+			errs[i] = checker.Health(ctx)
+		}(i, checker)
+	}
+	wg.Wait()
+	var msgs []string
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, names[i]+": "+err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package imagor
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type healthStore struct {
+	*mapStore
+	err error
+}
+
+func (s *healthStore) Health(ctx context.Context) error {
+	return s.err
+}
+
+func TestHealth(t *testing.T) {
+	store := &healthStore{mapStore: newMapStore()}
+	resultStore := &healthStore{mapStore: newMapStore()}
+	app := New(
+		WithLoaders(store),
+		WithStorages(store),
+		WithResultStorages(resultStore, newMapStore()),
+	)
+	assert.NoError(t, app.Health(context.Background()))
+
+	resultStore.err = errors.New("bucket not found")
+	assert.EqualError(t, app.Health(context.Background()),
+		"result-storage healthStore: bucket not found")
+
+	store.err = errors.New("timeout")
+	assert.EqualError(t, app.Health(context.Background()),
+		"loader healthStore: timeout; result-storage healthStore: bucket not found")
+}
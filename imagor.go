@@ -1,17 +1,24 @@
 package imagor
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/andybalholm/brotli"
 	"github.com/cshum/imagor/imagorpath"
 	"go.uber.org/zap"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/sync/singleflight"
 	"io"
+	"net"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,6 +41,30 @@ type Storage interface {
 	Meta(ctx context.Context, key string) (*Meta, error)
 }
 
+// Lister optional storage interface for listing image keys under prefix,
+// iterates until fn returns error or all keys are visited
+type Lister interface {
+	List(ctx context.Context, prefix string, fn func(key string) error) error
+}
+
+// Expirer optional storage interface reporting whether stored object of stat has expired,
+// such that expired results can be swept from storages that implement Lister
+type Expirer interface {
+	Expired(stat *Stat) bool
+}
+
+// URLStorage optional storage interface resolving URL of stored object,
+// such that clients can be redirected to the storage directly
+type URLStorage interface {
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// ETagLoader optional loader interface resolving ETag of the source image from origin.
+// If etag is provided, conditional request is made and etag is returned as-is if not modified
+type ETagLoader interface {
+	ETag(r *http.Request, key, etag string) (string, error)
+}
+
 // LoadFunc load function for Processor
 type LoadFunc func(string) (*Blob, error)
 
@@ -49,6 +80,17 @@ type ResultKey interface {
 	Generate(p imagorpath.Params) string
 }
 
+// Worker background job running along Imagor lifecycle until ctx is cancelled,
+// e.g. queue consumer
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+// AuthFunc request authentication hook, invoked prior to processing,
+// as well as prior to webhook purges and uploads, with params of the upload key as image.
+// Returning error rejects the request, e.g. ErrUnauthorized
+type AuthFunc func(r *http.Request, p imagorpath.Params) error
+
 // Imagor image resize HTTP handler
 type Imagor struct {
 	Unsafe                bool
@@ -57,27 +99,71 @@ type Imagor struct {
 	Loaders               []Loader
 	Storages              []Storage
 	ResultStorages        []Storage
+	MetaStorages          []Storage
+	ResultStorageRepair   bool
+	ResultStorageRedirect bool
 	Processors            []Processor
+	NamedProcessors       map[string]Processor
 	RequestTimeout        time.Duration
 	LoadTimeout           time.Duration
 	SaveTimeout           time.Duration
 	ProcessTimeout        time.Duration
 	CacheHeaderTTL        time.Duration
 	CacheHeaderSWR        time.Duration
+	CacheHeaderSIE        time.Duration
+	CacheHeaderMinTTL     time.Duration
+	CacheHeaderMaxTTL     time.Duration
+	NotFoundPlaceholder   []byte
+	Favicon               []byte
+	RobotsTxt             []byte
+	WebhookPath           string
+	WebhookSecret         string
+	WebhookPresets        []string
+	UploadPath            string
+	UploadSigner          *UploadTokenSigner
+	UploadMaxSize         int64
+	SurrogateKeyHeader    string
+	SurrogateKeys         func(r *http.Request, p imagorpath.Params) []string
 	ProcessConcurrency    int64
 	AutoWebP              bool
 	AutoAVIF              bool
+	AutoJXL               bool
+	AutoFormatPriority    []string
+	AutoQualityHints      bool
+	DPRClientHints        bool
 	ModifiedTimeCheck     bool
+	MaxNestedDepth        int
+	ETagCheck             bool
 	DisableErrorBody      bool
 	DisableParamsEndpoint bool
 	BaseParams            string
 	Logger                *zap.Logger
 	Debug                 bool
 	ResultKey             ResultKey
+	ResultKeyNamespace    string
+	MaxFilters            int
+	MaxBlur               float64
+	MaxWatermarks         int
+	MaxLoads              int
+	MaxPathLength         int
+	MaxImageLength        int
+	MaxFilterArgsLength   int
+	AuthFunc              AuthFunc
+	UnsafeCIDRs           []*net.IPNet
+	UnsafePathPrefixes    []string
+	EnforcedWatermark     string
+	WatermarkExempt       func(r *http.Request) bool
+	SanitizeSVG           bool
+	FilterSchemas         imagorpath.FilterSchemas
+	SweepInterval         time.Duration
+	Metrics               Metrics
+	Workers               []Worker
 
 	g          singleflight.Group
 	sema       *semaphore.Weighted
 	baseParams imagorpath.Params
+	bgCancel   func()
+	bgWg       sync.WaitGroup
 }
 
 // New create new Imagor
@@ -90,6 +176,9 @@ func New(options ...Option) *Imagor {
 		ProcessTimeout: time.Second * 20,
 		CacheHeaderTTL: time.Hour * 24 * 7,
 		CacheHeaderSWR: time.Hour * 24,
+		UploadMaxSize:  32 << 20,
+
+		AutoFormatPriority: []string{"jxl", "avif", "webp"},
 	}
 	for _, option := range options {
 		option(app)
@@ -107,22 +196,152 @@ func New(options ...Option) *Imagor {
 	if app.BaseParams != "" {
 		app.BaseParams = strings.TrimSuffix(app.BaseParams, "/") + "/"
 	}
+	if app.ResultKeyNamespace == "auto" {
+		app.ResultKeyNamespace = app.autoNamespace()
+	}
 	return app
 }
 
+func (app *Imagor) isAutoFormat(format string) bool {
+	switch format {
+	case "jxl":
+		return app.AutoJXL
+	case "avif":
+		return app.AutoAVIF
+	case "webp":
+		return app.AutoWebP
+	}
+	return false
+}
+
+// qualityHint derives quality hint from Save-Data and ECT client hints
+func qualityHint(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get("Save-Data"), "on") {
+		return "save-data"
+	}
+	switch ect := strings.ToLower(r.Header.Get("ECT")); ect {
+	case "slow-2g", "2g", "3g":
+		return ect
+	}
+	return ""
+}
+
+// clientHintDPR device pixel ratio from Sec-CH-DPR or DPR client hints
+func clientHintDPR(r *http.Request) float64 {
+	if v := r.Header.Get("Sec-CH-DPR"); v != "" {
+		return imagorpath.ParseDPR(v)
+	}
+	return imagorpath.ParseDPR(r.Header.Get("DPR"))
+}
+
+// Versioner optional processor interface for version,
+// which is part of auto result key namespace
+type Versioner interface {
+	Version() string
+}
+
+// autoNamespace derives result key namespace from imagor version,
+// processors and their versions, and base params
+func (app *Imagor) autoNamespace() string {
+	h := sha1.New()
+	h.Write([]byte(Version))
+	for _, processor := range app.allProcessors() {
+		h.Write([]byte(getType(processor)))
+		if v, ok := processor.(Versioner); ok {
+			h.Write([]byte(v.Version()))
+		}
+	}
+	h.Write([]byte(app.BaseParams))
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// allProcessors default and named processors without duplicates
+func (app *Imagor) allProcessors() (processors []Processor) {
+	processors = append(processors, app.Processors...)
+	var names []string
+	for name := range app.NamedProcessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		processor := app.NamedProcessors[name]
+		var exists bool
+		for _, p := range processors {
+			if isSameInstance(p, processor) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			processors = append(processors, processor)
+		}
+	}
+	return
+}
+
+func isSameInstance(a, b interface{}) bool {
+	if t := reflect.TypeOf(a); t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// selectProcessors returns processors for params, routed by processor(name) filter if exists
+func (app *Imagor) selectProcessors(p imagorpath.Params) ([]Processor, error) {
+	for _, f := range p.Filters {
+		if f.Name == "processor" {
+			if processor, ok := app.NamedProcessors[strings.TrimSpace(f.Args)]; ok {
+				return []Processor{processor}, nil
+			}
+			return nil, ErrInvalid
+		}
+	}
+	return app.Processors, nil
+}
+
 // Startup Imagor startup lifecycle
 func (app *Imagor) Startup(ctx context.Context) (err error) {
-	for _, processor := range app.Processors {
+	for _, processor := range app.allProcessors() {
 		if err = processor.Startup(ctx); err != nil {
 			return
 		}
 	}
+	if app.SweepInterval > 0 || len(app.Workers) > 0 {
+		var bgCtx context.Context
+		bgCtx, app.bgCancel = context.WithCancel(context.Background())
+		if app.SweepInterval > 0 {
+			app.runBackground(bgCtx, app.sweepLoop)
+		}
+		for _, worker := range app.Workers {
+			app.runBackground(bgCtx, worker.Run)
+		}
+	}
 	return
 }
 
+func (app *Imagor) runBackground(ctx context.Context, fn func(ctx context.Context)) {
+	app.bgWg.Add(1)
+	go func() {
+		defer app.bgWg.Done()
+		fn(ctx)
+	}()
+}
+
 // Shutdown Imagor shutdown lifecycle
 func (app *Imagor) Shutdown(ctx context.Context) (err error) {
-	for _, processor := range app.Processors {
+	if app.bgCancel != nil {
+		app.bgCancel()
+		done := make(chan struct{})
+		go func() {
+			app.bgWg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	for _, processor := range app.allProcessors() {
 		if err = processor.Shutdown(ctx); err != nil {
 			return
 		}
@@ -132,14 +351,36 @@ func (app *Imagor) Shutdown(ctx context.Context) (err error) {
 
 // ServeHTTP implements http.Handler for Imagor operations
 func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if app.WebhookPath != "" && r.URL.Path == app.WebhookPath {
+		if app.authenticate(w, r, imagorpath.Params{}) {
+			app.serveWebhook(w, r)
+		}
+		return
+	}
+	if app.UploadSigner != nil && strings.HasPrefix(r.URL.Path, app.UploadPath+"/") {
+		if app.authenticate(w, r, imagorpath.Params{
+			Image: strings.Trim(strings.TrimPrefix(r.URL.Path, app.UploadPath), "/"),
+		}) {
+			app.serveUpload(w, r)
+		}
+		return
+	}
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 	path := r.URL.EscapedPath()
+	switch path {
+	case "/favicon.ico":
+		app.writeStatic(w, r, app.Favicon, "image/x-icon")
+		return
+	case "/robots.txt":
+		app.writeStatic(w, r, app.RobotsTxt, "text/plain; charset=utf-8")
+		return
+	}
 	if path == "/" || path == "" {
 		if app.BasePathRedirect == "" {
-			writeJSON(w, r, json.RawMessage(fmt.Sprintf(
+			writeJSON(w, r, http.StatusOK, json.RawMessage(fmt.Sprintf(
 				`{"imagor":{"version":"%s"}}`, Version,
 			)))
 		} else {
@@ -147,18 +388,44 @@ func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if app.MaxPathLength > 0 && len(path) > app.MaxPathLength {
+		if app.DisableErrorBody {
+			w.WriteHeader(ErrURITooLong.Code)
+		} else {
+			writeJSON(w, r, ErrURITooLong.Code, ErrURITooLong)
+		}
+		return
+	}
 	p := imagorpath.Parse(path)
 	if p.Params {
 		if !app.DisableParamsEndpoint {
-			writeJSONIndent(w, r, p)
+			writeJSONIndent(w, r, http.StatusOK, p)
 		}
 		return
 	}
+	if !app.authenticate(w, r, p) {
+		return
+	}
+	var origin *resultOrigin
+	if app.ResultStorageRedirect && !p.Meta {
+		origin = &resultOrigin{}
+		r = r.WithContext(context.WithValue(r.Context(), resultOriginKey{}, origin))
+	}
 	blob, err := checkBlob(app.Do(r, p))
 	if err == nil && p.Meta && blob != nil && blob.Meta != nil {
-		writeJSON(w, r, blob.Meta)
+		writeJSON(w, r, http.StatusOK, blob.Meta)
 		return
 	}
+	if err == nil && origin != nil && origin.storage != nil {
+		if u, e := origin.storage.URL(r.Context(), origin.key); e == nil && u != "" {
+			// storage URLs such as presigned URLs may expire, hence not cached
+			setCacheHeaders(w, 0, 0, 0)
+			http.Redirect(w, r, u, http.StatusFound)
+			return
+		} else if e != nil {
+			app.Logger.Warn("result-url", zap.String("key", origin.key), zap.Error(e))
+		}
+	}
 	if !isBlobEmpty(blob) {
 		w.Header().Set("Content-Type", blob.ContentType())
 	}
@@ -168,6 +435,14 @@ func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		e := WrapError(err)
+		if e.Code == http.StatusNotFound && len(app.NotFoundPlaceholder) > 0 {
+			placeholder := NewBlobFromBytes(app.NotFoundPlaceholder)
+			reader, size, _ := placeholder.NewReader()
+			w.Header().Set("Content-Type", placeholder.ContentType())
+			setCacheHeaders(w, 0, 0, 0)
+			writeBody(w, r, reader, size)
+			return
+		}
 		if app.DisableErrorBody {
 			w.WriteHeader(e.Code)
 			return
@@ -180,41 +455,121 @@ func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
-		w.WriteHeader(e.Code)
-		writeJSON(w, r, e)
+		writeJSON(w, r, e.Code, e)
 		return
 	}
 	if isBlobEmpty(blob) {
 		return
 	}
 	reader, size, _ := blob.NewReader()
-	setCacheHeaders(w, app.CacheHeaderTTL, app.CacheHeaderSWR)
+	if app.AutoQualityHints {
+		w.Header().Add("Vary", "Save-Data, ECT")
+	}
+	if app.DPRClientHints {
+		w.Header().Set("Accept-CH", "Sec-CH-DPR, DPR")
+		w.Header().Add("Vary", "Sec-CH-DPR, DPR")
+	}
+	ttl, swr := app.cacheHeaderTTL(p)
+	setCacheHeaders(w, ttl, swr, app.CacheHeaderSIE)
+	if app.SurrogateKeyHeader != "" {
+		app.setSurrogateKeys(w, r, p)
+	}
 	writeBody(w, r, reader, size)
 	return
 }
 
+// authenticate invokes AuthFunc if configured, writes error response if rejected
+func (app *Imagor) authenticate(w http.ResponseWriter, r *http.Request, p imagorpath.Params) bool {
+	if app.AuthFunc == nil {
+		return true
+	}
+	if err := app.AuthFunc(r, p); err != nil {
+		e := WrapError(err)
+		if app.DisableErrorBody {
+			w.WriteHeader(e.Code)
+		} else {
+			writeJSON(w, r, e.Code, e)
+		}
+		return false
+	}
+	return true
+}
+
+// isRawParams raw() filter present, unless watermark is applied
+// such that enforced watermarks cannot be bypassed
+func isRawParams(p imagorpath.Params) (raw bool) {
+	for _, f := range p.Filters {
+		switch f.Name {
+		case "raw":
+			raw = true
+		case "watermark":
+			return false
+		}
+	}
+	return
+}
+
 // Do executes Imagor operations
 func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err error) {
 	var ctx = WithDefer(r.Context())
+	if app.MaxLoads > 0 {
+		ctx = withLoadCount(ctx)
+		r = r.WithContext(ctx)
+	}
 	var cancel func()
 	if app.RequestTimeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, app.RequestTimeout)
 		Defer(ctx, cancel)
 		r = r.WithContext(ctx)
 	}
-	if !(app.Unsafe && p.Unsafe) && app.Signer != nil && app.Signer.Sign(p.Path) != p.Hash {
+	if !(app.Unsafe && p.Unsafe && app.allowUnsafe(r, p)) && app.Signer != nil && !imagorpath.Verify(app.Signer, p.Path, p.Hash) {
 		err = ErrSignatureMismatch
 		if app.Debug {
 			app.Logger.Debug("sign-mismatch", zap.Any("params", p), zap.String("expected", app.Signer.Sign(p.Path)))
 		}
 		return
 	}
+	if err = app.checkLimits(p); err != nil {
+		return
+	}
+	if app.FilterSchemas != nil {
+		if p, err = app.FilterSchemas.Normalize(p); err != nil {
+			err = NewError(err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// dpr(n) filter, fallback to DPR client hints if enabled
+	var dpr float64
+	if app.DPRClientHints {
+		dpr = clientHintDPR(r)
+	}
+	p = imagorpath.ApplyDPR(p, dpr)
 	if app.BaseParams != "" {
 		p = imagorpath.Apply(p, app.BaseParams)
 		p.Path = imagorpath.GeneratePath(p)
 	}
-	// auto WebP / AVIF
-	if app.AutoWebP || app.AutoAVIF {
+	// enforced watermark on top level request unless exempted,
+	// not on nested sources e.g. watermark or composite images
+	if app.EnforcedWatermark != "" && nestedDepth(r.Context()) == 0 &&
+		(app.WatermarkExempt == nil || !app.WatermarkExempt(r)) {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "watermark",
+			Args: app.EnforcedWatermark,
+		})
+		p.Path = imagorpath.GeneratePath(p)
+	}
+	if !p.Meta && isRawParams(p) {
+		// raw() passthrough streams source image unmodified without processing
+		if blob, _, err = app.loadSource(r, p.Image); err != nil || isBlobEmpty(blob) {
+			return
+		}
+		if app.SanitizeSVG && blob.BlobType() == BlobTypeSVG {
+			blob, err = sanitizeSVGBlob(blob)
+		}
+		return
+	}
+	// auto JXL / AVIF / WebP
+	if app.AutoWebP || app.AutoAVIF || app.AutoJXL {
 		var hasFormat bool
 		for _, f := range p.Filters {
 			if f.Name == "format" {
@@ -223,31 +578,49 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 		}
 		if !hasFormat {
 			accept := r.Header.Get("Accept")
-			if app.AutoAVIF && strings.Contains(accept, "image/avif") {
-				p.Filters = append(p.Filters, imagorpath.Filter{
-					Name: "format",
-					Args: "avif",
-				})
-				p.Path = imagorpath.GeneratePath(p)
-			} else if app.AutoWebP && strings.Contains(accept, "image/webp") {
-				p.Filters = append(p.Filters, imagorpath.Filter{
-					Name: "format",
-					Args: "webp",
-				})
-				p.Path = imagorpath.GeneratePath(p)
+			for _, format := range app.AutoFormatPriority {
+				if app.isAutoFormat(format) && strings.Contains(accept, "image/"+format) {
+					p.Filters = append(p.Filters, imagorpath.Filter{
+						Name: "format",
+						Args: format,
+					})
+					p.Path = imagorpath.GeneratePath(p)
+					break
+				}
 			}
 		}
 	}
+	// Save-Data / ECT client hints for quality(auto)
+	if app.AutoQualityHints {
+		if hint := qualityHint(r); hint != "" {
+			var filters imagorpath.Filters
+			for _, f := range p.Filters {
+				if f.Name == "quality" && f.Args == "auto" {
+					f.Args = "auto," + hint
+				}
+				filters = append(filters, f)
+			}
+			p.Filters = filters
+			p.Path = imagorpath.GeneratePath(p)
+		}
+	}
 	var resultKey string
 	if app.ResultKey != nil {
 		resultKey = app.ResultKey.Generate(p)
 	} else {
 		resultKey = strings.TrimPrefix(p.Path, "meta/")
 	}
-	load := func(image string) (*Blob, error) {
-		b, _, err := app.loadStorage(r, image)
-		return b, err
+	if app.ResultKeyNamespace != "" {
+		resultKey = app.ResultKeyNamespace + "/" + resultKey
 	}
+	processors, err := app.selectProcessors(p)
+	if err != nil {
+		return
+	}
+	load := app.limitLoad(ctx, func(image string) (*Blob, error) {
+		b, _, err := app.loadSource(r, image)
+		return b, err
+	})
 	if p.Meta {
 		if blob := app.loadResult(r, resultKey, p.Image, true); blob != nil {
 			return blob, nil
@@ -259,7 +632,8 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 				return blob, nil
 			}
 		}
-		if app.sema != nil {
+		if app.sema != nil && nestedDepth(ctx) == 0 {
+			// nested requests run within the acquired slot of parent request
 			if err = app.sema.Acquire(ctx, 1); err != nil {
 				app.Logger.Debug("acquire", zap.Error(err))
 				return blob, err
@@ -267,19 +641,20 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 			defer app.sema.Release(1)
 		}
 		var isSave bool
-		if blob, isSave, err = app.loadStorage(r, p.Image); err != nil {
+		if blob, isSave, err = app.loadSource(r, p.Image); err != nil {
 			app.Logger.Debug("load", zap.Any("params", p), zap.Error(err))
 			return blob, err
 		}
 		if isBlobEmpty(blob) {
 			return blob, err
 		}
+		var source = blob
 		var cancel func()
 		if app.ProcessTimeout > 0 {
 			ctx, cancel = context.WithTimeout(ctx, app.ProcessTimeout)
 			Defer(ctx, cancel)
 		}
-		for _, processor := range app.Processors {
+		for _, processor := range processors {
 			b, e := checkBlob(processor.Process(ctx, blob, p, load))
 			if e == nil {
 				blob = b
@@ -306,8 +681,32 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 				}
 			}
 		}
-		if err == nil && len(app.ResultStorages) > 0 {
-			app.save(ctx, app.ResultStorages, resultKey, blob)
+		if app.SanitizeSVG && !isBlobEmpty(blob) && blob.BlobType() == BlobTypeSVG {
+			// untrusted SVG passthrough sanitized before being served or stored
+			if blob, err = sanitizeSVGBlob(blob); err != nil {
+				app.Logger.Warn("sanitize-svg", zap.Any("params", p), zap.Error(err))
+			}
+		}
+		if err == nil {
+			if p.Meta && len(app.MetaStorages) > 0 {
+				if blob.Meta != nil {
+					// meta storages keep meta only without the image
+					metaBlob := NewEmptyBlob()
+					metaBlob.Meta = blob.Meta
+					app.save(ctx, app.MetaStorages, resultKey, metaBlob)
+					if app.isPurgeable() {
+						app.indexResult(ctx, app.MetaStorages, p.Image, resultKey)
+					}
+				}
+			} else if len(app.ResultStorages) > 0 {
+				if app.ModifiedTimeCheck && app.ETagCheck {
+					app.setSourceETag(r, p.Image, source, blob)
+				}
+				app.save(ctx, app.ResultStorages, resultKey, blob)
+				if app.isPurgeable() {
+					app.indexResult(ctx, app.ResultStorages, p.Image, resultKey)
+				}
+			}
 		}
 		if err != nil && isSave {
 			app.del(ctx, app.Storages, p.Image)
@@ -331,25 +730,123 @@ func (app *Imagor) loadStorage(r *http.Request, key string) (*Blob, bool, error)
 	return b, isSave, err
 }
 
+type nestedDepthKey struct{}
+
+func nestedDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(nestedDepthKey{}).(int)
+	return depth
+}
+
+// loadSource loads source image, or output of nested imagor path as image source
+// if the image key is a signed imagor path, or unsafe path if allowed
+func (app *Imagor) loadSource(r *http.Request, key string) (*Blob, bool, error) {
+	if app.MaxNestedDepth > 0 {
+		if p := imagorpath.Parse(key); p.Image != "" &&
+			((app.Unsafe && p.Unsafe) || (app.Signer != nil && p.Hash != "" && imagorpath.Verify(app.Signer, p.Path, p.Hash))) {
+			depth := nestedDepth(r.Context())
+			if depth >= app.MaxNestedDepth {
+				return nil, false, ErrTooComplex
+			}
+			blob, err := app.Do(r.WithContext(context.WithValue(r.Context(), nestedDepthKey{}, depth+1)), p)
+			return blob, false, err
+		}
+	}
+	return app.loadStorage(r, key)
+}
+
+type resultOriginKey struct{}
+
+// resultOrigin result storage serving the top level request,
+// for redirecting clients to the storage if URLStorage implemented
+type resultOrigin struct {
+	storage URLStorage
+	key     string
+}
+
+func setResultOrigin(ctx context.Context, origin Storage, resultKey string) {
+	if o, ok := ctx.Value(resultOriginKey{}).(*resultOrigin); ok && nestedDepth(ctx) == 0 {
+		if s, ok := origin.(URLStorage); ok {
+			o.storage = s
+			o.key = resultKey
+		}
+	}
+}
+
 func (app *Imagor) loadResult(r *http.Request, resultKey, imageKey string, metaMode bool) *Blob {
 	ctx := r.Context()
-	blob, origin, err := app.load(r, app.ResultStorages, nil, resultKey, metaMode)
+	storages := app.ResultStorages
+	if metaMode && len(app.MetaStorages) > 0 {
+		storages = app.MetaStorages
+	}
+	blob, origin, err := app.load(r, storages, nil, resultKey, metaMode)
 	if err == nil && (!isBlobEmpty(blob) || metaMode) {
 		if app.ModifiedTimeCheck && origin != nil {
-			if resStat, err1 := origin.Stat(ctx, resultKey); resStat != nil && err1 == nil {
+			start := time.Now()
+			resStat, err1 := origin.Stat(ctx, resultKey)
+			app.observe(origin, "stat", start, 0, err1)
+			if resStat != nil && err1 == nil {
 				if sourceStat, err2 := app.storageStat(ctx, imageKey); sourceStat != nil && err2 == nil {
-					if !resStat.ModifiedTime.Before(sourceStat.ModifiedTime) {
-						return blob
+					if !resStat.ModifiedTime.Before(sourceStat.ModifiedTime) &&
+						(!app.ETagCheck || app.isETagMatch(r, origin, resultKey, imageKey)) {
+						setResultOrigin(ctx, origin, resultKey)
+						return app.repairResult(r, storages, origin, resultKey, blob, metaMode)
 					}
 				}
 			}
 		} else {
-			return blob
+			setResultOrigin(ctx, origin, resultKey)
+			return app.repairResult(r, storages, origin, resultKey, blob, metaMode)
 		}
 	}
 	return nil
 }
 
+// repairResult copies result served by fallback storage back into the
+// preceding storages in background, given result storage repair enabled.
+// Result is buffered as storage blobs may not be readable after request ends
+func (app *Imagor) repairResult(
+	r *http.Request, storages []Storage, origin Storage, resultKey string, blob *Blob, metaMode bool,
+) *Blob {
+	if !app.ResultStorageRepair || origin == nil || metaMode {
+		return blob
+	}
+	var missed []Storage
+	for _, storage := range storages {
+		if isSameInstance(storage, origin) {
+			break
+		}
+		missed = append(missed, storage)
+	}
+	if len(missed) == 0 || len(missed) == len(storages) {
+		return blob
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return blob
+	}
+	res := NewBlobFromBytes(buf)
+	res.Meta = blob.Meta
+	if res.Meta == nil {
+		// meta of result e.g. source ETag is kept along with the copies
+		start := time.Now()
+		meta, err := origin.Meta(r.Context(), resultKey)
+		app.observe(origin, "meta", start, 0, err)
+		if err == nil {
+			res.Meta = meta
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = WithDefer(ctx)
+	go func() {
+		defer cancel()
+		app.save(ctx, missed, resultKey, res)
+		if app.Debug {
+			app.Logger.Debug("repaired", zap.String("key", resultKey), zap.Int("storages", len(missed)))
+		}
+	}()
+	return res
+}
+
 func (app *Imagor) load(
 	r *http.Request, storages []Storage, loaders []Loader, key string, metaMode bool,
 ) (blob *Blob, origin Storage, err error) {
@@ -366,7 +863,9 @@ func (app *Imagor) load(
 	}
 	if metaMode {
 		for _, storage := range storages {
+			start := time.Now()
 			m, e := storage.Meta(ctx, key)
+			app.observe(storage, "meta", start, 0, e)
 			if e == nil && m != nil {
 				blob = NewEmptyBlob()
 				blob.Meta = m
@@ -377,7 +876,9 @@ func (app *Imagor) load(
 		}
 	} else {
 		for _, storage := range storages {
+			start := time.Now()
 			b, e := checkBlob(storage.Get(r, key))
+			app.observe(storage, "get", start, blobSize(b), e)
 			if !isBlobEmpty(b) {
 				blob = b
 				if e == nil {
@@ -389,7 +890,9 @@ func (app *Imagor) load(
 			err = e
 		}
 		for _, loader := range loaders {
+			start := time.Now()
 			b, e := checkBlob(loader.Get(r, key))
+			app.observe(loader, "get", start, blobSize(b), e)
 			if !isBlobEmpty(b) {
 				blob = b
 				if e == nil {
@@ -415,13 +918,65 @@ func (app *Imagor) load(
 
 func (app *Imagor) storageStat(ctx context.Context, key string) (stat *Stat, err error) {
 	for _, storage := range app.Storages {
-		if stat, err = storage.Stat(ctx, key); stat != nil && err == nil {
+		start := time.Now()
+		stat, err = storage.Stat(ctx, key)
+		app.observe(storage, "stat", start, 0, err)
+		if stat != nil && err == nil {
 			return
 		}
 	}
 	return
 }
 
+// isETagMatch checks source ETag recorded in meta of the result against the current source ETag,
+// catching source replacements that keep identical modified time
+func (app *Imagor) isETagMatch(r *http.Request, origin Storage, resultKey, imageKey string) bool {
+	start := time.Now()
+	meta, err := origin.Meta(r.Context(), resultKey)
+	app.observe(origin, "meta", start, 0, err)
+	if err != nil || meta == nil || meta.SourceETag == "" {
+		// no ETag recorded, fallback to modified time only
+		return true
+	}
+	current := app.sourceETag(r, imageKey, meta.SourceETag)
+	return current == "" || current == meta.SourceETag
+}
+
+// setSourceETag records source ETag in meta of the result, as reported by loader upon load.
+// Origin is only requested if loader has not reported one e.g. source served by storage.
+// Results without meta are left with modified time check only
+func (app *Imagor) setSourceETag(r *http.Request, imageKey string, source, result *Blob) {
+	if result.Meta == nil {
+		return
+	}
+	etag := source.ETag()
+	if etag == "" {
+		etag = app.sourceETag(r, imageKey, "")
+	}
+	if etag == "" {
+		return
+	}
+	meta := *result.Meta
+	meta.SourceETag = etag
+	result.Meta = &meta
+}
+
+// sourceETag resolves ETag of source image from origin loaders,
+// fallback to ETag of source storages
+func (app *Imagor) sourceETag(r *http.Request, key, etag string) string {
+	for _, loader := range app.Loaders {
+		if l, ok := loader.(ETagLoader); ok {
+			if current, err := l.ETag(r, key, etag); err == nil && current != "" {
+				return current
+			}
+		}
+	}
+	if stat, err := app.storageStat(r.Context(), key); stat != nil && err == nil {
+		return stat.ETag
+	}
+	return ""
+}
+
 func (app *Imagor) save(ctx context.Context, storages []Storage, key string, blob *Blob) {
 	var cancel func()
 	if app.SaveTimeout > 0 {
@@ -433,7 +988,10 @@ func (app *Imagor) save(ctx context.Context, storages []Storage, key string, blo
 		wg.Add(1)
 		go func(storage Storage) {
 			defer wg.Done()
-			if err := storage.Put(ctx, key, blob); err != nil {
+			start := time.Now()
+			err := storage.Put(ctx, key, blob)
+			app.observe(storage, "put", start, blobSize(blob), err)
+			if err != nil {
 				app.Logger.Warn("save", zap.String("key", key), zap.Error(err))
 			} else if app.Debug {
 				app.Logger.Debug("saved", zap.String("key", key))
@@ -450,7 +1008,10 @@ func (app *Imagor) del(ctx context.Context, storages []Storage, key string) {
 		wg.Add(1)
 		go func(storage Storage) {
 			defer wg.Done()
-			if err := storage.Delete(ctx, key); err != nil {
+			start := time.Now()
+			err := storage.Delete(ctx, key)
+			app.observe(storage, "delete", start, 0, err)
+			if err != nil {
 				app.Logger.Warn("delete", zap.String("key", key), zap.Error(err))
 			} else if app.Debug {
 				app.Logger.Debug("deleted", zap.String("key", key))
@@ -504,7 +1065,7 @@ func (app *Imagor) debugLog() {
 	if !app.Debug {
 		return
 	}
-	var loaders, storages, resultStorages, processors []string
+	var loaders, storages, resultStorages, metaStorages, processors []string
 	for _, v := range app.Loaders {
 		loaders = append(loaders, getType(v))
 	}
@@ -514,9 +1075,15 @@ func (app *Imagor) debugLog() {
 	for _, v := range app.Processors {
 		processors = append(processors, getType(v))
 	}
+	for name, v := range app.NamedProcessors {
+		processors = append(processors, name+":"+getType(v))
+	}
 	for _, v := range app.ResultStorages {
 		resultStorages = append(resultStorages, getType(v))
 	}
+	for _, v := range app.MetaStorages {
+		metaStorages = append(metaStorages, getType(v))
+	}
 	app.Logger.Debug("imagor",
 		zap.String("version", Version),
 		zap.Bool("unsafe", app.Unsafe),
@@ -529,18 +1096,80 @@ func (app *Imagor) debugLog() {
 		zap.Strings("loaders", loaders),
 		zap.Strings("storages", storages),
 		zap.Strings("result_storages", resultStorages),
+		zap.Strings("meta_storages", metaStorages),
 		zap.Strings("processors", processors),
 	)
 }
 
-func setCacheHeaders(w http.ResponseWriter, ttl, swr time.Duration) {
+// cacheHeaderTTL cache header ttl and swr, overridden by expire(seconds) filter
+// within CacheHeaderMinTTL and CacheHeaderMaxTTL bounds
+func (app *Imagor) cacheHeaderTTL(p imagorpath.Params) (ttl, swr time.Duration) {
+	ttl, swr = app.CacheHeaderTTL, app.CacheHeaderSWR
+	for _, f := range p.Filters {
+		if f.Name != "expire" {
+			continue
+		}
+		if sec, err := strconv.Atoi(strings.TrimSpace(f.Args)); err == nil && sec >= 0 {
+			ttl = time.Duration(sec) * time.Second
+			if ttl < app.CacheHeaderMinTTL {
+				ttl = app.CacheHeaderMinTTL
+			}
+			if app.CacheHeaderMaxTTL > 0 && ttl > app.CacheHeaderMaxTTL {
+				ttl = app.CacheHeaderMaxTTL
+			}
+		}
+	}
+	return
+}
+
+// writeStatic writes static content, or 204 if content is empty
+func (app *Imagor) writeStatic(w http.ResponseWriter, r *http.Request, buf []byte, contentType string) {
+	setCacheHeaders(w, app.CacheHeaderTTL, app.CacheHeaderSWR, app.CacheHeaderSIE)
+	if len(buf) == 0 {
+		// empty 200 if not set, as of prior favicon.ico handler
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(buf)
+	}
+}
+
+// SurrogateKey escapes key for Surrogate-Key or Cache-Tag header,
+// such that CDN purge requests can derive the same key from image
+func SurrogateKey(key string) string {
+	return surrogateKeyReplacer.Replace(strings.TrimPrefix(key, "/"))
+}
+
+var surrogateKeyReplacer = strings.NewReplacer(" ", "%20", ",", "%2C", "%", "%25")
+
+func (app *Imagor) setSurrogateKeys(w http.ResponseWriter, r *http.Request, p imagorpath.Params) {
+	keys := []string{SurrogateKey(p.Image)}
+	if app.SurrogateKeys != nil {
+		for _, key := range app.SurrogateKeys(r, p) {
+			if key != "" {
+				keys = append(keys, SurrogateKey(key))
+			}
+		}
+	}
+	sep := " "
+	if strings.EqualFold(app.SurrogateKeyHeader, "Cache-Tag") {
+		// Cloudflare Cache-Tag is comma separated
+		sep = ","
+	}
+	w.Header().Set(app.SurrogateKeyHeader, strings.Join(keys, sep))
+}
+
+func setCacheHeaders(w http.ResponseWriter, ttl, swr, sie time.Duration) {
 	expires := time.Now().Add(ttl)
 
 	w.Header().Add("Expires", strings.Replace(expires.Format(time.RFC1123), "UTC", "GMT", -1))
-	w.Header().Add("Cache-Control", getCacheControl(ttl, swr))
+	w.Header().Add("Cache-Control", getCacheControl(ttl, swr, sie))
 }
 
-func getCacheControl(ttl, swr time.Duration) string {
+func getCacheControl(ttl, swr, sie time.Duration) string {
 	if ttl == 0 {
 		return "private, no-cache, no-store, must-revalidate"
 	}
@@ -549,27 +1178,93 @@ func getCacheControl(ttl, swr time.Duration) string {
 	if swr > 0 && swr < ttl {
 		val += fmt.Sprintf(", stale-while-revalidate=%d", int64(swr.Seconds()))
 	}
+	if sie > 0 {
+		val += fmt.Sprintf(", stale-if-error=%d", int64(sie.Seconds()))
+	}
 	return val
 }
 
-func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+// minCompressSize minimum JSON response size for compression
+const minCompressSize = 1024
+
+// writeJSON writes JSON response of status code,
+// headers are set prior to status code such that they are not dropped
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
 	buf, _ := json.Marshal(v)
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
-	if r.Method != http.MethodHead {
-		_, _ = w.Write(buf)
-	}
-	return
+	writeJSONBuf(w, r, code, buf)
 }
 
-func writeJSONIndent(w http.ResponseWriter, r *http.Request, v interface{}) {
+func writeJSONIndent(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
 	buf, _ := json.MarshalIndent(v, "", "  ")
+	writeJSONBuf(w, r, code, buf)
+}
+
+func writeJSONBuf(w http.ResponseWriter, r *http.Request, code int, buf []byte) {
 	w.Header().Set("Content-Type", "application/json")
+	if len(buf) >= minCompressSize {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if enc := acceptEncoding(r, "br", "gzip"); enc != "" {
+			var b bytes.Buffer
+			var cw io.WriteCloser
+			if enc == "br" {
+				cw = brotli.NewWriterLevel(&b, brotli.DefaultCompression)
+			} else {
+				cw = gzip.NewWriter(&b)
+			}
+			if _, err := cw.Write(buf); err == nil && cw.Close() == nil {
+				w.Header().Set("Content-Encoding", enc)
+				buf = b.Bytes()
+			}
+		}
+	}
 	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(code)
 	if r.Method != http.MethodHead {
 		_, _ = w.Write(buf)
 	}
-	return
+}
+
+// acceptEncoding negotiates content encoding from request Accept-Encoding
+// with the highest q-value among supported encodings in order of preference.
+// Encodings not listed are accepted by the q-value of "*" if present.
+// Returns empty string if none is acceptable
+func acceptEncoding(r *http.Request, supported ...string) string {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return ""
+	}
+	qs := map[string]float64{}
+	for _, enc := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(enc, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, val, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = v
+				} else {
+					q = 0
+				}
+			}
+		}
+		qs[name] = q
+	}
+	var best string
+	var bestQ float64
+	for _, name := range supported {
+		q, ok := qs[name]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
 }
 
 func writeBody(w http.ResponseWriter, r *http.Request, reader io.ReadCloser, size int64) {
@@ -2,11 +2,13 @@ package imagor
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/andybalholm/brotli"
 	"github.com/cshum/imagor/imagorpath"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,6 +17,8 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -297,6 +301,19 @@ func TestWithCacheHeaderTTL(t *testing.T) {
 		assert.Equal(t, 200, w.Code)
 		assert.Equal(t, "public, s-maxage=169, max-age=169, no-transform", w.Header().Get("Cache-Control"))
 	})
+	t.Run("custom ttl swr sie", func(t *testing.T) {
+		app := New(
+			WithCacheHeaderSWR(time.Second*167),
+			WithCacheHeaderTTL(time.Second*169),
+			WithCacheHeaderSIE(time.Hour*24),
+			WithLoaders(loader),
+			WithUnsafe(true))
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/unsafe/foo.jpg", nil))
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "public, s-maxage=169, max-age=169, no-transform, stale-while-revalidate=167, stale-if-error=86400", w.Header().Get("Cache-Control"))
+	})
 	t.Run("no cache", func(t *testing.T) {
 		app := New(
 			WithDebug(true),
@@ -310,6 +327,40 @@ func TestWithCacheHeaderTTL(t *testing.T) {
 		assert.NotEmpty(t, w.Header().Get("Expires"))
 		assert.Equal(t, "private, no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
 	})
+	t.Run("expire filter", func(t *testing.T) {
+		app := New(
+			WithLoaders(loader),
+			WithCacheHeaderSWR(time.Second*60),
+			WithCacheHeaderMinTTL(time.Second*30),
+			WithCacheHeaderMaxTTL(time.Hour),
+			WithUnsafe(true))
+		tests := []struct {
+			path     string
+			expected string
+		}{
+			{"filters:expire(300)/foo.jpg", "public, s-maxage=300, max-age=300, no-transform, stale-while-revalidate=60"},
+			{"filters:expire(10)/foo.jpg", "public, s-maxage=30, max-age=30, no-transform"},
+			{"filters:expire(86400)/foo.jpg", "public, s-maxage=3600, max-age=3600, no-transform, stale-while-revalidate=60"},
+			{"filters:expire(abc)/foo.jpg", "public, s-maxage=604800, max-age=604800, no-transform, stale-while-revalidate=60"},
+		}
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(
+				http.MethodGet, "https://example.com/unsafe/"+tt.path, nil))
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tt.expected, w.Header().Get("Cache-Control"), tt.path)
+		}
+	})
+	t.Run("expire filter no cache", func(t *testing.T) {
+		app := New(
+			WithLoaders(loader),
+			WithUnsafe(true))
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/unsafe/filters:expire(0)/foo.jpg", nil))
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "private, no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+	})
 }
 
 func TestVersion(t *testing.T) {
@@ -721,6 +772,75 @@ func TestWithModifiedTimeCheck(t *testing.T) {
 	assert.Equal(t, 2, resultStore.SaveCnt["foo"])
 }
 
+type etagLoader struct {
+	etag string
+	cnt  int
+}
+
+func (l *etagLoader) Get(r *http.Request, image string) (*Blob, error) {
+	blob := NewBlobFromBytes([]byte(image + l.etag))
+	blob.SetETag(l.etag)
+	return blob, nil
+}
+
+func (l *etagLoader) ETag(r *http.Request, image, etag string) (string, error) {
+	l.cnt++
+	return l.etag, nil
+}
+
+func TestWithETagCheck(t *testing.T) {
+	store := newMapStore()
+	resultStore := newMapStore()
+	loader := &etagLoader{etag: "a"}
+	app := New(
+		WithStorages(store),
+		WithResultStorages(resultStore),
+		WithLoaders(loader),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			buf, _ := blob.ReadAll()
+			b := NewBlobFromBytes(buf)
+			b.Meta = &Meta{Format: "jpeg", ContentType: "image/jpeg"}
+			return b, nil
+		})),
+		WithUnsafe(true),
+		WithModifiedTimeCheck(true),
+		WithETagCheck(true),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/unsafe/foo", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fooa", w.Body.String())
+	assert.Equal(t, 1, resultStore.SaveCnt["foo"])
+	assert.Equal(t, "a", resultStore.Map["foo"].Meta.SourceETag, "should record ETag in result meta")
+	assert.Equal(t, 0, loader.cnt, "should use ETag reported upon load")
+	assert.Len(t, resultStore.Map, 1)
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/unsafe/foo", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fooa", w.Body.String())
+	assert.Equal(t, 1, resultStore.LoadCnt["foo"])
+	assert.Equal(t, 1, resultStore.SaveCnt["foo"])
+	assert.Equal(t, 1, loader.cnt)
+
+	// source replaced with identical modified time
+	loader.etag = "b"
+	store.Map["foo"] = NewBlobFromBytes([]byte("foob"))
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/unsafe/foo", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foob", w.Body.String())
+	assert.Equal(t, 2, resultStore.LoadCnt["foo"])
+	assert.Equal(t, 2, resultStore.SaveCnt["foo"])
+	assert.Equal(t, "b", resultStore.Map["foo"].Meta.SourceETag)
+	// source served by storage, ETag requested from origin
+	assert.Equal(t, 3, loader.cnt)
+}
+
 func TestWithSameStore(t *testing.T) {
 	store := newMapStore()
 	app := New(
@@ -753,6 +873,108 @@ func TestWithSameStore(t *testing.T) {
 	})
 }
 
+// putNotifyStore notifies puts, for storages written in background
+type putNotifyStore struct {
+	*mapStore
+	puts chan string
+}
+
+func (s *putNotifyStore) Put(ctx context.Context, image string, blob *Blob) error {
+	err := s.mapStore.Put(ctx, image, blob)
+	s.puts <- image
+	return err
+}
+
+func TestWithResultStorageRepair(t *testing.T) {
+	primary := &putNotifyStore{mapStore: newMapStore(), puts: make(chan string, 10)}
+	secondary := newMapStore()
+	var processed int
+	app := New(
+		WithUnsafe(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("foo")), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			processed++
+			return NewBlobFromBytes([]byte("bar")), nil
+		})),
+		WithResultStorages(primary, secondary),
+		WithResultStorageRepair(true),
+	)
+	serve := func() string {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/abc.png", nil))
+		assert.Equal(t, 200, w.Code)
+		return w.Body.String()
+	}
+	assert.Equal(t, "bar", serve())
+	assert.Equal(t, 1, processed)
+	assert.Equal(t, "abc.png", <-primary.puts)
+
+	// primary lost the result, served by secondary then repaired
+	delete(primary.Map, "abc.png")
+	assert.Equal(t, "bar", serve())
+	assert.Equal(t, 1, processed)
+	assert.Equal(t, 1, secondary.LoadCnt["abc.png"])
+	select {
+	case key := <-primary.puts:
+		assert.Equal(t, "abc.png", key)
+	case <-time.After(time.Second):
+		t.Fatal("primary not repaired")
+	}
+	assert.Equal(t, 2, primary.SaveCnt["abc.png"])
+
+	// served by primary afterwards
+	assert.Equal(t, "bar", serve())
+	assert.Equal(t, 1, primary.LoadCnt["abc.png"])
+	assert.Equal(t, 1, secondary.LoadCnt["abc.png"])
+	assert.Equal(t, 1, processed)
+}
+
+// urlStore mapStore resolving URL of stored object
+type urlStore struct {
+	*mapStore
+}
+
+func (s *urlStore) URL(ctx context.Context, image string) (string, error) {
+	return "https://storage.example.com/" + image, nil
+}
+
+func TestWithResultStorageRedirect(t *testing.T) {
+	resultStore := &urlStore{mapStore: newMapStore()}
+	var processed int
+	app := New(
+		WithUnsafe(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("foo")), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			processed++
+			return NewBlobFromBytes([]byte("bar")), nil
+		})),
+		WithResultStorages(resultStore),
+		WithResultStorageRedirect(true),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/abc.png", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "bar", w.Body.String())
+	assert.Equal(t, 1, processed)
+
+	// stored result redirected to storage URL
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/abc.png", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://storage.example.com/abc.png", w.Header().Get("Location"))
+	assert.Equal(t, "private, no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+	assert.Equal(t, 1, processed)
+
+	// meta served as-is
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/meta/abc.png", nil))
+	assert.NotEqual(t, http.StatusFound, w.Code)
+}
+
 func TestBaseParams(t *testing.T) {
 	app := New(
 		WithDebug(true),
@@ -1033,3 +1255,812 @@ func TestSuppression(t *testing.T) {
 	}
 	assert.NotEqual(t, resMap["a"], resMap["b"])
 }
+
+func TestWithMetaStorages(t *testing.T) {
+	resultStore := newMapStore()
+	metaStore := newMapStore()
+	fakeMeta := &Meta{Format: "a", ContentType: "b", Width: 167, Height: 167}
+	app := New(
+		WithDebug(true), WithLogger(zap.NewExample()),
+		WithResultStorages(resultStore),
+		WithMetaStorages(metaStore),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			blob.Meta = fakeMeta
+			return blob, nil
+		})),
+		WithUnsafe(true),
+	)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/unsafe/meta/foo", nil))
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, jsonStr(fakeMeta), w.Body.String())
+	}
+	assert.Equal(t, 1, metaStore.SaveCnt["foo"])
+	assert.True(t, metaStore.Map["foo"].IsEmpty())
+	assert.Equal(t, 0, resultStore.SaveCnt["foo"])
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/unsafe/foo", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Equal(t, 1, resultStore.SaveCnt["foo"])
+	assert.Equal(t, 1, metaStore.SaveCnt["foo"])
+}
+
+func TestWithLimits(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithMaxFilters(3),
+		WithMaxBlur(10),
+		WithMaxWatermarks(1),
+		WithMaxLoads(2),
+		WithMaxNestedDepth(1),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			for _, f := range p.Filters {
+				if f.Name == "watermark" || f.Name == "load" {
+					if _, err := load(f.Args); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return blob, nil
+		})),
+	)
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/unsafe/filters:blur(5):blur(5):watermark(a.jpg)/foo", 200},
+		{"/unsafe/filters:blur(5):blur(5):blur(1)/foo", 400},
+		{"/unsafe/filters:blur(11,2)/foo", 400},
+		{"/unsafe/filters:a():b():c():d()/foo", 400},
+		{"/unsafe/filters:watermark(a.jpg):watermark(b.jpg)/foo", 400},
+		{"/unsafe/filters:load(a.jpg):load(b.jpg)/foo", 200},
+		{"/unsafe/filters:load(a.jpg):load(b.jpg):load(c.jpg)/foo", 400},
+		{"/unsafe/filters:load(a.jpg)/unsafe/filters:load(b.jpg)/foo", 200},
+		{"/unsafe/filters:load(a.jpg)/unsafe/filters:load(b.jpg):load(c.jpg)/foo", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+tt.path, nil))
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestWithMaxLengths(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithMaxPathLength(60),
+		WithMaxImageLength(20),
+		WithMaxFilterArgsLength(10),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+	)
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/unsafe/filters:fill(white)/foo.jpg", 200},
+		{"/unsafe/filters:fill(white)/" + strings.Repeat("a", 60), 414},
+		{"/unsafe/" + strings.Repeat("a", 21), 400},
+		{"/unsafe/%61%61%61%61%61%61%61%61%61%61%61%61", 200},
+		{"/unsafe/filters:fill(lightgoldenrodyellow)/foo.jpg", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+tt.path, nil))
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestWithAuthFunc(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithAuthFunc(func(r *http.Request, p imagorpath.Params) error {
+			if len(p.Filters) > 0 && r.Header.Get("X-Api-Key") != "secret" {
+				return ErrUnauthorized
+			}
+			return nil
+		}),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+	)
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo.jpg", w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:fill(white)/foo.jpg", nil))
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, jsonStr(ErrUnauthorized), w.Body.String())
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:fill(white)/foo.jpg", nil)
+	r.Header.Set("X-Api-Key", "secret")
+	app.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo.jpg", w.Body.String())
+}
+
+func TestWithAuthFuncUploadWebhook(t *testing.T) {
+	buf, err := os.ReadFile("testdata/demo1.jpg")
+	require.NoError(t, err)
+	store := newMapStore()
+	var authed []imagorpath.Params
+	app := New(
+		WithStorages(store),
+		WithAuthFunc(func(r *http.Request, p imagorpath.Params) error {
+			authed = append(authed, p)
+			if r.Header.Get("X-Api-Key") != "secret" {
+				return ErrUnauthorized
+			}
+			return nil
+		}),
+		WithUpload("/upload", "s3cr3t"),
+		WithWebhook("/webhook", "s3cr3t"),
+	)
+	token, err := NewUploadTokenSigner("s3cr3t").Sign(UploadScope{}, time.Minute)
+	require.NoError(t, err)
+	body := []byte(`{"images":["a.jpg"]}`)
+	for _, key := range []string{"", "secret"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "https://example.com/upload/a.jpg", bytes.NewReader(buf))
+		r.Header.Set(UploadTokenHeader, token)
+		r.Header.Set("X-Api-Key", key)
+		app.ServeHTTP(w, r)
+		if key == "" {
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Empty(t, store.Map)
+		} else {
+			assert.Equal(t, http.StatusCreated, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "https://example.com/webhook", bytes.NewReader(body))
+		r.Header.Set(WebhookSignatureHeader, SignWebhook("s3cr3t", body))
+		r.Header.Set("X-Api-Key", key)
+		app.ServeHTTP(w, r)
+		if key == "" {
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		} else {
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+	}
+	assert.Equal(t, []imagorpath.Params{{Image: "a.jpg"}, {}, {Image: "a.jpg"}, {}}, authed)
+}
+
+func TestWithUnsafeRestrictions(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithUnsafeCIDRs("127.0.0.1", "10.0.0.0/8", "invalid"),
+		WithUnsafePathPrefixes("debug/", "/images"),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+	)
+	assert.Len(t, app.UnsafeCIDRs, 2)
+	tests := []struct {
+		remoteAddr string
+		path       string
+		code       int
+	}{
+		{"127.0.0.1:1234", "/unsafe/debug/foo.jpg", 200},
+		{"10.1.2.3:1234", "/unsafe/debug/foo.jpg", 200},
+		{"10.1.2.3:1234", "/unsafe/foo.jpg", 403},
+		{"10.1.2.3:1234", "/unsafe/images/foo.jpg", 200},
+		{"10.1.2.3:1234", "/unsafe/images-private/secret.jpg", 403},
+		{"10.1.2.3:1234", "/unsafe/debugger/foo.jpg", 403},
+		{"192.168.1.1:1234", "/unsafe/debug/foo.jpg", 403},
+		{"127.0.0.2:1234", "/unsafe/debug/foo.jpg", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://example.com"+tt.path, nil)
+			r.RemoteAddr = tt.remoteAddr
+			app.ServeHTTP(w, r)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestWithEnforcedWatermark(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithEnforcedWatermark("logo.png,repeat,bottom,10", func(r *http.Request) bool {
+			return r.Header.Get("X-Imagor-Key") == "secret"
+		}),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			return NewBlobFromBytes([]byte(p.Path)), nil
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/fit-in/100x100/foo.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fit-in/100x100/filters:watermark(logo.png,repeat,bottom,10)/foo.jpg", w.Body.String())
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/fit-in/100x100/foo.jpg", nil)
+	r.Header.Set("X-Imagor-Key", "secret")
+	app.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fit-in/100x100/foo.jpg", w.Body.String())
+}
+
+func TestWithEnforcedWatermarkNested(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithMaxNestedDepth(2),
+		WithEnforcedWatermark("logo.png", nil),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			buf, err := blob.ReadAll()
+			if err != nil {
+				return nil, err
+			}
+			return NewBlobFromBytes([]byte(p.Path + "|" + string(buf))), nil
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/fit-in/100x100/unsafe/10x10/foo.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fit-in/100x100/filters:watermark(logo.png)/unsafe/10x10/foo.jpg|10x10/foo.jpg|foo.jpg", w.Body.String())
+}
+
+func TestRawPassthrough(t *testing.T) {
+	resultStore := newMapStore()
+	var processed int
+	app := New(
+		WithUnsafe(true),
+		WithResultStorages(resultStore),
+		WithEnforcedWatermark("logo.png", func(r *http.Request) bool {
+			return r.Header.Get("X-Imagor-Key") == "secret"
+		}),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes(TransparentPixel), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			processed++
+			return NewBlobFromBytes([]byte(p.Path)), nil
+		})),
+	)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:raw()/foo.png", nil)
+	r.Header.Set("X-Imagor-Key", "secret")
+	app.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, TransparentPixel, w.Body.Bytes())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.NotEmpty(t, w.Header().Get("Cache-Control"))
+	assert.Equal(t, 0, processed)
+	assert.Empty(t, resultStore.Map)
+
+	// enforced watermark not bypassed
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:raw()/foo.png", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "filters:raw():watermark(logo.png)/foo.png", w.Body.String())
+	assert.Equal(t, 1, processed)
+}
+
+func TestWithSanitizeSVG(t *testing.T) {
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><script>alert(2)</script><rect width="10" height="10"/></svg>`
+	app := New(
+		WithUnsafe(true),
+		WithSanitizeSVG(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(svg)), nil
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo.svg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Equal(t, `<svg xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10"></rect></svg>`, w.Body.String())
+}
+
+func TestWithFilterSchemas(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithFilterSchemas(imagorpath.DefaultFilterSchemas),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			return NewBlobFromBytes([]byte(p.Path)), nil
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:quality(080)/foo.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "filters:quality(80)/foo.jpg", w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:quality(200)/foo.jpg", nil))
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, jsonStr(NewError("invalid filter quality amount: must be between 0 and 100", 400)), w.Body.String())
+}
+
+func TestAutoJXL(t *testing.T) {
+	factory := func(options ...Option) *Imagor {
+		return New(append([]Option{
+			WithUnsafe(true),
+			WithAutoJXL(true),
+			WithAutoAVIF(true),
+			WithAutoWebP(true),
+			WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+				return NewBlobFromBytes([]byte("foo")), nil
+			})),
+			WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+				return NewBlobFromBytes([]byte(p.Path)), nil
+			})),
+		}, options...)...)
+	}
+	tests := []struct {
+		name     string
+		app      *Imagor
+		accept   string
+		expected string
+	}{
+		{
+			name:     "jxl preferred",
+			app:      factory(),
+			accept:   "image/jxl,image/avif,image/webp,*/*",
+			expected: "filters:format(jxl)/abc.png",
+		},
+		{
+			name:     "avif fallback",
+			app:      factory(),
+			accept:   "image/avif,image/webp,*/*",
+			expected: "filters:format(avif)/abc.png",
+		},
+		{
+			name:     "jxl not enabled",
+			app:      factory(WithAutoJXL(false)),
+			accept:   "image/jxl,image/webp,*/*",
+			expected: "filters:format(webp)/abc.png",
+		},
+		{
+			name:     "custom priority",
+			app:      factory(WithAutoFormatPriority("webp", "avif", "jxl")),
+			accept:   "image/jxl,image/avif,image/webp,*/*",
+			expected: "filters:format(webp)/abc.png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/abc.png", nil)
+			r.Header.Set("Accept", tt.accept)
+			tt.app.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
+
+func TestWithAutoQualityHints(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithAutoQualityHints(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("foo")), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			return NewBlobFromBytes([]byte(p.Path)), nil
+		})),
+	)
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		path     string
+		expected string
+	}{
+		{"no hint", "", "", "filters:quality(auto)/abc.png", "filters:quality(auto)/abc.png"},
+		{"save data", "Save-Data", "on", "filters:quality(auto)/abc.png", "filters:quality(auto,save-data)/abc.png"},
+		{"ect", "ECT", "3g", "filters:quality(auto)/abc.png", "filters:quality(auto,3g)/abc.png"},
+		{"ect fast", "ECT", "4g", "filters:quality(auto)/abc.png", "filters:quality(auto)/abc.png"},
+		{"explicit quality", "Save-Data", "on", "filters:quality(90)/abc.png", "filters:quality(90)/abc.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/"+tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			app.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+			assert.Equal(t, "Save-Data, ECT", w.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestWithDPRClientHints(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithDPRClientHints(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("foo")), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			return NewBlobFromBytes([]byte(p.Path)), nil
+		})),
+	)
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		path     string
+		expected string
+	}{
+		{"no hint", "", "", "fit-in/100x50/abc.png", "fit-in/100x50/abc.png"},
+		{"dpr filter", "", "", "fit-in/100x50/filters:dpr(2)/abc.png", "fit-in/200x100/abc.png"},
+		{"sec-ch-dpr", "Sec-CH-DPR", "2", "fit-in/100x50/abc.png", "fit-in/200x100/abc.png"},
+		{"dpr", "DPR", "1.5", "fit-in/100x50/abc.png", "fit-in/150x75/abc.png"},
+		{"dpr filter precedence", "DPR", "3", "fit-in/100x50/filters:dpr(1)/abc.png", "fit-in/100x50/abc.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/"+tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			app.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+			assert.Equal(t, "Sec-CH-DPR, DPR", w.Header().Get("Accept-CH"))
+		})
+	}
+}
+
+func TestWriteJSONGzip(t *testing.T) {
+	app := New(WithUnsafe(true))
+	path := "https://example.com/params/unsafe/" + strings.Repeat("a", 1200) + ".jpg"
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	expected := w.Body.String()
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	app.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+	gr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(buf))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	app.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+	buf, err = io.ReadAll(brotli.NewReader(w.Body))
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(buf))
+
+	for _, header := range []string{"gzip;q=0", "*;q=0", "gzip;q=0, *"} {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", header)
+		app.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code)
+		if header == "gzip;q=0, *" {
+			assert.Equal(t, "br", w.Header().Get("Content-Encoding"), header)
+		} else {
+			assert.Empty(t, w.Header().Get("Content-Encoding"), header)
+			assert.Equal(t, expected, w.Body.String(), header)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "https://example.com/params/unsafe/foo.jpg", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	app.ServeHTTP(w, r)
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "should not compress small response")
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"gzip;q=1.0, br;q=0.8", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip; q=0.000", ""},
+		{"GZIP;Q=0", ""},
+		{"gzip;q=0, br", "br"},
+		{"*", "br"},
+		{"*;q=0", ""},
+		{"*;q=0, gzip", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"gzip;q=0, *;q=0.5", "br"},
+		{"gzip;q=boom", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		assert.Equal(t, tt.expected, acceptEncoding(r, "br", "gzip"), tt.header)
+	}
+}
+
+func TestWriteJSONGzipErrorStatus(t *testing.T) {
+	message := strings.Repeat("a", 1200)
+	app := New(
+		WithUnsafe(true),
+		WithAuthFunc(func(r *http.Request, p imagorpath.Params) error {
+			return NewError(message, http.StatusForbidden)
+		}),
+	)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo.jpg", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	app.ServeHTTP(w, r)
+	// headers as sent along with status code
+	res := w.Result()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), res.Header.Get("Content-Length"))
+	gr, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, `{"message":"`+message+`","status":403}`, string(buf))
+}
+
+func TestWithSurrogateKeyHeader(t *testing.T) {
+	loader := loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+		return NewBlobFromBytes([]byte("foo")), nil
+	})
+	app := New(
+		WithUnsafe(true),
+		WithLoaders(loader),
+		WithSurrogateKeyHeader("Surrogate-Key", func(r *http.Request, p imagorpath.Params) []string {
+			return []string{"tenant-a"}
+		}),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/fit-in/100x100/foo%20bar.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo%20bar.jpg tenant-a", w.Header().Get("Surrogate-Key"))
+
+	app = New(
+		WithUnsafe(true),
+		WithLoaders(loader),
+		WithSurrogateKeyHeader("Cache-Tag", func(r *http.Request, p imagorpath.Params) []string {
+			return []string{"tenant-a"}
+		}),
+	)
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/100x100/a/b.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "a/b.jpg,tenant-a", w.Header().Get("Cache-Tag"))
+	assert.Equal(t, "a%2Cb%2525.jpg", SurrogateKey("/a,b%25.jpg"))
+}
+
+func TestStaticHandlers(t *testing.T) {
+	app := New(WithRobotsTxt([]byte("User-agent: *\nDisallow: /\n")))
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/favicon.ico", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/robots.txt", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "https://example.com/robots.txt", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "https://example.com/", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestWithNotFoundPlaceholder(t *testing.T) {
+	app := New(
+		WithUnsafe(true),
+		WithNotFoundPlaceholder(TransparentPixel),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			if image == "foo.jpg" {
+				return NewBlobFromBytes([]byte("foo")), nil
+			}
+			return nil, ErrNotFound
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/bar.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "private, no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+	assert.Equal(t, TransparentPixel, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo.jpg", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo", w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/foo.jpg", nil))
+	assert.Equal(t, 403, w.Code, "should not apply to other errors")
+}
+
+type namedProcessor struct {
+	name    string
+	started int
+}
+
+func (p *namedProcessor) Startup(_ context.Context) error {
+	p.started++
+	return nil
+}
+
+func (p *namedProcessor) Process(_ context.Context, _ *Blob, _ imagorpath.Params, _ LoadFunc) (*Blob, error) {
+	return NewBlobFromBytes([]byte(p.name)), nil
+}
+
+func (p *namedProcessor) Shutdown(_ context.Context) error {
+	p.started--
+	return nil
+}
+
+func TestWithNamedProcessor(t *testing.T) {
+	foo := &namedProcessor{name: "foo"}
+	bar := &namedProcessor{name: "bar"}
+	app := New(
+		WithUnsafe(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("abc")), nil
+		})),
+		WithProcessors(foo),
+		WithNamedProcessor("foo", foo),
+		WithNamedProcessor("bar", bar),
+	)
+	require.NoError(t, app.Startup(context.Background()))
+	assert.Equal(t, 1, foo.started)
+	assert.Equal(t, 1, bar.started)
+
+	tests := []struct {
+		path     string
+		code     int
+		expected string
+	}{
+		{"/unsafe/abc.jpg", 200, "foo"},
+		{"/unsafe/filters:processor(bar)/abc.jpg", 200, "bar"},
+		{"/unsafe/filters:processor(foo)/abc.jpg", 200, "foo"},
+		{"/unsafe/filters:processor(baz)/abc.jpg", 400, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+tt.path, nil))
+			assert.Equal(t, tt.code, w.Code)
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, w.Body.String())
+			}
+		})
+	}
+	require.NoError(t, app.Shutdown(context.Background()))
+	assert.Equal(t, 0, foo.started)
+	assert.Equal(t, 0, bar.started)
+}
+
+func TestWithResultKeyNamespace(t *testing.T) {
+	resultStore := newMapStore()
+	app := New(
+		WithResultStorages(resultStore),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithResultKeyNamespace("/v2/"),
+		WithUnsafe(true),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/unsafe/fit-in/100x100/foo", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Equal(t, 1, resultStore.SaveCnt["v2/fit-in/100x100/foo"])
+
+	auto1 := New(WithResultKeyNamespace("auto"), WithProcessors(&namedProcessor{name: "a"}))
+	auto2 := New(WithResultKeyNamespace("auto"), WithProcessors(&namedProcessor{name: "b"}))
+	auto3 := New(WithResultKeyNamespace("auto"), WithProcessors(&namedProcessor{name: "a"}),
+		WithBaseParams("filters:quality(70)"))
+	assert.Len(t, auto1.ResultKeyNamespace, 8)
+	assert.Equal(t, auto1.ResultKeyNamespace, auto2.ResultKeyNamespace)
+	assert.NotEqual(t, auto1.ResultKeyNamespace, auto3.ResultKeyNamespace)
+}
+
+func TestWithMaxNestedDepth(t *testing.T) {
+	resultStore := newMapStore()
+	signer := imagorpath.NewDefaultSigner("1234")
+	sign := func(path string) string {
+		return signer.Sign(path) + "/" + path
+	}
+	app := New(
+		WithSigner(signer),
+		WithResultStorages(resultStore),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			buf, _ := blob.ReadAll()
+			return NewBlobFromBytes([]byte("(" + string(buf) + ")")), nil
+		})),
+		WithMaxNestedDepth(1),
+	)
+	inner := sign("fit-in/20x20/foo")
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/"+sign("fit-in/10x10/"+inner), nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "((foo))", w.Body.String())
+	assert.Equal(t, 1, resultStore.SaveCnt["fit-in/20x20/foo"])
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/"+sign("fit-in/30x30/"+inner), nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "((foo))", w.Body.String())
+	assert.Equal(t, 1, resultStore.LoadCnt["fit-in/20x20/foo"])
+	assert.Equal(t, 1, resultStore.SaveCnt["fit-in/20x20/foo"])
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/"+sign("fit-in/10x10/"+sign("fit-in/40x40/"+inner)), nil))
+	assert.Equal(t, ErrTooComplex.Code, w.Code)
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "https://example.com/"+sign("fit-in/10x10/abcdefghijk/fit-in/20x20/foo"), nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "(abcdefghijk/fit-in/20x20/foo)", w.Body.String())
+}
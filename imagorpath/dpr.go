@@ -0,0 +1,52 @@
+package imagorpath
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxDPR maximum device pixel ratio applicable
+const MaxDPR = 5
+
+// ParseDPR parses device pixel ratio value, returns 0 if invalid
+func ParseDPR(s string) float64 {
+	dpr, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || dpr <= 0 || math.IsNaN(dpr) {
+		return 0
+	}
+	return math.Min(dpr, MaxDPR)
+}
+
+// ApplyDPR consumes dpr(n) filter if exists, otherwise applies the fallback dpr,
+// multiplying requested dimensions and paddings by device pixel ratio
+func ApplyDPR(p Params, fallback float64) Params {
+	dpr := fallback
+	var filters Filters
+	var hasFilter bool
+	for _, f := range p.Filters {
+		if f.Name == "dpr" {
+			dpr = ParseDPR(f.Args)
+			hasFilter = true
+			continue
+		}
+		filters = append(filters, f)
+	}
+	if !hasFilter && (dpr <= 0 || dpr == 1) {
+		return p
+	}
+	p.Filters = filters
+	if dpr > 0 && dpr != 1 {
+		scale := func(v int) int {
+			return int(math.Round(float64(v) * dpr))
+		}
+		p.Width = scale(p.Width)
+		p.Height = scale(p.Height)
+		p.PaddingLeft = scale(p.PaddingLeft)
+		p.PaddingTop = scale(p.PaddingTop)
+		p.PaddingRight = scale(p.PaddingRight)
+		p.PaddingBottom = scale(p.PaddingBottom)
+	}
+	p.Path = GeneratePath(p)
+	return p
+}
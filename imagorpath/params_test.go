@@ -3,10 +3,18 @@ package imagorpath
 import (
 	"crypto/sha256"
 	"encoding/json"
-	"github.com/stretchr/testify/assert"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseGenerate(t *testing.T) {
@@ -284,3 +292,193 @@ func TestHMACSigner(t *testing.T) {
 	signer := NewHMACSigner(sha256.New, 28, "abcd")
 	assert.Equal(t, signer.Sign("assfasf"), "zb6uWXQxwJDOe_zOgxkuj96Etrsz")
 }
+
+func TestDigestResultKey(t *testing.T) {
+	key := NewDigestResultKey(nil, 0)
+	p := Parse("/unsafe/fit-in/200x200/filters:quality(80):format(webp)/https://example.com/foo%20bar.jpg?v=1")
+	assert.Equal(t, "2c5fd4220fd4f8d6f11dffd5a45801781b3cc235-q80.webp", key.Generate(p))
+	p.Meta = true
+	assert.Equal(t, "2c5fd4220fd4f8d6f11dffd5a45801781b3cc235-q80.webp", key.Generate(p), "should share key with meta")
+
+	assert.Equal(t, "33/47/3347b1305a897ed0d57130dd574fe7032a9e65ae.png",
+		NewDigestResultKey(nil, 2).Generate(Parse("/unsafe/100x100/gopher.PNG")))
+	assert.Equal(t, 64, len(NewDigestResultKey(sha256.New, 0).Generate(Parse("/unsafe/100x100/gopher"))))
+}
+
+func TestHMACSignerWithProvider(t *testing.T) {
+	signer := NewHMACSignerWithProvider(sha256.New, 28, StaticSecret("abcd"))
+	assert.Equal(t, signer.Sign("assfasf"), "zb6uWXQxwJDOe_zOgxkuj96Etrsz")
+
+	var cnt int
+	provider := NewCachedSecretProvider(func() (string, error) {
+		cnt++
+		if cnt > 1 {
+			return "", errors.New("unavailable")
+		}
+		return "abcd", nil
+	}, 0)
+	signer = NewHMACSignerWithProvider(sha256.New, 28, provider)
+	assert.Equal(t, signer.Sign("assfasf"), "zb6uWXQxwJDOe_zOgxkuj96Etrsz")
+	assert.Equal(t, signer.Sign("assfasf"), "zb6uWXQxwJDOe_zOgxkuj96Etrsz", "should retain last known secret")
+
+	signer = NewHMACSignerWithProvider(sha256.New, 28, StaticSecret(""))
+	assert.NotEqual(t, NewHMACSigner(sha256.New, 28, "").Sign("assfasf"), signer.Sign("assfasf"),
+		"should not sign with empty secret")
+}
+
+func TestHMACSignerWithRotationProvider(t *testing.T) {
+	secret := "abcd"
+	provider := NewRotationSecretProvider(NewCachedSecretProvider(func() (string, error) {
+		return secret, nil
+	}, 0), time.Hour)
+	signer := NewHMACSignerWithProvider(sha256.New, 28, provider)
+	oldHash := signer.Sign("assfasf")
+	assert.Equal(t, "zb6uWXQxwJDOe_zOgxkuj96Etrsz", oldHash)
+	assert.True(t, Verify(signer, "assfasf", oldHash))
+	assert.False(t, Verify(signer, "assfasf", "zb6uWXQxwJDOe_zOgxkuj96Etrsa"))
+
+	secret = "efgh"
+	newHash := signer.Sign("assfasf")
+	assert.NotEqual(t, oldHash, newHash)
+	assert.True(t, Verify(signer, "assfasf", newHash))
+	assert.True(t, Verify(signer, "assfasf", oldHash), "should accept previous secret within grace period")
+	assert.False(t, Verify(signer, "assfasf", NewHMACSigner(sha256.New, 28, "ijkl").Sign("assfasf")))
+
+	provider.(*rotationSecretProvider).rotated = time.Now().Add(-time.Hour * 2)
+	assert.True(t, Verify(signer, "assfasf", newHash))
+	assert.False(t, Verify(signer, "assfasf", oldHash), "should reject previous secret beyond grace period")
+
+	// signer without Verifier falls back to Sign
+	assert.True(t, Verify(NewDefaultSigner("abcd"), "assfasf", NewDefaultSigner("abcd").Sign("assfasf")))
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	provider := NewFileSecretProvider(file, 0)
+	_, err := provider.Secret()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(file, []byte("abcd\n"), 0600))
+	secret, err := provider.Secret()
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", secret)
+
+	require.NoError(t, os.WriteFile(file, []byte("efgh"), 0600))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+	secret, err = provider.Secret()
+	require.NoError(t, err)
+	assert.Equal(t, "efgh", secret)
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "mytoken" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/imagor":
+			_, _ = w.Write([]byte(`{"data":{"data":{"secret":"abcd"},"metadata":{"version":1}}}`))
+		case "/v1/kv/imagor":
+			_, _ = w.Write([]byte(`{"data":{"key":"efgh"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	secret, err := NewVaultSecretProvider(ts.URL, "mytoken", "secret/data/imagor", "secret", time.Minute).Secret()
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", secret)
+
+	secret, err = NewVaultSecretProvider(ts.URL, "mytoken", "/kv/imagor", "key", time.Minute).Secret()
+	require.NoError(t, err)
+	assert.Equal(t, "efgh", secret)
+
+	_, err = NewVaultSecretProvider(ts.URL, "mytoken", "kv/imagor", "secret", time.Minute).Secret()
+	assert.Error(t, err)
+
+	_, err = NewVaultSecretProvider(ts.URL, "wrong", "kv/imagor", "key", time.Minute).Secret()
+	assert.Error(t, err)
+}
+
+func TestFilterSchemas(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect string
+		err    string
+	}{
+		{path: "filters:quality(080):format(WEBP)/foo.jpg", expect: "filters:quality(80):format(webp)/foo.jpg"},
+		{path: "filters:fill(auto,bottom-right):blur(2.50)/foo.jpg", expect: "filters:fill(auto,bottom-right):blur(2.5)/foo.jpg"},
+		{path: "filters:watermark(logo.png,-10p,center,50,20,none):grayscale()/foo.jpg", expect: "filters:watermark(logo.png,-10p,center,50,20,none):grayscale()/foo.jpg"},
+		{path: "filters:custom(whatever,args)/foo.jpg", expect: "filters:custom(whatever,args)/foo.jpg"},
+		{path: "filters:quality(101)/foo.jpg", err: "invalid filter quality amount: must be between 0 and 100"},
+		{path: "filters:quality(abc)/foo.jpg", err: "invalid filter quality amount: must be integer"},
+		{path: "filters:quality()/foo.jpg", err: "invalid filter quality: requires 1 arguments"},
+		{path: "filters:format(exe)/foo.jpg", err: "invalid filter format format: must be one of jpeg, jpg, png, gif, webp, avif, tiff, heif, bmp, jp2, jxl, mp4, webm"},
+		{path: "filters:rgb(1,2)/foo.jpg", err: "invalid filter rgb: requires 3 arguments"},
+		{path: "filters:grayscale(1)/foo.jpg", err: "invalid filter grayscale: accepts at most 0 arguments"},
+		{path: "filters:fill(<script>)/foo.jpg", err: "invalid filter fill color: must be color name or hex"},
+		{path: "filters:watermark(logo.png,abc,0)/foo.jpg", err: "invalid filter watermark x: invalid value"},
+		{path: "filters:rotate(090)/foo.jpg", expect: "filters:rotate(90)/foo.jpg"},
+		{path: "filters:rotate(-30,white)/foo.jpg", expect: "filters:rotate(-30,white)/foo.jpg"},
+		{path: "filters:rotate(720)/foo.jpg", err: "invalid filter rotate angle: must be between -360 and 360"},
+		{path: "filters:round_corner(20,white)/foo.jpg", expect: "filters:round_corner(20,white)/foo.jpg"},
+		{path: "filters:round_corner(20,30,ff0000)/foo.jpg", expect: "filters:round_corner(20,30,ff0000)/foo.jpg"},
+		{path: "filters:round_corner(20,-1)/foo.jpg", err: "invalid filter round_corner ry: invalid value"},
+		{path: "filters:label(Hello%2C%20World,-10,bottom,24,white,Roboto,black)/foo.jpg", expect: "filters:label(Hello%2C%20World,-10,bottom,24,white,Roboto,black)/foo.jpg"},
+		{path: "filters:label(Hello,10,10,0)/foo.jpg", err: "invalid filter label size: must be between 1 and 1000"},
+		{path: "filters:watermark(logo.png,repeat,repeat,70,30,none,45)/foo.jpg", expect: "filters:watermark(logo.png,repeat,repeat,70,30,none,45)/foo.jpg"},
+		{path: "filters:watermark(logo.png,repeat,repeat,70,30,none,400)/foo.jpg", err: "invalid filter watermark angle: must be between -360 and 360"},
+		{path: "filters:page(03)/foo.tiff", expect: "filters:page(3)/foo.tiff"},
+		{path: "filters:page(0)/foo.tiff", err: "invalid filter page num: must be between 1 and 100000"},
+		{path: "filters:format(avif):speed(08)/foo.jpg", expect: "filters:format(avif):speed(8)/foo.jpg"},
+		{path: "filters:speed(10)/foo.jpg", err: "invalid filter speed n: must be between 0 and 9"},
+		{path: "filters:page(2):dpi(0150)/foo.pdf", expect: "filters:page(2):dpi(150)/foo.pdf"},
+		{path: "filters:dpi(2400)/foo.pdf", err: "invalid filter dpi num: must be between 1 and 1200"},
+		{path: "filters:collage(grid,010,White,a.jpg,b.jpg,c.jpg)/foo.jpg", expect: "filters:collage(grid,10,white,a.jpg,b.jpg,c.jpg)/foo.jpg"},
+		{path: "filters:collage(diagonal,0,white,a.jpg)/foo.jpg", err: "invalid filter collage layout: invalid value"},
+		{path: "filters:collage(h,0,white)/foo.jpg", err: "invalid filter collage: requires 4 arguments"},
+		{path: "filters:loop(3)/foo.gif", expect: "filters:loop(3)/foo.gif"},
+		{path: "filters:blurhash(10)/foo.jpg", err: "invalid filter blurhash x: must be between 1 and 9"},
+		{path: "filters:blurhash(5,2):palette(03)/foo.jpg", expect: "filters:blurhash(5,2):palette(3)/foo.jpg"},
+		{path: "filters:thumbhash()/foo.jpg", expect: "filters:thumbhash()/foo.jpg"},
+		{path: "filters:palette(0)/foo.jpg", err: "invalid filter palette n: must be between 1 and 16"},
+		{path: "filters:sharpen(2.0,0.50,4)/foo.jpg", expect: "filters:sharpen(2,0.5,4)/foo.jpg"},
+		{path: "filters:sharpen(1,2,true)/foo.jpg", expect: "filters:sharpen(1,2,true)/foo.jpg"},
+		{path: "filters:sharpen(2,11)/foo.jpg", err: "invalid filter sharpen flat: must be between 0 and 10"},
+		{path: "filters:sharpen(2,1,abc)/foo.jpg", err: "invalid filter sharpen jagged: must be number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := DefaultFilterSchemas.Normalize(Parse(tt.path))
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expect, p.Path)
+			}
+		})
+	}
+}
+
+func TestApplyDPR(t *testing.T) {
+	tests := []struct {
+		path     string
+		fallback float64
+		expect   string
+	}{
+		{"fit-in/100x50/filters:dpr(2):quality(80)/foo.jpg", 0, "fit-in/200x100/filters:quality(80)/foo.jpg"},
+		{"100x0/10x5/filters:dpr(1.5)/foo.jpg", 3, "150x0/15x8/foo.jpg"},
+		{"100x50/filters:dpr(1)/foo.jpg", 2, "100x50/foo.jpg"},
+		{"100x50/filters:dpr(abc)/foo.jpg", 2, "100x50/foo.jpg"},
+		{"-100x50/filters:dpr(10)/foo.jpg", 0, "-500x250/foo.jpg"},
+		{"100x50/foo.jpg", 2, "200x100/foo.jpg"},
+		{"100x50/foo.jpg", 0, "100x50/foo.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expect, ApplyDPR(Parse(tt.path), tt.fallback).Path)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package imagorpath
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"path"
+	"strings"
+)
+
+// NewDigestResultKey result key generator using hex digest of the canonical params path,
+// producing short storage safe keys regardless of source image URL length.
+// Keys are suffixed with quality and format if specified e.g. 0a1b...9f-q80.webp.
+// shard splits leading digest into 2 characters directories e.g. shard 2 becomes 0a/1b/0a1b...9f
+func NewDigestResultKey(alg func() hash.Hash, shard int) *DigestResultKey {
+	if alg == nil {
+		alg = sha1.New
+	}
+	return &DigestResultKey{
+		alg:   alg,
+		shard: shard,
+	}
+}
+
+// DigestResultKey result key generator of hex digest, optionally sharded into directories
+type DigestResultKey struct {
+	alg   func() hash.Hash
+	shard int
+}
+
+func (k *DigestResultKey) Generate(p Params) string {
+	// meta and image results share the same key
+	p.Meta = false
+	h := k.alg()
+	h.Write([]byte(GeneratePath(p)))
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	var sb strings.Builder
+	for i := 0; i < k.shard && (i+1)*2 < len(digest); i++ {
+		sb.WriteString(digest[i*2 : (i+1)*2])
+		sb.WriteByte('/')
+	}
+	sb.WriteString(digest)
+
+	var format, quality string
+	for _, f := range p.Filters {
+		switch f.Name {
+		case "format":
+			format = f.Args
+		case "quality":
+			quality = f.Args
+		}
+	}
+	if isKeySuffix(quality) {
+		sb.WriteString("-q")
+		sb.WriteString(quality)
+	}
+	if format == "" {
+		// source image format if no format specified
+		format = strings.TrimPrefix(path.Ext(p.Image), ".")
+	}
+	if format = strings.ToLower(format); isKeySuffix(format) && len(format) <= 5 {
+		sb.WriteByte('.')
+		sb.WriteString(format)
+	}
+	return sb.String()
+}
+
+func isKeySuffix(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
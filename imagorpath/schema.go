@@ -0,0 +1,368 @@
+package imagorpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ArgType filter argument type
+type ArgType int
+
+const (
+	ArgString ArgType = iota
+	ArgInt
+	ArgFloat
+	ArgColor
+	ArgEnum
+)
+
+// ArgSchema filter argument schema
+type ArgSchema struct {
+	Name string
+	Type ArgType
+	// Min Max inclusive numeric range, applies if Min < Max
+	Min, Max float64
+	// Enum allowed values for ArgEnum, or accepted keywords for other types
+	Enum []string
+	// Validate optional custom validation for ArgString
+	Validate func(arg string) bool
+}
+
+// FilterSchema filter arguments schema
+type FilterSchema struct {
+	Args []ArgSchema
+	// Required number of leading arguments that must be present
+	Required int
+	// Raw skips argument splitting and validates the whole argument string as the first arg
+	Raw bool
+}
+
+// FilterSchemas registry of filter schemas by filter name
+type FilterSchemas map[string]FilterSchema
+
+// FilterArgError invalid filter argument error
+type FilterArgError struct {
+	Filter string
+	Arg    string
+	Reason string
+}
+
+func (e FilterArgError) Error() string {
+	if e.Arg == "" {
+		return fmt.Sprintf("invalid filter %s: %s", e.Filter, e.Reason)
+	}
+	return fmt.Sprintf("invalid filter %s %s: %s", e.Filter, e.Arg, e.Reason)
+}
+
+func isPosition(arg string) bool {
+	switch arg {
+	case "center", HAlignLeft, HAlignRight, VAlignTop, VAlignBottom, "repeat":
+		return true
+	}
+	arg = strings.TrimSuffix(arg, "p")
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+func isSize(arg string) bool {
+	if arg == "none" {
+		return true
+	}
+	_, err := strconv.Atoi(strings.TrimSuffix(arg, "p"))
+	return err == nil
+}
+
+// DefaultFilterSchemas schemas of built-in filters
+var DefaultFilterSchemas = FilterSchemas{
+	"quality": {Required: 1, Args: []ArgSchema{
+		{Name: "amount", Type: ArgInt, Min: 0, Max: 100, Enum: []string{"auto"}},
+		{Name: "hint", Type: ArgEnum, Enum: []string{"save-data", "slow-2g", "2g", "3g", "4g"}},
+	}},
+	"format": {Required: 1, Args: []ArgSchema{
+		{Name: "format", Type: ArgEnum, Enum: []string{
+			"jpeg", "jpg", "png", "gif", "webp", "avif", "tiff", "heif", "bmp", "jp2", "jxl", "mp4", "webm"}},
+	}},
+	"fill": {Required: 1, Raw: true, Args: []ArgSchema{
+		{Name: "color", Type: ArgColor, Enum: []string{"auto", "blur", "none", "transparent"}},
+	}},
+	"background_color": {Required: 1, Raw: true, Args: []ArgSchema{
+		{Name: "color", Type: ArgColor, Enum: []string{"auto"}},
+	}},
+	"label": {Required: 1, Args: []ArgSchema{
+		{Name: "text", Type: ArgString},
+		{Name: "x", Type: ArgString, Validate: isPosition},
+		{Name: "y", Type: ArgString, Validate: isPosition},
+		{Name: "size", Type: ArgInt, Min: 1, Max: 1000},
+		{Name: "color", Type: ArgColor},
+		{Name: "font", Type: ArgString},
+		{Name: "shadow", Type: ArgColor},
+	}},
+	"max_bytes": {Required: 1, Args: []ArgSchema{
+		{Name: "amount", Type: ArgInt, Min: 0, Max: 1 << 31},
+	}},
+	"round_corner": {Required: 1, Args: []ArgSchema{
+		{Name: "rx", Type: ArgString},
+		{Name: "ry", Type: ArgString, Validate: isRadiusOrColor},
+		{Name: "color", Type: ArgColor},
+	}},
+	"rotate": {Required: 1, Args: []ArgSchema{
+		{Name: "angle", Type: ArgFloat, Min: -360, Max: 360},
+		{Name: "color", Type: ArgColor},
+	}},
+	"brightness": {Required: 1, Args: []ArgSchema{
+		{Name: "amount", Type: ArgFloat, Min: -100, Max: 100},
+	}},
+	"contrast": {Required: 1, Args: []ArgSchema{
+		{Name: "amount", Type: ArgFloat, Min: -100, Max: 100},
+	}},
+	"saturation": {Required: 1, Args: []ArgSchema{
+		{Name: "amount", Type: ArgFloat, Min: -100, Max: 100},
+	}},
+	"hue": {Required: 1, Args: []ArgSchema{
+		{Name: "angle", Type: ArgFloat, Min: -360, Max: 360},
+	}},
+	"rgb": {Required: 3, Args: []ArgSchema{
+		{Name: "r", Type: ArgFloat, Min: -100, Max: 100},
+		{Name: "g", Type: ArgFloat, Min: -100, Max: 100},
+		{Name: "b", Type: ArgFloat, Min: -100, Max: 100},
+	}},
+	"modulate": {Required: 3, Args: []ArgSchema{
+		{Name: "brightness", Type: ArgFloat, Min: -100, Max: 100},
+		{Name: "saturation", Type: ArgFloat, Min: -100, Max: 100},
+		{Name: "hue", Type: ArgFloat, Min: -360, Max: 360},
+	}},
+	"blur": {Required: 1, Args: []ArgSchema{
+		{Name: "radius", Type: ArgFloat, Min: 0, Max: 150},
+		{Name: "sigma", Type: ArgFloat, Min: 0, Max: 150},
+	}},
+	// sharpen(sigma[,flat,jagged]), or Thumbor sharpen(amount,radius,luminance_only)
+	"sharpen": {Required: 1, Args: []ArgSchema{
+		{Name: "sigma", Type: ArgFloat, Min: 0, Max: 10},
+		{Name: "flat", Type: ArgFloat, Min: 0, Max: 10},
+		{Name: "jagged", Type: ArgFloat, Min: 0, Max: 20, Enum: []string{"true", "false"}},
+	}},
+	"dpr": {Required: 1, Args: []ArgSchema{
+		{Name: "ratio", Type: ArgFloat, Min: 0, Max: MaxDPR},
+	}},
+	"expire": {Required: 1, Args: []ArgSchema{
+		{Name: "seconds", Type: ArgInt, Min: 0, Max: 1 << 31},
+	}},
+	"depth": {Required: 1, Args: []ArgSchema{
+		{Name: "bits", Type: ArgEnum, Enum: []string{"8", "16"}},
+	}},
+	"speed": {Required: 1, Args: []ArgSchema{
+		{Name: "n", Type: ArgInt, Min: 0, Max: 9},
+	}},
+	"linear": {Args: []ArgSchema{
+		{Name: "enabled", Type: ArgEnum, Enum: []string{"true", "false"}},
+	}},
+	"progressive": {Args: []ArgSchema{
+		{Name: "enabled", Type: ArgEnum, Enum: []string{"true", "false"}},
+	}},
+	"page": {Required: 1, Args: []ArgSchema{
+		{Name: "num", Type: ArgInt, Min: 1, Max: 100000},
+	}},
+	"frame": {Required: 1, Args: []ArgSchema{
+		{Name: "num", Type: ArgInt, Min: 1, Max: 100000},
+	}},
+	"dpi": {Required: 1, Args: []ArgSchema{
+		{Name: "num", Type: ArgInt, Min: 1, Max: 1200},
+	}},
+	"processor": {Required: 1, Args: []ArgSchema{
+		{Name: "name", Type: ArgString},
+	}},
+	"grayscale":  {},
+	"raw":        {},
+	"strip_icc":  {},
+	"remove_bg":  {},
+	"strip_exif": {},
+	"upscale":    {},
+	"no_upscale": {},
+	"stretch":    {},
+	"trim": {Args: []ArgSchema{
+		{Name: "tolerance", Type: ArgInt, Min: 0, Max: 442},
+		{Name: "position", Type: ArgEnum, Enum: []string{"top-left", "bottom-right"}},
+	}},
+	"frames": {Required: 1, Args: []ArgSchema{
+		{Name: "n", Type: ArgInt, Min: 1, Max: 1000},
+		{Name: "delay", Type: ArgInt, Min: 0, Max: 100000},
+	}},
+	"collage": {Required: 4, Args: []ArgSchema{
+		{Name: "layout", Type: ArgString, Validate: isCollageLayout},
+		{Name: "gap", Type: ArgInt, Min: 0, Max: 1000},
+		{Name: "color", Type: ArgColor, Enum: []string{"auto", "none", "transparent"}},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+		{Name: "image", Type: ArgString},
+	}},
+	"blurhash": {Args: []ArgSchema{
+		{Name: "x", Type: ArgInt, Min: 1, Max: 9},
+		{Name: "y", Type: ArgInt, Min: 1, Max: 9},
+	}},
+	"thumbhash": {},
+	"palette": {Args: []ArgSchema{
+		{Name: "n", Type: ArgInt, Min: 1, Max: 16},
+	}},
+	"loop": {Required: 1, Args: []ArgSchema{
+		{Name: "count", Type: ArgInt, Min: 0, Max: 65535},
+	}},
+	"padding": {Required: 2, Args: []ArgSchema{
+		{Name: "color", Type: ArgColor, Enum: []string{"auto", "blur", "none", "transparent"}},
+		{Name: "left", Type: ArgInt, Min: 0, Max: 10000},
+		{Name: "top", Type: ArgInt, Min: 0, Max: 10000},
+		{Name: "right", Type: ArgInt, Min: 0, Max: 10000},
+		{Name: "bottom", Type: ArgInt, Min: 0, Max: 10000},
+	}},
+	"proportion": {Required: 1, Args: []ArgSchema{
+		{Name: "percentage", Type: ArgFloat, Min: 0, Max: 100},
+	}},
+	"watermark": {Required: 1, Args: []ArgSchema{
+		{Name: "image", Type: ArgString},
+		{Name: "x", Type: ArgString, Validate: isPosition},
+		{Name: "y", Type: ArgString, Validate: isPosition},
+		{Name: "alpha", Type: ArgFloat, Min: 0, Max: 100},
+		{Name: "w_ratio", Type: ArgString, Validate: isSize},
+		{Name: "h_ratio", Type: ArgString, Validate: isSize},
+		{Name: "angle", Type: ArgFloat, Min: -360, Max: 360},
+	}},
+}
+
+// Normalize validates filters of params against schemas, returning params with normalized filter args.
+// Filters without schema are left unchanged
+func (s FilterSchemas) Normalize(p Params) (Params, error) {
+	if len(p.Filters) == 0 || len(s) == 0 {
+		return p, nil
+	}
+	var changed bool
+	filters := make(Filters, len(p.Filters))
+	for i, f := range p.Filters {
+		nf, err := s.NormalizeFilter(f)
+		if err != nil {
+			return p, err
+		}
+		if nf != f {
+			changed = true
+		}
+		filters[i] = nf
+	}
+	if changed {
+		p.Filters = filters
+		p.Path = GeneratePath(p)
+	}
+	return p, nil
+}
+
+// NormalizeFilter validates and normalizes filter args against schema
+func (s FilterSchemas) NormalizeFilter(f Filter) (Filter, error) {
+	schema, ok := s[f.Name]
+	if !ok {
+		return f, nil
+	}
+	var args []string
+	if schema.Raw {
+		if f.Args != "" {
+			args = []string{f.Args}
+		}
+	} else if f.Args != "" {
+		args = strings.Split(f.Args, ",")
+	}
+	if len(args) < schema.Required {
+		return f, FilterArgError{Filter: f.Name, Reason: fmt.Sprintf("requires %d arguments", schema.Required)}
+	}
+	if len(args) > len(schema.Args) {
+		return f, FilterArgError{Filter: f.Name, Reason: fmt.Sprintf("accepts at most %d arguments", len(schema.Args))}
+	}
+	for i, arg := range args {
+		as := schema.Args[i]
+		norm, reason := as.normalize(strings.TrimSpace(arg))
+		if reason != "" {
+			return f, FilterArgError{Filter: f.Name, Arg: as.Name, Reason: reason}
+		}
+		args[i] = norm
+	}
+	f.Args = strings.Join(args, ",")
+	return f, nil
+}
+
+func (a ArgSchema) normalize(arg string) (string, string) {
+	if a.Type != ArgString {
+		arg = strings.ToLower(arg)
+	}
+	for _, e := range a.Enum {
+		if arg == e {
+			return arg, ""
+		}
+	}
+	switch a.Type {
+	case ArgEnum:
+		return arg, "must be one of " + strings.Join(a.Enum, ", ")
+	case ArgInt:
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return arg, "must be integer"
+		}
+		if a.Min < a.Max && (float64(v) < a.Min || float64(v) > a.Max) {
+			return arg, fmt.Sprintf("must be between %v and %v", a.Min, a.Max)
+		}
+		return strconv.Itoa(v), ""
+	case ArgFloat:
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return arg, "must be number"
+		}
+		if a.Min < a.Max && (v < a.Min || v > a.Max) {
+			return arg, fmt.Sprintf("must be between %v and %v", a.Min, a.Max)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), ""
+	case ArgColor:
+		if !isColor(arg) {
+			return arg, "must be color name or hex"
+		}
+		return arg, ""
+	}
+	if a.Validate != nil && !a.Validate(arg) {
+		return arg, "invalid value"
+	}
+	return arg, ""
+}
+
+// isCollageLayout strip direction, grid, or number of columns
+func isCollageLayout(arg string) bool {
+	switch arg {
+	case "horizontal", "h", "vertical", "v", "grid":
+		return true
+	}
+	n, err := strconv.Atoi(arg)
+	return err == nil && n >= 1 && n <= 9
+}
+
+// isRadiusOrColor where optional radius can be followed by color
+func isRadiusOrColor(arg string) bool {
+	if n, err := strconv.Atoi(arg); err == nil {
+		return n >= 0 && n <= 10000
+	}
+	return isColor(arg)
+}
+
+func isColor(arg string) bool {
+	arg, mode, _ := strings.Cut(arg, ",")
+	if mode != "" && mode != "top-left" && mode != "bottom-right" {
+		return false
+	}
+	arg = strings.TrimPrefix(arg, "#")
+	if arg == "" {
+		return false
+	}
+	for _, c := range arg {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
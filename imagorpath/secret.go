@@ -0,0 +1,188 @@
+package imagorpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider provides secret for signer,
+// allowing secret to be sourced and rotated externally
+type SecretProvider interface {
+	Secret() (string, error)
+}
+
+// RotationSecretProvider optional SecretProvider interface providing the previous secret
+// along with the current one, such that signatures of either are accepted during rotation
+type RotationSecretProvider interface {
+	SecretProvider
+	Secrets() (current, previous string, err error)
+}
+
+// StaticSecret secret provider of static string
+type StaticSecret string
+
+func (s StaticSecret) Secret() (string, error) {
+	return string(s), nil
+}
+
+// NewFileSecretProvider secret provider reading secret from file,
+// re-read when file modified time changed, checked at most once per interval
+func NewFileSecretProvider(path string, interval time.Duration) SecretProvider {
+	return &fileSecretProvider{path: path, interval: interval}
+}
+
+type fileSecretProvider struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	secret  string
+	modTime time.Time
+	checked time.Time
+}
+
+func (p *fileSecretProvider) Secret() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if !p.checked.IsZero() && now.Sub(p.checked) < p.interval {
+		return p.secret, nil
+	}
+	p.checked = now
+	stat, err := os.Stat(p.path)
+	if err != nil {
+		return p.secret, err
+	}
+	if stat.ModTime().Equal(p.modTime) {
+		return p.secret, nil
+	}
+	buf, err := os.ReadFile(p.path)
+	if err != nil {
+		return p.secret, err
+	}
+	p.secret = strings.TrimSpace(string(buf))
+	p.modTime = stat.ModTime()
+	return p.secret, nil
+}
+
+// NewCachedSecretProvider secret provider caching the result of fetch for ttl.
+// Last known secret is retained if fetch failed after ttl
+func NewCachedSecretProvider(fetch func() (string, error), ttl time.Duration) SecretProvider {
+	return &cachedSecretProvider{fetch: fetch, ttl: ttl}
+}
+
+type cachedSecretProvider struct {
+	fetch func() (string, error)
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	secret  string
+	fetched time.Time
+}
+
+func (p *cachedSecretProvider) Secret() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.fetched.IsZero() && time.Since(p.fetched) < p.ttl {
+		return p.secret, nil
+	}
+	secret, err := p.fetch()
+	if err != nil {
+		return p.secret, err
+	}
+	p.secret = secret
+	p.fetched = time.Now()
+	return p.secret, nil
+}
+
+// NewVaultSecretProvider secret provider reading field of HashiCorp Vault KV secret,
+// supports both KV version 1 and 2 e.g. path secret/data/imagor for KV version 2
+func NewVaultSecretProvider(addr, token, path, field string, ttl time.Duration) SecretProvider {
+	client := &http.Client{Timeout: time.Second * 10}
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	return NewCachedSecretProvider(func() (string, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-Vault-Token", token)
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("vault: %s", resp.Status)
+		}
+		var res struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return "", err
+		}
+		data := res.Data
+		if nested, ok := data["data"]; ok {
+			// KV version 2
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(nested, &m); err == nil {
+				data = m
+			}
+		}
+		var secret string
+		if raw, ok := data[field]; !ok {
+			return "", errors.New("vault: secret field not found")
+		} else if err := json.Unmarshal(raw, &secret); err != nil {
+			return "", err
+		}
+		return secret, nil
+	}, ttl)
+}
+
+// NewRotationSecretProvider wraps secret provider retaining the previous secret for grace period after rotation,
+// such that URLs signed with the previous secret remain valid until re-signed
+func NewRotationSecretProvider(provider SecretProvider, grace time.Duration) RotationSecretProvider {
+	return &rotationSecretProvider{provider: provider, grace: grace}
+}
+
+type rotationSecretProvider struct {
+	provider SecretProvider
+	grace    time.Duration
+
+	mu       sync.Mutex
+	current  string
+	previous string
+	rotated  time.Time
+}
+
+func (p *rotationSecretProvider) Secret() (string, error) {
+	secret, err := p.provider.Secret()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if secret != "" && secret != p.current {
+		if p.current != "" {
+			p.previous = p.current
+			p.rotated = time.Now()
+		}
+		p.current = secret
+	}
+	return secret, err
+}
+
+// Secrets returns current and previous secret, previous is empty beyond grace period
+func (p *rotationSecretProvider) Secrets() (current, previous string, err error) {
+	current, err = p.Secret()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.previous != "" && time.Since(p.rotated) < p.grace {
+		previous = p.previous
+	}
+	return
+}
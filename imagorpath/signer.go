@@ -2,6 +2,7 @@ package imagorpath
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
 	"hash"
@@ -12,6 +13,20 @@ type Signer interface {
 	Sign(path string) string
 }
 
+// Verifier optional signer interface verifying signature of path,
+// e.g. accepting signature of previous secret during secret rotation
+type Verifier interface {
+	Verify(path, hash string) bool
+}
+
+// Verify verifies signature hash of path, by Verifier if implemented by signer
+func Verify(signer Signer, path, hash string) bool {
+	if v, ok := signer.(Verifier); ok {
+		return v.Verify(path, hash)
+	}
+	return signer.Sign(path) == hash
+}
+
 // NewDefaultSigner default signer using SHA1 with secret
 func NewDefaultSigner(secret string) Signer {
 	return NewHMACSigner(sha1.New, 0, secret)
@@ -26,14 +41,58 @@ func NewHMACSigner(alg func() hash.Hash, truncate int, secret string) *hmacSigne
 	}
 }
 
+// NewHMACSignerWithProvider custom HMAC alg signer with secret from SecretProvider
+func NewHMACSignerWithProvider(alg func() hash.Hash, truncate int, provider SecretProvider) *hmacSigner {
+	// random secret as fallback if provider has no secret available,
+	// such that signature can never be matched instead of signing with empty secret
+	fallback := make([]byte, 32)
+	_, _ = rand.Read(fallback)
+	return &hmacSigner{
+		alg:      alg,
+		truncate: truncate,
+		secret:   fallback,
+		provider: provider,
+	}
+}
+
 type hmacSigner struct {
 	alg      func() hash.Hash
 	truncate int
 	secret   []byte
+	provider SecretProvider
 }
 
 func (s *hmacSigner) Sign(path string) string {
-	h := hmac.New(s.alg, s.secret)
+	secret := s.secret
+	if s.provider != nil {
+		// provider returns last known secret on error
+		if v, _ := s.provider.Secret(); v != "" {
+			secret = []byte(v)
+		}
+	}
+	return s.sign(secret, path)
+}
+
+// Verify accepts signature of either current or previous secret
+// if provider implements RotationSecretProvider
+func (s *hmacSigner) Verify(path, hash string) bool {
+	p, ok := s.provider.(RotationSecretProvider)
+	if !ok {
+		return hmac.Equal([]byte(s.Sign(path)), []byte(hash))
+	}
+	secret := s.secret
+	current, previous, _ := p.Secrets()
+	if current != "" {
+		secret = []byte(current)
+	}
+	if hmac.Equal([]byte(s.sign(secret, path)), []byte(hash)) {
+		return true
+	}
+	return previous != "" && hmac.Equal([]byte(s.sign([]byte(previous), path)), []byte(hash))
+}
+
+func (s *hmacSigner) sign(secret []byte, path string) string {
+	h := hmac.New(s.alg, secret)
 	h.Write([]byte(path))
 	sig := base64.URLEncoding.EncodeToString(h.Sum(nil))
 	if s.truncate > 0 && len(sig) > s.truncate {
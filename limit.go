@@ -0,0 +1,111 @@
+package imagor
+
+import (
+	"context"
+	"github.com/cshum/imagor/imagorpath"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// checkLimits rejects request params exceeding complexity limits
+func (app *Imagor) checkLimits(p imagorpath.Params) error {
+	if app.MaxImageLength > 0 && len(p.Image) > app.MaxImageLength {
+		return ErrParamsTooLong
+	}
+	if app.MaxFilterArgsLength > 0 {
+		for _, f := range p.Filters {
+			if len(f.Args) > app.MaxFilterArgsLength {
+				return ErrParamsTooLong
+			}
+		}
+	}
+	if app.MaxFilters > 0 && len(p.Filters) > app.MaxFilters {
+		return ErrTooComplex
+	}
+	var blur float64
+	var watermarks int
+	for _, f := range p.Filters {
+		switch f.Name {
+		case "blur":
+			radius, _, _ := strings.Cut(f.Args, ",")
+			if v, err := strconv.ParseFloat(strings.TrimSpace(radius), 64); err == nil && v > 0 {
+				blur += v
+			}
+		case "watermark":
+			watermarks++
+		}
+	}
+	if app.MaxBlur > 0 && blur > app.MaxBlur {
+		return ErrTooComplex
+	}
+	if app.MaxWatermarks > 0 && watermarks > app.MaxWatermarks {
+		return ErrTooComplex
+	}
+	return nil
+}
+
+type loadCountKey struct{}
+
+// withLoadCount context with load counter, shared by nested imagor path sources of the request
+func withLoadCount(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(loadCountKey{}).(*int64); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, loadCountKey{}, new(int64))
+}
+
+// limitLoad limits number of nested loads per request e.g. watermark images
+func (app *Imagor) limitLoad(ctx context.Context, load LoadFunc) LoadFunc {
+	if app.MaxLoads <= 0 {
+		return load
+	}
+	cnt, ok := ctx.Value(loadCountKey{}).(*int64)
+	if !ok {
+		cnt = new(int64)
+	}
+	return func(image string) (*Blob, error) {
+		if atomic.AddInt64(cnt, 1) > int64(app.MaxLoads) {
+			return nil, ErrTooComplex
+		}
+		return load(image)
+	}
+}
+
+// allowUnsafe checks if unsafe request is allowed by client network and image path restrictions
+func (app *Imagor) allowUnsafe(r *http.Request, p imagorpath.Params) bool {
+	if len(app.UnsafeCIDRs) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		var allowed bool
+		for _, ipNet := range app.UnsafeCIDRs {
+			if ipNet.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if len(app.UnsafePathPrefixes) > 0 {
+		image := strings.TrimPrefix(p.Image, "/")
+		for _, prefix := range app.UnsafePathPrefixes {
+			// match on path segment boundary, such that "images" does not cover "images-private"
+			prefix = strings.Trim(prefix, "/")
+			if prefix == "" || image == prefix || strings.HasPrefix(image, prefix+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
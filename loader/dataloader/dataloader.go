@@ -0,0 +1,73 @@
+package dataloader
+
+import (
+	"encoding/base64"
+	"github.com/cshum/imagor"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DataLoader decodes images from data URI embedded in image key
+// e.g. data:image/png;base64,iVBORw0KGgo...
+type DataLoader struct {
+	// MaxAllowedSize maximum bytes allowed for decoded image
+	MaxAllowedSize int
+}
+
+func New(options ...Option) *DataLoader {
+	l := &DataLoader{}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+func (l *DataLoader) Get(_ *http.Request, image string) (*imagor.Blob, error) {
+	if !strings.HasPrefix(image, "data:") {
+		return nil, imagor.ErrInvalid
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(image, "data:"), ",")
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	// "+" of media type and base64 may have been unescaped into space from path
+	header = strings.ReplaceAll(header, " ", "+")
+	isBase64 := strings.HasSuffix(header, ";base64")
+	mediaType, _, _ := strings.Cut(strings.TrimSuffix(header, ";base64"), ";")
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, imagor.ErrUnsupportedFormat
+	}
+	if l.MaxAllowedSize > 0 && len(data) > l.MaxAllowedSize*4/3+4 {
+		return nil, imagor.ErrMaxSizeExceeded
+	}
+	var buf []byte
+	if isBase64 {
+		var err error
+		if buf, err = decodeBase64(strings.ReplaceAll(data, " ", "+")); err != nil {
+			return nil, imagor.ErrInvalid
+		}
+	} else {
+		unescaped, err := url.PathUnescape(data)
+		if err != nil {
+			return nil, imagor.ErrInvalid
+		}
+		buf = []byte(unescaped)
+	}
+	if l.MaxAllowedSize > 0 && len(buf) > l.MaxAllowedSize {
+		return nil, imagor.ErrMaxSizeExceeded
+	}
+	return imagor.NewBlobFromBytes(buf), nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64, with or without padding
+func decodeBase64(data string) ([]byte, error) {
+	enc := base64.StdEncoding
+	if strings.ContainsAny(data, "-_") {
+		enc = base64.URLEncoding
+	}
+	if !strings.HasSuffix(data, "=") && len(data)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	return enc.DecodeString(data)
+}
@@ -0,0 +1,81 @@
+package dataloader
+
+import (
+	"encoding/base64"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDataLoader(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	pixel := imagor.TransparentPixel
+	tests := []struct {
+		name     string
+		image    string
+		expected []byte
+		err      error
+	}{
+		{
+			name:     "base64",
+			image:    "data:image/png;base64," + base64.StdEncoding.EncodeToString(pixel),
+			expected: pixel,
+		},
+		{
+			name:     "base64 url unpadded",
+			image:    "data:image/png;base64," + base64.RawURLEncoding.EncodeToString(pixel),
+			expected: pixel,
+		},
+		{
+			name:     "url encoded",
+			image:    "data:image/svg+xml,%3Csvg%3E%3C/svg%3E",
+			expected: []byte("<svg></svg>"),
+		},
+		{
+			name:  "not data uri",
+			image: "https://example.com/foo.jpg",
+			err:   imagor.ErrInvalid,
+		},
+		{
+			name:  "not image",
+			image: "data:text/html;base64,PGgxPg==",
+			err:   imagor.ErrUnsupportedFormat,
+		},
+		{
+			name:  "invalid base64",
+			image: "data:image/png;base64,!!!",
+			err:   imagor.ErrInvalid,
+		},
+	}
+	loader := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob, err := loader.Get(r, tt.image)
+			if tt.err != nil {
+				assert.Equal(t, tt.err, err)
+				return
+			}
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf)
+		})
+	}
+
+	t.Run("plus unescaped from path", func(t *testing.T) {
+		p := imagorpath.Parse("fit-in/10x10/data:image/png;base64,+/+/")
+		blob, err := loader.Get(r, p.Image)
+		require.NoError(t, err)
+		buf, err := blob.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0xfb, 0xff, 0xbf}, buf)
+	})
+
+	t.Run("max allowed size", func(t *testing.T) {
+		_, err := New(WithMaxAllowedSize(10)).Get(r, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(pixel))
+		assert.Equal(t, imagor.ErrMaxSizeExceeded, err)
+	})
+}
@@ -0,0 +1,11 @@
+package dataloader
+
+type Option func(l *DataLoader)
+
+func WithMaxAllowedSize(size int) Option {
+	return func(l *DataLoader) {
+		if size > 0 {
+			l.MaxAllowedSize = size
+		}
+	}
+}
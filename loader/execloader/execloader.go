@@ -0,0 +1,137 @@
+package execloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/cshum/imagor"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// KeyPlaceholder placeholder of command template substituted by image key
+const KeyPlaceholder = "{key}"
+
+const maxStderrSize = 1 << 10
+
+// ExecLoader loads images from stdout of an external command,
+// e.g. `dam-cli export --id {key}`.
+// Command is executed directly without shell,
+// such that image key cannot be interpreted by shell
+type ExecLoader struct {
+	// Args command template arguments, with {key} substituted by image key
+	Args []string
+
+	// PathPrefix only image keys with path prefix are handled.
+	// Path prefix is trimmed before substitution
+	PathPrefix string
+
+	// Env additional environment variables in KEY=value format
+	Env []string
+
+	// Timeout maximum duration of command execution
+	Timeout time.Duration
+
+	// MaxAllowedSize maximum bytes allowed for image
+	MaxAllowedSize int
+}
+
+func New(command string, options ...Option) *ExecLoader {
+	l := &ExecLoader{
+		Args:    strings.Fields(command),
+		Timeout: time.Second * 30,
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+func (l *ExecLoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	if len(l.Args) == 0 || !strings.HasPrefix(image, l.PathPrefix) {
+		return nil, imagor.ErrInvalid
+	}
+	key := strings.TrimPrefix(image, l.PathPrefix)
+	if !isKeyValid(key) {
+		return nil, imagor.ErrInvalid
+	}
+	ctx := r.Context()
+	if l.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+	args := make([]string, len(l.Args))
+	for i, arg := range l.Args {
+		args[i] = strings.ReplaceAll(arg, KeyPlaceholder, key)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if len(l.Env) > 0 {
+		cmd.Env = append(os.Environ(), l.Env...)
+	}
+	stdout := &limitedBuffer{max: l.MaxAllowedSize}
+	stderr := &limitedBuffer{max: maxStderrSize, truncate: true}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if stdout.exceeded {
+			return nil, imagor.ErrMaxSizeExceeded
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, imagor.ErrTimeout
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+				return nil, imagor.NewError("exec: "+msg, http.StatusBadGateway)
+			}
+			return nil, imagor.NewError("exec: "+exitErr.Error(), http.StatusBadGateway)
+		}
+		return nil, err
+	}
+	if stdout.buf.Len() == 0 {
+		return nil, imagor.ErrNotFound
+	}
+	return imagor.NewBlobFromBytes(stdout.buf.Bytes()), nil
+}
+
+// isKeyValid rejects keys that may be interpreted as command options
+// or escape the intended namespace of command
+func isKeyValid(key string) bool {
+	if key == "" || strings.HasPrefix(key, "-") || strings.ContainsRune(key, 0) {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// limitedBuffer buffer that fails writes beyond max bytes,
+// or discards them silently if truncate.
+// bytes.Buffer not embedded, as its ReadFrom would bypass the limit
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	truncate bool
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && b.buf.Len()+len(p) > b.max {
+		if !b.truncate {
+			b.exceeded = true
+			return 0, imagor.ErrMaxSizeExceeded
+		}
+		if n := b.max - b.buf.Len(); n > 0 {
+			_, _ = b.buf.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,66 @@
+package execloader
+
+import (
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExecLoader(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "foo.png"), []byte("foo"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.png"), nil, 0644))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	loader := New("cat "+dir+"/{key}",
+		WithPathPrefix("dam:"),
+		WithMaxAllowedSize(10),
+		WithTimeout(time.Second),
+	)
+	assert.Equal(t, []string{"cat", dir + "/{key}"}, loader.Args)
+
+	blob, err := loader.Get(r, "dam:a/foo.png")
+	require.NoError(t, err)
+	buf, err := blob.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	for _, image := range []string{
+		"a/foo.png", "dam:", "dam:-n", "dam:../etc/passwd", "dam:a/../../foo",
+	} {
+		_, err = loader.Get(r, image)
+		assert.Equal(t, imagor.ErrInvalid, err, image)
+	}
+
+	_, err = loader.Get(r, "dam:empty.png")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	_, err = loader.Get(r, "dam:missing.png")
+	require.Error(t, err)
+	e, ok := err.(imagor.Error)
+	require.True(t, ok)
+	assert.Equal(t, 502, e.Code)
+	assert.Contains(t, e.Message, "missing.png")
+
+	loader = New("head -c {key} /dev/zero", WithMaxAllowedSize(10))
+	_, err = loader.Get(r, "100")
+	assert.Equal(t, imagor.ErrMaxSizeExceeded, err)
+
+	loader = New("sleep {key}", WithTimeout(time.Millisecond*50))
+	_, err = loader.Get(r, "5")
+	assert.Equal(t, imagor.ErrTimeout, err)
+
+	loader = New("sh -c {key}", WithEnv("IMAGOR_TEST=bar", " "))
+	assert.Equal(t, []string{"IMAGOR_TEST=bar"}, loader.Env)
+	blob, err = loader.Get(r, "printf $IMAGOR_TEST")
+	require.NoError(t, err)
+	buf, err = blob.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+}
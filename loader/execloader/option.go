@@ -0,0 +1,40 @@
+package execloader
+
+import (
+	"strings"
+	"time"
+)
+
+type Option func(l *ExecLoader)
+
+func WithPathPrefix(prefix string) Option {
+	return func(l *ExecLoader) {
+		l.PathPrefix = prefix
+	}
+}
+
+func WithEnv(env ...string) Option {
+	return func(l *ExecLoader) {
+		for _, kv := range env {
+			if kv = strings.TrimSpace(kv); kv != "" {
+				l.Env = append(l.Env, kv)
+			}
+		}
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(l *ExecLoader) {
+		if timeout > 0 {
+			l.Timeout = timeout
+		}
+	}
+}
+
+func WithMaxAllowedSize(size int) Option {
+	return func(l *ExecLoader) {
+		if size > 0 {
+			l.MaxAllowedSize = size
+		}
+	}
+}
@@ -0,0 +1,167 @@
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative loader.proto
+
+package grpcloader
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/cshum/imagor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// GRPCLoader loads images from internal asset service over gRPC, see loader.proto.
+// Request deadline is propagated to the service
+type GRPCLoader struct {
+	// Addr gRPC target address e.g. assets.internal:443
+	Addr string
+
+	// TLSConfig transport TLS config, with client certificates for mTLS
+	TLSConfig *tls.Config
+
+	// Insecure uses plaintext transport
+	Insecure bool
+
+	// MaxAllowedSize maximum bytes allowed for image
+	MaxAllowedSize int64
+
+	// DialOptions additional gRPC dial options
+	DialOptions []grpc.DialOption
+
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+func New(addr string, options ...Option) *GRPCLoader {
+	l := &GRPCLoader{Addr: addr}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+func (l *GRPCLoader) dial() (*grpc.ClientConn, error) {
+	l.once.Do(func() {
+		creds := insecure.NewCredentials()
+		if !l.Insecure {
+			creds = credentials.NewTLS(l.TLSConfig)
+		}
+		l.conn, l.err = grpc.Dial(l.Addr, append([]grpc.DialOption{
+			grpc.WithTransportCredentials(creds),
+		}, l.DialOptions...)...)
+	})
+	return l.conn, l.err
+}
+
+// load opens Load stream and receives the first response
+func (l *GRPCLoader) load(ctx context.Context, key string) (*streamReader, int64, error) {
+	conn, err := l.dial()
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := NewLoaderClient(conn).Load(ctx, &LoadRequest{Key: key})
+	res := &LoadResponse{}
+	if err == nil {
+		if res, err = stream.Recv(); err == io.EOF {
+			// empty stream
+			res, err = &LoadResponse{}, nil
+		}
+	}
+	if err == nil && l.MaxAllowedSize > 0 && res.Size > l.MaxAllowedSize {
+		err = imagor.ErrMaxSizeExceeded
+	}
+	if err != nil {
+		cancel()
+		return nil, 0, wrapErr(err)
+	}
+	return &streamReader{
+		stream: stream,
+		buf:    res.Chunk,
+		max:    l.MaxAllowedSize,
+		read:   int64(len(res.Chunk)),
+		cancel: cancel,
+	}, res.Size, nil
+}
+
+func (l *GRPCLoader) Get(r *http.Request, key string) (*imagor.Blob, error) {
+	if key == "" {
+		return nil, imagor.ErrInvalid
+	}
+	ctx := r.Context()
+	first, size, err := l.load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		mu.Lock()
+		reader := first
+		first = nil
+		mu.Unlock()
+		if reader != nil {
+			return reader, size, nil
+		}
+		// first stream consumed, open new stream
+		reader, size, err := l.load(ctx, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		return reader, size, nil
+	}), nil
+}
+
+// streamReader reads chunks of Load stream
+type streamReader struct {
+	stream Loader_LoadClient
+	buf    []byte
+	max    int64
+	read   int64
+	cancel context.CancelFunc
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		res, err := s.stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, wrapErr(err)
+		}
+		s.buf = res.Chunk
+		s.read += int64(len(res.Chunk))
+		if s.max > 0 && s.read > s.max {
+			return 0, imagor.ErrMaxSizeExceeded
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *streamReader) Close() error {
+	s.cancel()
+	return nil
+}
+
+func wrapErr(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return imagor.ErrNotFound
+	case codes.InvalidArgument:
+		return imagor.ErrInvalid
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return imagor.ErrUnauthorized
+	case codes.DeadlineExceeded:
+		return imagor.ErrTimeout
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package grpcloader
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type loaderServer struct {
+	UnimplementedLoaderServer
+	images map[string][]byte
+}
+
+func (s loaderServer) Load(req *LoadRequest, stream Loader_LoadServer) error {
+	if _, ok := stream.Context().Deadline(); !ok {
+		return status.Error(codes.FailedPrecondition, "deadline not propagated")
+	}
+	buf, ok := s.images[req.Key]
+	if !ok {
+		return status.Error(codes.NotFound, "not found")
+	}
+	res := &LoadResponse{Size: int64(len(buf)), ContentType: "image/jpeg"}
+	for len(buf) > 0 {
+		n := 4
+		if n > len(buf) {
+			n = len(buf)
+		}
+		res.Chunk, buf = buf[:n], buf[n:]
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+		res = &LoadResponse{}
+	}
+	return nil
+}
+
+func withTimeout(r *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel
+}
+
+func TestGRPCLoader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 3)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer(loaderServer{images: map[string][]byte{"foo.jpg": content}})
+	// other services served on the same server
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Stop()
+
+	loader := New(ln.Addr().String(), WithInsecure(true))
+	r := httptest.NewRequest("GET", "/", nil)
+
+	t.Run("load", func(t *testing.T) {
+		r, cancel := withTimeout(r, time.Second)
+		defer cancel()
+		blob, err := loader.Get(r, "foo.jpg")
+		require.NoError(t, err)
+		buf, err := blob.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, content, buf)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		r, cancel := withTimeout(r, time.Second)
+		defer cancel()
+		_, err := loader.Get(r, "bar.jpg")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("deadline not propagated", func(t *testing.T) {
+		_, err := loader.Get(r, "foo.jpg")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("max allowed size", func(t *testing.T) {
+		r, cancel := withTimeout(r, time.Second)
+		defer cancel()
+		_, err := New(ln.Addr().String(), WithInsecure(true), WithMaxAllowedSize(10)).Get(r, "foo.jpg")
+		assert.Equal(t, imagor.ErrMaxSizeExceeded, err)
+	})
+
+	t.Run("other services", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn, err := loader.dial()
+		require.NoError(t, err)
+		res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+	})
+}
@@ -0,0 +1,36 @@
+package grpcloader
+
+import (
+	"crypto/tls"
+	"google.golang.org/grpc"
+)
+
+type Option func(l *GRPCLoader)
+
+func WithTLSConfig(config *tls.Config) Option {
+	return func(l *GRPCLoader) {
+		if config != nil {
+			l.TLSConfig = config
+		}
+	}
+}
+
+func WithInsecure(insecure bool) Option {
+	return func(l *GRPCLoader) {
+		l.Insecure = insecure
+	}
+}
+
+func WithMaxAllowedSize(size int64) Option {
+	return func(l *GRPCLoader) {
+		if size > 0 {
+			l.MaxAllowedSize = size
+		}
+	}
+}
+
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(l *GRPCLoader) {
+		l.DialOptions = append(l.DialOptions, opts...)
+	}
+}
@@ -0,0 +1,14 @@
+package grpcloader
+
+import (
+	"google.golang.org/grpc"
+)
+
+// NewServer creates gRPC server serving Loader service implemented in Go.
+// Use RegisterLoaderServer instead for serving alongside other services on an existing server.
+// Services in other languages may generate server stubs from loader.proto
+func NewServer(srv LoaderServer, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	RegisterLoaderServer(s, srv)
+	return s
+}
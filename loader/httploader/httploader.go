@@ -109,11 +109,16 @@ func (h *HTTPLoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
 	if err != nil {
 		return nil, err
 	}
-	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+	var blob *imagor.Blob
+	blob = imagor.NewBlob(func() (io.ReadCloser, int64, error) {
 		resp, err := client.Do(req)
 		if err != nil {
 			return nil, 0, err
 		}
+		if etag := responseETag(resp); etag != "" {
+			// recorded with result for ETag check without requesting origin again
+			blob.SetETag(etag)
+		}
 		body := resp.Body
 		size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
 		if resp.Header.Get("Content-Encoding") == "gzip" {
@@ -131,7 +136,60 @@ func (h *HTTPLoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
 			return body, size, imagor.ErrUnsupportedFormat
 		}
 		return body, size, nil
-	}), nil
+	})
+	return blob, nil
+}
+
+// ETag resolves ETag of image from origin, falls back to Content-MD5.
+// If etag provided, conditional request is made with If-None-Match
+func (h *HTTPLoader) ETag(r *http.Request, image, etag string) (string, error) {
+	if image == "" {
+		return "", imagor.ErrInvalid
+	}
+	u, err := url.Parse(image)
+	if err != nil {
+		return "", imagor.ErrInvalid
+	}
+	if u.Host == "" || u.Scheme == "" {
+		if h.DefaultScheme == "" {
+			return "", imagor.ErrInvalid
+		}
+		image = h.DefaultScheme + "://" + image
+		if u, err = url.Parse(image); err != nil {
+			return "", imagor.ErrInvalid
+		}
+	}
+	if !isURLAllowed(u, h.AllowedSources) {
+		return "", imagor.ErrInvalid
+	}
+	req, err := h.newRequest(r, http.MethodHead, image)
+	if err != nil {
+		return "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	client := &http.Client{Transport: h.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return etag, nil
+	}
+	if resp.StatusCode >= 400 {
+		return "", imagor.NewErrorFromStatusCode(resp.StatusCode)
+	}
+	return responseETag(resp), nil
+}
+
+// responseETag ETag of response, falls back to Content-MD5
+func responseETag(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag
+	}
+	return resp.Header.Get("Content-MD5")
 }
 
 func (h *HTTPLoader) newRequest(r *http.Request, method, url string) (*http.Request, error) {
@@ -505,3 +505,79 @@ func TestWithGzip(t *testing.T) {
 		},
 	})
 }
+
+func TestETag(t *testing.T) {
+	loader := New(
+		WithTransport(roundTripFunc(func(r *http.Request) (w *http.Response, err error) {
+			assert.Equal(t, http.MethodHead, r.Method)
+			res := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     map[string][]string{},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}
+			switch r.URL.Path {
+			case "/md5":
+				res.Header.Set("Content-MD5", "Q2hlY2sgSW50ZWdyaXR5IQ==")
+			case "/missing":
+				res.StatusCode = http.StatusNotFound
+			default:
+				if r.Header.Get("If-None-Match") == `"abc"` {
+					res.StatusCode = http.StatusNotModified
+				} else {
+					res.Header.Set("ETag", `"abc"`)
+				}
+			}
+			return res, nil
+		})),
+	)
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/imagor", nil)
+	etag, err := loader.ETag(r, "https://foo.bar/baz", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc"`, etag)
+
+	etag, err = loader.ETag(r, "https://foo.bar/baz", `"abc"`)
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc"`, etag)
+
+	etag, err = loader.ETag(r, "https://foo.bar/baz", `"def"`)
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc"`, etag)
+
+	etag, err = loader.ETag(r, "https://foo.bar/md5", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Q2hlY2sgSW50ZWdyaXR5IQ==", etag)
+
+	_, err = loader.ETag(r, "https://foo.bar/missing", "")
+	assert.Equal(t, imagor.NewErrorFromStatusCode(http.StatusNotFound), err)
+
+	_, err = loader.ETag(r, "", "")
+	assert.Equal(t, imagor.ErrInvalid, err)
+}
+
+func TestGetETag(t *testing.T) {
+	loader := New(
+		WithTransport(roundTripFunc(func(r *http.Request) (w *http.Response, err error) {
+			res := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     map[string][]string{},
+				Body:       ioutil.NopCloser(strings.NewReader("foo")),
+			}
+			res.Header.Set("Content-Type", "image/jpeg")
+			if r.URL.Path == "/etag" {
+				res.Header.Set("ETag", `"abc"`)
+			}
+			return res, nil
+		})),
+	)
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/imagor", nil)
+	b, err := loader.Get(r, "https://foo.bar/etag")
+	require.NoError(t, err)
+	assert.Equal(t, `"abc"`, b.ETag())
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	b, err = loader.Get(r, "https://foo.bar/baz")
+	require.NoError(t, err)
+	assert.Empty(t, b.ETag())
+}
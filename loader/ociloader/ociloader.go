@@ -0,0 +1,349 @@
+package ociloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cshum/imagor"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const manifestAccept = "application/vnd.oci.image.manifest.v1+json, " +
+	"application/vnd.docker.distribution.manifest.v2+json"
+
+var digestRegex = regexp.MustCompile("^sha256:[a-f0-9]{64}$")
+
+// OCILoader loads image blobs stored as OCI artifacts from container registries,
+// by image key of format registry/repo@digest or registry/repo:tag
+type OCILoader struct {
+	// The Transport used to request registries, default http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// AllowedRegistries list of registry hosts allowed to load from,
+	// supports glob patterns such as *.pkg.dev
+	AllowedRegistries []string
+
+	// Username and Password for registry basic auth or token exchange
+	Username string
+	Password string
+
+	// Insecure uses plain http for registries e.g. localhost:5000
+	Insecure bool
+
+	// MaxAllowedSize maximum bytes allowed for image
+	MaxAllowedSize int64
+
+	mu     sync.Mutex
+	tokens map[string]token
+}
+
+type token struct {
+	value   string
+	expires time.Time
+}
+
+type reference struct {
+	Registry string
+	Repo     string
+	Tag      string
+	Digest   string
+}
+
+type manifest struct {
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Size      int64  `json:"size"`
+	} `json:"layers"`
+}
+
+func New(options ...Option) *OCILoader {
+	l := &OCILoader{
+		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		tokens:    map[string]token{},
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+// parseReference parses image key of format registry/repo@digest or registry/repo:tag
+func parseReference(image string) (reference, bool) {
+	var ref reference
+	registry, name, found := strings.Cut(image, "/")
+	if !found || name == "" ||
+		(!strings.ContainsAny(registry, ".:") && registry != "localhost") {
+		return reference{}, false
+	}
+	ref.Registry = registry
+	if repo, digest, found := strings.Cut(name, "@"); found {
+		if !digestRegex.MatchString(digest) {
+			return reference{}, false
+		}
+		ref.Repo, ref.Digest = repo, digest
+	} else if idx := strings.LastIndex(name, ":"); idx > 0 && !strings.Contains(name[idx:], "/") {
+		ref.Repo, ref.Tag = name[:idx], name[idx+1:]
+	} else {
+		return reference{}, false
+	}
+	if ref.Repo == "" || path.Clean(ref.Repo) != ref.Repo {
+		return reference{}, false
+	}
+	return ref, true
+}
+
+func (l *OCILoader) isAllowed(registry string) bool {
+	if len(l.AllowedRegistries) == 0 {
+		return true
+	}
+	for _, pattern := range l.AllowedRegistries {
+		if matched, _ := path.Match(pattern, registry); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *OCILoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	ref, ok := parseReference(image)
+	if !ok || !l.isAllowed(ref.Registry) {
+		return nil, imagor.ErrInvalid
+	}
+	client := &http.Client{Transport: l.Transport}
+	digest, size, err := l.resolve(r, client, ref)
+	if err != nil {
+		return nil, err
+	}
+	if l.MaxAllowedSize > 0 && size > l.MaxAllowedSize {
+		return nil, imagor.ErrMaxSizeExceeded
+	}
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		resp, err := l.do(r, client, ref, "blobs/"+digest, "")
+		if err != nil {
+			return nil, 0, err
+		}
+		if size <= 0 {
+			size = resp.ContentLength
+		}
+		if l.MaxAllowedSize > 0 && size > l.MaxAllowedSize {
+			_ = resp.Body.Close()
+			return nil, 0, imagor.ErrMaxSizeExceeded
+		}
+		return &digestReader{
+			ReadCloser: resp.Body,
+			hash:       sha256.New(),
+			digest:     digest,
+			size:       size,
+		}, size, nil
+	}), nil
+}
+
+// resolve resolves digest and size of the image blob.
+// Manifests are resolved into their first layer,
+// digest not referencing a manifest is treated as blob digest
+func (l *OCILoader) resolve(r *http.Request, client *http.Client, ref reference) (string, int64, error) {
+	tagOrDigest := ref.Tag
+	if ref.Digest != "" {
+		tagOrDigest = ref.Digest
+	}
+	resp, err := l.do(r, client, ref, "manifests/"+tagOrDigest, manifestAccept)
+	if err != nil {
+		if err == imagor.ErrNotFound && ref.Digest != "" {
+			return ref.Digest, 0, nil
+		}
+		return "", 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var m manifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&m); err != nil {
+		return "", 0, err
+	}
+	if len(m.Layers) == 0 || !digestRegex.MatchString(m.Layers[0].Digest) {
+		return "", 0, imagor.ErrNotFound
+	}
+	return m.Layers[0].Digest, m.Layers[0].Size, nil
+}
+
+func (l *OCILoader) url(ref reference, p string) string {
+	scheme := "https"
+	if l.Insecure {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Registry, ref.Repo, p)
+}
+
+// do performs registry request, with token auth upon Bearer challenge
+func (l *OCILoader) do(r *http.Request, client *http.Client, ref reference, p, accept string) (*http.Response, error) {
+	scope := "repository:" + ref.Repo + ":pull"
+	cacheKey := ref.Registry + "/" + scope
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, l.url(ref, p), nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		req.Header.Set("User-Agent", fmt.Sprintf("Imagor/%s", imagor.Version))
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := l.token(cacheKey); ok {
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		_ = resp.Body.Close()
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if req, err = newRequest(); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			t, err := l.fetchToken(r, client, cacheKey, challenge, scope)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+t)
+		} else if l.Username != "" {
+			req.SetBasicAuth(l.Username, l.Password)
+		} else {
+			return nil, imagor.ErrUnauthorized
+		}
+		if resp, err = client.Do(req); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode >= 400 {
+		_ = resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return nil, imagor.ErrNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return nil, imagor.ErrUnauthorized
+		}
+		return nil, imagor.NewErrorFromStatusCode(resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (l *OCILoader) token(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.tokens[key]
+	if !ok || time.Now().After(t.expires) {
+		return "", false
+	}
+	return t.value, true
+}
+
+// fetchToken exchanges token from realm of Bearer challenge
+// e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func (l *OCILoader) fetchToken(r *http.Request, client *http.Client, key, challenge, scope string) (string, error) {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return "", imagor.ErrUnauthorized
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, realm, nil)
+	if err != nil {
+		return "", err
+	}
+	q := req.URL.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	if s := params["scope"]; s != "" {
+		scope = s
+	}
+	q.Set("scope", scope)
+	req.URL.RawQuery = q.Encode()
+	if l.Username != "" {
+		req.SetBasicAuth(l.Username, l.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", imagor.ErrUnauthorized
+	}
+	var res struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return "", err
+	}
+	value := res.Token
+	if value == "" {
+		value = res.AccessToken
+	}
+	if value == "" {
+		return "", imagor.ErrUnauthorized
+	}
+	// default token lifetime 60 seconds per token spec
+	expiresIn := 60
+	if res.ExpiresIn > 0 {
+		expiresIn = res.ExpiresIn
+	}
+	l.mu.Lock()
+	l.tokens[key] = token{
+		value:   value,
+		expires: time.Now().Add(time.Duration(expiresIn)*time.Second - time.Second*5),
+	}
+	l.mu.Unlock()
+	return value, nil
+}
+
+func parseChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+	_, rest, _ := strings.Cut(challenge, " ")
+	for _, part := range strings.Split(rest, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			params[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return params
+}
+
+// digestReader verifies content digest upon EOF or reaching expected size
+type digestReader struct {
+	io.ReadCloser
+	hash   hash.Hash
+	digest string
+	size   int64
+	read   int64
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	d.hash.Write(p[:n])
+	d.read += int64(n)
+	if (err == io.EOF || (d.size > 0 && d.read >= d.size)) &&
+		"sha256:"+hex.EncodeToString(d.hash.Sum(nil)) != d.digest {
+		// withhold the last read such that consumers never complete with unverified content
+		return 0, fmt.Errorf("ociloader: digest mismatch %s", d.digest)
+	}
+	return n, err
+}
@@ -0,0 +1,131 @@
+package ociloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func digestOf(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestParseReference(t *testing.T) {
+	digest := digestOf([]byte("foo"))
+	tests := []struct {
+		image    string
+		expected reference
+		ok       bool
+	}{
+		{"ghcr.io/org/assets@" + digest, reference{Registry: "ghcr.io", Repo: "org/assets", Digest: digest}, true},
+		{"localhost:5000/assets:v1", reference{Registry: "localhost:5000", Repo: "assets", Tag: "v1"}, true},
+		{"localhost/assets:latest", reference{Registry: "localhost", Repo: "assets", Tag: "latest"}, true},
+		{"org/assets:v1", reference{}, false},
+		{"ghcr.io/org/assets", reference{}, false},
+		{"ghcr.io/org/assets@sha256:abc", reference{}, false},
+		{"ghcr.io/org/../assets:v1", reference{}, false},
+		{"ghcr.io/org:v1/assets", reference{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			ref, ok := parseReference(tt.image)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, ref)
+		})
+	}
+}
+
+func TestOCILoader(t *testing.T) {
+	content := []byte("image content")
+	digest := digestOf(content)
+	var tokenCalls int32
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			atomic.AddInt32(&tokenCalls, 1)
+			if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" ||
+				r.URL.Query().Get("scope") != "repository:org/assets:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"t0k3n","expires_in":300}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="registry",scope="repository:org/assets:pull"`, ts.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/org/assets/manifests/v1":
+			assert.Contains(t, r.Header.Get("Accept"), "application/vnd.oci.image.manifest.v1+json")
+			_, _ = fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"mediaType":"image/jpeg","digest":"%s","size":%d}]}`, digest, len(content))
+		case "/v2/org/assets/blobs/" + digest:
+			_, _ = w.Write(content)
+		case "/v2/org/assets/blobs/" + digestOf([]byte("corrupted")):
+			_, _ = w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	loader := New(WithInsecure(true), WithCredentials("user", "pass"), WithAllowedRegistries(host))
+
+	t.Run("tag", func(t *testing.T) {
+		blob, err := loader.Get(r, host+"/org/assets:v1")
+		require.NoError(t, err)
+		buf, err := blob.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, content, buf)
+	})
+
+	t.Run("blob digest", func(t *testing.T) {
+		blob, err := loader.Get(r, host+"/org/assets@"+digest)
+		require.NoError(t, err)
+		buf, err := blob.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, content, buf)
+		// token cached per scope
+		assert.Equal(t, int32(1), atomic.LoadInt32(&tokenCalls))
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		blob, err := loader.Get(r, host+"/org/assets@"+digestOf([]byte("corrupted")))
+		require.NoError(t, err)
+		_, err = blob.ReadAll()
+		assert.ErrorContains(t, err, "digest mismatch")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := loader.Get(r, host+"/org/assets:v2")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("registry not allowed", func(t *testing.T) {
+		_, err := New(WithAllowedRegistries("ghcr.io")).Get(r, host+"/org/assets:v1")
+		assert.Equal(t, imagor.ErrInvalid, err)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		_, err := New(WithInsecure(true), WithCredentials("user", "wrong")).Get(r, host+"/org/assets:v1")
+		assert.Equal(t, imagor.ErrUnauthorized, err)
+	})
+
+	t.Run("max allowed size", func(t *testing.T) {
+		_, err := New(WithInsecure(true), WithCredentials("user", "pass"), WithMaxAllowedSize(5)).Get(r, host+"/org/assets:v1")
+		assert.Equal(t, imagor.ErrMaxSizeExceeded, err)
+	})
+}
@@ -0,0 +1,49 @@
+package ociloader
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Option func(l *OCILoader)
+
+func WithTransport(transport http.RoundTripper) Option {
+	return func(l *OCILoader) {
+		if transport != nil {
+			l.Transport = transport
+		}
+	}
+}
+
+func WithAllowedRegistries(registries ...string) Option {
+	return func(l *OCILoader) {
+		for _, raw := range registries {
+			for _, registry := range strings.Split(raw, ",") {
+				if registry = strings.TrimSpace(registry); registry != "" {
+					l.AllowedRegistries = append(l.AllowedRegistries, registry)
+				}
+			}
+		}
+	}
+}
+
+func WithCredentials(username, password string) Option {
+	return func(l *OCILoader) {
+		l.Username = username
+		l.Password = password
+	}
+}
+
+func WithInsecure(insecure bool) Option {
+	return func(l *OCILoader) {
+		l.Insecure = insecure
+	}
+}
+
+func WithMaxAllowedSize(size int64) Option {
+	return func(l *OCILoader) {
+		if size > 0 {
+			l.MaxAllowedSize = size
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package retryloader
+
+import "time"
+
+type Option func(l *RetryLoader)
+
+func WithMaxAttempts(attempts int) Option {
+	return func(l *RetryLoader) {
+		if attempts > 0 {
+			l.MaxAttempts = attempts
+		}
+	}
+}
+
+func WithBackoff(backoff, maxBackoff time.Duration) Option {
+	return func(l *RetryLoader) {
+		if backoff > 0 {
+			l.Backoff = backoff
+		}
+		if maxBackoff > 0 {
+			l.MaxBackoff = maxBackoff
+		}
+	}
+}
+
+func WithRetryable(fn func(err error) bool) Option {
+	return func(l *RetryLoader) {
+		if fn != nil {
+			l.Retryable = fn
+		}
+	}
+}
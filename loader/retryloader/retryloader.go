@@ -0,0 +1,152 @@
+package retryloader
+
+import (
+	"context"
+	"errors"
+	"github.com/cshum/imagor"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryLoader retries Get of Loader on transient errors with exponential backoff,
+// such that flaky origins do not surface errors to clients immediately
+type RetryLoader struct {
+	Loader imagor.Loader
+
+	// MaxAttempts maximum number of attempts including the first one
+	MaxAttempts int
+
+	// Backoff delay before the first retry, doubled for every subsequent retry with jitter
+	Backoff time.Duration
+
+	// MaxBackoff maximum delay between retries
+	MaxBackoff time.Duration
+
+	// Retryable reports whether error is retryable, default IsTransient
+	Retryable func(err error) bool
+}
+
+func New(loader imagor.Loader, options ...Option) *RetryLoader {
+	l := &RetryLoader{
+		Loader:      loader,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond * 100,
+		MaxBackoff:  time.Second * 2,
+		Retryable:   IsTransient,
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+func (l *RetryLoader) Get(r *http.Request, image string) (blob *imagor.Blob, err error) {
+	ctx := r.Context()
+	for attempt := 1; ; attempt++ {
+		blob, err = l.Loader.Get(r, image)
+		if blob != nil && err == nil {
+			// lazy blob surfaces error on first read
+			err = blob.Err()
+		}
+		if err == nil || attempt >= l.MaxAttempts || !l.Retryable(err) || ctx.Err() != nil {
+			return
+		}
+		if !sleep(ctx, l.backoff(attempt)) {
+			return
+		}
+	}
+}
+
+// ETag resolves ETag from Loader if it implements imagor.ETagLoader
+func (l *RetryLoader) ETag(r *http.Request, image, etag string) (string, error) {
+	if etagLoader, ok := l.Loader.(imagor.ETagLoader); ok {
+		return etagLoader.ETag(r, image, etag)
+	}
+	return "", nil
+}
+
+// Health delegates health check to Loader if it implements imagor.HealthChecker
+func (l *RetryLoader) Health(ctx context.Context) error {
+	if checker, ok := l.Loader.(imagor.HealthChecker); ok {
+		return checker.Health(ctx)
+	}
+	return nil
+}
+
+// backoff returns delay before retry of attempt,
+// exponential with equal jitter and capped by MaxBackoff
+func (l *RetryLoader) backoff(attempt int) time.Duration {
+	d := l.Backoff
+	for i := 1; i < attempt && d < l.MaxBackoff; i++ {
+		d *= 2
+	}
+	if l.MaxBackoff > 0 && d > l.MaxBackoff {
+		d = l.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// IsTransient reports whether error is likely transient,
+// i.e. network errors, timeouts, rate limited or server errors of origin.
+// Not found and other client errors are not retried
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var e imagor.Error
+	if errors.As(err, &e) {
+		switch e.Code {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// RetryStorage Storage with Get retried by RetryLoader.
+// Other operations are delegated to Storage as-is
+type RetryStorage struct {
+	imagor.Storage
+	Retry *RetryLoader
+}
+
+func NewStorage(storage imagor.Storage, options ...Option) *RetryStorage {
+	return &RetryStorage{
+		Storage: storage,
+		Retry:   New(storage, options...),
+	}
+}
+
+func (s *RetryStorage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	return s.Retry.Get(r, image)
+}
+
+// Health delegates health check to Storage if it implements imagor.HealthChecker
+func (s *RetryStorage) Health(ctx context.Context) error {
+	return s.Retry.Health(ctx)
+}
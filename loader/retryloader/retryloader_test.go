@@ -0,0 +1,120 @@
+package retryloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type loaderFunc func(r *http.Request, image string) (*imagor.Blob, error)
+
+func (f loaderFunc) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	return f(r, image)
+}
+
+// flaky fails with errs in order, then succeeds
+func flaky(cnt *int, errs ...error) loaderFunc {
+	return func(r *http.Request, image string) (*imagor.Blob, error) {
+		*cnt++
+		if *cnt <= len(errs) {
+			err := errs[*cnt-1]
+			// error surfaced lazily on read
+			return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+				return nil, 0, err
+			}), nil
+		}
+		return imagor.NewBlobFromBytes([]byte(image)), nil
+	}
+}
+
+func TestRetryLoader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var cnt int
+	l := New(flaky(&cnt, imagor.NewErrorFromStatusCode(502), syscall.ECONNRESET),
+		WithBackoff(time.Millisecond, time.Millisecond*5))
+	blob, err := l.Get(r, "foo")
+	require.NoError(t, err)
+	buf, err := blob.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+	assert.Equal(t, 3, cnt)
+
+	cnt = 0
+	l = New(flaky(&cnt, imagor.ErrNotFound), WithBackoff(time.Millisecond, 0))
+	_, err = l.Get(r, "foo")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	assert.Equal(t, 1, cnt)
+
+	cnt = 0
+	l = New(flaky(&cnt, imagor.ErrTimeout, imagor.ErrTimeout, imagor.ErrTimeout),
+		WithMaxAttempts(2), WithBackoff(time.Millisecond, 0))
+	_, err = l.Get(r, "foo")
+	assert.Equal(t, imagor.ErrTimeout, err)
+	assert.Equal(t, 2, cnt)
+
+	cnt = 0
+	l = New(flaky(&cnt, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF),
+		WithBackoff(time.Second, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err = l.Get(r.WithContext(ctx), "foo")
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 1, cnt)
+}
+
+func TestBackoff(t *testing.T) {
+	l := New(nil, WithBackoff(time.Millisecond*100, time.Millisecond*300))
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		d := l.backoff(attempt + 1)
+		assert.GreaterOrEqual(t, int64(d), int64(max*time.Millisecond/2))
+		assert.LessOrEqual(t, int64(d), int64(max*time.Millisecond))
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, err := range []error{
+		imagor.ErrTimeout,
+		imagor.NewErrorFromStatusCode(429),
+		imagor.NewErrorFromStatusCode(503),
+		io.ErrUnexpectedEOF,
+		fmt.Errorf("dial: %w", syscall.ECONNREFUSED),
+	} {
+		assert.True(t, IsTransient(err), err.Error())
+	}
+	for _, err := range []error{
+		nil,
+		imagor.ErrNotFound,
+		imagor.ErrInvalid,
+		imagor.ErrUnsupportedFormat,
+		context.Canceled,
+		context.DeadlineExceeded,
+		errors.New("foo"),
+	} {
+		assert.False(t, IsTransient(err))
+	}
+}
+
+func TestRetryStorage(t *testing.T) {
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	var s imagor.Storage = NewStorage(memorystorage.New(), WithMaxAttempts(2))
+	require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+	blob, err := s.Get(r, "foo")
+	require.NoError(t, err)
+	buf, err := blob.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+	_, err = s.Get(r, "baz")
+	assert.Equal(t, imagor.ErrNotFound, err)
+}
@@ -0,0 +1,80 @@
+package routeloader
+
+import (
+	"github.com/cshum/imagor"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Route routes image keys matching Pattern to Loader
+type Route struct {
+	Pattern string
+	Loader  imagor.Loader
+
+	re *regexp.Regexp
+}
+
+// RouteLoader selects loader of the first route matching image key,
+// instead of trying all loaders in order.
+// Patterns are globs where * matches any characters including slashes,
+// e.g. cdn.example.com/*, *.s3.amazonaws.com/*, uploads/*.
+// URL scheme of both pattern and key is ignored
+type RouteLoader struct {
+	Routes []Route
+}
+
+func New(routes ...Route) *RouteLoader {
+	l := &RouteLoader{}
+	for _, route := range routes {
+		route.re = compile(route.Pattern)
+		l.Routes = append(l.Routes, route)
+	}
+	return l
+}
+
+func compile(pattern string) *regexp.Regexp {
+	parts := strings.Split(trimScheme(pattern), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func trimScheme(key string) string {
+	if _, rest, ok := strings.Cut(key, "://"); ok && !strings.Contains(key[:len(key)-len(rest)-3], "/") {
+		return rest
+	}
+	return key
+}
+
+// Match returns loader of the first route matching image key
+func (l *RouteLoader) Match(image string) (imagor.Loader, bool) {
+	key := trimScheme(image)
+	for _, route := range l.Routes {
+		if route.re.MatchString(key) {
+			return route.Loader, true
+		}
+	}
+	return nil, false
+}
+
+func (l *RouteLoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	loader, ok := l.Match(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	return loader.Get(r, image)
+}
+
+// ETag resolves ETag from the routed loader if it implements imagor.ETagLoader
+func (l *RouteLoader) ETag(r *http.Request, image, etag string) (string, error) {
+	loader, ok := l.Match(image)
+	if !ok {
+		return "", imagor.ErrInvalid
+	}
+	if etagLoader, ok := loader.(imagor.ETagLoader); ok {
+		return etagLoader.ETag(r, image, etag)
+	}
+	return "", nil
+}
@@ -0,0 +1,74 @@
+package routeloader
+
+import (
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type loaderFunc func(r *http.Request, image string) (*imagor.Blob, error)
+
+func (f loaderFunc) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	return f(r, image)
+}
+
+type etagLoader struct {
+	loaderFunc
+}
+
+func (l etagLoader) ETag(_ *http.Request, image, _ string) (string, error) {
+	return "etag:" + image, nil
+}
+
+func named(name string) loaderFunc {
+	return func(r *http.Request, image string) (*imagor.Blob, error) {
+		return imagor.NewBlobFromBytes([]byte(name)), nil
+	}
+}
+
+func TestRouteLoader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	l := New(
+		Route{Pattern: "https://cdn.example.com/*", Loader: etagLoader{named("s3")}},
+		Route{Pattern: "*.assets.example.com/*", Loader: named("gcs")},
+		Route{Pattern: "uploads/*.png", Loader: named("file")},
+		Route{Pattern: "*", Loader: named("http")},
+	)
+	tests := []struct {
+		image    string
+		expected string
+	}{
+		{"cdn.example.com/a/b.jpg", "s3"},
+		{"http://cdn.example.com/a.jpg", "s3"},
+		{"https://img.assets.example.com/a.jpg", "gcs"},
+		{"uploads/a/b.png", "file"},
+		{"uploads/a/b.jpg", "http"},
+		{"cdn.example.com.evil.com/a.jpg", "http"},
+		{"https://example.com/?u=https://cdn.example.com/a.jpg", "http"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			blob, err := l.Get(r, tt.image)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(buf))
+		})
+	}
+
+	etag, err := l.ETag(r, "cdn.example.com/a.jpg", "")
+	require.NoError(t, err)
+	assert.Equal(t, "etag:cdn.example.com/a.jpg", etag)
+	etag, err = l.ETag(r, "foo.jpg", "")
+	require.NoError(t, err)
+	assert.Equal(t, "", etag)
+
+	l = New(Route{Pattern: "cdn.example.com/*", Loader: named("s3")})
+	_, err = l.Get(r, "example.com/a.jpg")
+	assert.Equal(t, imagor.ErrInvalid, err)
+	_, err = l.ETag(r, "example.com/a.jpg", "")
+	assert.Equal(t, imagor.ErrInvalid, err)
+}
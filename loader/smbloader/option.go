@@ -0,0 +1,66 @@
+package smbloader
+
+import (
+	"strings"
+	"time"
+)
+
+type Option func(h *SMBLoader)
+
+func WithCredentials(username, password string) Option {
+	return func(s *SMBLoader) {
+		s.Username = username
+		s.Password = password
+	}
+}
+
+// WithDomain sets domain or workgroup of credentials
+func WithDomain(domain string) Option {
+	return func(s *SMBLoader) {
+		s.Domain = domain
+	}
+}
+
+func WithBaseDir(baseDir string) Option {
+	return func(s *SMBLoader) {
+		if baseDir != "" {
+			s.BaseDir = "/" + strings.Trim(strings.ReplaceAll(baseDir, `\`, "/"), "/")
+		}
+	}
+}
+
+func WithPathPrefix(prefix string) Option {
+	return func(s *SMBLoader) {
+		if prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/")
+			if prefix != "/" {
+				prefix += "/"
+			}
+			s.PathPrefix = prefix
+		}
+	}
+}
+
+func WithSafeChars(chars string) Option {
+	return func(s *SMBLoader) {
+		if chars != "" {
+			s.SafeChars = chars
+		}
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SMBLoader) {
+		if timeout > 0 {
+			s.Timeout = timeout
+		}
+	}
+}
+
+func WithMaxIdleConns(n int) Option {
+	return func(s *SMBLoader) {
+		if n >= 0 {
+			s.MaxIdleConns = n
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package smbloader
+
+import (
+	"context"
+	"errors"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/hirochachacha/go-smb2"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// SMBLoader loads images from SMB/CIFS file share e.g. Windows file server or Samba,
+// over SMB 2 and 3 dialects with NTLM authentication
+type SMBLoader struct {
+	Addr         string
+	Share        string
+	Username     string
+	Password     string
+	Domain       string
+	BaseDir      string
+	PathPrefix   string
+	SafeChars    string
+	Timeout      time.Duration
+	MaxIdleConns int
+
+	safeChars imagorpath.SafeChars
+	idle      chan *conn
+}
+
+// conn SMB session with share mounted over TCP connection
+type conn struct {
+	*smb2.Share
+	session *smb2.Session
+	netConn net.Conn
+}
+
+func (c *conn) Close() error {
+	_ = c.Umount()
+	_ = c.session.Logoff()
+	return c.netConn.Close()
+}
+
+// New creates SMB loader of server address e.g. fileserver:445 and share name
+func New(addr, share string, options ...Option) *SMBLoader {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "445")
+	}
+	s := &SMBLoader{
+		Addr:         addr,
+		Share:        strings.Trim(share, `/\`),
+		BaseDir:      "/",
+		PathPrefix:   "/",
+		Timeout:      time.Second * 30,
+		MaxIdleConns: 4,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.safeChars = imagorpath.NewSafeChars(s.SafeChars)
+	s.idle = make(chan *conn, s.MaxIdleConns)
+	return s
+}
+
+// Path returns file path within share
+func (s *SMBLoader) Path(image string) (string, bool) {
+	image = "/" + imagorpath.Normalize(image, s.safeChars)
+	if !strings.HasPrefix(image, s.PathPrefix) {
+		return "", false
+	}
+	return path.Join(s.BaseDir, strings.TrimPrefix(image, s.PathPrefix)), true
+}
+
+func (s *SMBLoader) dial() (*conn, error) {
+	netConn, err := net.DialTimeout("tcp", s.Addr, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	dialer := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     s.Username,
+			Password: s.Password,
+			Domain:   s.Domain,
+		},
+	}
+	session, err := dialer.DialContext(ctx, netConn)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	share, err := session.WithContext(ctx).Mount(s.Share)
+	if err != nil {
+		_ = session.Logoff()
+		_ = netConn.Close()
+		return nil, err
+	}
+	return &conn{Share: share, session: session, netConn: netConn}, nil
+}
+
+// acquire returns idle connection from pool if still alive, otherwise dials new connection
+func (s *SMBLoader) acquire() (*conn, error) {
+	for {
+		select {
+		case c := <-s.idle:
+			if _, err := c.Stat(""); err != nil {
+				_ = c.Close()
+				continue
+			}
+			return c, nil
+		default:
+			return s.dial()
+		}
+	}
+}
+
+// release returns connection to pool unless it is broken or pool is full
+func (s *SMBLoader) release(c *conn, err error) {
+	if err != nil && !isProtocolErr(err) {
+		_ = c.Close()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		_ = c.Close()
+	}
+}
+
+func (s *SMBLoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	// fail early if not found, such that next loader can be attempted
+	stat, err := s.stat(r.Context(), image)
+	if err != nil {
+		return nil, err
+	}
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		c, err := s.acquire()
+		if err != nil {
+			return nil, 0, err
+		}
+		file, err := c.WithContext(r.Context()).Open(sharePath(image))
+		if err != nil {
+			s.release(c, err)
+			return nil, 0, wrapErr(err)
+		}
+		return &releaseReader{ReadCloser: file, release: func(err error) {
+			s.release(c, err)
+		}}, stat.Size, nil
+	}), nil
+}
+
+type releaseReader struct {
+	io.ReadCloser
+	release func(err error)
+}
+
+func (r *releaseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.release(err)
+	return err
+}
+
+func (s *SMBLoader) Stat(ctx context.Context, image string) (*imagor.Stat, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	return s.stat(ctx, image)
+}
+
+func (s *SMBLoader) stat(ctx context.Context, image string) (*imagor.Stat, error) {
+	c, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.WithContext(ctx).Stat(sharePath(image))
+	s.release(c, err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	if info.IsDir() {
+		return nil, imagor.ErrNotFound
+	}
+	return &imagor.Stat{
+		Size:         info.Size(),
+		ModifiedTime: info.ModTime(),
+	}, nil
+}
+
+// Health checks if share is accessible
+func (s *SMBLoader) Health(_ context.Context) error {
+	c, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	s.release(c, nil)
+	return nil
+}
+
+// sharePath file path relative to share root, as leading separator is not allowed
+func sharePath(image string) string {
+	return strings.TrimPrefix(image, "/")
+}
+
+// NTSTATUS codes of paths not being a loadable file
+const (
+	statusObjectNameInvalid = 0xC0000033
+	statusFileIsADirectory  = 0xC00000BA
+)
+
+func wrapErr(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return imagor.ErrNotFound
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return imagor.NewError(err.Error(), http.StatusForbidden)
+	}
+	var e *smb2.ResponseError
+	if errors.As(err, &e) && (e.Code == statusObjectNameInvalid || e.Code == statusFileIsADirectory) {
+		return imagor.ErrNotFound
+	}
+	return err
+}
+
+// isProtocolErr checks if error is SMB status error, such that connection can be reused
+func isProtocolErr(err error) bool {
+	var e *smb2.ResponseError
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) || errors.As(err, &e)
+}
@@ -0,0 +1,94 @@
+package smbloader
+
+import (
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/hirochachacha/go-smb2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestSMBLoader_Path(t *testing.T) {
+	tests := []struct {
+		name       string
+		baseDir    string
+		prefix     string
+		image      string
+		expected   string
+		expectedOk bool
+	}{
+		{
+			name:       "path under base dir",
+			baseDir:    `photos\2022`,
+			image:      "/foo/bar.jpg",
+			expected:   "/photos/2022/foo/bar.jpg",
+			expectedOk: true,
+		},
+		{
+			name:       "path under with prefix",
+			prefix:     "/foo",
+			image:      "/foo/bar.jpg",
+			expected:   "/bar.jpg",
+			expectedOk: true,
+		},
+		{
+			name:   "path not under prefix",
+			prefix: "/foo",
+			image:  "/fooo/bar.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := New("fileserver", "images", WithBaseDir(tt.baseDir), WithPathPrefix(tt.prefix)).Path(tt.image)
+			assert.Equal(t, tt.expected, res)
+			assert.Equal(t, tt.expectedOk, ok)
+		})
+	}
+	assert.Equal(t, "fileserver:445", New("fileserver", "images").Addr)
+}
+
+func TestWrapErr(t *testing.T) {
+	for _, err := range []error{
+		os.ErrNotExist,
+		&os.PathError{Op: "stat", Path: `photos\a.jpg`, Err: os.ErrNotExist},
+		&os.PathError{Op: "open", Path: "photos", Err: &smb2.ResponseError{Code: statusFileIsADirectory}},
+		&smb2.ResponseError{Code: statusObjectNameInvalid},
+	} {
+		assert.Equal(t, imagor.ErrNotFound, wrapErr(err))
+		assert.True(t, isProtocolErr(err))
+	}
+	err := wrapErr(&os.PathError{Op: "open", Path: "a.jpg", Err: os.ErrPermission})
+	assert.Equal(t, http.StatusForbidden, imagor.WrapError(err).Code)
+
+	transportErr := &smb2.TransportError{Err: fmt.Errorf("broken pipe")}
+	assert.Equal(t, transportErr, wrapErr(transportErr))
+	assert.False(t, isProtocolErr(transportErr))
+}
+
+func TestSMBLoaderDialError(t *testing.T) {
+	// server closing connection prior to negotiation
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.Close()
+		}
+	}()
+	s := New(ln.Addr().String(), "images", WithCredentials("user", "pass"))
+	_, err = s.Get((&http.Request{}).WithContext(context.Background()), "a.jpg")
+	assert.Error(t, err)
+	assert.NotEqual(t, imagor.ErrNotFound, err)
+	assert.Error(t, s.Health(context.Background()))
+}
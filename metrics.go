@@ -0,0 +1,76 @@
+package imagor
+
+import (
+	"time"
+)
+
+// Observation loader or storage operation observed by Metrics
+type Observation struct {
+	// Role loader, storage, result-storage or meta-storage
+	Role string
+	// Name type name of loader or storage e.g. S3Storage
+	Name string
+	// Op operation get, put, delete, stat or meta
+	Op string
+	// Size bytes of image loaded or saved, 0 if unknown
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
+
+// Metrics pluggable collector of loader and storage operations,
+// e.g. counters and latency histograms of Prometheus or StatsD
+type Metrics interface {
+	Observe(o Observation)
+}
+
+// MetricsFunc Metrics adapter of ordinary function
+type MetricsFunc func(o Observation)
+
+// Observe calls f(o)
+func (f MetricsFunc) Observe(o Observation) {
+	f(o)
+}
+
+// observe reports operation op of loader or storage v started at start
+func (app *Imagor) observe(v interface{}, op string, start time.Time, size int64, err error) {
+	if app.Metrics == nil {
+		return
+	}
+	app.Metrics.Observe(Observation{
+		Role:     app.roleOf(v),
+		Name:     getType(v),
+		Op:       op,
+		Size:     size,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// roleOf role of loader or storage v, in precedence of storage roles over loader
+func (app *Imagor) roleOf(v interface{}) string {
+	for _, storage := range app.Storages {
+		if isSameInstance(storage, v) {
+			return "storage"
+		}
+	}
+	for _, storage := range app.ResultStorages {
+		if isSameInstance(storage, v) {
+			return "result-storage"
+		}
+	}
+	for _, storage := range app.MetaStorages {
+		if isSameInstance(storage, v) {
+			return "meta-storage"
+		}
+	}
+	return "loader"
+}
+
+// blobSize size of blob for metrics, 0 if empty
+func blobSize(blob *Blob) int64 {
+	if blob == nil {
+		return 0
+	}
+	return blob.Size()
+}
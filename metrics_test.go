@@ -0,0 +1,52 @@
+package imagor
+
+import (
+	"context"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	var mu sync.Mutex
+	var observations []Observation
+	app := New(
+		WithUnsafe(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			if image == "bar" {
+				return nil, ErrNotFound
+			}
+			return NewBlobFromBytes([]byte("foo")), nil
+		})),
+		WithStorages(newMapStore()),
+		WithResultStorages(newMapStore()),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			return blob, nil
+		})),
+		WithMetrics(MetricsFunc(func(o Observation) {
+			mu.Lock()
+			defer mu.Unlock()
+			o.Duration = 0
+			observations = append(observations, o)
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []Observation{
+		{Role: "result-storage", Name: "mapStore", Op: "get", Err: ErrNotFound},
+		{Role: "storage", Name: "mapStore", Op: "get", Err: ErrNotFound},
+		{Role: "loader", Name: "loaderFunc", Op: "get", Size: 3},
+		{Role: "storage", Name: "mapStore", Op: "put", Size: 3},
+		{Role: "result-storage", Name: "mapStore", Op: "put", Size: 3},
+	}, observations)
+
+	observations = nil
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/bar", nil))
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, Observation{Role: "loader", Name: "loaderFunc", Op: "get", Err: ErrNotFound}, observations[len(observations)-1])
+}
@@ -0,0 +1,254 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"github.com/cshum/imagor"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrListNotSupported source storage does not implement imagor.Lister
+var ErrListNotSupported = errors.New("imagor: source storage does not support listing")
+
+// ErrCheckpointNotFound checkpoint key no longer listed by source storage
+var ErrCheckpointNotFound = errors.New("imagor: migrate checkpoint key not found in source storage, remove checkpoint file to start over")
+
+// Migrate copies images with metadata from one storage to another
+type Migrate struct {
+	Prefix      string
+	Concurrency int
+	Overwrite   bool
+	Logger      *zap.Logger
+
+	// Checkpoint file recording the last key, up to which all listed keys have been migrated.
+	// Resumed runs skip listed keys up to the checkpoint key without looking them up.
+	// Removed once migration completes without failure
+	Checkpoint string
+}
+
+// Result migration counters
+type Result struct {
+	Copied  int64
+	Skipped int64
+	Failed  int64
+	Resumed int64
+}
+
+func New(options ...Option) *Migrate {
+	m := &Migrate{
+		Concurrency: 10,
+		Logger:      zap.NewNop(),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// Run walks source storage under Prefix and copies each image to target storage.
+// Images that already exist in target storage with the same size are skipped unless Overwrite,
+// so that an interrupted migration can be resumed by running again.
+// With Checkpoint, resumed runs also skip looking up keys migrated by previous runs
+func (m *Migrate) Run(ctx context.Context, from, to imagor.Storage) (*Result, error) {
+	lister, ok := from.(imagor.Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	var (
+		res  = &Result{}
+		wg   sync.WaitGroup
+		sema = make(chan struct{}, m.Concurrency)
+		cp   *checkpoint
+		seq  int
+	)
+	if m.Checkpoint != "" {
+		var err error
+		if cp, err = loadCheckpoint(m.Checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	err := lister.List(ctx, m.Prefix, func(key string) error {
+		if cp.skip(key) {
+			res.Resumed++
+			return nil
+		}
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		i := seq
+		seq++
+		cp.listed(i, key)
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sema
+				wg.Done()
+			}()
+			copied, err := m.copy(ctx, from, to, key)
+			if err != nil {
+				atomic.AddInt64(&res.Failed, 1)
+				m.Logger.Warn("migrate", zap.String("key", key), zap.Error(err))
+			} else if copied {
+				atomic.AddInt64(&res.Copied, 1)
+				m.Logger.Debug("migrate", zap.String("key", key))
+			} else {
+				atomic.AddInt64(&res.Skipped, 1)
+			}
+			if err == nil {
+				if err := cp.done(i); err != nil {
+					m.Logger.Warn("migrate", zap.String("checkpoint", m.Checkpoint), zap.Error(err))
+				}
+			}
+		}()
+		return nil
+	})
+	wg.Wait()
+	if err == nil && cp != nil {
+		if cp.resume != "" {
+			err = ErrCheckpointNotFound
+		} else if res.Failed == 0 {
+			err = os.Remove(m.Checkpoint)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = cp.save()
+		}
+	}
+	return res, err
+}
+
+// checkpoint tracks the low watermark of migrated keys in listing order.
+// Keys migrate concurrently, such that the watermark only advances
+// when all preceding keys are done, and stops at failed keys
+type checkpoint struct {
+	file   string
+	resume string
+
+	mu        sync.Mutex
+	pending   map[int]string
+	completed map[int]bool
+	next      int
+	last      string
+	saved     time.Time
+}
+
+func loadCheckpoint(file string) (*checkpoint, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &checkpoint{
+		file:      file,
+		resume:    strings.TrimSpace(string(buf)),
+		pending:   map[int]string{},
+		completed: map[int]bool{},
+		saved:     time.Now(),
+	}, nil
+}
+
+// skip reports whether key precedes or equals resume key in listing order
+func (c *checkpoint) skip(key string) bool {
+	if c == nil || c.resume == "" {
+		return false
+	}
+	if key == c.resume {
+		c.last = c.resume
+		c.resume = ""
+	}
+	return true
+}
+
+func (c *checkpoint) listed(i int, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.pending[i] = key
+	c.mu.Unlock()
+}
+
+func (c *checkpoint) done(i int) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completed[i] = true
+	for c.completed[c.next] {
+		c.last = c.pending[c.next]
+		delete(c.completed, c.next)
+		delete(c.pending, c.next)
+		c.next++
+	}
+	if time.Since(c.saved) < time.Second {
+		return nil
+	}
+	c.saved = time.Now()
+	return c.write()
+}
+
+func (c *checkpoint) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write()
+}
+
+// write replaces checkpoint file atomically
+func (c *checkpoint) write() error {
+	if c.last == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.WriteString(c.last + "\n"); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file)
+}
+
+func (m *Migrate) copy(ctx context.Context, from, to imagor.Storage, key string) (bool, error) {
+	stat, err := from.Stat(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if !m.Overwrite {
+		if target, err := to.Stat(ctx, key); err == nil && target.Size == stat.Size {
+			return false, nil
+		}
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return false, err
+	}
+	blob, err := from.Get(r, key)
+	if err != nil {
+		return false, err
+	}
+	if meta, err := from.Meta(ctx, key); err == nil {
+		blob.Meta = meta
+	} else if !errors.Is(err, imagor.ErrNotFound) {
+		return false, err
+	}
+	if err := to.Put(ctx, key, blob); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package migrate
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/filestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type noListStorage struct {
+	imagor.Storage
+}
+
+type failStorage struct {
+	imagor.Storage
+	Key string
+}
+
+func (s failStorage) Put(ctx context.Context, key string, blob *imagor.Blob) error {
+	if key == s.Key {
+		return imagor.ErrInternal
+	}
+	return s.Storage.Put(ctx, key, blob)
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	srcDir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+	dstDir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+	src := filestorage.New(srcDir)
+	dst := filestorage.New(dstDir)
+
+	blob := imagor.NewBlobFromBytes([]byte("foo"))
+	blob.Meta = &imagor.Meta{Format: "jpeg", Width: 167, Height: 169}
+	require.NoError(t, src.Put(ctx, "fit-in/a.jpg", blob))
+	require.NoError(t, src.Put(ctx, "fit-in/b.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	require.NoError(t, src.Put(ctx, "c.jpg", imagor.NewBlobFromBytes([]byte("baz"))))
+
+	res, err := New(WithPrefix("fit-in"), WithConcurrency(2)).Run(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Copied: 2}, res)
+
+	b, err := dst.Get(&http.Request{}, "fit-in/a.jpg")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+	meta, err := dst.Meta(ctx, "fit-in/a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, blob.Meta, meta)
+	_, err = dst.Stat(ctx, "c.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	res, err = New().Run(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Copied: 1, Skipped: 2}, res)
+
+	res, err = New(WithOverwrite(true)).Run(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Copied: 3}, res)
+
+	_, err = New().Run(ctx, noListStorage{src}, dst)
+	assert.Equal(t, ErrListNotSupported, err)
+}
+
+func TestMigrateCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	src := filestorage.New(t.TempDir())
+	dst := filestorage.New(t.TempDir())
+	file := filepath.Join(t.TempDir(), "checkpoint")
+	for _, key := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+		require.NoError(t, src.Put(ctx, key, imagor.NewBlobFromBytes([]byte(key))))
+	}
+
+	// watermark stops before failed key
+	res, err := New(WithCheckpoint(file), WithConcurrency(1)).Run(ctx, src, failStorage{dst, "c.jpg"})
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Copied: 3, Failed: 1}, res)
+	buf, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "b.jpg\n", string(buf))
+
+	// resumes after checkpoint key, removes checkpoint once completed
+	res, err = New(WithCheckpoint(file)).Run(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Copied: 1, Skipped: 1, Resumed: 2}, res)
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	_, err = dst.Stat(ctx, "c.jpg")
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(file, []byte("x.jpg\n"), 0644))
+	res, err = New(WithCheckpoint(file)).Run(ctx, src, dst)
+	assert.Equal(t, ErrCheckpointNotFound, err)
+	assert.Equal(t, &Result{Resumed: 4}, res)
+}
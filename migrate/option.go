@@ -0,0 +1,39 @@
+package migrate
+
+import "go.uber.org/zap"
+
+type Option func(m *Migrate)
+
+func WithPrefix(prefix string) Option {
+	return func(m *Migrate) {
+		m.Prefix = prefix
+	}
+}
+
+func WithConcurrency(concurrency int) Option {
+	return func(m *Migrate) {
+		if concurrency > 0 {
+			m.Concurrency = concurrency
+		}
+	}
+}
+
+func WithOverwrite(overwrite bool) Option {
+	return func(m *Migrate) {
+		m.Overwrite = overwrite
+	}
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(m *Migrate) {
+		if logger != nil {
+			m.Logger = logger
+		}
+	}
+}
+
+func WithCheckpoint(file string) Option {
+	return func(m *Migrate) {
+		m.Checkpoint = file
+	}
+}
@@ -3,6 +3,9 @@ package imagor
 import (
 	"github.com/cshum/imagor/imagorpath"
 	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strings"
 	"time"
 )
 
@@ -34,12 +37,46 @@ func WithResultStorages(savers ...Storage) Option {
 	}
 }
 
+// WithResultStorageRepair copies results served by fallback result storages
+// back into the preceding result storages that missed or failed
+func WithResultStorageRepair(enabled bool) Option {
+	return func(app *Imagor) {
+		app.ResultStorageRepair = enabled
+	}
+}
+
+// WithResultStorageRedirect redirects clients to the result storage serving the result,
+// given the result storage implements URLStorage e.g. presigned URL
+func WithResultStorageRedirect(enabled bool) Option {
+	return func(app *Imagor) {
+		app.ResultStorageRedirect = enabled
+	}
+}
+
+func WithMetaStorages(savers ...Storage) Option {
+	return func(app *Imagor) {
+		app.MetaStorages = append(app.MetaStorages, savers...)
+	}
+}
+
 func WithProcessors(processors ...Processor) Option {
 	return func(app *Imagor) {
 		app.Processors = append(app.Processors, processors...)
 	}
 }
 
+// WithNamedProcessor registers processor that requests can be routed to by processor(name) filter
+func WithNamedProcessor(name string, processor Processor) Option {
+	return func(app *Imagor) {
+		if name != "" && processor != nil {
+			if app.NamedProcessors == nil {
+				app.NamedProcessors = map[string]Processor{}
+			}
+			app.NamedProcessors[name] = processor
+		}
+	}
+}
+
 func WithRequestTimeout(timeout time.Duration) Option {
 	return func(app *Imagor) {
 		if timeout > 0 {
@@ -64,6 +101,30 @@ func WithCacheHeaderSWR(swr time.Duration) Option {
 	}
 }
 
+func WithCacheHeaderSIE(sie time.Duration) Option {
+	return func(app *Imagor) {
+		if sie > 0 {
+			app.CacheHeaderSIE = sie
+		}
+	}
+}
+
+func WithCacheHeaderMinTTL(ttl time.Duration) Option {
+	return func(app *Imagor) {
+		if ttl > 0 {
+			app.CacheHeaderMinTTL = ttl
+		}
+	}
+}
+
+func WithCacheHeaderMaxTTL(ttl time.Duration) Option {
+	return func(app *Imagor) {
+		if ttl > 0 {
+			app.CacheHeaderMaxTTL = ttl
+		}
+	}
+}
+
 func WithCacheHeaderNoCache(nocache bool) Option {
 	return func(app *Imagor) {
 		if nocache {
@@ -122,6 +183,41 @@ func WithAutoAVIF(enable bool) Option {
 	}
 }
 
+func WithAutoJXL(enable bool) Option {
+	return func(app *Imagor) {
+		app.AutoJXL = enable
+	}
+}
+
+// WithAutoQualityHints applies Save-Data and ECT client hints to quality(auto)
+func WithAutoQualityHints(enable bool) Option {
+	return func(app *Imagor) {
+		app.AutoQualityHints = enable
+	}
+}
+
+// WithDPRClientHints applies Sec-CH-DPR or DPR client hints as default dpr(n)
+func WithDPRClientHints(enable bool) Option {
+	return func(app *Imagor) {
+		app.DPRClientHints = enable
+	}
+}
+
+// WithAutoFormatPriority negotiation priority of auto formats, default jxl, avif, webp
+func WithAutoFormatPriority(formats ...string) Option {
+	return func(app *Imagor) {
+		var priority []string
+		for _, format := range formats {
+			if format = strings.ToLower(strings.TrimSpace(format)); format != "" {
+				priority = append(priority, format)
+			}
+		}
+		if len(priority) > 0 {
+			app.AutoFormatPriority = priority
+		}
+	}
+}
+
 func WithBasePathRedirect(url string) Option {
 	return func(app *Imagor) {
 		app.BasePathRedirect = url
@@ -140,6 +236,22 @@ func WithModifiedTimeCheck(enabled bool) Option {
 	}
 }
 
+// WithMaxNestedDepth enables signed imagor path as image source of another request,
+// up to the maximum nesting depth
+func WithMaxNestedDepth(depth int) Option {
+	return func(app *Imagor) {
+		app.MaxNestedDepth = depth
+	}
+}
+
+// WithETagCheck with ModifiedTimeCheck also compares source ETag recorded with the result
+// against origin via conditional request
+func WithETagCheck(enabled bool) Option {
+	return func(app *Imagor) {
+		app.ETagCheck = enabled
+	}
+}
+
 func WithDisableErrorBody(disabled bool) Option {
 	return func(app *Imagor) {
 		app.DisableErrorBody = disabled
@@ -158,6 +270,15 @@ func WithDebug(debug bool) Option {
 	}
 }
 
+// WithResultKeyNamespace prefixes result keys with namespace,
+// such that bumping namespace invalidates previous results.
+// "auto" derives namespace from imagor and processor versions and base params
+func WithResultKeyNamespace(namespace string) Option {
+	return func(app *Imagor) {
+		app.ResultKeyNamespace = strings.Trim(strings.TrimSpace(namespace), "/")
+	}
+}
+
 func WithResultKey(resultKey ResultKey) Option {
 	return func(app *Imagor) {
 		app.ResultKey = resultKey
@@ -171,3 +292,215 @@ func WithSigner(signer imagorpath.Signer) Option {
 		}
 	}
 }
+
+func WithMaxFilters(num int) Option {
+	return func(app *Imagor) {
+		if num > 0 {
+			app.MaxFilters = num
+		}
+	}
+}
+
+func WithMaxBlur(radius float64) Option {
+	return func(app *Imagor) {
+		if radius > 0 {
+			app.MaxBlur = radius
+		}
+	}
+}
+
+func WithMaxWatermarks(num int) Option {
+	return func(app *Imagor) {
+		if num > 0 {
+			app.MaxWatermarks = num
+		}
+	}
+}
+
+func WithMaxLoads(num int) Option {
+	return func(app *Imagor) {
+		if num > 0 {
+			app.MaxLoads = num
+		}
+	}
+}
+
+func WithMaxPathLength(length int) Option {
+	return func(app *Imagor) {
+		if length > 0 {
+			app.MaxPathLength = length
+		}
+	}
+}
+
+func WithMaxImageLength(length int) Option {
+	return func(app *Imagor) {
+		if length > 0 {
+			app.MaxImageLength = length
+		}
+	}
+}
+
+func WithMaxFilterArgsLength(length int) Option {
+	return func(app *Imagor) {
+		if length > 0 {
+			app.MaxFilterArgsLength = length
+		}
+	}
+}
+
+func WithAuthFunc(fn AuthFunc) Option {
+	return func(app *Imagor) {
+		app.AuthFunc = fn
+	}
+}
+
+// WithUnsafeCIDRs restricts unsafe mode to client IP within CIDRs e.g. 127.0.0.1/32, 10.0.0.0/8.
+// Plain IP addresses are accepted as single host ranges
+func WithUnsafeCIDRs(cidrs ...string) Option {
+	return func(app *Imagor) {
+		for _, cidr := range cidrs {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+				app.UnsafeCIDRs = append(app.UnsafeCIDRs, ipNet)
+			}
+		}
+	}
+}
+
+// WithUnsafePathPrefixes restricts unsafe mode to image paths with prefixes
+func WithUnsafePathPrefixes(prefixes ...string) Option {
+	return func(app *Imagor) {
+		for _, prefix := range prefixes {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				app.UnsafePathPrefixes = append(app.UnsafePathPrefixes, prefix)
+			}
+		}
+	}
+}
+
+// WithEnforcedWatermark injects watermark filter with args e.g. logo.png,repeat,bottom,10
+// to all requests, except those satisfying exempt function if provided
+func WithEnforcedWatermark(args string, exempt func(r *http.Request) bool) Option {
+	return func(app *Imagor) {
+		app.EnforcedWatermark = strings.TrimSpace(args)
+		app.WatermarkExempt = exempt
+	}
+}
+
+func WithSanitizeSVG(enabled bool) Option {
+	return func(app *Imagor) {
+		app.SanitizeSVG = enabled
+	}
+}
+
+// WithFilterSchemas validates and normalizes filter args against schemas,
+// e.g. imagorpath.DefaultFilterSchemas
+func WithFilterSchemas(schemas imagorpath.FilterSchemas) Option {
+	return func(app *Imagor) {
+		app.FilterSchemas = schemas
+	}
+}
+
+// WithSurrogateKeyHeader emits source image key on header e.g. Surrogate-Key, Cache-Tag
+// for CDN tag based purging, with additional keys from optional keys function
+func WithSurrogateKeyHeader(header string, keys func(r *http.Request, p imagorpath.Params) []string) Option {
+	return func(app *Imagor) {
+		app.SurrogateKeyHeader = strings.TrimSpace(header)
+		app.SurrogateKeys = keys
+	}
+}
+
+// WithFavicon favicon.ico content. Responds empty 200 if not set
+func WithFavicon(buf []byte) Option {
+	return func(app *Imagor) {
+		app.Favicon = buf
+	}
+}
+
+// WithWebhook enables source change webhook endpoint at path authenticated by HMAC secret.
+// Purges source and derived results of notified images, then re-generates presets in background
+func WithWebhook(path, secret string, presets ...string) Option {
+	return func(app *Imagor) {
+		if path != "" && secret != "" {
+			app.WebhookPath = "/" + strings.Trim(path, "/")
+			app.WebhookSecret = secret
+			for _, preset := range presets {
+				if preset = strings.TrimSpace(preset); preset != "" {
+					app.WebhookPresets = append(app.WebhookPresets, preset)
+				}
+			}
+		}
+	}
+}
+
+// WithUpload enables upload endpoint at path, writing uploaded images into storages.
+// Requests are authenticated by one-time upload tokens minted by UploadTokenSigner of secret.
+// Used tokens are tracked in memory, hence replay is only prevented within a single instance
+func WithUpload(path, secret string) Option {
+	return func(app *Imagor) {
+		if path != "" && secret != "" {
+			app.UploadPath = "/" + strings.Trim(path, "/")
+			app.UploadSigner = NewUploadTokenSigner(secret)
+		}
+	}
+}
+
+// WithUploadMaxSize maximum upload request body size in bytes,
+// applies regardless of upload token max size
+func WithUploadMaxSize(size int64) Option {
+	return func(app *Imagor) {
+		if size > 0 {
+			app.UploadMaxSize = size
+		}
+	}
+}
+
+// WithMetrics collects metrics of loader and storage operations
+func WithMetrics(metrics Metrics) Option {
+	return func(app *Imagor) {
+		app.Metrics = metrics
+	}
+}
+
+// WithWorkers background workers running along Imagor lifecycle e.g. queue consumers
+func WithWorkers(workers ...Worker) Option {
+	return func(app *Imagor) {
+		app.Workers = append(app.Workers, workers...)
+	}
+}
+
+// WithSweepInterval periodically deletes expired objects from result storages
+// that implement Lister and Expirer, e.g. file storage with expiration
+func WithSweepInterval(interval time.Duration) Option {
+	return func(app *Imagor) {
+		if interval > 0 {
+			app.SweepInterval = interval
+		}
+	}
+}
+
+// WithRobotsTxt robots.txt content. Responds empty 200 if not set
+func WithRobotsTxt(buf []byte) Option {
+	return func(app *Imagor) {
+		app.RobotsTxt = buf
+	}
+}
+
+// WithNotFoundPlaceholder responds not found source with placeholder image and no-cache headers
+// instead of JSON 404, e.g. TransparentPixel
+func WithNotFoundPlaceholder(buf []byte) Option {
+	return func(app *Imagor) {
+		app.NotFoundPlaceholder = buf
+	}
+}
@@ -0,0 +1,120 @@
+package imagor
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Palette extracts up to n most common colors of image as hex strings, most dominant first.
+// Colors are clustered by k-means into at least 5 clusters, such that dominant color is not a blend,
+// seeded by the most populated buckets of color histogram.
+// Transparent pixels are ignored. Image is expected to be small e.g. 64px thumbnail
+func Palette(img image.Image, n int) []string {
+	if n < 1 {
+		return nil
+	}
+	var (
+		bounds  = img.Bounds()
+		pixels  [][3]float64
+		buckets = map[int][]int{}
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			// un-premultiply to 8 bit
+			r, g, b = r*0xff/a, g*0xff/a, b*0xff/a
+			key := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+			buckets[key] = append(buckets[key], len(pixels))
+			pixels = append(pixels, [3]float64{float64(r), float64(g), float64(b)})
+		}
+	}
+	if len(pixels) == 0 {
+		return nil
+	}
+	// seed centroids by mean of the most populated buckets
+	keys := make([]int, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if li, lj := len(buckets[keys[i]]), len(buckets[keys[j]]); li != lj {
+			return li > lj
+		}
+		return keys[i] < keys[j]
+	})
+	limit := n
+	if n < 5 {
+		n = 5
+	}
+	if len(keys) < n {
+		n = len(keys)
+	}
+	centroids := make([][3]float64, n)
+	for i := range centroids {
+		idx := buckets[keys[i]]
+		for _, p := range idx {
+			for c := 0; c < 3; c++ {
+				centroids[i][c] += pixels[p][c] / float64(len(idx))
+			}
+		}
+	}
+	counts := make([]int, n)
+	assign := make([]int, len(pixels))
+	for iter := 0; iter < 10; iter++ {
+		changed := false
+		for i, p := range pixels {
+			nearest, dist := 0, -1.0
+			for k, c := range centroids {
+				dr, dg, db := p[0]-c[0], p[1]-c[1], p[2]-c[2]
+				if d := dr*dr + dg*dg + db*db; dist < 0 || d < dist {
+					nearest, dist = k, d
+				}
+			}
+			if iter == 0 || assign[i] != nearest {
+				assign[i] = nearest
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([][3]float64, n)
+		counts = make([]int, n)
+		for i, p := range pixels {
+			k := assign[i]
+			counts[k]++
+			for c := 0; c < 3; c++ {
+				sums[k][c] += p[c]
+			}
+		}
+		for k := range centroids {
+			if counts[k] > 0 {
+				for c := 0; c < 3; c++ {
+					centroids[k][c] = sums[k][c] / float64(counts[k])
+				}
+			}
+		}
+	}
+	order := make([]int, 0, n)
+	for k := range centroids {
+		if counts[k] > 0 {
+			order = append(order, k)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+	if len(order) > limit {
+		order = order[:limit]
+	}
+	palette := make([]string, len(order))
+	for i, k := range order {
+		c := centroids[k]
+		palette[i] = fmt.Sprintf("#%02x%02x%02x", uint8(c[0]+0.5), uint8(c[1]+0.5), uint8(c[2]+0.5))
+	}
+	return palette
+}
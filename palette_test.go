@@ -0,0 +1,30 @@
+package imagor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestPalette(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 10))
+	draw.Draw(img, image.Rect(0, 0, 30, 10), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(30, 0, 38, 10), image.NewUniform(color.NRGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	// transparent pixels ignored
+	draw.Draw(img, image.Rect(38, 0, 40, 10), image.Transparent, image.Point{}, draw.Src)
+
+	assert.Equal(t, []string{"#ff0000", "#0000ff"}, Palette(img, 5))
+	assert.Equal(t, []string{"#ff0000"}, Palette(img, 1))
+	assert.Empty(t, Palette(img, 0))
+	assert.Empty(t, Palette(image.NewNRGBA(image.Rect(0, 0, 10, 10)), 5))
+
+	gradient := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			gradient.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	assert.Len(t, Palette(gradient, 8), 8)
+}
@@ -0,0 +1,60 @@
+package prewarm
+
+import (
+	"bytes"
+	"context"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaQueue Queue consuming object-created events from Kafka topic as consumer group,
+// e.g. bucket notifications of MinIO or Ceph. Message values are either
+// S3 event notifications in JSON or plain object keys.
+// Offsets are committed on Ack. As offsets are committed per partition,
+// failed messages are redelivered only if no later message of the partition was committed
+type KafkaQueue struct {
+	Reader *kafka.Reader
+}
+
+// NewKafkaQueue creates KafkaQueue of topic, consuming as group ID
+func NewKafkaQueue(brokers []string, topic, groupID string) *KafkaQueue {
+	return &KafkaQueue{
+		Reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: groupID,
+		}),
+	}
+}
+
+func (q *KafkaQueue) Receive(ctx context.Context) ([]*Message, error) {
+	m, err := q.Reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []*Message{{
+		Keys: ParseKafkaValue(m.Value),
+		Ack: func(ctx context.Context) error {
+			return q.Reader.CommitMessages(ctx, m)
+		},
+	}}, nil
+}
+
+// Close closes the Kafka reader, leaving the consumer group
+func (q *KafkaQueue) Close() error {
+	return q.Reader.Close()
+}
+
+// ParseKafkaValue parses object keys from Kafka message value,
+// either S3 event notification in JSON or plain object key.
+// Malformed events result in no keys
+func ParseKafkaValue(value []byte) []string {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return nil
+	}
+	if value[0] == '{' {
+		keys, _ := ParseS3Event(value)
+		return keys
+	}
+	return []string{string(value)}
+}
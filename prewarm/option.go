@@ -0,0 +1,32 @@
+package prewarm
+
+import (
+	"go.uber.org/zap"
+	"strings"
+)
+
+type Option func(w *Warmer)
+
+// WithTrimPrefix trims prefix from object keys of events to form image keys,
+// e.g. base directory of the loader bucket
+func WithTrimPrefix(prefix string) Option {
+	return func(w *Warmer) {
+		if prefix = strings.TrimPrefix(prefix, "/"); prefix != "" {
+			w.TrimPrefix = strings.TrimSuffix(prefix, "/") + "/"
+		}
+	}
+}
+
+func WithConcurrency(n int) Option {
+	return func(w *Warmer) {
+		if n > 0 {
+			w.Concurrency = n
+		}
+	}
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(w *Warmer) {
+		w.Logger = logger
+	}
+}
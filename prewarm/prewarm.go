@@ -0,0 +1,194 @@
+package prewarm
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message object-created event message received from Queue
+type Message struct {
+	// Keys object keys of images created
+	Keys []string
+	// Ack acknowledges the message as processed,
+	// messages not acknowledged are expected to be redelivered by the queue
+	Ack func(ctx context.Context) error
+}
+
+// Queue source of object-created events e.g. S3 notifications via SQS.
+// Queue implementing io.Closer is closed once Warmer stopped running
+type Queue interface {
+	// Receive blocks until messages are received or ctx is done
+	Receive(ctx context.Context) ([]*Message, error)
+}
+
+// Warmer imagor.Worker consuming object-created events from Queue,
+// pre-generates presets for each new image such that results are ready on first view
+type Warmer struct {
+	App         *imagor.Imagor
+	Queue       Queue
+	Presets     []string
+	TrimPrefix  string
+	Concurrency int
+	// Logger defaults to logger of App
+	Logger *zap.Logger
+
+	// RetryInterval interval between receive attempts after queue error
+	RetryInterval time.Duration
+}
+
+// New creates Warmer of app consuming queue
+func New(app *imagor.Imagor, queue Queue, presets []string, options ...Option) *Warmer {
+	w := &Warmer{
+		App:           app,
+		Queue:         queue,
+		Concurrency:   4,
+		RetryInterval: time.Second * 5,
+	}
+	for _, preset := range presets {
+		if preset = strings.Trim(strings.TrimSpace(preset), "/"); preset != "" {
+			w.Presets = append(w.Presets, preset)
+		}
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w
+}
+
+// Run consumes queue until ctx is cancelled
+func (w *Warmer) Run(ctx context.Context) {
+	if w.Logger == nil {
+		w.Logger = w.App.Logger
+	}
+	if closer, ok := w.Queue.(io.Closer); ok {
+		defer func() {
+			if err := closer.Close(); err != nil {
+				w.Logger.Warn("prewarm-close", zap.Error(err))
+			}
+		}()
+	}
+	sema := make(chan struct{}, w.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for ctx.Err() == nil {
+		msgs, err := w.Queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.Logger.Warn("prewarm-receive", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.RetryInterval):
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			select {
+			case <-ctx.Done():
+				return
+			case sema <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(msg *Message) {
+				defer func() {
+					<-sema
+					wg.Done()
+				}()
+				w.Handle(ctx, msg)
+			}(msg)
+		}
+	}
+}
+
+// Handle pre-generates presets of images of message, and acknowledges the message
+// unless any of them failed with server error that may succeed on redelivery
+func (w *Warmer) Handle(ctx context.Context, msg *Message) {
+	var retry bool
+	for _, key := range msg.Keys {
+		image := strings.TrimPrefix(strings.TrimPrefix(key, "/"), w.TrimPrefix)
+		if image == "" {
+			continue
+		}
+		for _, preset := range w.Presets {
+			path := preset + "/" + image
+			if err := w.warm(ctx, path); err != nil {
+				if e := imagor.WrapError(err); e.Code >= 500 || e.Timeout() {
+					retry = true
+				}
+				w.Logger.Warn("prewarm", zap.String("path", path), zap.Error(err))
+			} else if w.App.Debug {
+				w.Logger.Debug("prewarm", zap.String("path", path))
+			}
+		}
+	}
+	if retry || msg.Ack == nil {
+		return
+	}
+	if err := msg.Ack(ctx); err != nil {
+		w.Logger.Warn("prewarm-ack", zap.Error(err))
+	}
+}
+
+func (w *Warmer) warm(ctx context.Context, path string) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return err
+	}
+	p := imagorpath.Parse(path)
+	if w.App.Signer != nil {
+		p.Hash = w.App.Signer.Sign(p.Path)
+	}
+	_, err = w.App.Do(r, p)
+	return err
+}
+
+type s3Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+	// Message SNS notification envelope
+	Message string `json:"Message"`
+}
+
+// ParseS3Event parses object keys of ObjectCreated records from S3 event notification,
+// either delivered directly or wrapped by SNS notification.
+// Event names of S3 compatible servers prefixed with s3: e.g. MinIO are also accepted.
+// Test events and other event types result in no keys
+func ParseS3Event(body []byte) ([]string, error) {
+	var event s3Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.Message != "" && len(event.Records) == 0 {
+		return ParseS3Event([]byte(event.Message))
+	}
+	var keys []string
+	for _, record := range event.Records {
+		if !strings.HasPrefix(strings.TrimPrefix(record.EventName, "s3:"), "ObjectCreated:") {
+			continue
+		}
+		// object keys of S3 events are URL encoded with spaces as +
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
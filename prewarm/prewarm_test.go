@@ -0,0 +1,140 @@
+package prewarm
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type loaderFunc func(r *http.Request, image string) (*imagor.Blob, error)
+
+func (f loaderFunc) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	return f(r, image)
+}
+
+type processorFunc func(ctx context.Context, blob *imagor.Blob, p imagorpath.Params, load imagor.LoadFunc) (*imagor.Blob, error)
+
+func (f processorFunc) Startup(ctx context.Context) error  { return nil }
+func (f processorFunc) Shutdown(ctx context.Context) error { return nil }
+func (f processorFunc) Process(ctx context.Context, blob *imagor.Blob, p imagorpath.Params, load imagor.LoadFunc) (*imagor.Blob, error) {
+	return f(ctx, blob, p, load)
+}
+
+type chanQueue chan *Message
+
+func (q chanQueue) Receive(ctx context.Context) ([]*Message, error) {
+	select {
+	case msg := <-q:
+		return []*Message{msg}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// closerQueue chanQueue recording if closed
+type closerQueue struct {
+	chanQueue
+	closed bool
+}
+
+func (q *closerQueue) Close() error {
+	q.closed = true
+	return nil
+}
+
+func TestParseS3Event(t *testing.T) {
+	keys, err := ParseS3Event([]byte(`{"Records":[
+		{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"images/my+photo%281%29.jpg"}}},
+		{"eventName":"ObjectRemoved:Delete","s3":{"object":{"key":"images/b.jpg"}}},
+		{"eventName":"ObjectCreated:CompleteMultipartUpload","s3":{"object":{"key":"images/c.jpg"}}}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"images/my photo(1).jpg", "images/c.jpg"}, keys)
+
+	keys, err = ParseS3Event([]byte(`{"Type":"Notification","Message":"{\"Records\":[{\"eventName\":\"ObjectCreated:Put\",\"s3\":{\"object\":{\"key\":\"a.png\"}}}]}"}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.png"}, keys)
+
+	keys, err = ParseS3Event([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent"}`))
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	keys, err = ParseS3Event([]byte(`{"EventName":"s3:ObjectCreated:Put","Key":"mybucket/images/a.jpg","Records":[
+		{"eventName":"s3:ObjectCreated:Put","s3":{"object":{"key":"images%2Fa.jpg"}}}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"images/a.jpg"}, keys)
+
+	_, err = ParseS3Event([]byte(`boom`))
+	assert.Error(t, err)
+}
+
+func TestParseKafkaValue(t *testing.T) {
+	assert.Equal(t, []string{"images/a b.jpg"}, ParseKafkaValue([]byte(" images/a b.jpg\n")))
+	assert.Equal(t, []string{"images/c.jpg"}, ParseKafkaValue([]byte(
+		`{"Records":[{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"images/c.jpg"}}}]}`)))
+	assert.Empty(t, ParseKafkaValue([]byte(`{"boom"`)))
+	assert.Empty(t, ParseKafkaValue([]byte(" ")))
+}
+
+func TestWarmer(t *testing.T) {
+	var mu sync.Mutex
+	var processed []string
+	app := imagor.New(
+		imagor.WithSigner(imagorpath.NewDefaultSigner("1234")),
+		imagor.WithLoaders(loaderFunc(func(r *http.Request, image string) (*imagor.Blob, error) {
+			if image == "down.jpg" {
+				return nil, imagor.NewError("origin down", http.StatusBadGateway)
+			}
+			if image == "missing.jpg" {
+				return nil, imagor.ErrNotFound
+			}
+			return imagor.NewBlobFromBytes([]byte(image)), nil
+		})),
+		imagor.WithProcessors(processorFunc(func(ctx context.Context, blob *imagor.Blob, p imagorpath.Params, load imagor.LoadFunc) (*imagor.Blob, error) {
+			mu.Lock()
+			processed = append(processed, p.Path)
+			mu.Unlock()
+			return blob, nil
+		})),
+	)
+	queue := &closerQueue{chanQueue: make(chanQueue)}
+	w := New(app, queue, []string{"fit-in/200x200/", " ", "/filters:format(webp)"},
+		WithTrimPrefix("/images"), WithConcurrency(2))
+	assert.Equal(t, []string{"fit-in/200x200", "filters:format(webp)"}, w.Presets)
+	assert.Equal(t, "images/", w.TrimPrefix)
+
+	acked := make(chan string, 3)
+	newMessage := func(name string, keys ...string) *Message {
+		return &Message{Keys: keys, Ack: func(ctx context.Context) error {
+			acked <- name
+			return nil
+		}}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	queue.chanQueue <- newMessage("a", "images/a.jpg")
+	assert.Equal(t, "a", <-acked)
+	queue.chanQueue <- newMessage("b", "images/down.jpg")
+	queue.chanQueue <- newMessage("c", "images/missing.jpg")
+	assert.Equal(t, "c", <-acked)
+	cancel()
+	<-done
+	assert.Empty(t, acked)
+	assert.True(t, queue.closed)
+
+	mu.Lock()
+	sort.Strings(processed)
+	assert.Equal(t, []string{"filters:format(webp)/a.jpg", "fit-in/200x200/a.jpg"}, processed)
+	mu.Unlock()
+}
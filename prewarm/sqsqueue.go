@@ -0,0 +1,55 @@
+package prewarm
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQSQueue Queue receiving S3 event notifications from AWS SQS by long polling.
+// Messages are deleted from SQS on Ack, otherwise redelivered after visibility timeout
+type SQSQueue struct {
+	SQS      *sqs.SQS
+	QueueURL string
+}
+
+// NewSQSQueue creates SQSQueue of queue URL
+func NewSQSQueue(sess *session.Session, queueURL string) *SQSQueue {
+	return &SQSQueue{
+		SQS:      sqs.New(sess),
+		QueueURL: queueURL,
+	}
+}
+
+func (q *SQSQueue) Receive(ctx context.Context) ([]*Message, error) {
+	out, err := q.SQS.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.QueueURL),
+		MaxNumberOfMessages: aws.Int64(10),
+		WaitTimeSeconds:     aws.Int64(20),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*Message
+	for _, m := range out.Messages {
+		if m.Body == nil || m.ReceiptHandle == nil {
+			continue
+		}
+		// malformed messages result in no keys and are acknowledged,
+		// as they would never succeed on redelivery
+		keys, _ := ParseS3Event([]byte(*m.Body))
+		msgs = append(msgs, &Message{Keys: keys, Ack: q.ack(*m.ReceiptHandle)})
+	}
+	return msgs, nil
+}
+
+func (q *SQSQueue) ack(receiptHandle string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := q.SQS.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(q.QueueURL),
+			ReceiptHandle: aws.String(receiptHandle),
+		})
+		return err
+	}
+}
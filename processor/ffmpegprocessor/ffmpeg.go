@@ -0,0 +1,152 @@
+package ffmpegprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FFmpegProcessor converts animated GIF and WebP into MP4 or WebM video by format(mp4) or format(webm),
+// using the ffmpeg binary. Requests of other formats are passed to the next processor
+type FFmpegProcessor struct {
+	Binary      string
+	MaxDuration time.Duration
+	Logger      *zap.Logger
+	Debug       bool
+}
+
+func New(options ...Option) *FFmpegProcessor {
+	f := &FFmpegProcessor{
+		Binary: "ffmpeg",
+		Logger: zap.NewNop(),
+	}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+func (f *FFmpegProcessor) Startup(_ context.Context) error {
+	if _, err := exec.LookPath(f.Binary); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
+
+func (f *FFmpegProcessor) Shutdown(_ context.Context) error {
+	return nil
+}
+
+func (f *FFmpegProcessor) Process(
+	ctx context.Context, blob *imagor.Blob, p imagorpath.Params, _ imagor.LoadFunc,
+) (*imagor.Blob, error) {
+	format := videoFormat(p)
+	if format == "" || !blob.SupportsAnimation() {
+		return nil, imagor.ErrPass
+	}
+	reader, _, err := blob.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	args := f.args(format, p)
+	if f.Debug {
+		f.Logger.Debug("ffmpeg", zap.Strings("args", args))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.Binary, args...)
+	cmd.Stdin = reader
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, imagor.NewError("ffmpeg: "+msg, http.StatusUnprocessableEntity)
+	}
+	return imagor.NewBlobFromBytes(stdout.Bytes()), nil
+}
+
+func videoFormat(p imagorpath.Params) (format string) {
+	for _, filter := range p.Filters {
+		if filter.Name == "format" {
+			format = strings.ToLower(strings.TrimSpace(filter.Args))
+		}
+	}
+	if format == "mp4" || format == "webm" {
+		return
+	}
+	return ""
+}
+
+func (f *FFmpegProcessor) args(format string, p imagorpath.Params) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-an"}
+	if f.MaxDuration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(f.MaxDuration.Seconds(), 'f', -1, 64))
+	}
+	// yuv420p requires even dimensions
+	args = append(args, "-vf", scale(p)+"scale=trunc(iw/2)*2:trunc(ih/2)*2", "-pix_fmt", "yuv420p")
+	quality := -1
+	for _, filter := range p.Filters {
+		if filter.Name == "quality" {
+			if q, err := strconv.Atoi(filter.Args); err == nil && q >= 0 && q <= 100 {
+				quality = q
+			}
+		}
+	}
+	if format == "webm" {
+		// VP9 constant quality mode, crf 0-63
+		args = append(args, "-c:v", "libvpx-vp9", "-b:v", "0", "-crf", strconv.Itoa(crf(quality, 63, 35)), "-f", "webm")
+	} else {
+		// fragmented mp4 allows writing to pipe without seeking
+		args = append(args, "-c:v", "libx264", "-crf", strconv.Itoa(crf(quality, 51, 23)),
+			"-movflags", "frag_keyframe+empty_moov", "-f", "mp4")
+	}
+	return append(args, "pipe:1")
+}
+
+// scale resize filter by params dimensions
+func scale(p imagorpath.Params) string {
+	w, h := p.Width, p.Height
+	if w <= 0 && h <= 0 {
+		return ""
+	}
+	if w <= 0 || h <= 0 {
+		if w <= 0 {
+			w = -2
+		}
+		if h <= 0 {
+			h = -2
+		}
+		return fmt.Sprintf("scale=%d:%d,", w, h)
+	}
+	if p.FitIn {
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,", w, h)
+	}
+	if p.Stretch {
+		return fmt.Sprintf("scale=%d:%d,", w, h)
+	}
+	return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,", w, h, w, h)
+}
+
+// crf maps quality 0-100 into encoder constant rate factor, lower crf is higher quality
+func crf(quality, max, fallback int) int {
+	if quality < 0 {
+		return fallback
+	}
+	return (100 - quality) * max / 100
+}
@@ -0,0 +1,57 @@
+package ffmpegprocessor
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArgs(t *testing.T) {
+	f := New(WithMaxDuration(time.Second * 5))
+	tests := []struct {
+		path   string
+		expect string
+	}{
+		{
+			path:   "filters:format(mp4)/foo.gif",
+			expect: "-hide_banner -loglevel error -i pipe:0 -an -t 5 -vf scale=trunc(iw/2)*2:trunc(ih/2)*2 -pix_fmt yuv420p -c:v libx264 -crf 23 -movflags frag_keyframe+empty_moov -f mp4 pipe:1",
+		},
+		{
+			path:   "fit-in/200x100/filters:format(webm):quality(60)/foo.gif",
+			expect: "-hide_banner -loglevel error -i pipe:0 -an -t 5 -vf scale=200:100:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2 -pix_fmt yuv420p -c:v libvpx-vp9 -b:v 0 -crf 25 -f webm pipe:1",
+		},
+		{
+			path:   "200x0/filters:format(mp4):quality(100)/foo.gif",
+			expect: "-hide_banner -loglevel error -i pipe:0 -an -t 5 -vf scale=200:-2,scale=trunc(iw/2)*2:trunc(ih/2)*2 -pix_fmt yuv420p -c:v libx264 -crf 0 -movflags frag_keyframe+empty_moov -f mp4 pipe:1",
+		},
+		{
+			path:   "200x100/filters:format(mp4)/foo.gif",
+			expect: "-hide_banner -loglevel error -i pipe:0 -an -t 5 -vf scale=200:100:force_original_aspect_ratio=increase,crop=200:100,scale=trunc(iw/2)*2:trunc(ih/2)*2 -pix_fmt yuv420p -c:v libx264 -crf 23 -movflags frag_keyframe+empty_moov -f mp4 pipe:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p := imagorpath.Parse(tt.path)
+			assert.Equal(t, tt.expect, strings.Join(f.args(videoFormat(p), p), " "))
+		})
+	}
+}
+
+func TestProcessPass(t *testing.T) {
+	f := New()
+	ctx := context.Background()
+	_, err := f.Process(ctx, imagor.NewBlobFromPath("../../testdata/demo1.jpg"),
+		imagorpath.Parse("filters:format(mp4)/demo1.jpg"), nil)
+	assert.Equal(t, imagor.ErrPass, err)
+	_, err = f.Process(ctx, imagor.NewBlobFromPath("../../testdata/dancing-banana.gif"),
+		imagorpath.Parse("filters:format(webp)/dancing-banana.gif"), nil)
+	assert.Equal(t, imagor.ErrPass, err)
+}
+
+func TestStartup(t *testing.T) {
+	assert.Error(t, New(WithBinary("ffmpeg-not-exists")).Startup(context.Background()))
+}
@@ -0,0 +1,38 @@
+package ffmpegprocessor
+
+import (
+	"go.uber.org/zap"
+	"time"
+)
+
+type Option func(f *FFmpegProcessor)
+
+func WithBinary(binary string) Option {
+	return func(f *FFmpegProcessor) {
+		if binary != "" {
+			f.Binary = binary
+		}
+	}
+}
+
+func WithMaxDuration(duration time.Duration) Option {
+	return func(f *FFmpegProcessor) {
+		if duration > 0 {
+			f.MaxDuration = duration
+		}
+	}
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(f *FFmpegProcessor) {
+		if logger != nil {
+			f.Logger = logger
+		}
+	}
+}
+
+func WithDebug(debug bool) Option {
+	return func(f *FFmpegProcessor) {
+		f.Debug = debug
+	}
+}
@@ -0,0 +1,79 @@
+package stdprocessor
+
+import (
+	"image"
+	"math"
+)
+
+// linear applies a * v + b to RGB channels, following vips processor
+func linear(img *image.NRGBA, a, b [3]float64) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		for k := 0; k < 3; k++ {
+			img.Pix[i+k] = uint8(math.Round(math.Max(math.Min(a[k]*float64(img.Pix[i+k])+b[k], 255), 0)))
+		}
+	}
+}
+
+// modulate multiplies lightness and chroma, and rotates hue in degrees in LCh space,
+// same as vips modulate
+func modulate(img *image.NRGBA, brightness, saturation, hue float64) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		l, a, b := toLab(img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+		c := math.Hypot(a, b) * saturation
+		h := math.Atan2(b, a) + hue*math.Pi/180
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = fromLab(l*brightness, c*math.Cos(h), c*math.Sin(h))
+	}
+}
+
+// D65 white point
+const xn, yn, zn = 0.95047, 1.0, 1.08883
+
+func toLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func fromLinear(c float64) uint8 {
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return uint8(math.Round(math.Max(math.Min(c*255, 255), 0)))
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > 216.0/24389 {
+		return t3
+	}
+	return (116*t - 16) * 27 / 24389
+}
+
+func toLab(r8, g8, b8 uint8) (l, a, b float64) {
+	r, g, bl := toLinear(r8), toLinear(g8), toLinear(b8)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*bl) / xn
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*bl) / yn
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*bl) / zn
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func fromLab(l, a, b float64) (uint8, uint8, uint8) {
+	fy := (l + 16) / 116
+	x := labFInv(fy+a/500) * xn
+	y := labFInv(fy) * yn
+	z := labFInv(fy-b/200) * zn
+	return fromLinear(3.2404542*x - 1.5371385*y - 0.4985314*z),
+		fromLinear(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+		fromLinear(0.0556434*x - 0.2040259*y + 1.0572252*z)
+}
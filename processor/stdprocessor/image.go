@@ -0,0 +1,520 @@
+package stdprocessor
+
+import (
+	"encoding/binary"
+	"github.com/cshum/imagor/imagorpath"
+	"golang.org/x/image/colornames"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// transform crop, resize and flip image by params, following vips processor semantics
+func (s *StdProcessor) transform(img image.Image, p imagorpath.Params, upscale, stretch bool) *image.NRGBA {
+	var (
+		b          = img.Bounds()
+		origWidth  = float64(b.Dx())
+		origHeight = float64(b.Dy())
+		r          = b
+	)
+	if p.CropRight > 0 || p.CropLeft > 0 || p.CropBottom > 0 || p.CropTop > 0 {
+		cropLeft := math.Max(p.CropLeft, 0)
+		cropTop := math.Max(p.CropTop, 0)
+		cropRight := p.CropRight
+		cropBottom := p.CropBottom
+		if p.CropLeft < 1 && p.CropTop < 1 && p.CropRight <= 1 && p.CropBottom <= 1 {
+			// percentage
+			cropLeft = math.Round(cropLeft * origWidth)
+			cropTop = math.Round(cropTop * origHeight)
+			cropRight = math.Round(cropRight * origWidth)
+			cropBottom = math.Round(cropBottom * origHeight)
+		}
+		if cropRight == 0 {
+			cropRight = origWidth - 1
+		}
+		if cropBottom == 0 {
+			cropBottom = origHeight - 1
+		}
+		cropRight = math.Min(cropRight, origWidth-1)
+		cropBottom = math.Min(cropBottom, origHeight-1)
+		if cropRight > cropLeft && cropBottom > cropTop {
+			r = image.Rect(
+				int(cropLeft), int(cropTop), int(cropRight), int(cropBottom),
+			).Add(b.Min)
+		}
+	}
+	var (
+		srcWidth  = r.Dx()
+		srcHeight = r.Dy()
+		w         = p.Width
+		h         = p.Height
+		dw        = srcWidth
+		dh        = srcHeight
+	)
+	if w == 0 && h == 0 {
+		w, h = srcWidth, srcHeight
+	} else if w == 0 {
+		w = srcWidth * h / srcHeight
+		if !upscale && w > srcWidth {
+			w = srcWidth
+		}
+	} else if h == 0 {
+		h = srcHeight * w / srcWidth
+		if !upscale && h > srcHeight {
+			h = srcHeight
+		}
+	}
+	if p.FitIn {
+		if upscale || w < srcWidth || h < srcHeight {
+			f := math.Min(float64(w)/float64(srcWidth), float64(h)/float64(srcHeight))
+			dw = int(math.Round(float64(srcWidth) * f))
+			dh = int(math.Round(float64(srcHeight) * f))
+		}
+	} else if stretch {
+		if upscale || (w < srcWidth && h < srcHeight) {
+			dw, dh = w, h
+		}
+	} else if upscale || w < srcWidth || h < srcHeight {
+		f := math.Max(float64(w)/float64(srcWidth), float64(h)/float64(srcHeight))
+		if !upscale && f > 1 {
+			f = 1
+		}
+		dw = int(math.Min(float64(w), math.Round(float64(srcWidth)*f)))
+		dh = int(math.Min(float64(h), math.Round(float64(srcHeight)*f)))
+		cw := int(math.Min(float64(srcWidth), math.Round(float64(dw)/f)))
+		ch := int(math.Min(float64(srcHeight), math.Round(float64(dh)/f)))
+		r = image.Rect(0, 0, cw, ch).Add(r.Min).Add(
+			image.Pt(offset(p.HAlign, srcWidth-cw), offset(p.VAlign, srcHeight-ch)))
+	}
+	if dw > s.MaxWidth || dh > s.MaxHeight {
+		f := math.Min(float64(s.MaxWidth)/float64(dw), float64(s.MaxHeight)/float64(dh))
+		dw = int(math.Round(float64(dw) * f))
+		dh = int(math.Round(float64(dh) * f))
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	if dw == r.Dx() && dh == r.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, r, draw.Src, nil)
+	}
+	if p.HFlip {
+		flip(dst, true)
+	}
+	if p.VFlip {
+		flip(dst, false)
+	}
+	return dst
+}
+
+// gaussianBlur blurs image by separable gaussian kernel, weighted by alpha
+func gaussianBlur(img *image.NRGBA, sigma float64) *image.NRGBA {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, radius*2+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	tmp := convolve(img, kernel, true)
+	return convolve(tmp, kernel, false)
+}
+
+// sharpen image by unsharp mask of gaussian sigma
+func sharpen(img *image.NRGBA, sigma float64) *image.NRGBA {
+	blurred := gaussianBlur(img, sigma)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			j := blurred.PixOffset(x, y)
+			for k := 0; k < 3; k++ {
+				v := 2*int(img.Pix[i+k]) - int(blurred.Pix[j+k])
+				blurred.Pix[j+k] = uint8(clamp(v, 255))
+			}
+			blurred.Pix[j+3] = img.Pix[i+3]
+		}
+	}
+	return blurred
+}
+
+// roundCorner makes corners outside of ellipse of radius rx ry transparent, anti-aliased at the edge
+func roundCorner(img *image.NRGBA, rx, ry int) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if rx > w/2 {
+		rx = w / 2
+	}
+	if ry > h/2 {
+		ry = h / 2
+	}
+	if rx <= 0 || ry <= 0 {
+		return
+	}
+	for y := 0; y < h; y++ {
+		cy := float64(ry)
+		if y >= h-ry {
+			cy = float64(h - ry)
+		} else if y >= ry {
+			continue
+		}
+		for x := 0; x < w; x++ {
+			cx := float64(rx)
+			if x >= w-rx {
+				cx = float64(w - rx)
+			} else if x >= rx {
+				continue
+			}
+			dx := (float64(x) + 0.5 - cx) / float64(rx)
+			dy := (float64(y) + 0.5 - cy) / float64(ry)
+			// approximate distance in pixels outside of the ellipse
+			dist := (math.Sqrt(dx*dx+dy*dy) - 1) * math.Min(float64(rx), float64(ry))
+			if coverage := 0.5 - dist; coverage < 1 {
+				i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+				img.Pix[i+3] = uint8(float64(img.Pix[i+3]) * math.Max(coverage, 0))
+			}
+		}
+	}
+}
+
+// flattenOnto composites image onto background color in place
+func flattenOnto(img *image.NRGBA, c color.NRGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := float64(img.Pix[i+3]) / 255
+		img.Pix[i] = uint8(math.Round(float64(img.Pix[i])*a + float64(c.R)*(1-a)))
+		img.Pix[i+1] = uint8(math.Round(float64(img.Pix[i+1])*a + float64(c.G)*(1-a)))
+		img.Pix[i+2] = uint8(math.Round(float64(img.Pix[i+2])*a + float64(c.B)*(1-a)))
+		img.Pix[i+3] = 255
+	}
+}
+
+// fill centers image on canvas of width and height plus paddings,
+// filled with color, or blurred copy of the image if color is nil and blur is true
+func fill(img *image.NRGBA, width, height, left, top, right, bottom int, c *color.NRGBA, blur bool) *image.NRGBA {
+	b := img.Rect
+	if width < b.Dx() {
+		width = b.Dx()
+	}
+	if height < b.Dy() {
+		height = b.Dy()
+	}
+	canvas := image.Rect(0, 0, width+left+right, height+top+bottom)
+	var dst *image.NRGBA
+	if c == nil && blur {
+		// blur at reduced scale, as large sigma is expensive
+		small := image.NewNRGBA(image.Rect(0, 0, (canvas.Dx()+7)/8, (canvas.Dy()+7)/8))
+		draw.ApproxBiLinear.Scale(small, small.Rect, img, b, draw.Src, nil)
+		small = gaussianBlur(small, 50.0/8)
+		dst = image.NewNRGBA(canvas)
+		draw.BiLinear.Scale(dst, dst.Rect, small, small.Rect, draw.Src, nil)
+	} else {
+		dst = image.NewNRGBA(canvas)
+		if c != nil {
+			draw.Draw(dst, dst.Rect, image.NewUniform(*c), image.Point{}, draw.Src)
+		}
+	}
+	r := image.Rect(0, 0, b.Dx(), b.Dy()).Add(image.Pt((width-b.Dx())/2+left, (height-b.Dy())/2+top))
+	draw.Draw(dst, r, img, b.Min, draw.Over)
+	return dst
+}
+
+// parseColor of name or hex e.g. white, #fff, ff0000
+func parseColor(s string) *color.NRGBA {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "#")
+	if c, ok := colornames.Map[s]; ok {
+		return &color.NRGBA{R: c.R, G: c.G, B: c.B, A: 255}
+	}
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return nil
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil
+	}
+	return &color.NRGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 255}
+}
+
+// convolve image by 1D kernel horizontally or vertically, clamping at edges
+func convolve(img *image.NRGBA, kernel []float64, horizontal bool) *image.NRGBA {
+	var (
+		b      = img.Rect
+		w, h   = b.Dx(), b.Dy()
+		radius = len(kernel) / 2
+		dst    = image.NewNRGBA(image.Rect(0, 0, w, h))
+	)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, bl, a float64
+			for k, weight := range kernel {
+				sx, sy := x, y
+				if horizontal {
+					sx = clamp(x+k-radius, w-1)
+				} else {
+					sy = clamp(y+k-radius, h-1)
+				}
+				i := img.PixOffset(b.Min.X+sx, b.Min.Y+sy)
+				pa := float64(img.Pix[i+3]) * weight
+				r += float64(img.Pix[i]) * pa
+				g += float64(img.Pix[i+1]) * pa
+				bl += float64(img.Pix[i+2]) * pa
+				a += pa
+			}
+			if a > 0 {
+				i := dst.PixOffset(x, y)
+				dst.Pix[i] = uint8(math.Round(r / a))
+				dst.Pix[i+1] = uint8(math.Round(g / a))
+				dst.Pix[i+2] = uint8(math.Round(bl / a))
+				dst.Pix[i+3] = uint8(math.Round(a))
+			}
+		}
+	}
+	return dst
+}
+
+func clamp(n, hi int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
+
+// offset of crop area by alignment, centered by default
+func offset(align string, n int) int {
+	switch align {
+	case imagorpath.HAlignLeft, imagorpath.VAlignTop:
+		return 0
+	case imagorpath.HAlignRight, imagorpath.VAlignBottom:
+		return n
+	}
+	return n / 2
+}
+
+func flip(img *image.NRGBA, horizontal bool) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			x2, y2 := x, h-1-y
+			if horizontal {
+				if x >= w/2 {
+					break
+				}
+				x2, y2 = w-1-x, y
+			} else if y >= h/2 {
+				return
+			}
+			i, j := img.PixOffset(x, y), img.PixOffset(x2, y2)
+			for k := 0; k < 4; k++ {
+				img.Pix[i+k], img.Pix[j+k] = img.Pix[j+k], img.Pix[i+k]
+			}
+		}
+	}
+}
+
+// coalesce animated GIF into fully composited frames
+func coalesce(g *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() && len(g.Image) > 0 {
+		bounds = g.Image[0].Bounds()
+	}
+	var (
+		canvas   = image.NewNRGBA(bounds)
+		previous *image.NRGBA
+		frames   = make([]image.Image, 0, len(g.Image))
+	)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = clone(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, clone(canvas))
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func clone(img *image.NRGBA) *image.NRGBA {
+	c := image.NewNRGBA(img.Rect)
+	copy(c.Pix, img.Pix)
+	return c
+}
+
+// flatten transparent image on white background for formats without alpha
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+var gifPalette = append(color.Palette{color.Transparent}, palette.Plan9[:255]...)
+
+func toPaletted(img image.Image) *image.Paletted {
+	if p, ok := img.(*image.Paletted); ok {
+		return p
+	}
+	dst := image.NewPaletted(img.Bounds(), gifPalette)
+	draw.FloydSteinberg.Draw(dst, dst.Bounds(), img, img.Bounds().Min)
+	return dst
+}
+
+// orient image by EXIF orientation, as the standard library decoders do not
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads orientation tag of JPEG EXIF, 0 if not found
+func exifOrientation(buf []byte) int {
+	for i := 2; i+4 <= len(buf) && buf[i] == 0xFF; {
+		marker := buf[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// start of scan
+			return 0
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(buf[i+2:]))
+		if end > len(buf) {
+			return 0
+		}
+		if seg := buf[i+4 : end]; marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i = end
+	}
+	return 0
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < n; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// blurHashComponents x and y components of blurhash filter args, 4 by 3 by default
+func blurHashComponents(args string) (x, y int) {
+	x, y = 4, 3
+	if args == "" {
+		return
+	}
+	s := strings.Split(args, ",")
+	if n, _ := strconv.Atoi(s[0]); n >= 1 && n <= 9 {
+		x, y = n, n
+	}
+	if len(s) > 1 {
+		if n, _ := strconv.Atoi(s[1]); n >= 1 && n <= 9 {
+			y = n
+		}
+	}
+	return
+}
+
+// preview downscales image within size, optionally flattened onto white
+func preview(img image.Image, size int, flatten bool) image.Image {
+	b := img.Bounds()
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = b.Dy() * size / b.Dx()
+	} else {
+		w = b.Dx() * size / b.Dy()
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	op := draw.Src
+	if flatten {
+		draw.Draw(dst, dst.Rect, image.White, image.Point{}, draw.Src)
+		op = draw.Over
+	}
+	draw.ApproxBiLinear.Scale(dst, dst.Rect, img, b, op, nil)
+	return dst
+}
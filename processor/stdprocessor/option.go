@@ -0,0 +1,53 @@
+package stdprocessor
+
+import (
+	"go.uber.org/zap"
+)
+
+type Option func(s *StdProcessor)
+
+func WithMaxWidth(width int) Option {
+	return func(s *StdProcessor) {
+		if width > 0 {
+			s.MaxWidth = width
+		}
+	}
+}
+
+func WithMaxHeight(height int) Option {
+	return func(s *StdProcessor) {
+		if height > 0 {
+			s.MaxHeight = height
+		}
+	}
+}
+
+func WithMaxResolution(res int) Option {
+	return func(s *StdProcessor) {
+		if res > 0 {
+			s.MaxResolution = res
+		}
+	}
+}
+
+func WithMaxAnimationFrames(num int) Option {
+	return func(s *StdProcessor) {
+		if num != 0 {
+			s.MaxAnimationFrames = num
+		}
+	}
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *StdProcessor) {
+		if logger != nil {
+			s.Logger = logger
+		}
+	}
+}
+
+func WithDebug(debug bool) Option {
+	return func(s *StdProcessor) {
+		s.Debug = debug
+	}
+}
@@ -0,0 +1,479 @@
+package stdprocessor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StdProcessor pure Go image processor based on the standard library image packages,
+// for environments where libvips is not available.
+// Covers crop, resize, flip, rotate, fill, color adjustments, blur, sharpen, round corner, background color, watermark and format conversion of JPEG, PNG and GIF, with TIFF and BMP outputs.
+// Other image types and output formats are passed to the next processor
+type StdProcessor struct {
+	MaxWidth           int
+	MaxHeight          int
+	MaxResolution      int
+	MaxAnimationFrames int
+	Logger             *zap.Logger
+	Debug              bool
+}
+
+func New(options ...Option) *StdProcessor {
+	s := &StdProcessor{
+		MaxWidth:           9999,
+		MaxHeight:          9999,
+		MaxResolution:      16800000,
+		MaxAnimationFrames: -1,
+		Logger:             zap.NewNop(),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *StdProcessor) Startup(_ context.Context) error {
+	return nil
+}
+
+func (s *StdProcessor) Shutdown(_ context.Context) error {
+	return nil
+}
+
+func (s *StdProcessor) Process(
+	ctx context.Context, blob *imagor.Blob, p imagorpath.Params, load imagor.LoadFunc,
+) (*imagor.Blob, error) {
+	var (
+		format  = formatOf(blob.BlobType())
+		quality = jpeg.DefaultQuality
+		upscale = !p.FitIn
+		stretch = p.Stretch
+		maxN    = s.MaxAnimationFrames
+		page    = -1
+		loop    = -1
+		hashX   int
+		hashY   int
+		thumb   bool
+		colors  int
+		filters []imagorpath.Filter
+	)
+	if format == "" {
+		return nil, imagor.ErrPass
+	}
+	if maxN == 0 || maxN < -1 {
+		maxN = 1
+	}
+	for _, f := range p.Filters {
+		switch f.Name {
+		case "format":
+			if format = normalizeFormat(f.Args); format == "" {
+				return nil, imagor.ErrPass
+			}
+			break
+		case "autojpg":
+			format = "jpeg"
+			break
+		case "quality":
+			if q, err := strconv.Atoi(f.Args); err == nil && q > 0 && q <= 100 {
+				quality = q
+			}
+			break
+		case "upscale":
+			upscale = true
+			break
+		case "no_upscale":
+			upscale = false
+			break
+		case "stretch":
+			stretch = true
+			break
+		case "watermark", "blur", "sharpen", "round_corner", "background_color", "fill", "rotate",
+			"brightness", "contrast", "saturation", "hue", "rgb":
+			// applied after resize in order
+			filters = append(filters, f)
+			break
+		case "blurhash":
+			hashX, hashY = blurHashComponents(f.Args)
+			break
+		case "thumbhash":
+			thumb = true
+			break
+		case "palette":
+			// number of colors, 5 by default
+			colors = 5
+			if n, _ := strconv.Atoi(f.Args); n >= 1 && n <= 16 {
+				colors = n
+			}
+			break
+		case "loop":
+			// number of times animation plays, 0 for infinite
+			if n, err := strconv.Atoi(f.Args); err == nil && n >= 0 && n <= 0xFFFF {
+				loop = n
+			}
+			break
+		case "page", "frame":
+			// frame number starting from 1 of animated GIF, rendered as still
+			if n, _ := strconv.Atoi(f.Args); n >= 1 {
+				page = n - 1
+			}
+			break
+		default:
+			if s.Debug {
+				s.Logger.Debug("std-filter-skipped", zap.String("name", f.Name))
+			}
+		}
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, imagor.NewError("std: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	if cfg.Width*cfg.Height > s.MaxResolution {
+		return nil, imagor.ErrMaxResolutionExceeded
+	}
+	if format != "gif" {
+		// no frames if export format not support animation
+		maxN = 1
+	}
+	frames, delays, loopCount, err := decode(buf, blob.BlobType(), maxN, page)
+	if err != nil {
+		return nil, imagor.NewError("std: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	if loop == 0 {
+		loopCount = 0
+	} else if loop > 0 {
+		// gif LoopCount is the number of repeats, -1 plays once
+		loopCount = loop - 1
+		if loopCount == 0 {
+			loopCount = -1
+		}
+	}
+	pages := len(frames)
+	if page >= 0 {
+		if page >= len(frames) {
+			return nil, imagor.NewError(
+				fmt.Sprintf("std: page %d out of range of %d", page+1, len(frames)),
+				http.StatusUnprocessableEntity)
+		}
+		frames, delays = frames[page:page+1], nil
+	} else if maxN > 0 && len(frames) > maxN {
+		frames, delays = frames[:maxN], delays[:maxN]
+		pages = maxN
+	}
+	if blob.BlobType() == imagor.BlobTypeJPEG {
+		if o := exifOrientation(buf); o > 1 {
+			for i, frame := range frames {
+				frames[i] = orient(frame, o)
+			}
+		}
+	}
+	for i, frame := range frames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		frames[i] = s.transform(frame, p, upscale, stretch)
+	}
+	var hasFill bool
+	for _, f := range filters {
+		if f.Name == "fill" {
+			hasFill = true
+		}
+	}
+	for _, f := range filters {
+		args := strings.Split(f.Args, ",")
+		switch f.Name {
+		case "watermark":
+			b := frames[0].Bounds()
+			layer, err := s.watermark(load, b.Dx(), b.Dy(), args)
+			if err != nil {
+				return nil, err
+			}
+			if layer == nil {
+				continue
+			}
+			for _, frame := range frames {
+				draw.Draw(frame.(*image.NRGBA), b, layer, image.Point{}, draw.Over)
+			}
+		case "blur":
+			// blur(sigma) or blur(radius,sigma), same scale as vips processor
+			sigma, _ := strconv.ParseFloat(args[len(args)-1], 64)
+			if sigma /= 2; sigma > 0 {
+				for i, frame := range frames {
+					frames[i] = gaussianBlur(frame.(*image.NRGBA), sigma)
+				}
+			}
+		case "sharpen":
+			// sharpen(sigma[,flat,jagged]) or sharpen(amount,radius,luminance_only) radius as sigma, same as vips processor.
+			// flat and jagged are not applicable to unsharp mask
+			var sigma float64
+			if _, err := strconv.ParseBool(args[len(args)-1]); len(args) == 3 && err == nil {
+				sigma, _ = strconv.ParseFloat(args[1], 64)
+			} else {
+				sigma, _ = strconv.ParseFloat(args[0], 64)
+			}
+			for i, frame := range frames {
+				frames[i] = sharpen(frame.(*image.NRGBA), 1+sigma*2)
+			}
+		case "background_color":
+			c := parseColor(args[0])
+			if args[0] == "auto" {
+				top := frames[0].(*image.NRGBA).NRGBAAt(0, 0)
+				c = &color.NRGBA{R: top.R, G: top.G, B: top.B, A: 255}
+			}
+			if c == nil {
+				continue
+			}
+			for i, frame := range frames {
+				flattenOnto(frame.(*image.NRGBA), *c)
+				if p.FitIn && p.Width > 0 && p.Height > 0 && !hasFill {
+					// letterbox fit-in with background color
+					frames[i] = fill(frame.(*image.NRGBA), p.Width, p.Height,
+						p.PaddingLeft, p.PaddingTop, p.PaddingRight, p.PaddingBottom, c, false)
+				}
+			}
+		case "fill":
+			// fill(color), fill(auto) by top left pixel, fill(blur) by blurred copy of the image
+			var c *color.NRGBA
+			if args[0] == "auto" {
+				top := frames[0].(*image.NRGBA).NRGBAAt(0, 0)
+				c = &color.NRGBA{R: top.R, G: top.G, B: top.B, A: 255}
+			} else {
+				c = parseColor(args[0])
+			}
+			for i, frame := range frames {
+				b := frame.Bounds()
+				w, h := p.Width, p.Height
+				if w == 0 {
+					w = b.Dx()
+				}
+				if h == 0 {
+					h = b.Dy()
+				}
+				frames[i] = fill(frame.(*image.NRGBA), w, h,
+					p.PaddingLeft, p.PaddingTop, p.PaddingRight, p.PaddingBottom, c, args[0] == "blur")
+			}
+		case "brightness":
+			b, _ := strconv.ParseFloat(args[0], 64)
+			b = b * 255 / 100
+			for _, frame := range frames {
+				linear(frame.(*image.NRGBA), [3]float64{1, 1, 1}, [3]float64{b, b, b})
+			}
+		case "contrast":
+			a, _ := strconv.ParseFloat(args[0], 64)
+			a = math.Min(math.Max(a*255/100, -255), 255)
+			a = (259 * (a + 255)) / (255 * (259 - a))
+			b := 128 - a*128
+			for _, frame := range frames {
+				linear(frame.(*image.NRGBA), [3]float64{a, a, a}, [3]float64{b, b, b})
+			}
+		case "rgb":
+			// rgb(r,g,b) percentage shifts of each channel
+			if len(args) != 3 {
+				continue
+			}
+			var shift [3]float64
+			for k := range shift {
+				v, _ := strconv.ParseFloat(args[k], 64)
+				shift[k] = v * 255 / 100
+			}
+			for _, frame := range frames {
+				linear(frame.(*image.NRGBA), [3]float64{1, 1, 1}, shift)
+			}
+		case "saturation":
+			s, _ := strconv.ParseFloat(args[0], 64)
+			for _, frame := range frames {
+				modulate(frame.(*image.NRGBA), 1, 1+s/100, 0)
+			}
+		case "hue":
+			h, _ := strconv.ParseFloat(args[0], 64)
+			for _, frame := range frames {
+				modulate(frame.(*image.NRGBA), 1, 1, h)
+			}
+		case "rotate":
+			// rotate(angle [, color]) counterclockwise
+			deg, _ := strconv.ParseFloat(args[0], 64)
+			if deg = math.Mod(deg, 360); deg < 0 {
+				deg += 360
+			}
+			var c *color.NRGBA
+			if len(args) > 1 {
+				c = parseColor(args[1])
+			}
+			for i, frame := range frames {
+				switch deg {
+				case 0:
+				case 90:
+					frames[i] = orient(frame, 8)
+				case 180:
+					frames[i] = orient(frame, 3)
+				case 270:
+					frames[i] = orient(frame, 6)
+				default:
+					rotated := rotate(frame.(*image.NRGBA), deg)
+					if c != nil {
+						flattenOnto(rotated, *c)
+					}
+					frames[i] = rotated
+				}
+			}
+		case "round_corner":
+			// round_corner(rx [, ry] [, color])
+			var c *color.NRGBA
+			if len(args) > 1 {
+				if _, err := strconv.Atoi(args[len(args)-1]); err != nil {
+					c = parseColor(args[len(args)-1])
+					args = args[:len(args)-1]
+				}
+			}
+			rx, _ := strconv.Atoi(args[0])
+			ry := rx
+			if len(args) > 1 {
+				ry, _ = strconv.Atoi(args[1])
+			}
+			for _, frame := range frames {
+				roundCorner(frame.(*image.NRGBA), rx, ry)
+				if c != nil {
+					flattenOnto(frame.(*image.NRGBA), *c)
+				}
+			}
+		}
+	}
+	if s.Debug {
+		b := frames[0].Bounds()
+		s.Logger.Debug("std",
+			zap.String("format", format),
+			zap.Int("width", b.Dx()),
+			zap.Int("height", b.Dy()),
+			zap.Int("frames", len(frames)))
+	}
+	out, err := encode(frames, delays, loopCount, format, quality)
+	if err != nil {
+		return nil, imagor.NewError("std: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	b := imagor.NewBlobFromBytes(out)
+	bounds := frames[0].Bounds()
+	b.Meta = &imagor.Meta{
+		Format:      format,
+		ContentType: "image/" + format,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Pages:       pages,
+	}
+	if hashX > 0 {
+		b.Meta.BlurHash = imagor.BlurHash(preview(frames[0], 32, true), hashX, hashY)
+	}
+	if thumb {
+		b.Meta.ThumbHash = base64.StdEncoding.EncodeToString(imagor.ThumbHash(preview(frames[0], 100, false)))
+	}
+	if colors > 0 {
+		if b.Meta.Palette = imagor.Palette(preview(frames[0], 64, false), colors); len(b.Meta.Palette) > 0 {
+			b.Meta.DominantColor = b.Meta.Palette[0]
+		}
+	}
+	return b, nil
+}
+
+func formatOf(typ imagor.BlobType) string {
+	switch typ {
+	case imagor.BlobTypeJPEG:
+		return "jpeg"
+	case imagor.BlobTypePNG:
+		return "png"
+	case imagor.BlobTypeGIF:
+		return "gif"
+	}
+	return ""
+}
+
+func normalizeFormat(format string) string {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "jpeg", "jpg":
+		return "jpeg"
+	case "png":
+		return "png"
+	case "gif":
+		return "gif"
+	case "tiff":
+		return "tiff"
+	case "bmp":
+		return "bmp"
+	}
+	return ""
+}
+
+// decode image frames, frames of animated GIF are composited
+// where animation is kept or a page is selected
+func decode(buf []byte, typ imagor.BlobType, maxN, page int) (frames []image.Image, delays []int, loopCount int, err error) {
+	if typ == imagor.BlobTypeGIF && (maxN != 1 || page >= 0) {
+		var g *gif.GIF
+		if g, err = gif.DecodeAll(bytes.NewReader(buf)); err != nil {
+			return
+		}
+		return coalesce(g), g.Delay, g.LoopCount, nil
+	}
+	var img image.Image
+	switch typ {
+	case imagor.BlobTypeJPEG:
+		img, err = jpeg.Decode(bytes.NewReader(buf))
+	case imagor.BlobTypePNG:
+		img, err = png.Decode(bytes.NewReader(buf))
+	default:
+		img, err = gif.Decode(bytes.NewReader(buf))
+	}
+	if err != nil {
+		return
+	}
+	return []image.Image{img}, nil, 0, nil
+}
+
+func encode(frames []image.Image, delays []int, loopCount int, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, flatten(frames[0]), &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buf, frames[0])
+	case "tiff":
+		err = tiff.Encode(&buf, frames[0], &tiff.Options{Compression: tiff.Deflate})
+	case "bmp":
+		err = bmp.Encode(&buf, frames[0])
+	default:
+		g := &gif.GIF{LoopCount: loopCount}
+		for i, frame := range frames {
+			g.Image = append(g.Image, toPaletted(frame))
+			if i < len(delays) {
+				g.Delay = append(g.Delay, delays[i])
+			} else {
+				g.Delay = append(g.Delay, 0)
+			}
+			// frames are fully composited, clear before drawing the next
+			g.Disposal = append(g.Disposal, gif.DisposalBackground)
+		}
+		err = gif.EncodeAll(&buf, g)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,583 @@
+package stdprocessor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var testDataDir = "../../testdata/"
+
+func TestProcess(t *testing.T) {
+	s := New()
+	tests := []struct {
+		path   string
+		format string
+		width  int
+		height int
+		pages  int
+	}{
+		{path: "fit-in/100x100/gopher.png", format: "png", width: 73, height: 100, pages: 1},
+		{path: "100x100/gopher.png", format: "png", width: 100, height: 100, pages: 1},
+		{path: "-100x50/gopher.png", format: "png", width: 100, height: 50, pages: 1},
+		{path: "200x0/gopher.png", format: "png", width: 200, height: 272, pages: 1},
+		{path: "stretch/100x100/gopher.png", format: "png", width: 100, height: 100, pages: 1},
+		{path: "fit-in/5000x5000/gopher.png", format: "png", width: 1634, height: 2224, pages: 1},
+		{path: "fit-in/5000x5000/filters:upscale()/gopher.png", format: "png", width: 3674, height: 5000, pages: 1},
+		{path: "0x0:817x1112/gopher.png", format: "png", width: 817, height: 1112, pages: 1},
+		{path: "0.25x0.25:0.75x0.75/100x0/gopher.png", format: "png", width: 100, height: 136, pages: 1},
+		{path: "50x50/filters:format(jpg):quality(70)/gopher.png", format: "jpeg", width: 50, height: 50, pages: 1},
+		{path: "50x0/filters:format(gif)/gopher.png", format: "gif", width: 50, height: 68, pages: 1},
+		{path: "50x0/filters:format(tiff)/gopher.png", format: "tiff", width: 50, height: 68, pages: 1},
+		{path: "50x0/filters:format(bmp)/gopher.png", format: "bmp", width: 50, height: 68, pages: 1},
+		{path: "fit-in/60x60/dancing-banana.gif", format: "gif", width: 57, height: 60, pages: 8},
+		{path: "fit-in/60x60/filters:format(png)/dancing-banana.gif", format: "png", width: 57, height: 60, pages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p := imagorpath.Parse(tt.path)
+			blob, err := s.Process(context.Background(),
+				imagor.NewBlobFromPath(testDataDir+p.Image), p, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.format, blob.Meta.Format)
+			assert.Equal(t, "image/"+tt.format, blob.ContentType())
+			assert.Equal(t, tt.width, blob.Meta.Width)
+			assert.Equal(t, tt.height, blob.Meta.Height)
+			assert.Equal(t, tt.pages, blob.Meta.Pages)
+
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(buf))
+			require.NoError(t, err)
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, tt.width, cfg.Width)
+			assert.Equal(t, tt.height, cfg.Height)
+			if tt.format == "gif" {
+				g, err := gif.DecodeAll(bytes.NewReader(buf))
+				require.NoError(t, err)
+				assert.Len(t, g.Image, tt.pages)
+			}
+		})
+	}
+}
+
+func TestProcessPass(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	_, err := s.Process(ctx, imagor.NewBlobFromPath(testDataDir+"demo3.webp"),
+		imagorpath.Parse("100x100/demo3.webp"), nil)
+	assert.Equal(t, imagor.ErrPass, err)
+	_, err = s.Process(ctx, imagor.NewBlobFromPath(testDataDir+"gopher.tiff"),
+		imagorpath.Parse("100x100/gopher.tiff"), nil)
+	assert.Equal(t, imagor.ErrPass, err)
+	_, err = s.Process(ctx, imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("100x100/filters:format(webp)/gopher.png"), nil)
+	assert.Equal(t, imagor.ErrPass, err)
+}
+
+func TestAnimation(t *testing.T) {
+	ctx := context.Background()
+	blob, err := New(WithMaxAnimationFrames(3)).Process(ctx, imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("30x30/dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, blob.Meta.Pages)
+	buf, err := blob.ReadAll()
+	require.NoError(t, err)
+	g, err := gif.DecodeAll(bytes.NewReader(buf))
+	require.NoError(t, err)
+	require.Len(t, g.Image, 3)
+	assert.Len(t, g.Delay, 3)
+	for _, frame := range g.Image {
+		assert.Equal(t, image.Rect(0, 0, 30, 30), frame.Bounds())
+	}
+
+	blob, err = New(WithMaxAnimationFrames(1)).Process(ctx, imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, blob.Meta.Pages)
+
+	blob, err = New().Process(ctx, imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("filters:page(3)/dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 8, blob.Meta.Pages)
+	buf, err = blob.ReadAll()
+	require.NoError(t, err)
+	g, err = gif.DecodeAll(bytes.NewReader(buf))
+	require.NoError(t, err)
+	assert.Len(t, g.Image, 1)
+
+	blob, err = New().Process(ctx, imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("filters:frame(1)/dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 8, blob.Meta.Pages)
+	buf, err = blob.ReadAll()
+	require.NoError(t, err)
+	g, err = gif.DecodeAll(bytes.NewReader(buf))
+	require.NoError(t, err)
+	assert.Len(t, g.Image, 1)
+
+	_, err = New().Process(ctx, imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("filters:page(9)/dancing-banana.gif"), nil)
+	assert.Error(t, err)
+
+	blob, err = New().Process(ctx, imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("filters:loop(1)/dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	buf, err = blob.ReadAll()
+	require.NoError(t, err)
+	g, err = gif.DecodeAll(bytes.NewReader(buf))
+	require.NoError(t, err)
+	assert.Equal(t, -1, g.LoopCount)
+	assert.Len(t, g.Image, 8)
+}
+
+func TestMaxResolution(t *testing.T) {
+	s := New(WithMaxResolution(1000))
+	_, err := s.Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("100x100/gopher.png"), nil)
+	assert.Equal(t, imagor.ErrMaxResolutionExceeded, err)
+}
+
+func TestMaxWidthHeight(t *testing.T) {
+	s := New(WithMaxWidth(100), WithMaxHeight(100))
+	blob, err := s.Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 73, blob.Meta.Width)
+	assert.Equal(t, 100, blob.Meta.Height)
+}
+
+func TestBlurHash(t *testing.T) {
+	for path, ln := range map[string]int{
+		"100x100/filters:blurhash()/gopher.png":                28,
+		"100x100/filters:blurhash(3)/gopher.png":               22,
+		"100x100/filters:blurhash(5,2):format(gif)/gopher.png": 24,
+		"100x100/gopher.png":                                   0,
+	} {
+		blob, err := New().Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+			imagorpath.Parse(path), nil)
+		require.NoError(t, err)
+		assert.Len(t, blob.Meta.BlurHash, ln, path)
+	}
+}
+
+func TestThumbHash(t *testing.T) {
+	for path, ok := range map[string]bool{
+		"100x100/filters:thumbhash()/gopher.png":                    true,
+		"fit-in/300x200/filters:thumbhash():format(gif)/gopher.png": true,
+		"100x100/gopher.png":                                        false,
+	} {
+		blob, err := New().Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+			imagorpath.Parse(path), nil)
+		require.NoError(t, err)
+		if !ok {
+			assert.Empty(t, blob.Meta.ThumbHash, path)
+			continue
+		}
+		hash, err := base64.StdEncoding.DecodeString(blob.Meta.ThumbHash)
+		require.NoError(t, err, path)
+		assert.GreaterOrEqual(t, len(hash), 5, path)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	red := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(red, red.Rect, image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, red))
+	blob, err := New().Process(context.Background(), imagor.NewBlobFromBytes(buf.Bytes()),
+		imagorpath.Parse("filters:palette()/red.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#ff0000", blob.Meta.DominantColor)
+	assert.Equal(t, []string{"#ff0000"}, blob.Meta.Palette)
+
+	blob, err = New().Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("filters:palette(3)/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Len(t, blob.Meta.Palette, 3)
+	assert.Equal(t, blob.Meta.Palette[0], blob.Meta.DominantColor)
+}
+
+func TestFlip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	s := New()
+	for path, pt := range map[string]image.Point{
+		"-0x0/a.png":  {X: 2},
+		"0x-0/a.png":  {Y: 1},
+		"-0x-0/a.png": {X: 2, Y: 1},
+	} {
+		blob, err := s.Process(context.Background(), imagor.NewBlobFromBytes(buf.Bytes()),
+			imagorpath.Parse(path), nil)
+		require.NoError(t, err, path)
+		b, err := blob.ReadAll()
+		require.NoError(t, err)
+		out, err := png.Decode(bytes.NewReader(b))
+		require.NoError(t, err)
+		r, _, _, a := out.At(pt.X, pt.Y).RGBA()
+		assert.Equal(t, uint32(0xffff), r, path)
+		assert.Equal(t, uint32(0xffff), a, path)
+	}
+}
+
+func TestFlattenJPEG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	blob, err := New().Process(context.Background(), imagor.NewBlobFromBytes(buf.Bytes()),
+		imagorpath.Parse("filters:format(jpeg)/a.png"), nil)
+	require.NoError(t, err)
+	b, err := blob.ReadAll()
+	require.NoError(t, err)
+	out, err := jpeg.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	r, g, bl, _ := out.At(4, 4).RGBA()
+	assert.Greater(t, r, uint32(0xf000))
+	assert.Greater(t, g, uint32(0xf000))
+	assert.Greater(t, bl, uint32(0xf000))
+}
+
+func TestOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	// big endian TIFF with a single IFD entry of orientation 6
+	exif := []byte("Exif\x00\x00MM\x00\x2A\x00\x00\x00\x08\x00\x01" +
+		"\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00" + "\x00\x00\x00\x00")
+	app1 := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	jpg := append(append(buf.Bytes()[:2:2], app1...), buf.Bytes()[2:]...)
+	assert.Equal(t, 6, exifOrientation(jpg))
+	assert.Equal(t, 0, exifOrientation(buf.Bytes()))
+
+	blob, err := New().Process(context.Background(), imagor.NewBlobFromBytes(jpg),
+		imagorpath.Parse("a.jpg"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 20, blob.Meta.Width)
+	assert.Equal(t, 40, blob.Meta.Height)
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	for o, pt := range map[int]image.Point{
+		1: {}, 2: {X: 2}, 3: {X: 2, Y: 1}, 4: {Y: 1},
+		5: {}, 6: {X: 1}, 7: {X: 1, Y: 2}, 8: {Y: 2},
+	} {
+		out := orient(img, o)
+		if o >= 5 {
+			assert.Equal(t, image.Rect(0, 0, 2, 3), out.Bounds(), o)
+		} else {
+			assert.Equal(t, image.Rect(0, 0, 3, 2), out.Bounds(), o)
+		}
+		r, _, _, _ := out.At(pt.X, pt.Y).RGBA()
+		assert.Equal(t, uint32(0xffff), r, o)
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	newPNG := func(w, h int, c color.Color) []byte {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+	red := color.NRGBA{R: 255, A: 255}
+	load := func(image string) (*imagor.Blob, error) {
+		if image != "mark.png" {
+			return nil, imagor.ErrNotFound
+		}
+		return imagor.NewBlobFromBytes(newPNG(10, 10, red)), nil
+	}
+	src := newPNG(100, 100, color.White)
+	tests := []struct {
+		path  string
+		red   []image.Point
+		white []image.Point
+	}{
+		{path: "filters:watermark(mark.png)/a.png", red: []image.Point{{5, 5}}, white: []image.Point{{15, 15}}},
+		{path: "filters:watermark(mark.png,right,bottom,0)/a.png", red: []image.Point{{95, 95}}, white: []image.Point{{5, 5}}},
+		{path: "filters:watermark(mark.png,center,-5)/a.png", red: []image.Point{{50, 90}}, white: []image.Point{{50, 50}}},
+		{path: "filters:watermark(mark.png,repeat,10p,0)/a.png", red: []image.Point{{5, 15}, {95, 15}}, white: []image.Point{{5, 5}}},
+		{path: "filters:watermark(mark.png,repeat,repeat,0,none,none,45)/a.png", red: []image.Point{{7, 7}, {97, 97}}, white: []image.Point{{0, 0}}},
+		{path: "filters:watermark(mark.png,0,0,0,5,5)/a.png", red: []image.Point{{2, 2}}, white: []image.Point{{7, 7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			blob, err := New().Process(context.Background(), imagor.NewBlobFromBytes(src),
+				imagorpath.Parse(tt.path), load)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			out, err := png.Decode(bytes.NewReader(buf))
+			require.NoError(t, err)
+			for _, pt := range tt.red {
+				_, g, _, _ := out.At(pt.X, pt.Y).RGBA()
+				assert.Equal(t, uint32(0), g, pt)
+			}
+			for _, pt := range tt.white {
+				_, g, _, _ := out.At(pt.X, pt.Y).RGBA()
+				assert.Equal(t, uint32(0xffff), g, pt)
+			}
+		})
+	}
+	_, err := New().Process(context.Background(), imagor.NewBlobFromBytes(src),
+		imagorpath.Parse("filters:watermark(missing.png)/a.png"), load)
+	assert.Equal(t, imagor.ErrNotFound, err)
+}
+
+func TestRotate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	out := rotate(img, 90)
+	assert.Equal(t, image.Rect(0, 0, 20, 40), out.Bounds())
+	_, _, _, a := out.At(10, 20).RGBA()
+	assert.Equal(t, uint32(0xffff), a)
+
+	out = rotate(img, 45)
+	assert.Equal(t, image.Rect(0, 0, 43, 43), out.Bounds())
+	_, _, _, a = out.At(21, 21).RGBA()
+	assert.Equal(t, uint32(0xffff), a)
+	_, _, _, a = out.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0), a, "transparent corner")
+}
+
+func TestBlur(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(img, image.Rect(0, 0, 10, 20), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 0, 20, 20), image.NewUniform(color.NRGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	blob, err := New().Process(context.Background(), imagor.NewBlobFromBytes(buf.Bytes()),
+		imagorpath.Parse("filters:blur(4)/a.png"), nil)
+	require.NoError(t, err)
+	b, err := blob.ReadAll()
+	require.NoError(t, err)
+	out, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	r, _, bl, a := out.At(9, 10).RGBA()
+	assert.Less(t, r, uint32(0xf000))
+	assert.Greater(t, bl, uint32(0x1000))
+	assert.Equal(t, uint32(0xffff), a, "opaque edges")
+	r, _, bl, _ = out.At(0, 10).RGBA()
+	assert.Greater(t, r, uint32(0xf000))
+	assert.Less(t, bl, uint32(0x1000))
+
+	blob, err = New().Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"dancing-banana.gif"),
+		imagorpath.Parse("fit-in/60x60/filters:blur(3)/dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 8, blob.Meta.Pages)
+}
+
+func TestSharpen(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 100, G: 100, B: 100, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 0, 20, 20), image.NewUniform(color.NRGBA{R: 200, G: 200, B: 200, A: 255}), image.Point{}, draw.Src)
+	out := sharpen(img, 2)
+	// overshoot at edge increases contrast
+	assert.Less(t, out.NRGBAAt(9, 10).R, uint8(100))
+	assert.Greater(t, out.NRGBAAt(10, 10).R, uint8(200))
+	assert.Equal(t, uint8(100), out.NRGBAAt(0, 10).R)
+	assert.Equal(t, uint8(255), out.NRGBAAt(9, 10).A)
+
+	blob, err := New().Process(context.Background(), imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("50x50/filters:sharpen(1,2,true)/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 50, blob.Meta.Width)
+}
+
+func TestRoundCorner(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	for path, corner := range map[string]color.NRGBA{
+		"filters:round_corner(10)/a.png":                {},
+		"filters:round_corner(10,white)/a.png":          {R: 255, G: 255, B: 255, A: 255},
+		"filters:round_corner(10,10,00ff00)/a.png":      {G: 255, A: 255},
+		"filters:round_corner(10,20):format(png)/a.png": {},
+	} {
+		blob, err := New().Process(context.Background(), imagor.NewBlobFromBytes(buf.Bytes()),
+			imagorpath.Parse(path), nil)
+		require.NoError(t, err, path)
+		b, err := blob.ReadAll()
+		require.NoError(t, err)
+		out, err := png.Decode(bytes.NewReader(b))
+		require.NoError(t, err)
+		nrgba := image.NewNRGBA(out.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), out, image.Point{}, draw.Src)
+		assert.Equal(t, corner.A, nrgba.NRGBAAt(0, 0).A, path)
+		if corner.A > 0 {
+			assert.Equal(t, corner, nrgba.NRGBAAt(0, 0), path)
+		}
+		assert.Equal(t, color.NRGBA{R: 255, A: 255}, nrgba.NRGBAAt(20, 20), path)
+		assert.Equal(t, color.NRGBA{R: 255, A: 255}, nrgba.NRGBAAt(5, 20), path)
+	}
+	assert.Equal(t, &color.NRGBA{R: 255, G: 255, B: 255, A: 255}, parseColor("#fff"))
+	assert.Equal(t, &color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 255}, parseColor("123456"))
+	assert.Nil(t, parseColor("foo"))
+}
+
+func TestBackgroundColor(t *testing.T) {
+	ctx := context.Background()
+	blob, err := New().Process(ctx, imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("fit-in/300x200/filters:background_color(ffff00)/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 300, blob.Meta.Width)
+	assert.Equal(t, 200, blob.Meta.Height)
+	buf, err := blob.ReadAll()
+	require.NoError(t, err)
+	out, err := png.Decode(bytes.NewReader(buf))
+	require.NoError(t, err)
+	r, g, b, a := out.At(5, 100).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0, 0xffff}, []uint32{r, g, b, a})
+
+	blob, err = New().Process(ctx, imagor.NewBlobFromPath(testDataDir+"gopher.png"),
+		imagorpath.Parse("100x100/filters:background_color(ffff00):format(jpeg)/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 100, blob.Meta.Width)
+	assert.Equal(t, 100, blob.Meta.Height)
+}
+
+func TestFill(t *testing.T) {
+	ctx := context.Background()
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	tests := []struct {
+		path   string
+		bar    color.NRGBA
+		width  int
+		height int
+	}{
+		{path: "fit-in/40x40/filters:fill(00ff00)/a.png", bar: color.NRGBA{G: 255, A: 255}, width: 40, height: 40},
+		{path: "fit-in/40x40/filters:fill(none)/a.png", bar: color.NRGBA{}, width: 40, height: 40},
+		{path: "fit-in/40x40/10x10:10x10/filters:fill(white)/a.png", bar: color.NRGBA{R: 255, G: 255, B: 255, A: 255}, width: 60, height: 60},
+		{path: "fit-in/40x40/filters:fill(blur)/a.png", bar: color.NRGBA{R: 255, A: 255}, width: 40, height: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			blob, err := New().Process(ctx, imagor.NewBlobFromBytes(buf.Bytes()), imagorpath.Parse(tt.path), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.width, blob.Meta.Width)
+			assert.Equal(t, tt.height, blob.Meta.Height)
+			b, err := blob.ReadAll()
+			require.NoError(t, err)
+			out, err := png.Decode(bytes.NewReader(b))
+			require.NoError(t, err)
+			nrgba := image.NewNRGBA(out.Bounds())
+			draw.Draw(nrgba, nrgba.Bounds(), out, image.Point{}, draw.Src)
+			assert.Equal(t, tt.bar, nrgba.NRGBAAt(tt.width/2, 2))
+			assert.Equal(t, color.NRGBA{R: 255, A: 255}, nrgba.NRGBAAt(tt.width/2, tt.height/2))
+		})
+	}
+}
+
+func TestRotateFilter(t *testing.T) {
+	ctx := context.Background()
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	img.Set(0, 0, color.NRGBA{B: 255, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	tests := []struct {
+		path   string
+		width  int
+		height int
+		blue   image.Point
+	}{
+		{path: "filters:rotate(90)/a.png", width: 20, height: 40, blue: image.Pt(0, 39)},
+		{path: "filters:rotate(-90)/a.png", width: 20, height: 40, blue: image.Pt(19, 0)},
+		{path: "filters:rotate(180)/a.png", width: 40, height: 20, blue: image.Pt(39, 19)},
+		{path: "filters:rotate(360)/a.png", width: 40, height: 20, blue: image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		blob, err := New().Process(ctx, imagor.NewBlobFromBytes(buf.Bytes()), imagorpath.Parse(tt.path), nil)
+		require.NoError(t, err, tt.path)
+		assert.Equal(t, tt.width, blob.Meta.Width, tt.path)
+		assert.Equal(t, tt.height, blob.Meta.Height, tt.path)
+		b, err := blob.ReadAll()
+		require.NoError(t, err)
+		out, err := png.Decode(bytes.NewReader(b))
+		require.NoError(t, err)
+		_, _, bl, _ := out.At(tt.blue.X, tt.blue.Y).RGBA()
+		assert.Equal(t, uint32(0xffff), bl, tt.path)
+	}
+
+	blob, err := New().Process(ctx, imagor.NewBlobFromBytes(buf.Bytes()),
+		imagorpath.Parse("filters:rotate(45,white)/a.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 43, blob.Meta.Width)
+	assert.Equal(t, 43, blob.Meta.Height)
+	b, err := blob.ReadAll()
+	require.NoError(t, err)
+	out, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	r, g, bl, a := out.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0xffff, 0xffff}, []uint32{r, g, bl, a})
+}
+
+func TestColorFilters(t *testing.T) {
+	ctx := context.Background()
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{R: 200, G: 50, B: 50, A: 255})
+	img.Set(1, 0, color.NRGBA{R: 100, G: 100, B: 100, A: 128})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	process := func(filters string) (c0, c1 color.NRGBA) {
+		blob, err := New().Process(ctx, imagor.NewBlobFromBytes(buf.Bytes()),
+			imagorpath.Parse("filters:"+filters+"/a.png"), nil)
+		require.NoError(t, err, filters)
+		b, err := blob.ReadAll()
+		require.NoError(t, err)
+		out, err := png.Decode(bytes.NewReader(b))
+		require.NoError(t, err)
+		nrgba := image.NewNRGBA(out.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), out, image.Point{}, draw.Src)
+		return nrgba.NRGBAAt(0, 0), nrgba.NRGBAAt(1, 0)
+	}
+	c0, c1 := process("brightness(20)")
+	assert.Equal(t, color.NRGBA{R: 251, G: 101, B: 101, A: 255}, c0)
+	assert.Equal(t, color.NRGBA{R: 151, G: 151, B: 151, A: 128}, c1)
+
+	c0, c1 = process("rgb(10,-20,0)")
+	assert.Equal(t, color.NRGBA{R: 226, G: 0, B: 50, A: 255}, c0)
+	assert.Equal(t, color.NRGBA{R: 126, G: 49, B: 100, A: 128}, c1)
+
+	c0, _ = process("rgb(10,-20)")
+	assert.Equal(t, color.NRGBA{R: 200, G: 50, B: 50, A: 255}, c0)
+
+	c0, c1 = process("contrast(50)")
+	assert.Greater(t, c0.R, uint8(200))
+	assert.Less(t, c0.G, uint8(50))
+	assert.Equal(t, uint8(128), c1.A)
+
+	c0, c1 = process("saturation(-100)")
+	assert.InDelta(t, int(c0.R), int(c0.G), 1)
+	assert.InDelta(t, int(c0.G), int(c0.B), 1)
+	assert.Equal(t, color.NRGBA{R: 100, G: 100, B: 100, A: 128}, c1)
+
+	c0, _ = process("hue(0)")
+	assert.InDelta(t, 200, int(c0.R), 1)
+	assert.InDelta(t, 50, int(c0.G), 1)
+	c0, _ = process("hue(120)")
+	assert.Greater(t, c0.G, c0.R)
+}
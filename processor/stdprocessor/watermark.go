@@ -0,0 +1,149 @@
+package stdprocessor
+
+import (
+	"bytes"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+	"image"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// watermark loads the watermark image by LoadFunc and renders it onto a transparent layer
+// of width and height, following vips processor semantics
+func (s *StdProcessor) watermark(load imagor.LoadFunc, width, height int, args []string) (*image.NRGBA, error) {
+	ln := len(args)
+	if ln < 1 || args[0] == "" || load == nil {
+		return nil, nil
+	}
+	name := args[0]
+	if unescape, e := url.QueryUnescape(args[0]); e == nil {
+		name = unescape
+	}
+	blob, err := load(name)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, imagor.NewError("std: watermark: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	// w_ratio h_ratio
+	w, h := s.MaxWidth, s.MaxHeight
+	if ln >= 6 {
+		w, h = width, height
+		if args[4] != "none" {
+			w, _ = strconv.Atoi(args[4])
+			w = width * w / 100
+		}
+		if args[5] != "none" {
+			h, _ = strconv.Atoi(args[5])
+			h = height * h / 100
+		}
+	}
+	b := src.Bounds()
+	ow, oh := b.Dx(), b.Dy()
+	if w < ow || h < oh {
+		f := math.Min(float64(w)/float64(ow), float64(h)/float64(oh))
+		ow = int(math.Max(math.Round(float64(ow)*f), 1))
+		oh = int(math.Max(math.Round(float64(oh)*f), 1))
+	}
+	overlay := image.NewNRGBA(image.Rect(0, 0, ow, oh))
+	if ow == b.Dx() && oh == b.Dy() {
+		draw.Draw(overlay, overlay.Bounds(), src, b.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(overlay, overlay.Bounds(), src, b, draw.Src, nil)
+	}
+	// alpha
+	if ln >= 4 {
+		alpha, _ := strconv.ParseFloat(args[3], 64)
+		if alpha = 1 - alpha/100; alpha != 1 {
+			alpha = math.Max(math.Min(alpha, 1), 0)
+			for i := 3; i < len(overlay.Pix); i += 4 {
+				overlay.Pix[i] = uint8(float64(overlay.Pix[i]) * alpha)
+			}
+		}
+	}
+	// angle counterclockwise, such as diagonal watermark across the image
+	if ln >= 7 {
+		if angle, _ := strconv.ParseFloat(args[6], 64); angle != 0 {
+			overlay = rotate(overlay, angle)
+			ow, oh = overlay.Rect.Dx(), overlay.Rect.Dy()
+		}
+	}
+	// x y
+	var x, y int
+	var repeatX, repeatY bool
+	if ln >= 3 {
+		x, repeatX = position(args[1], width, ow, imagorpath.HAlignLeft, imagorpath.HAlignRight)
+		y, repeatY = position(args[2], height, oh, imagorpath.VAlignTop, imagorpath.VAlignBottom)
+	}
+	layer := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for ty := y; ty < height; ty += oh {
+		for tx := x; tx < width; tx += ow {
+			r := image.Rect(tx, ty, tx+ow, ty+oh)
+			draw.Draw(layer, r, overlay, image.Point{}, draw.Src)
+			if !repeatX {
+				break
+			}
+		}
+		if !repeatY {
+			break
+		}
+	}
+	return layer, nil
+}
+
+// rotate image counterclockwise by degrees, expanding to the bounding box on transparent background
+func rotate(img *image.NRGBA, degrees float64) *image.NRGBA {
+	var (
+		rad      = -degrees * math.Pi / 180
+		cos, sin = math.Cos(rad), math.Sin(rad)
+		w, h     = float64(img.Rect.Dx()), float64(img.Rect.Dy())
+		dw       = math.Abs(w*cos) + math.Abs(h*sin)
+		dh       = math.Abs(w*sin) + math.Abs(h*cos)
+		dst      = image.NewNRGBA(image.Rect(0, 0, int(math.Ceil(dw-1e-9)), int(math.Ceil(dh-1e-9))))
+	)
+	// rotate around center of source onto center of destination
+	draw.BiLinear.Transform(dst, f64.Aff3{
+		cos, -sin, dw/2 - cos*w/2 + sin*h/2,
+		sin, cos, dh/2 - sin*w/2 - cos*h/2,
+	}, img, img.Rect, draw.Src, nil)
+	return dst
+}
+
+// position of watermark by keyword, percentage, float or pixels, negative counts from the far end
+func position(arg string, size, overlay int, start, end string) (pos int, repeat bool) {
+	switch arg {
+	case "center":
+		return (size - overlay) / 2, false
+	case start:
+		return 0, false
+	case end:
+		return size - overlay, false
+	case "repeat":
+		return 0, true
+	}
+	if strings.HasPrefix(strings.TrimPrefix(arg, "-"), "0.") {
+		pec, _ := strconv.ParseFloat(arg, 64)
+		pos = int(pec * float64(size))
+	} else if strings.HasSuffix(arg, "p") {
+		pos, _ = strconv.Atoi(strings.TrimSuffix(arg, "p"))
+		pos = pos * size / 100
+	} else {
+		pos, _ = strconv.Atoi(arg)
+	}
+	if pos < 0 {
+		pos += size - overlay
+	}
+	return pos, false
+}
@@ -0,0 +1,77 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// gifNetscape GIF application extension of loop count, followed by count and terminator
+var gifNetscape = []byte("\x21\xFF\x0BNETSCAPE2.0\x03\x01")
+
+// setLoop sets number of times the encoded animation plays, 0 for infinite
+func setLoop(buf []byte, format vips.ImageType, loop int) []byte {
+	if loop < 0 || loop > 0xFFFF {
+		return buf
+	}
+	switch format {
+	case vips.ImageTypeGIF:
+		return gifLoop(buf, loop)
+	case vips.ImageTypeWEBP:
+		return webpLoop(buf, loop)
+	}
+	return buf
+}
+
+// gifLoop sets repeat count of NETSCAPE2.0 extension, which is one less than plays.
+// GIF without the extension plays once
+func gifLoop(buf []byte, loop int) []byte {
+	if len(buf) < 13 {
+		return buf
+	}
+	var (
+		i   = bytes.Index(buf, gifNetscape)
+		end = i + len(gifNetscape) + 3
+	)
+	if loop == 1 {
+		if i >= 0 && end <= len(buf) {
+			return append(buf[:i:i], buf[end:]...)
+		}
+		return buf
+	}
+	var repeat uint16
+	if loop > 1 {
+		repeat = uint16(loop - 1)
+	}
+	if i >= 0 && end <= len(buf) {
+		binary.LittleEndian.PutUint16(buf[i+len(gifNetscape):], repeat)
+		return buf
+	}
+	// insert after logical screen descriptor and global color table
+	pos := 13
+	if buf[10]&0x80 != 0 {
+		pos += 3 << (buf[10]&0x07 + 1)
+	}
+	if pos > len(buf) {
+		return buf
+	}
+	out := make([]byte, 0, len(buf)+len(gifNetscape)+3)
+	out = append(out, buf[:pos]...)
+	out = append(out, gifNetscape...)
+	out = append(out, byte(repeat), byte(repeat>>8), 0)
+	return append(out, buf[pos:]...)
+}
+
+// webpLoop sets loop count of ANIM chunk
+func webpLoop(buf []byte, loop int) []byte {
+	// RIFF header then chunks of fourcc, size and payload padded to even
+	for i := 12; i+8 <= len(buf); {
+		size := int(binary.LittleEndian.Uint32(buf[i+4:]))
+		if string(buf[i:i+4]) == "ANIM" && size >= 6 && i+14 <= len(buf) {
+			binary.LittleEndian.PutUint16(buf[i+12:], uint16(loop))
+			return buf
+		}
+		i += 8 + size + size&1
+	}
+	return buf
+}
@@ -0,0 +1,121 @@
+package vipsprocessor
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/davidbyttow/govips/v2/vips"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// maxCollageImages maximum number of images composed by collage, including the image itself
+const maxCollageImages = 9
+
+// collageColumns number of columns of layout for n images
+func collageColumns(layout string, n int) int {
+	switch layout {
+	case "horizontal", "h":
+		return n
+	case "vertical", "v":
+		return 1
+	case "", "grid":
+		return int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	cols, _ := strconv.Atoi(layout)
+	if cols < 1 {
+		return 1
+	}
+	if cols > n {
+		return n
+	}
+	return cols
+}
+
+// collage composes the image and images loaded through LoadFunc into cells of
+// a grid or strip, within the dimension of the image
+// collage(layout, gap, color, image, ...)
+func (v *VipsProcessor) collage(ctx context.Context, img *vips.ImageRef, load imagor.LoadFunc, args ...string) (err error) {
+	ln := len(args)
+	if ln < 4 || IsAnimated(ctx) {
+		// skip animation support
+		return
+	}
+	images := args[3:]
+	if len(images) > maxCollageImages-1 {
+		images = images[:maxCollageImages-1]
+	}
+	var (
+		n      = len(images) + 1
+		cols   = collageColumns(args[0], n)
+		rows   = (n + cols - 1) / cols
+		gap, _ = strconv.Atoi(args[1])
+		width  = img.Width()
+		height = img.PageHeight()
+		color  = args[2]
+	)
+	if gap < 0 {
+		gap = 0
+	}
+	cellW := (width - gap*(cols-1)) / cols
+	cellH := (height - gap*(rows-1)) / rows
+	if cellW < 1 || cellH < 1 {
+		return
+	}
+	var cells []*vips.ImageRef
+	for _, image := range images {
+		if unescape, e := url.QueryUnescape(image); e == nil {
+			image = unescape
+		}
+		var blob *imagor.Blob
+		if blob, err = load(image); err != nil {
+			return
+		}
+		var cell *vips.ImageRef
+		if cell, err = v.newThumbnail(
+			blob, cellW, cellH, vips.InterestingCentre, vips.SizeBoth, 1,
+		); err != nil {
+			return
+		}
+		AddImageRef(ctx, cell)
+		cells = append(cells, cell)
+	}
+	// the image itself as the first cell, on the canvas of the original dimension
+	if err = img.ThumbnailWithSize(cellW, cellH, vips.InterestingCentre, vips.SizeBoth); err != nil {
+		return
+	}
+	transparent := isBlank(color)
+	if transparent && !img.HasAlpha() {
+		if err = img.AddAlpha(); err != nil {
+			return
+		}
+	}
+	hasAlpha := img.HasAlpha()
+	if transparent {
+		err = img.EmbedBackgroundRGBA(0, 0, width, height, &vips.ColorRGBA{})
+	} else {
+		err = img.EmbedBackground(0, 0, width, height, getColor(img, color))
+	}
+	if err != nil {
+		return
+	}
+	for i, cell := range cells {
+		x := (i + 1) % cols * (cellW + gap)
+		y := (i + 1) / cols * (cellH + gap)
+		// center cells thumbnailed smaller than the cell
+		x += (cellW - cell.Width()) / 2
+		y += (cellH - cell.PageHeight()) / 2
+		if err = img.Composite(cell, vips.BlendModeOver, x, y); err != nil {
+			return
+		}
+	}
+	if !hasAlpha {
+		// composite adds alpha channel
+		return img.Flatten(getColor(img, color))
+	}
+	return
+}
+
+func isBlank(color string) bool {
+	return color == "" || color == "none" || color == "transparent"
+}
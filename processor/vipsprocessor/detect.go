@@ -0,0 +1,103 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/davidbyttow/govips/v2/vips"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// detectSize max dimension of the preview image sent to Detector
+const detectSize = 600
+
+// Region detected region of interest in pixels
+type Region struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+}
+
+// Detector detects regions of interest e.g. faces for smart crop.
+// buf is a JPEG preview of the image, regions are in pixels of the preview.
+// Implement with an external detection service or an embedded model
+type Detector interface {
+	Detect(ctx context.Context, buf []byte) ([]Region, error)
+}
+
+// HTTPDetector Detector backed by external detection service,
+// which accepts JPEG by POST request and responds JSON array of regions
+// e.g. [{"left":10,"top":20,"right":110,"bottom":140}]
+type HTTPDetector struct {
+	URL       string
+	Transport http.RoundTripper
+}
+
+func (d *HTTPDetector) Detect(ctx context.Context, buf []byte) ([]Region, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	client := &http.Client{Transport: d.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("detector: unexpected status %d", resp.StatusCode)
+	}
+	var regions []Region
+	if err := json.NewDecoder(resp.Body).Decode(&regions); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// detect regions of interest by Detector, scaled to pixels of the image.
+// Detection errors are logged and fall back to smart crop without regions
+func (v *VipsProcessor) detect(ctx context.Context, img *vips.ImageRef) []focal {
+	if img.Height() != img.PageHeight() {
+		// skip animation support
+		return nil
+	}
+	preview, err := img.Copy()
+	if err != nil {
+		return nil
+	}
+	defer preview.Close()
+	if err := preview.Thumbnail(detectSize, detectSize, vips.InterestingNone); err != nil {
+		return nil
+	}
+	buf, _, err := preview.ExportJpeg(vips.NewJpegExportParams())
+	if err != nil {
+		return nil
+	}
+	regions, err := v.Detector.Detect(ctx, buf)
+	if err != nil {
+		v.Logger.Warn("detect", zap.Error(err))
+		return nil
+	}
+	var (
+		rx         = float64(img.Width()) / float64(preview.Width())
+		ry         = float64(img.PageHeight()) / float64(preview.PageHeight())
+		focalRects []focal
+	)
+	for _, r := range regions {
+		if r.Right > r.Left && r.Bottom > r.Top {
+			focalRects = append(focalRects, focal{
+				Left: r.Left * rx, Top: r.Top * ry, Right: r.Right * rx, Bottom: r.Bottom * ry,
+			})
+		}
+	}
+	if v.Debug {
+		v.Logger.Debug("detect", zap.Int("regions", len(focalRects)))
+	}
+	return focalRects
+}
@@ -62,6 +62,14 @@ func (v *VipsProcessor) watermark(ctx context.Context, img *vips.ImageRef, load
 	if err = overlay.AddAlpha(); err != nil {
 		return
 	}
+	// angle counterclockwise, such as diagonal watermark across the image
+	if ln >= 7 && overlayN == 1 {
+		if angle, _ := strconv.ParseFloat(args[6], 64); angle != 0 {
+			if err = overlay.Similarity(1, -angle, &vips.ColorRGBA{}, 0, 0, 0, 0); err != nil {
+				return
+			}
+		}
+	}
 	w = overlay.Width()
 	h = overlay.PageHeight()
 	// alpha
@@ -76,49 +84,51 @@ func (v *VipsProcessor) watermark(ctx context.Context, img *vips.ImageRef, load
 	}
 	// x y
 	if ln >= 3 {
-		if args[1] == "center" {
-			x = (img.Width() - overlay.Width()) / 2
-		} else if args[1] == imagorpath.HAlignLeft {
-			x = 0
-		} else if args[1] == imagorpath.HAlignRight {
-			x = img.Width() - overlay.Width()
-		} else if args[1] == "repeat" {
-			x = 0
-			across = img.Width()/overlay.Width() + 1
-		} else if strings.HasPrefix(strings.TrimPrefix(args[1], "-"), "0.") {
-			pec, _ := strconv.ParseFloat(args[1], 64)
-			x = int(pec * float64(img.Width()))
-		} else if strings.HasSuffix(args[1], "p") {
-			x, _ = strconv.Atoi(strings.TrimSuffix(args[1], "p"))
-			x = x * img.Width() / 100
-		} else {
-			x, _ = strconv.Atoi(args[1])
-		}
-		if args[2] == "center" {
-			y = (img.PageHeight() - overlay.PageHeight()) / 2
-		} else if args[2] == imagorpath.VAlignTop {
-			y = 0
-		} else if args[2] == imagorpath.VAlignBottom {
-			y = img.PageHeight() - overlay.PageHeight()
-		} else if args[2] == "repeat" {
-			y = 0
-			down = img.PageHeight()/overlay.PageHeight() + 1
-		} else if strings.HasPrefix(strings.TrimPrefix(args[2], "-"), "0.") {
-			pec, _ := strconv.ParseFloat(args[2], 64)
-			y = int(pec * float64(img.PageHeight()))
-		} else if strings.HasSuffix(args[2], "p") {
-			y, _ = strconv.Atoi(strings.TrimSuffix(args[2], "p"))
-			y = y * img.PageHeight() / 100
-		} else {
-			y, _ = strconv.Atoi(args[2])
-		}
-		if x < 0 {
-			x += img.Width() - overlay.Width()
+		var repeatX, repeatY bool
+		x, repeatX = getPosition(args[1], img.Width(), w, imagorpath.HAlignLeft, imagorpath.HAlignRight)
+		y, repeatY = getPosition(args[2], img.PageHeight(), h, imagorpath.VAlignTop, imagorpath.VAlignBottom)
+		if repeatX {
+			across = img.Width()/w + 1
 		}
-		if y < 0 {
-			y += img.PageHeight() - overlay.PageHeight()
+		if repeatY {
+			down = img.PageHeight()/h + 1
 		}
 	}
+	return compositeOverlay(ctx, img, overlay, x, y, across, down, overlayN)
+}
+
+// getPosition of overlay by keyword, percentage, float or pixels, negative counts from the far end
+func getPosition(arg string, size, overlay int, start, end string) (pos int, repeat bool) {
+	if arg == "center" {
+		pos = (size - overlay) / 2
+	} else if arg == start {
+		pos = 0
+	} else if arg == end {
+		pos = size - overlay
+	} else if arg == "repeat" {
+		return 0, true
+	} else if strings.HasPrefix(strings.TrimPrefix(arg, "-"), "0.") {
+		pec, _ := strconv.ParseFloat(arg, 64)
+		pos = int(pec * float64(size))
+	} else if strings.HasSuffix(arg, "p") {
+		pos, _ = strconv.Atoi(strings.TrimSuffix(arg, "p"))
+		pos = pos * size / 100
+	} else {
+		pos, _ = strconv.Atoi(arg)
+	}
+	if pos < 0 {
+		pos += size - overlay
+	}
+	return
+}
+
+// compositeOverlay composites overlay onto image at x y, repeated across and down,
+// replicated to match the pages of animated image
+func compositeOverlay(
+	ctx context.Context, img, overlay *vips.ImageRef, x, y, across, down, overlayN int,
+) (err error) {
+	w := overlay.Width()
+	h := overlay.PageHeight()
 	if across*down > 1 {
 		if err = overlay.Embed(0, 0, across*w, down*h, vips.ExtendRepeat); err != nil {
 			return
@@ -153,6 +163,8 @@ func frames(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...
 	if newN < 1 {
 		return
 	}
+	// source delays cycled to the new frames, unless delay specified
+	srcDelays, _ := img.PageDelay()
 	if n := GetPageN(ctx); n != newN {
 		height := img.PageHeight()
 		if err = img.SetPageHeight(img.Height()); err != nil {
@@ -170,12 +182,15 @@ func frames(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...
 	if ln > 1 {
 		delay, _ = strconv.Atoi(args[1])
 	}
-	if delay == 0 {
-		delay = 100
-	}
 	delays := make([]int, newN)
 	for i := 0; i < newN; i++ {
-		delays[i] = delay
+		if delay > 0 {
+			delays[i] = delay
+		} else if len(srcDelays) > 0 && srcDelays[i%len(srcDelays)] > 0 {
+			delays[i] = srcDelays[i%len(srcDelays)]
+		} else {
+			delays[i] = 100
+		}
 	}
 	if err = img.SetPageDelay(delays); err != nil {
 		return
@@ -256,6 +271,12 @@ func roundCorner(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, arg
 		// rx,ry,color
 		c = getColor(img, args[2])
 		args = args[:2]
+	} else if len(args) == 2 {
+		if _, e := strconv.Atoi(args[1]); e != nil {
+			// rx,color
+			c = getColor(img, args[1])
+			args = args[:1]
+		}
 	}
 	rx, _ = strconv.Atoi(args[0])
 	ry = rx
@@ -329,7 +350,29 @@ func rotate(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...
 	if len(args) == 0 {
 		return
 	}
-	if angle, _ := strconv.Atoi(args[0]); angle > 0 {
+	deg, _ := strconv.ParseFloat(args[0], 64)
+	if deg = math.Mod(deg, 360); deg < 0 {
+		deg += 360
+	}
+	if deg != math.Trunc(deg) || int(deg)%90 != 0 {
+		if IsAnimated(ctx) {
+			// skip animation support
+			return
+		}
+		// arbitrary angle counterclockwise, canvas expanded to fit with background color
+		bg := &vips.ColorRGBA{}
+		if len(args) > 1 {
+			c := getColor(img, args[1])
+			bg = &vips.ColorRGBA{R: c.R, G: c.G, B: c.B, A: 255}
+		}
+		if bg.A == 0 {
+			if err = img.AddAlpha(); err != nil {
+				return
+			}
+		}
+		return img.Similarity(1, -deg, bg, 0, 0, 0, 0)
+	}
+	if angle := int(deg); angle > 0 {
 		vAngle := vips.Angle0
 		switch angle {
 		case 90:
@@ -438,10 +481,6 @@ func modulate(_ context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...
 }
 
 func blur(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...string) (err error) {
-	if IsAnimated(ctx) {
-		// skip animation support
-		return
-	}
 	var sigma float64
 	switch len(args) {
 	case 2:
@@ -453,33 +492,91 @@ func blur(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...st
 	}
 	sigma /= 2
 	if sigma > 0 {
-		return img.GaussianBlur(sigma)
+		return eachPage(ctx, img, func(page *vips.ImageRef) error {
+			return page.GaussianBlur(sigma)
+		})
+	}
+	return
+}
+
+// eachPage applies fn to each page of animated image separately,
+// such that convolution e.g. blur does not bleed across page boundaries
+func eachPage(ctx context.Context, img *vips.ImageRef, fn func(page *vips.ImageRef) error) (err error) {
+	n := GetPageN(ctx)
+	if n <= 1 {
+		return fn(img)
+	}
+	var (
+		w        = img.Width()
+		h        = img.PageHeight()
+		hasAlpha = img.HasAlpha()
+	)
+	for i := 0; i < n; i++ {
+		var page *vips.ImageRef
+		if page, err = img.Copy(); err != nil {
+			return
+		}
+		AddImageRef(ctx, page)
+		if err = page.ExtractArea(0, i*h, w, h); err != nil {
+			return
+		}
+		if err = fn(page); err != nil {
+			return
+		}
+		if err = img.Composite(page, vips.BlendModeSource, 0, i*h); err != nil {
+			return
+		}
+	}
+	if !hasAlpha {
+		// composite adds alpha channel, fully opaque where pages are opaque
+		return img.Flatten(&vips.Color{})
 	}
 	return
 }
 
 func sharpen(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...string) (err error) {
-	if IsAnimated(ctx) {
-		// skip animation support
-		return
+	sigma, flat, jagged := parseSharpen(args...)
+	return eachPage(ctx, img, func(page *vips.ImageRef) error {
+		return page.Sharpen(sigma, flat, jagged)
+	})
+}
+
+// parseSharpen parses sharpen(sigma[,flat,jagged]) arguments,
+// or Thumbor sharpen(amount,radius,luminance_only) with radius as sigma
+func parseSharpen(args ...string) (sigma, flat, jagged float64) {
+	flat, jagged = 1, 2
+	if len(args) == 3 {
+		if _, err := strconv.ParseBool(args[2]); err == nil {
+			sigma, _ = strconv.ParseFloat(args[1], 64)
+			return 1 + sigma*2, flat, jagged
+		}
 	}
-	var sigma float64
-	switch len(args) {
-	case 1:
+	if len(args) > 0 {
 		sigma, _ = strconv.ParseFloat(args[0], 64)
-		break
-	case 2, 3:
-		sigma, _ = strconv.ParseFloat(args[1], 64)
-		break
 	}
-	sigma = 1 + sigma*2
-	return img.Sharpen(sigma, 1, 2)
+	if len(args) > 1 {
+		if v, err := strconv.ParseFloat(args[1], 64); err == nil && v >= 0 {
+			flat = v
+		}
+	}
+	if len(args) > 2 {
+		if v, err := strconv.ParseFloat(args[2], 64); err == nil && v >= 0 {
+			jagged = v
+		}
+	}
+	return 1 + sigma*2, flat, jagged
 }
 
 func stripIcc(_ context.Context, img *vips.ImageRef, _ imagor.LoadFunc, _ ...string) (err error) {
 	return img.RemoveICCProfile()
 }
 
+// stripExif removes EXIF, XMP and IPTC metadata, keeping ICC profile.
+// Orientation is already applied on load
+func stripExif(_ context.Context, img *vips.ImageRef, _ imagor.LoadFunc, _ ...string) (err error) {
+	return img.RemoveMetadata()
+}
+
 func trim(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, args ...string) error {
 	var (
 		ln        = len(args)
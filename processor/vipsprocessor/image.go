@@ -34,7 +34,7 @@ func (v *VipsProcessor) newThumbnail(
 			if n > 1 && img.Pages() > n {
 				// reload image to restrict frames loaded
 				img.Close()
-				return v.newThumbnail(blob, width, height, crop, size, -n)
+				return v.newThumbnail(blob, width, height, crop, size, v.reloadFrames(n))
 			}
 		} else {
 			if img, err = v.checkResolution(vips.LoadImageFromBuffer(buf, params)); err != nil {
@@ -43,7 +43,7 @@ func (v *VipsProcessor) newThumbnail(
 			if n > 1 && img.Pages() > n {
 				// reload image to restrict frames loaded
 				img.Close()
-				return v.newThumbnail(blob, width, height, crop, size, -n)
+				return v.newThumbnail(blob, width, height, crop, size, v.reloadFrames(n))
 			}
 			if err = v.animatedThumbnailWithCrop(img, width, height, crop, size); err != nil {
 				img.Close()
@@ -94,7 +94,7 @@ func (v *VipsProcessor) newImage(blob *imagor.Blob, n int) (*vips.ImageRef, erro
 		// reload image to restrict frames loaded
 		if n > 1 && img.Pages() > n {
 			img.Close()
-			return v.newImage(blob, -n)
+			return v.newImage(blob, v.reloadFrames(n))
 		} else {
 			return img, nil
 		}
@@ -103,10 +103,91 @@ func (v *VipsProcessor) newImage(blob *imagor.Blob, n int) (*vips.ImageRef, erro
 		if err != nil {
 			return nil, wrapErr(err)
 		}
-		return img, nil
+		return autoRotate(img)
 	}
 }
 
+// newImagePage loads the page of multi-page image, page starting from 0,
+// rendered at dpi for vector sources if specified
+func (v *VipsProcessor) newImagePage(blob *imagor.Blob, page, dpi int) (*vips.ImageRef, error) {
+	if blob == nil || blob.IsEmpty() {
+		return nil, imagor.ErrNotFound
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	params := vips.NewImportParams()
+	params.Page.Set(page)
+	if dpi > 0 && blob.BlobType() == imagor.BlobTypeSVG {
+		dpi = v.svgDPI(buf, dpi)
+	}
+	if dpi > 0 {
+		params.Density.Set(dpi)
+	}
+	img, err := v.checkResolution(vips.LoadImageFromBuffer(buf, params))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return autoRotate(img)
+}
+
+// svgDPI limits SVG render density such that the canvas fits within max dimensions and resolution
+func (v *VipsProcessor) svgDPI(buf []byte, dpi int) int {
+	// SVG header loads at default 72 dpi without rendering
+	img, err := vips.LoadImageFromBuffer(buf, nil)
+	if err != nil {
+		return dpi
+	}
+	defer img.Close()
+	return fitDPI(img.Width(), img.Height(), dpi, v.MaxWidth, v.MaxHeight, v.MaxResolution)
+}
+
+func fitDPI(width, height, dpi, maxWidth, maxHeight, maxResolution int) int {
+	if width <= 0 || height <= 0 {
+		return dpi
+	}
+	w, h := float64(width), float64(height)
+	scale := math.Min(float64(maxWidth)/w, float64(maxHeight)/h)
+	scale = math.Min(scale, math.Sqrt(float64(maxResolution)/(w*h)))
+	if limit := int(scale * 72); dpi > limit {
+		if limit < 1 {
+			return 1
+		}
+		return limit
+	}
+	return dpi
+}
+
+// toSRGB converts CMYK and ICC tagged sources e.g. Adobe RGB photos to sRGB by the embedded profile,
+// such that colors are not desaturated. Tagged with compact sRGB profile if embed,
+// otherwise untagged which is assumed sRGB
+func toSRGB(img *vips.ImageRef, embed bool) error {
+	if !img.HasICCProfile() && img.Interpretation() != vips.InterpretationCMYK {
+		return nil
+	}
+	if err := img.OptimizeICCProfile(); err != nil {
+		return err
+	}
+	if !embed {
+		return img.RemoveICCProfile()
+	}
+	return nil
+}
+
+// autoRotate applies EXIF orientation e.g. of camera JPEG and iPhone HEIF,
+// which is applied by thumbnail but not by image loading,
+// such that orientation is honored before metadata are stripped
+func autoRotate(img *vips.ImageRef) (*vips.ImageRef, error) {
+	if img.Orientation() > 1 && img.Height() == img.PageHeight() {
+		if err := img.AutoRotate(); err != nil {
+			img.Close()
+			return nil, wrapErr(err)
+		}
+	}
+	return img, nil
+}
+
 func (v *VipsProcessor) thumbnail(
 	img *vips.ImageRef, width, height int, crop vips.Interesting, size vips.Size,
 ) error {
@@ -172,6 +253,15 @@ func (v *VipsProcessor) checkResolution(img *vips.ImageRef, err error) (*vips.Im
 	return img, nil
 }
 
+// reloadFrames frames to be reloaded when animation exceeds max n frames,
+// the first n frames, or a still of the first frame if CollapseAnimation
+func (v *VipsProcessor) reloadFrames(n int) int {
+	if v.CollapseAnimation {
+		return 1
+	}
+	return -n
+}
+
 func isBlobAnimated(blob *imagor.Blob, n int) bool {
 	return blob != nil && blob.SupportsAnimation() && n != 1 && n != 0
 }
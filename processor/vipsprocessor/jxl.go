@@ -0,0 +1,74 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// decodeJxl decodes JPEG XL into PNG using djxl of libjxl,
+// as JPEG XL is not supported by the libvips binding
+func (v *VipsProcessor) decodeJxl(ctx context.Context, blob *imagor.Blob) (*imagor.Blob, error) {
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	out, err := runJxl(ctx, v.JxlDecoder, buf, ".jxl", ".png")
+	if err != nil {
+		return nil, err
+	}
+	return imagor.NewBlobFromBytes(out), nil
+}
+
+// encodeJxl encodes PNG into JPEG XL using cjxl of libjxl
+func (v *VipsProcessor) encodeJxl(ctx context.Context, buf []byte, quality int) ([]byte, error) {
+	var args []string
+	if quality > 0 {
+		args = append(args, "-q", strconv.Itoa(quality))
+	}
+	return runJxl(ctx, v.JxlEncoder, buf, ".png", ".jxl", args...)
+}
+
+// runJxl runs libjxl tool with input and output files,
+// which determines the output format by file extension
+func runJxl(ctx context.Context, binary string, buf []byte, inExt, outExt string, args ...string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "imagor-jxl-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	in := filepath.Join(dir, "in"+inExt)
+	out := filepath.Join(dir, "out"+outExt)
+	if err := os.WriteFile(in, buf, 0600); err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, append([]string{in, out}, args...)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, imagor.NewError("jxl: "+msg, http.StatusUnprocessableEntity)
+	}
+	res, err := os.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, imagor.ErrUnsupportedFormat
+	}
+	return res, nil
+}
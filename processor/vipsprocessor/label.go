@@ -0,0 +1,203 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/davidbyttow/govips/v2/vips"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// label draws text onto the image, rendered by font from font dir or storage key,
+// defaults to Go Regular font
+func (v *VipsProcessor) label(ctx context.Context, img *vips.ImageRef, load imagor.LoadFunc, args ...string) (err error) {
+	ln := len(args)
+	if ln < 1 {
+		return
+	}
+	text := args[0]
+	if unescape, e := url.QueryUnescape(args[0]); e == nil {
+		text = unescape
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	var (
+		size     = 16
+		c        = color.NRGBA{A: 255}
+		shadow   *color.NRGBA
+		fontName string
+		align    = imagorpath.HAlignLeft
+	)
+	if ln >= 4 {
+		if n, _ := strconv.Atoi(args[3]); n > 0 {
+			size = n
+		}
+	}
+	if ln >= 5 && args[4] != "" {
+		vc := getColor(img, args[4])
+		c = color.NRGBA{R: vc.R, G: vc.G, B: vc.B, A: 255}
+	}
+	if ln >= 6 {
+		fontName = args[5]
+	}
+	if ln >= 7 && args[6] != "" {
+		vc := getColor(img, args[6])
+		shadow = &color.NRGBA{R: vc.R, G: vc.G, B: vc.B, A: 255}
+	}
+	if ln >= 2 {
+		// text alignment follows horizontal position
+		if args[1] == "center" || args[1] == imagorpath.HAlignRight {
+			align = args[1]
+		} else if strings.HasPrefix(args[1], "-") {
+			align = imagorpath.HAlignRight
+		}
+	}
+	f, err := v.loadFont(fontName, load)
+	if err != nil {
+		return
+	}
+	rendered, err := renderLabel(text, f, size, c, shadow, align, v.MaxWidth, v.MaxHeight)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, rendered); err != nil {
+		return
+	}
+	var overlay *vips.ImageRef
+	if overlay, err = vips.NewImageFromBuffer(buf.Bytes()); err != nil {
+		return
+	}
+	AddImageRef(ctx, overlay)
+	var x, y, across, down = 0, 0, 1, 1
+	if ln >= 3 {
+		var repeatX, repeatY bool
+		x, repeatX = getPosition(args[1], img.Width(), overlay.Width(), imagorpath.HAlignLeft, imagorpath.HAlignRight)
+		y, repeatY = getPosition(args[2], img.PageHeight(), overlay.PageHeight(), imagorpath.VAlignTop, imagorpath.VAlignBottom)
+		if repeatX {
+			across = img.Width()/overlay.Width() + 1
+		}
+		if repeatY {
+			down = img.PageHeight()/overlay.PageHeight() + 1
+		}
+	}
+	return compositeOverlay(ctx, img, overlay, x, y, across, down, 1)
+}
+
+// loadFont by name from font dir, or by storage key through LoadFunc
+func (v *VipsProcessor) loadFont(name string, load imagor.LoadFunc) (*opentype.Font, error) {
+	if name == "" {
+		return opentype.Parse(goregular.TTF)
+	}
+	if unescape, e := url.QueryUnescape(name); e == nil {
+		name = unescape
+	}
+	var buf []byte
+	if v.FontDir != "" {
+		base := filepath.Base(name)
+		for _, ext := range []string{"", ".ttf", ".otf"} {
+			if b, err := os.ReadFile(filepath.Join(v.FontDir, base+ext)); err == nil {
+				buf = b
+				break
+			}
+		}
+	}
+	if buf == nil {
+		if load == nil {
+			return nil, imagor.ErrNotFound
+		}
+		blob, err := load(name)
+		if err != nil {
+			return nil, err
+		}
+		if buf, err = blob.ReadAll(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := opentype.Parse(buf)
+	if err != nil {
+		return nil, imagor.NewError("label: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	return f, nil
+}
+
+// renderLabel renders lines of text onto transparent image, bounded by max width and height
+func renderLabel(
+	text string, f *opentype.Font, size int, c color.NRGBA, shadow *color.NRGBA, align string, maxWidth, maxHeight int,
+) (*image.NRGBA, error) {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size: float64(size), DPI: 72, Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, imagor.NewError("label: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	defer func() {
+		_ = face.Close()
+	}()
+	var (
+		m          = face.Metrics()
+		lines      = strings.Split(text, "\n")
+		widths     = make([]int, len(lines))
+		lineHeight = m.Height.Ceil()
+		width      int
+		offset     int
+	)
+	for i, line := range lines {
+		widths[i] = font.MeasureString(face, line).Ceil()
+		if widths[i] > width {
+			width = widths[i]
+		}
+	}
+	height := lineHeight*(len(lines)-1) + (m.Ascent + m.Descent).Ceil()
+	if shadow != nil {
+		if offset = size / 16; offset < 1 {
+			offset = 1
+		}
+	}
+	if width+offset > maxWidth {
+		width = maxWidth - offset
+	}
+	if height+offset > maxHeight {
+		height = maxHeight - offset
+	}
+	if width <= 0 || height <= 0 {
+		return nil, imagor.ErrMaxResolutionExceeded
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width+offset, height+offset))
+	draw := func(src color.NRGBA, dx, dy int) {
+		d := &font.Drawer{Dst: dst, Src: image.NewUniform(src), Face: face}
+		for i, line := range lines {
+			x := 0
+			switch align {
+			case "center":
+				x = (width - widths[i]) / 2
+			case imagorpath.HAlignRight:
+				x = width - widths[i]
+			}
+			d.Dot = fixed.Point26_6{
+				X: fixed.I(x + dx),
+				Y: m.Ascent + fixed.I(i*lineHeight+dy),
+			}
+			d.DrawString(line)
+		}
+	}
+	if shadow != nil {
+		draw(*shadow, offset, offset)
+	}
+	draw(c, 0, 0)
+	return dst, nil
+}
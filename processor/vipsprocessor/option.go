@@ -1,6 +1,7 @@
 package vipsprocessor
 
 import (
+	"github.com/davidbyttow/govips/v2/vips"
 	"go.uber.org/zap"
 	"strings"
 )
@@ -33,12 +34,163 @@ func WithDisableFilters(filters ...string) Option {
 	}
 }
 
+// WithRawDecoder enables camera RAW decoding with dcraw compatible decoder binary e.g. dcraw, dcraw_emu
+func WithRawDecoder(binary string) Option {
+	return func(v *VipsProcessor) {
+		v.RawDecoder = binary
+	}
+}
+
+// WithJxlDecoder enables JPEG XL decoding with djxl binary of libjxl
+func WithJxlDecoder(binary string) Option {
+	return func(v *VipsProcessor) {
+		v.JxlDecoder = binary
+	}
+}
+
+// WithJxlEncoder enables JPEG XL encoding by format(jxl) with cjxl binary of libjxl
+func WithJxlEncoder(binary string) Option {
+	return func(v *VipsProcessor) {
+		v.JxlEncoder = binary
+	}
+}
+
+// WithPreserveDepth keeps 16-bit and HDR depth for output formats that support it e.g. PNG, TIFF,
+// instead of flattening to 8-bit
+func WithPreserveDepth(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.PreserveDepth = enabled
+	}
+}
+
+// WithStripMetadata strips EXIF, XMP and IPTC metadata of all outputs by default,
+// same as strip_exif() filter. EXIF orientation is applied before stripping
+func WithStripMetadata(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.StripMetadata = enabled
+	}
+}
+
+// WithStripICC strips ICC profile of all outputs by default, same as strip_icc() filter
+func WithStripICC(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.StripICC = enabled
+	}
+}
+
+// WithEmbedSRGB embeds compact sRGB profile in outputs converted from CMYK or ICC tagged sources
+func WithEmbedSRGB(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.EmbedSRGB = enabled
+	}
+}
+
+// WithProgressive encodes progressive JPEG and interlaced PNG by default,
+// can be overridden per request by progressive(false)
+func WithProgressive(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.Progressive = enabled
+	}
+}
+
+// WithLinear resamples in linear light by default, can be overridden per request by linear(false)
+func WithLinear(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.Linear = enabled
+	}
+}
+
 func WithMozJPEG(enabled bool) Option {
 	return func(v *VipsProcessor) {
 		v.MozJPEG = enabled
 	}
 }
 
+func WithAvifSpeed(speed int) Option {
+	return func(v *VipsProcessor) {
+		if speed >= 0 && speed <= 9 {
+			v.AvifSpeed = speed
+		}
+	}
+}
+
+func WithAvifQuality(quality int) Option {
+	return func(v *VipsProcessor) {
+		if quality > 0 && quality <= 100 {
+			v.AvifQuality = quality
+		}
+	}
+}
+
+// WithSvgDPI default render density of SVG sources, where dpi(n) filter is not specified
+func WithSvgDPI(dpi int) Option {
+	return func(v *VipsProcessor) {
+		if dpi > 0 && dpi <= maxDPI {
+			v.SvgDPI = dpi
+		}
+	}
+}
+
+// WithSmartCrop saliency strategy of smart crop, attention or entropy
+func WithSmartCrop(strategy string) Option {
+	return func(v *VipsProcessor) {
+		switch strings.ToLower(strings.TrimSpace(strategy)) {
+		case "attention":
+			v.SmartCrop = vips.InterestingAttention
+		case "entropy":
+			v.SmartCrop = vips.InterestingEntropy
+		}
+	}
+}
+
+// WithAutoQualityDSSIM enables quality(auto) to search the lowest quality
+// of which the output is within target DSSIM of the image, e.g. 0.0015
+func WithAutoQualityDSSIM(target float64) Option {
+	return func(v *VipsProcessor) {
+		if target > 0 && target < 1 {
+			v.AutoQualityDSSIM = target
+		}
+	}
+}
+
+// WithUpscaler enlarges by Upscaler e.g. super-resolution model,
+// for enlargements of upscale factor or beyond
+func WithUpscaler(upscaler Upscaler) Option {
+	return func(v *VipsProcessor) {
+		v.Upscaler = upscaler
+	}
+}
+
+// WithUpscaleFactor minimum enlargement factor that Upscaler is applied, defaults to 2
+func WithUpscaleFactor(factor float64) Option {
+	return func(v *VipsProcessor) {
+		if factor > 1 {
+			v.UpscaleFactor = factor
+		}
+	}
+}
+
+// WithSegmenter enables remove_bg filter by Segmenter e.g. ONNX model or external service
+func WithSegmenter(segmenter Segmenter) Option {
+	return func(v *VipsProcessor) {
+		v.Segmenter = segmenter
+	}
+}
+
+// WithDetector biases smart crop toward regions e.g. faces detected by Detector
+func WithDetector(detector Detector) Option {
+	return func(v *VipsProcessor) {
+		v.Detector = detector
+	}
+}
+
+// WithFontDir directory of TTF or OTF fonts for label filter, looked up by file name
+func WithFontDir(dir string) Option {
+	return func(v *VipsProcessor) {
+		v.FontDir = dir
+	}
+}
+
 func WithMaxFilterOps(num int) Option {
 	return func(v *VipsProcessor) {
 		if num != 0 {
@@ -55,6 +207,12 @@ func WithMaxAnimationFrames(num int) Option {
 	}
 }
 
+func WithCollapseAnimation(enabled bool) Option {
+	return func(v *VipsProcessor) {
+		v.CollapseAnimation = enabled
+	}
+}
+
 func WithConcurrency(num int) Option {
 	return func(v *VipsProcessor) {
 		if num != 0 {
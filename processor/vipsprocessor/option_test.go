@@ -21,8 +21,25 @@ func TestWithOption(t *testing.T) {
 			WithMaxHeight(998),
 			WithMaxResolution(1666667),
 			WithMozJPEG(true),
+			WithAvifSpeed(8),
+			WithAvifQuality(50),
+			WithSvgDPI(144),
+			WithAutoQualityDSSIM(0.0015),
+			WithUpscaleFactor(3),
+			WithSmartCrop("entropy"),
+			WithFontDir("/usr/share/fonts"),
+			WithRawDecoder("dcraw_emu"),
+			WithJxlDecoder("djxl"),
+			WithJxlEncoder("cjxl"),
+			WithPreserveDepth(true),
+			WithLinear(true),
+			WithStripMetadata(true),
+			WithStripICC(true),
+			WithEmbedSRGB(true),
+			WithProgressive(true),
 			WithDebug(true),
 			WithMaxAnimationFrames(3),
+			WithCollapseAnimation(true),
 			WithDisableFilters("rgb", "fill, watermark"),
 			WithFilter("noop", func(ctx context.Context, img *vips.ImageRef, load imagor.LoadFunc, args ...string) (err error) {
 				return nil
@@ -37,14 +54,39 @@ func TestWithOption(t *testing.T) {
 		assert.Equal(t, 998, v.MaxHeight)
 		assert.Equal(t, 1666667, v.MaxResolution)
 		assert.Equal(t, 3, v.MaxAnimationFrames)
+		assert.Equal(t, true, v.CollapseAnimation)
 		assert.Equal(t, true, v.MozJPEG)
+		assert.Equal(t, 8, v.AvifSpeed)
+		assert.Equal(t, 50, v.AvifQuality)
+		assert.Equal(t, 144, v.SvgDPI)
+		assert.Equal(t, 0.0015, v.AutoQualityDSSIM)
+		assert.Equal(t, 3.0, v.UpscaleFactor)
+		assert.Equal(t, vips.InterestingEntropy, v.SmartCrop)
+		assert.Equal(t, "/usr/share/fonts", v.FontDir)
+		assert.Equal(t, "dcraw_emu", v.RawDecoder)
+		assert.Equal(t, "djxl", v.JxlDecoder)
+		assert.Equal(t, "cjxl", v.JxlEncoder)
+		assert.Equal(t, true, v.PreserveDepth)
+		assert.Equal(t, true, v.Linear)
+		assert.Equal(t, true, v.StripMetadata)
+		assert.Equal(t, true, v.StripICC)
+		assert.Equal(t, true, v.EmbedSRGB)
+		assert.Equal(t, true, v.Progressive)
 		assert.Equal(t, []string{"rgb", "fill", "watermark"}, v.DisableFilters)
 
 	})
 	t.Run("edge options", func(t *testing.T) {
 		v := New(
 			WithConcurrency(-1),
+			WithAvifSpeed(10),
+			WithAvifQuality(101),
+			WithAutoQualityDSSIM(1),
+			WithUpscaleFactor(0.5),
 		)
 		assert.Equal(t, runtime.NumCPU(), v.Concurrency)
+		assert.Equal(t, -1, v.AvifSpeed)
+		assert.Equal(t, 0, v.AvifQuality)
+		assert.Equal(t, 0.0, v.AutoQualityDSSIM)
+		assert.Equal(t, 2.0, v.UpscaleFactor)
 	})
 }
@@ -0,0 +1,86 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/cshum/imagor"
+	"github.com/davidbyttow/govips/v2/vips"
+	"image"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// blurHashComponents x and y components of blurhash filter args, 4 by 3 by default
+func blurHashComponents(args string) (x, y int) {
+	x, y = 4, 3
+	if args == "" {
+		return
+	}
+	s := strings.Split(args, ",")
+	if n, _ := strconv.Atoi(s[0]); n >= 1 && n <= 9 {
+		x, y = n, n
+	}
+	if len(s) > 1 {
+		if n, _ := strconv.Atoi(s[1]); n >= 1 && n <= 9 {
+			y = n
+		}
+	}
+	return
+}
+
+// blurHash encodes BlurHash of the first page of image, from 32px thumbnail flattened onto white
+func blurHash(ctx context.Context, img *vips.ImageRef, x, y int) (string, error) {
+	im, err := preview(ctx, img, 32, true)
+	if err != nil {
+		return "", err
+	}
+	return imagor.BlurHash(im, x, y), nil
+}
+
+// thumbHashString encodes base64 ThumbHash of the first page of image, from 100px thumbnail
+func thumbHashString(ctx context.Context, img *vips.ImageRef) (string, error) {
+	im, err := preview(ctx, img, 100, false)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(imagor.ThumbHash(im)), nil
+}
+
+// palette extracts up to n dominant colors of the first page of image, from 64px thumbnail
+func palette(ctx context.Context, img *vips.ImageRef, n int) ([]string, error) {
+	im, err := preview(ctx, img, 64, false)
+	if err != nil {
+		return nil, err
+	}
+	return imagor.Palette(im, n), nil
+}
+
+// preview decodes thumbnail of the first page of image within size,
+// optionally flattened onto white
+func preview(ctx context.Context, img *vips.ImageRef, size int, flatten bool) (image.Image, error) {
+	thumb, err := img.Copy()
+	if err != nil {
+		return nil, err
+	}
+	AddImageRef(ctx, thumb)
+	if thumb.Height() != thumb.PageHeight() {
+		if err = thumb.ExtractArea(0, 0, thumb.Width(), thumb.PageHeight()); err != nil {
+			return nil, err
+		}
+	}
+	if err = thumb.Thumbnail(size, size, vips.InterestingNone); err != nil {
+		return nil, err
+	}
+	if flatten && thumb.HasAlpha() {
+		if err = thumb.Flatten(&vips.Color{R: 255, G: 255, B: 255}); err != nil {
+			return nil, err
+		}
+	}
+	buf, _, err := thumb.ExportPng(vips.NewPngExportParams())
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(buf))
+}
@@ -14,7 +14,7 @@ import (
 )
 
 func (v *VipsProcessor) process(
-	ctx context.Context, img *vips.ImageRef, p imagorpath.Params, load imagor.LoadFunc, thumbnail, stretch, upscale bool, focalRects []focal,
+	ctx context.Context, img *vips.ImageRef, p imagorpath.Params, load imagor.LoadFunc, thumbnail, stretch, upscale, linear bool, focalRects []focal,
 ) error {
 	var (
 		origWidth  = float64(img.Width())
@@ -86,6 +86,24 @@ func (v *VipsProcessor) process(
 			h = img.PageHeight()
 		}
 	}
+	if !thumbnail && v.Upscaler != nil {
+		if scale := enlargement(img.Width(), img.PageHeight(), w, h,
+			p.FitIn, stretch, upscale); scale >= v.UpscaleFactor {
+			if err := v.upscale(ctx, img, scale); err != nil {
+				return err
+			}
+		}
+	}
+	interpretation := vips.InterpretationSRGB
+	if img.Interpretation() == vips.InterpretationBW {
+		interpretation = vips.InterpretationBW
+	}
+	if !thumbnail && linear {
+		// resample in linear light to avoid darkening of fine details
+		if err := img.ToColorSpace(vips.InterpretationScRGB); err != nil {
+			return err
+		}
+	}
 	if !thumbnail {
 		if p.FitIn {
 			if upscale || w < img.Width() || h < img.PageHeight() {
@@ -104,7 +122,7 @@ func (v *VipsProcessor) process(
 		} else if upscale || w < img.Width() || h < img.PageHeight() {
 			interest := vips.InterestingCentre
 			if p.Smart {
-				interest = vips.InterestingAttention
+				interest = v.SmartCrop
 			} else if float64(w)/float64(h) > float64(img.Width())/float64(img.PageHeight()) {
 				if p.VAlign == imagorpath.VAlignTop {
 					interest = vips.InterestingLow
@@ -137,6 +155,11 @@ func (v *VipsProcessor) process(
 			}
 		}
 	}
+	if !thumbnail && linear {
+		if err := img.ToColorSpace(interpretation); err != nil {
+			return err
+		}
+	}
 	if p.HFlip {
 		if err := img.Flip(vips.DirectionHorizontal); err != nil {
 			return err
@@ -147,6 +170,12 @@ func (v *VipsProcessor) process(
 			return err
 		}
 	}
+	var hasFill bool
+	for _, filter := range p.Filters {
+		if filter.Name == "fill" {
+			hasFill = true
+		}
+	}
 	for i, filter := range p.Filters {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -167,6 +196,15 @@ func (v *VipsProcessor) process(
 			if err := fn(ctx, img, load, args...); err != nil {
 				return err
 			}
+			if filter.Name == "background_color" && len(args) > 0 && args[0] != "blur" &&
+				p.FitIn && p.Width > 0 && p.Height > 0 && !hasFill {
+				// letterbox fit-in with background color
+				if err := v.fill(ctx, img, w, h,
+					p.PaddingLeft, p.PaddingTop, p.PaddingRight, p.PaddingBottom,
+					filter.Args); err != nil {
+					return err
+				}
+			}
 		} else if filter.Name == "fill" {
 			if err := v.fill(ctx, img, w, h,
 				p.PaddingLeft, p.PaddingTop, p.PaddingRight, p.PaddingBottom,
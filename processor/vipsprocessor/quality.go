@@ -0,0 +1,180 @@
+package vipsprocessor
+
+import (
+	"github.com/davidbyttow/govips/v2/vips"
+	"go.uber.org/zap"
+)
+
+// autoQuality picks encoder quality by output format, dimensions, content and client hint,
+// such that outputs are visually consistent at minimum bytes
+func autoQuality(format vips.ImageType, width, height int, hasAlpha bool, hint string) int {
+	var quality int
+	switch format {
+	case vips.ImageTypeAVIF, vips.ImageTypeHEIF:
+		quality = 55
+	case vips.ImageTypeWEBP:
+		quality = 78
+	default:
+		quality = 80
+	}
+	// artifacts are less visible on large images that are usually displayed at high DPR
+	switch pixels := width * height; {
+	case pixels >= 4000000:
+		quality -= 10
+	case pixels >= 2000000:
+		quality -= 5
+	case pixels <= 100000:
+		quality += 5
+	}
+	// flat colored graphics with alpha are more prone to artifacts
+	if hasAlpha {
+		quality += 5
+	}
+	switch hint {
+	case "save-data":
+		quality -= 20
+	case "slow-2g", "2g":
+		quality -= 25
+	case "3g":
+		quality -= 10
+	}
+	if quality < 30 {
+		quality = 30
+	} else if quality > 95 {
+		quality = 95
+	}
+	return quality
+}
+
+// dssimSize max dimension of the previews compared by DSSIM
+const dssimSize = 256
+
+// searchQuality binary searches the lowest encoder quality of which the decoded output
+// is within target DSSIM of the image. Falls back to quality on error
+func (v *VipsProcessor) searchQuality(
+	img *vips.ImageRef, format vips.ImageType, quality, bitdepth, speed int, interlace bool, target float64,
+) int {
+	ref, width, err := lumaPreview(img)
+	if err != nil {
+		return quality
+	}
+	var (
+		lo, hi = 30, 95
+		found  = hi
+	)
+	for lo <= hi {
+		q := (lo + hi) / 2
+		buf, _, err := v.export(img, format, q, bitdepth, speed, interlace)
+		if err != nil {
+			return quality
+		}
+		out, err := vips.NewImageFromBuffer(buf)
+		if err != nil {
+			return quality
+		}
+		luma, _, err := lumaPreview(out)
+		out.Close()
+		if err != nil || len(luma) != len(ref) {
+			return quality
+		}
+		score := dssim(ref, luma, width)
+		if v.Debug {
+			v.Logger.Debug("auto_quality_search",
+				zap.Int("quality", q), zap.Int("bytes", len(buf)), zap.Float64("dssim", score))
+		}
+		if score <= target {
+			found = q
+			hi = q - 1
+		} else {
+			lo = q + 1
+		}
+	}
+	return found
+}
+
+// lumaPreview 8-bit luma pixels of image downscaled within dssimSize, flattened onto white
+func lumaPreview(img *vips.ImageRef) ([]byte, int, error) {
+	preview, err := img.Copy()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer preview.Close()
+	if err = preview.Thumbnail(dssimSize, dssimSize, vips.InterestingNone); err != nil {
+		return nil, 0, err
+	}
+	if preview.HasAlpha() {
+		if err = preview.Flatten(&vips.Color{R: 255, G: 255, B: 255}); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err = preview.ToColorSpace(vips.InterpretationBW); err != nil {
+		return nil, 0, err
+	}
+	if preview.Bands() > 1 {
+		if err = preview.ExtractBand(0, 1); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err = preview.Cast(vips.BandFormatUchar); err != nil {
+		return nil, 0, err
+	}
+	buf, err := preview.ToBytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	return buf, preview.Width(), nil
+}
+
+// dssim structural dissimilarity of 8-bit luma pixels a and b of width,
+// by mean SSIM over 8x8 windows with stride 4 clipped at edges, where 0 means identical
+func dssim(a, b []byte, width int) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+		n  = 8
+	)
+	if width <= 0 || len(a) != len(b) {
+		return 1
+	}
+	height := len(a) / width
+	if height == 0 {
+		return 1
+	}
+	var (
+		sum   float64
+		count int
+	)
+	for y := 0; y < height; y += n / 2 {
+		for x := 0; x < width; x += n / 2 {
+			var ma, mb, va, vb, cov, k float64
+			for j := y; j < y+n && j < height; j++ {
+				for i := x; i < x+n && i < width; i++ {
+					pa, pb := float64(a[j*width+i]), float64(b[j*width+i])
+					ma += pa
+					mb += pb
+					va += pa * pa
+					vb += pb * pb
+					cov += pa * pb
+					k++
+				}
+			}
+			ma /= k
+			mb /= k
+			va = va/k - ma*ma
+			vb = vb/k - mb*mb
+			cov = cov/k - ma*mb
+			sum += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			count++
+			if x+n >= width {
+				break
+			}
+		}
+		if y+n >= height {
+			break
+		}
+	}
+	if ssim := sum / float64(count); ssim > 0 {
+		return 1/ssim - 1
+	}
+	return 1
+}
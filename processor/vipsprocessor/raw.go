@@ -0,0 +1,76 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+var rawExtensions = map[string]bool{
+	".cr2": true, ".cr3": true, ".crw": true, ".nef": true, ".nrw": true,
+	".arw": true, ".srf": true, ".sr2": true, ".dng": true, ".orf": true,
+	".rw2": true, ".raf": true, ".pef": true, ".srw": true, ".x3f": true,
+}
+
+var cr2Header = []byte("\x49\x49\x2A\x00\x10\x00\x00\x00\x43\x52")
+
+// isRawImage checks for camera RAW by image key extension or CR2 header,
+// since most RAW formats are TIFF based and cannot be told apart from TIFF by sniffing
+func isRawImage(image string, blob *imagor.Blob) bool {
+	if rawExtensions[strings.ToLower(path.Ext(image))] {
+		return true
+	}
+	return blob != nil && bytes.HasPrefix(blob.Sniff(), cr2Header)
+}
+
+// decodeRaw develops camera RAW into 16-bit TIFF using dcraw compatible decoder,
+// e.g. dcraw or dcraw_emu of libraw
+func (v *VipsProcessor) decodeRaw(ctx context.Context, blob *imagor.Blob) (*imagor.Blob, error) {
+	reader, _, err := blob.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	// dcraw reads from file only
+	file, err := os.CreateTemp("", "imagor-raw-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+	_, err = io.Copy(file, reader)
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	// -c write to stdout, -w camera white balance, -T tiff output
+	cmd := exec.CommandContext(ctx, v.RawDecoder, "-c", "-w", "-T", file.Name())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, imagor.NewError("raw: "+msg, http.StatusUnprocessableEntity)
+	}
+	if stdout.Len() == 0 {
+		return nil, imagor.ErrUnsupportedFormat
+	}
+	return imagor.NewBlobFromBytes(stdout.Bytes()), nil
+}
@@ -0,0 +1,100 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/davidbyttow/govips/v2/vips"
+	"io"
+	"net/http"
+)
+
+// Segmenter separates foreground from background for remove_bg filter.
+// buf is a PNG of the image, returns a grayscale mask where white is foreground,
+// or a cutout with transparent background. Any size, which is resized to the image.
+// Implement with an external segmentation service or an embedded model e.g. ONNX
+type Segmenter interface {
+	Segment(ctx context.Context, buf []byte) ([]byte, error)
+}
+
+// HTTPSegmenter Segmenter backed by external segmentation service e.g. rembg,
+// which accepts PNG by POST request and responds mask or cutout image
+type HTTPSegmenter struct {
+	URL       string
+	Transport http.RoundTripper
+}
+
+func (s *HTTPSegmenter) Segment(ctx context.Context, buf []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	client := &http.Client{Transport: s.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("segmenter: unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// removeBg makes background transparent by mask of Segmenter
+func (v *VipsProcessor) removeBg(ctx context.Context, img *vips.ImageRef, _ imagor.LoadFunc, _ ...string) (err error) {
+	if v.Segmenter == nil || img.Height() != img.PageHeight() {
+		// skip animation support
+		return
+	}
+	buf, _, err := img.ExportPng(vips.NewPngExportParams())
+	if err != nil {
+		return
+	}
+	out, err := v.Segmenter.Segment(ctx, buf)
+	if err != nil {
+		return imagor.NewError("remove_bg: "+err.Error(), http.StatusBadGateway)
+	}
+	mask, err := vips.NewImageFromBuffer(out)
+	if err != nil {
+		return imagor.NewError("remove_bg: "+err.Error(), http.StatusBadGateway)
+	}
+	AddImageRef(ctx, mask)
+	if mask.HasAlpha() {
+		// alpha of cutout
+		if err = mask.ExtractBand(mask.Bands()-1, 1); err != nil {
+			return
+		}
+	} else {
+		if err = mask.ToColorSpace(vips.InterpretationBW); err != nil {
+			return
+		}
+		if mask.Bands() > 1 {
+			if err = mask.ExtractBand(0, 1); err != nil {
+				return
+			}
+		}
+	}
+	if err = mask.Cast(vips.BandFormatUchar); err != nil {
+		return
+	}
+	if mask.Width() != img.Width() || mask.Height() != img.Height() {
+		if err = mask.ResizeWithVScale(
+			float64(img.Width())/float64(mask.Width()),
+			float64(img.Height())/float64(mask.Height()),
+			vips.KernelLinear,
+		); err != nil {
+			return
+		}
+	}
+	if img.HasAlpha() {
+		if err = img.ExtractBand(0, img.Bands()-1); err != nil {
+			return
+		}
+	}
+	return img.BandJoin(mask)
+}
@@ -0,0 +1,179 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/davidbyttow/govips/v2/vips"
+	"go.uber.org/zap"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Upscaler enlarges images e.g. by super-resolution model, for enlargements beyond upscale factor.
+// buf is a PNG of the image, scale is the minimum integer factor required.
+// The returned image can be any size larger than the input, which is then resized to the target.
+// Implement with an external upscaling service e.g. Real-ESRGAN sidecar or an embedded model
+type Upscaler interface {
+	Upscale(ctx context.Context, buf []byte, scale int) ([]byte, error)
+}
+
+// HTTPUpscaler Upscaler backed by external upscaling service,
+// which accepts PNG by POST request with scale query param and responds the enlarged image
+type HTTPUpscaler struct {
+	URL       string
+	Transport http.RoundTripper
+}
+
+func (u *HTTPUpscaler) Upscale(ctx context.Context, buf []byte, scale int) ([]byte, error) {
+	uri, err := url.Parse(u.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := uri.Query()
+	query.Set("scale", strconv.Itoa(scale))
+	uri.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri.String(), bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	client := &http.Client{Transport: u.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upscaler: unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// enlargement factor of resizing width x height to w x h, 0 if not enlarged
+func enlargement(width, height, w, h int, fitIn, stretch, upscale bool) float64 {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	sx, sy := float64(w)/float64(width), float64(h)/float64(height)
+	if w == 0 {
+		sx = sy
+	} else if h == 0 {
+		sy = sx
+	}
+	var scale float64
+	switch {
+	case fitIn:
+		if !upscale {
+			return 0
+		}
+		scale = math.Min(sx, sy)
+	case stretch:
+		if !upscale {
+			return 0
+		}
+		scale = math.Max(sx, sy)
+	default:
+		if !upscale && sx >= 1 && sy >= 1 {
+			return 0
+		}
+		scale = math.Max(sx, sy)
+	}
+	if scale <= 1 {
+		return 0
+	}
+	return scale
+}
+
+// imageSize reads image dimensions from the header without decoding pixels,
+// ok false for formats without header decoder
+func imageSize(blob *imagor.Blob) (width, height int, ok bool) {
+	var decodeConfig func(io.Reader) (image.Config, error)
+	switch blob.BlobType() {
+	case imagor.BlobTypeJPEG:
+		decodeConfig = jpeg.DecodeConfig
+	case imagor.BlobTypePNG:
+		decodeConfig = png.DecodeConfig
+	case imagor.BlobTypeGIF:
+		decodeConfig = gif.DecodeConfig
+	case imagor.BlobTypeWEBP:
+		decodeConfig = webp.DecodeConfig
+	case imagor.BlobTypeBMP:
+		decodeConfig = bmp.DecodeConfig
+	case imagor.BlobTypeTIFF:
+		decodeConfig = tiff.DecodeConfig
+	default:
+		return
+	}
+	reader, _, err := blob.NewReader()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	cfg, err := decodeConfig(reader)
+	if err != nil {
+		return
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// upscale enlarges the image by Upscaler, which is then resized to the target.
+// Upscaler errors are logged and fall back to resampling
+func (v *VipsProcessor) upscale(ctx context.Context, img *vips.ImageRef, scale float64) error {
+	if img.Height() != img.PageHeight() {
+		// skip animation support
+		return nil
+	}
+	buf, _, err := img.ExportPng(vips.NewPngExportParams())
+	if err != nil {
+		return err
+	}
+	out, err := v.Upscaler.Upscale(ctx, buf, int(math.Ceil(scale)))
+	if err != nil {
+		v.Logger.Warn("upscale", zap.Error(err))
+		return nil
+	}
+	up, err := v.checkResolution(vips.NewImageFromBuffer(out))
+	if err != nil {
+		v.Logger.Warn("upscale", zap.Error(err))
+		return nil
+	}
+	AddImageRef(ctx, up)
+	if up.Width() <= img.Width() || up.PageHeight() <= img.PageHeight() {
+		return nil
+	}
+	if v.Debug {
+		v.Logger.Debug("upscale",
+			zap.Float64("scale", scale),
+			zap.Int("width", up.Width()),
+			zap.Int("height", up.PageHeight()))
+	}
+	// replace the image by the upscaled, on the canvas extended to its size
+	hasAlpha := img.HasAlpha()
+	if err = img.Embed(0, 0, up.Width(), up.PageHeight(), vips.ExtendBlack); err != nil {
+		return err
+	}
+	if err = img.Composite(up, vips.BlendModeSource, 0, 0); err != nil {
+		return err
+	}
+	if !hasAlpha {
+		// composite adds alpha channel
+		return img.Flatten(&vips.Color{})
+	}
+	return nil
+}
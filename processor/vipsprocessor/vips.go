@@ -1,11 +1,16 @@
 package vipsprocessor
 
 import (
+	"bytes"
 	"context"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/imagorpath"
 	"github.com/davidbyttow/govips/v2/vips"
 	"go.uber.org/zap"
+	"golang.org/x/image/bmp"
+	"image/png"
+	"math"
+	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
@@ -33,7 +38,27 @@ type VipsProcessor struct {
 	MaxHeight          int
 	MaxResolution      int
 	MaxAnimationFrames int
+	CollapseAnimation  bool
 	MozJPEG            bool
+	AvifSpeed          int
+	AvifQuality        int
+	SvgDPI             int
+	SmartCrop          vips.Interesting
+	AutoQualityDSSIM   float64
+	Detector           Detector
+	Upscaler           Upscaler
+	Segmenter          Segmenter
+	UpscaleFactor      float64
+	FontDir            string
+	RawDecoder         string
+	JxlDecoder         string
+	JxlEncoder         string
+	PreserveDepth      bool
+	StripMetadata      bool
+	StripICC           bool
+	EmbedSRGB          bool
+	Progressive        bool
+	Linear             bool
 	Debug              bool
 }
 
@@ -45,10 +70,14 @@ func New(options ...Option) *VipsProcessor {
 		Concurrency:        1,
 		MaxFilterOps:       -1,
 		MaxAnimationFrames: -1,
+		AvifSpeed:          -1,
+		SmartCrop:          vips.InterestingAttention,
+		UpscaleFactor:      2,
 		Logger:             zap.NewNop(),
 	}
 	v.Filters = FilterMap{
 		"watermark":        v.watermark,
+		"label":            v.label,
 		"round_corner":     roundCorner,
 		"rotate":           rotate,
 		"grayscale":        grayscale,
@@ -62,11 +91,13 @@ func New(options ...Option) *VipsProcessor {
 		"blur":             blur,
 		"sharpen":          sharpen,
 		"strip_icc":        stripIcc,
-		"strip_exif":       stripIcc,
+		"strip_exif":       stripExif,
 		"trim":             trim,
 		"frames":           frames,
 		"padding":          v.padding,
 		"proportion":       proportion,
+		"remove_bg":        v.removeBg,
+		"collage":          v.collage,
 	}
 	for _, option := range options {
 		option(v)
@@ -84,6 +115,13 @@ func New(options ...Option) *VipsProcessor {
 }
 
 func (v *VipsProcessor) Startup(_ context.Context) error {
+	for _, binary := range []string{v.RawDecoder, v.JxlDecoder, v.JxlEncoder} {
+		if binary != "" {
+			if _, err := exec.LookPath(binary); err != nil {
+				return err
+			}
+		}
+	}
 	l.Lock()
 	defer l.Unlock()
 	cnt++
@@ -146,9 +184,34 @@ func (v *VipsProcessor) Process(
 		format                = vips.ImageTypeUnknown
 		maxN                  = v.MaxAnimationFrames
 		maxBytes              int
+		page                  int
+		dpi                   int
+		depth                 int
+		linear                = v.Linear
+		progressive           = v.Progressive
+		loop                  = -1
+		hashX                 int
+		hashY                 int
+		thumbHash             bool
+		paletteN              int
+		removeBg              bool
+		isPageSelected        bool
 		focalRects            []focal
+		isJxl                 bool
 		err                   error
 	)
+	if v.RawDecoder != "" && isRawImage(p.Image, blob) {
+		if blob, err = v.decodeRaw(ctx, blob); err != nil {
+			return nil, err
+		}
+	}
+	if v.JxlDecoder != "" && blob.BlobType() == imagor.BlobTypeJXL {
+		if blob, err = v.decodeJxl(ctx, blob); err != nil {
+			return nil, err
+		}
+		// JPEG XL output by default if encoder available
+		isJxl = v.JxlEncoder != ""
+	}
 	ctx = withInitImageRefs(ctx)
 	defer closeImageRefs(ctx)
 	if p.Trim {
@@ -163,7 +226,11 @@ func (v *VipsProcessor) Process(
 	for _, p := range p.Filters {
 		switch p.Name {
 		case "format":
-			if typ, ok := imageTypeMap[p.Args]; ok {
+			// JPEG XL encoded from PNG output
+			if isJxl = p.Args == "jxl" && v.JxlEncoder != ""; isJxl {
+				format = vips.ImageTypePNG
+				maxN = 1
+			} else if typ, ok := imageTypeMap[p.Args]; ok {
 				format = typ
 				if format != vips.ImageTypeGIF && format != vips.ImageTypeWEBP {
 					// no frames if export format not support animation
@@ -194,11 +261,81 @@ func (v *VipsProcessor) Process(
 		case "focal":
 			thumbnailNotSupported = true
 			break
+		case "linear":
+			linear = p.Args != "false"
+			break
+		case "remove_bg":
+			removeBg = v.Segmenter != nil && v.Filters["remove_bg"] != nil
+			break
+		case "progressive":
+			progressive = p.Args != "false"
+			break
+		case "blurhash":
+			hashX, hashY = blurHashComponents(p.Args)
+			break
+		case "thumbhash":
+			thumbHash = true
+			break
+		case "palette":
+			// number of colors, 5 by default
+			paletteN = 5
+			if n, _ := strconv.Atoi(p.Args); n >= 1 && n <= 16 {
+				paletteN = n
+			}
+			break
+		case "loop":
+			// number of times animation plays, 0 for infinite
+			if n, err := strconv.Atoi(p.Args); err == nil && n >= 0 {
+				loop = n
+			}
+			break
+		case "depth":
+			depth, _ = strconv.Atoi(p.Args)
+			break
+		case "page", "frame":
+			// page number starting from 1 for multi-page sources e.g. TIFF, PDF,
+			// or frame of animated sources e.g. GIF, WebP rendered as still
+			if n, _ := strconv.Atoi(p.Args); n >= 1 {
+				page = n - 1
+				maxN = 1
+				isPageSelected = true
+				if page > 0 {
+					thumbnailNotSupported = true
+				}
+			}
+			break
+		case "dpi":
+			// render density of vector sources e.g. PDF, SVG
+			if n, _ := strconv.Atoi(p.Args); n > 0 && n <= maxDPI {
+				dpi = n
+				maxN = 1
+				thumbnailNotSupported = true
+			}
+			break
 		case "trim":
 			thumbnailNotSupported = true
 			break
 		}
 	}
+	if dpi == 0 && v.SvgDPI > 0 && blob.BlobType() == imagor.BlobTypeSVG {
+		dpi = v.SvgDPI
+		thumbnailNotSupported = true
+	}
+	if p.Smart && v.Detector != nil {
+		// detection requires the full image
+		thumbnailNotSupported = true
+	}
+	if linear {
+		// shrink-on-load resamples in gamma space
+		thumbnailNotSupported = true
+	}
+	if v.Upscaler != nil && !thumbnailNotSupported && (p.Width > 0 || p.Height > 0) {
+		// upscaler requires the full image, dimensions probed from header only
+		if width, height, ok := imageSize(blob); ok &&
+			enlargement(width, height, p.Width, p.Height, p.FitIn, stretch, upscale) >= v.UpscaleFactor {
+			thumbnailNotSupported = true
+		}
+	}
 	if !thumbnailNotSupported &&
 		p.CropBottom == 0.0 && p.CropTop == 0.0 && p.CropLeft == 0.0 && p.CropRight == 0.0 {
 		// apply shrink-on-load where possible
@@ -237,7 +374,7 @@ func (v *VipsProcessor) Process(
 			if p.Width > 0 && p.Height > 0 {
 				interest := vips.InterestingNone
 				if p.Smart {
-					interest = vips.InterestingAttention
+					interest = v.SmartCrop
 					thumbnail = true
 				} else if (p.VAlign == imagorpath.VAlignTop && p.HAlign == "") ||
 					(p.HAlign == imagorpath.HAlignLeft && p.VAlign == "") {
@@ -280,7 +417,11 @@ func (v *VipsProcessor) Process(
 		}
 	}
 	if !thumbnail {
-		if thumbnailNotSupported {
+		if page > 0 || dpi > 0 {
+			if img, err = v.newImagePage(blob, page, dpi); err != nil {
+				return nil, err
+			}
+		} else if thumbnailNotSupported {
 			if img, err = v.newImage(blob, maxN); err != nil {
 				return nil, err
 			}
@@ -294,14 +435,35 @@ func (v *VipsProcessor) Process(
 		}
 	}
 	AddImageRef(ctx, img)
+	if !isHighDepth(img) {
+		if err := toSRGB(img, v.EmbedSRGB); err != nil {
+			return nil, wrapErr(err)
+		}
+	}
 	var (
-		quality    int
-		pageN      = img.Height() / img.PageHeight()
-		origWidth  = float64(img.Width())
-		origHeight = float64(img.PageHeight())
+		quality       int
+		isAutoQuality bool
+		qualityHint   string
+		speed         = v.AvifSpeed
+		pageN         = img.Height() / img.PageHeight()
+		origWidth     = float64(img.Width())
+		origHeight    = float64(img.PageHeight())
 	)
 	if format == vips.ImageTypeUnknown {
-		format = img.Format()
+		switch blob.BlobType() {
+		case imagor.BlobTypeHEIF:
+			// HEIF is not widely supported by browsers, served as JPEG by default
+			format = vips.ImageTypeJPEG
+		case imagor.BlobTypeSVG:
+			// rasterized SVG keeps transparency
+			format = vips.ImageTypePNG
+		default:
+			format = img.Format()
+		}
+		if removeBg && format == vips.ImageTypeJPEG {
+			// transparent background
+			format = vips.ImageTypePNG
+		}
 	}
 	SetPageN(ctx, pageN)
 	if v.Debug {
@@ -314,10 +476,24 @@ func (v *VipsProcessor) Process(
 	for _, p := range p.Filters {
 		switch p.Name {
 		case "quality":
-			quality, _ = strconv.Atoi(p.Args)
+			if args := strings.Split(p.Args, ","); args[0] == "auto" {
+				isAutoQuality = true
+				if len(args) > 1 {
+					qualityHint = args[1]
+				}
+			} else {
+				quality, _ = strconv.Atoi(p.Args)
+			}
+			break
+		case "speed":
+			// AVIF encoder speed 0-9, higher is faster with larger output
+			if n, err := strconv.Atoi(p.Args); err == nil && n >= 0 && n <= 9 {
+				speed = n
+			}
 			break
 		case "autojpg":
 			format = vips.ImageTypeJPEG
+			isJxl = false
 			break
 		case "focal":
 			if args := strings.FieldsFunc(p.Args, focalSplit); len(args) == 4 {
@@ -339,23 +515,73 @@ func (v *VipsProcessor) Process(
 			break
 		}
 	}
-	if err := v.process(ctx, img, p, load, thumbnail, stretch, upscale, focalRects); err != nil {
+	if p.Smart && len(focalRects) == 0 && v.Detector != nil {
+		focalRects = v.detect(ctx, img)
+	}
+	if err := v.process(ctx, img, p, load, thumbnail, stretch, upscale, linear, focalRects); err != nil {
 		return nil, wrapErr(err)
 	}
+	if v.StripMetadata {
+		if err := img.RemoveMetadata(); err != nil {
+			return nil, wrapErr(err)
+		}
+	}
+	if v.StripICC {
+		if err := img.RemoveICCProfile(); err != nil {
+			return nil, wrapErr(err)
+		}
+	}
+	if isAutoQuality {
+		quality = autoQuality(format, img.Width(), img.PageHeight(), img.HasAlpha(), qualityHint)
+		if v.Debug {
+			v.Logger.Debug("auto_quality",
+				zap.Int("quality", quality), zap.String("hint", qualityHint))
+		}
+	}
+	bitdepth := 8
+	if isHighDepth(img) {
+		if depth == 16 || (depth == 0 && v.PreserveDepth) {
+			bitdepth = 16
+		} else if depth == 8 && format == vips.ImageTypeTIFF {
+			// tiff saves native depth, flatten if 8-bit is explicitly requested
+			if err := flattenDepth(img); err != nil {
+				return nil, wrapErr(err)
+			}
+		}
+	}
+	// perceptual search of auto quality, where client hints take precedence
+	if isAutoQuality && v.AutoQualityDSSIM > 0 && qualityHint == "" && bitdepth == 8 && pageN == 1 && !isJxl {
+		switch format {
+		case vips.ImageTypeJPEG, vips.ImageTypeWEBP, vips.ImageTypeAVIF, vips.ImageTypeHEIF:
+			quality = v.searchQuality(img, format, quality, bitdepth, speed, progressive, v.AutoQualityDSSIM)
+		}
+	}
 	for {
-		buf, meta, err := v.export(img, format, quality)
+		buf, meta, err := v.export(img, format, quality, bitdepth, speed, progressive)
 		if err != nil {
 			return nil, wrapErr(err)
 		}
-		if maxBytes > 0 && (quality > 10 || quality == 0) && format != vips.ImageTypePNG {
-			ln := len(buf)
+		if isJxl {
+			if buf, err = v.encodeJxl(ctx, buf, quality); err != nil {
+				return nil, err
+			}
+		}
+		if loop >= 0 && img.Height() != img.PageHeight() {
+			buf = setLoop(buf, format, loop)
+		}
+		if ln := len(buf); maxBytes > 0 && ln > maxBytes {
 			if v.Debug {
 				v.Logger.Debug("max_bytes",
 					zap.Int("bytes", ln),
 					zap.Int("quality", quality),
+					zap.Int("width", img.Width()),
+					zap.Int("height", img.PageHeight()),
 				)
 			}
-			if ln > maxBytes {
+			if err := ctx.Err(); err != nil {
+				return nil, wrapErr(err)
+			}
+			if (quality > 10 || quality == 0) && (format != vips.ImageTypePNG || isJxl) {
 				if quality == 0 {
 					quality = 80
 				}
@@ -368,20 +594,93 @@ func (v *VipsProcessor) Process(
 				default:
 					quality = quality * 75 / 100
 				}
-				if err := ctx.Err(); err != nil {
+				continue
+			}
+			// quality alone does not fit, downscale by the remaining ratio
+			// until dimensions cannot be reduced. Skip animation support
+			if width, height := img.Width(), img.PageHeight(); height == img.Height() {
+				scale := math.Sqrt(float64(maxBytes)/float64(ln)) * 0.9
+				if err := img.Resize(scale, vips.KernelAuto); err != nil {
 					return nil, wrapErr(err)
 				}
-				continue
+				if img.Width() < width || img.PageHeight() < height {
+					continue
+				}
 			}
 		}
 		b := imagor.NewBlobFromBytes(buf)
 		if meta != nil {
 			b.Meta = getMeta(meta)
+			// multi-page sources e.g. TIFF are loaded one page at a time,
+			// such that pages count is not the number of pages loaded
+			b.Meta.Height = img.PageHeight()
+			if isPageSelected {
+				// total pages or frames of the source
+				b.Meta.Pages = img.Pages()
+			}
+			if isJxl {
+				b.Meta.Format = "jxl"
+				b.Meta.ContentType = "image/jxl"
+			}
+			if hashX > 0 {
+				if b.Meta.BlurHash, err = blurHash(ctx, img, hashX, hashY); err != nil {
+					v.Logger.Warn("blurhash", zap.Error(err))
+				}
+			}
+			if thumbHash {
+				if b.Meta.ThumbHash, err = thumbHashString(ctx, img); err != nil {
+					v.Logger.Warn("thumbhash", zap.Error(err))
+				}
+			}
+			if paletteN > 0 {
+				if b.Meta.Palette, err = palette(ctx, img, paletteN); err != nil {
+					v.Logger.Warn("palette", zap.Error(err))
+				} else if len(b.Meta.Palette) > 0 {
+					b.Meta.DominantColor = b.Meta.Palette[0]
+				}
+			}
 		}
 		return b, nil
 	}
 }
 
+// exportBMP encodes BMP from PNG export, as libvips has no BMP saver
+func exportBMP(image *vips.ImageRef) ([]byte, *vips.ImageMetadata, error) {
+	buf, meta, err := image.ExportPng(vips.NewPngExportParams())
+	if err != nil {
+		return nil, nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, nil, err
+	}
+	var out bytes.Buffer
+	if err = bmp.Encode(&out, img); err != nil {
+		return nil, nil, err
+	}
+	if meta != nil {
+		meta.Format = vips.ImageTypeBMP
+	}
+	return out.Bytes(), meta, nil
+}
+
+// isHighDepth checks for 16-bit or float HDR pixel formats
+func isHighDepth(img *vips.ImageRef) bool {
+	switch img.BandFormat() {
+	case vips.BandFormatUshort, vips.BandFormatShort, vips.BandFormatFloat, vips.BandFormatDouble:
+		return true
+	}
+	return false
+}
+
+func flattenDepth(img *vips.ImageRef) error {
+	switch img.Interpretation() {
+	case vips.InterpretationGB16, vips.InterpretationBW:
+		return img.ToColorSpace(vips.InterpretationBW)
+	}
+	return img.ToColorSpace(vips.InterpretationSRGB)
+}
+
 func getMeta(meta *vips.ImageMetadata) *imagor.Meta {
 	format := vips.ImageTypes[meta.Format]
 	contentType := imageMimeTypeMap[format]
@@ -406,6 +705,8 @@ func getMeta(meta *vips.ImageMetadata) *imagor.Meta {
 	}
 }
 
+const maxDPI = 1200
+
 var imageTypeMap = map[string]vips.ImageType{
 	"gif":    vips.ImageTypeGIF,
 	"jpeg":   vips.ImageTypeJPEG,
@@ -437,10 +738,16 @@ var imageMimeTypeMap = map[string]string{
 	"jp2":  "image/jp2",
 }
 
-func (v *VipsProcessor) export(image *vips.ImageRef, format vips.ImageType, quality int) ([]byte, *vips.ImageMetadata, error) {
+func (v *VipsProcessor) export(
+	image *vips.ImageRef, format vips.ImageType, quality, bitdepth, speed int, interlace bool,
+) ([]byte, *vips.ImageMetadata, error) {
 	switch format {
 	case vips.ImageTypePNG:
 		opts := vips.NewPngExportParams()
+		if bitdepth == 16 {
+			opts.Bitdepth = 16
+		}
+		opts.Interlace = interlace
 		return image.ExportPng(opts)
 	case vips.ImageTypeWEBP:
 		opts := vips.NewWebpExportParams()
@@ -462,9 +769,15 @@ func (v *VipsProcessor) export(image *vips.ImageRef, format vips.ImageType, qual
 		return image.ExportGIF(opts)
 	case vips.ImageTypeAVIF:
 		opts := vips.NewAvifExportParams()
+		if v.AvifQuality > 0 {
+			opts.Quality = v.AvifQuality
+		}
 		if quality > 0 {
 			opts.Quality = quality
 		}
+		if speed >= 0 {
+			opts.Speed = speed
+		}
 		return image.ExportAvif(opts)
 	case vips.ImageTypeJP2K:
 		opts := vips.NewJp2kExportParams()
@@ -472,6 +785,8 @@ func (v *VipsProcessor) export(image *vips.ImageRef, format vips.ImageType, qual
 			opts.Quality = quality
 		}
 		return image.ExportJp2k(opts)
+	case vips.ImageTypeBMP:
+		return exportBMP(image)
 	default:
 		opts := vips.NewJpegExportParams()
 		if v.MozJPEG {
@@ -483,6 +798,9 @@ func (v *VipsProcessor) export(image *vips.ImageRef, format vips.ImageType, qual
 			opts.TrellisQuant = true
 			opts.QuantTable = 3
 		}
+		if interlace {
+			opts.Interlace = true
+		}
 		if quality > 0 {
 			opts.Quality = quality
 		}
@@ -1,29 +1,39 @@
 package vipsprocessor
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/imagorpath"
 	"github.com/cshum/imagor/storage/filestorage"
+	"github.com/davidbyttow/govips/v2/vips"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
 	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
 	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
-	_ "image/gif"
 	_ "image/jpeg"
-	_ "image/png"
 )
 
 var testDataDir string
@@ -49,7 +59,13 @@ func TestVipsProcessor(t *testing.T) {
 			{name: "export gif", path: "filters:format(gif):quality(70)/gopher-front.png", checkTypeOnly: true},
 			{name: "export webp", path: "filters:format(webp):quality(70)/gopher-front.png", checkTypeOnly: true},
 			{name: "export avif", path: "filters:format(avif):quality(70)/gopher-front.png", checkTypeOnly: true},
+			{name: "export avif speed", path: "filters:format(avif):quality(50):speed(9)/gopher-front.png", checkTypeOnly: true},
+			{name: "svg to png", path: "300x0/sample.svg", checkTypeOnly: true},
+			{name: "svg dpi", path: "filters:dpi(300):format(webp)/sample.svg", checkTypeOnly: true},
 			{name: "export tiff", path: "filters:format(tiff):quality(70)/gopher-front.png", checkTypeOnly: true},
+			{name: "export bmp", path: "filters:format(bmp)/gopher-front.png", checkTypeOnly: true},
+			{name: "export webp auto quality", path: "filters:format(webp):quality(auto)/gopher-front.png", checkTypeOnly: true},
+			{name: "export jpeg auto quality save-data", path: "filters:format(jpeg):quality(auto,save-data)/gopher-front.png", checkTypeOnly: true},
 			{name: "no-ops", path: "filters:background_color():frames():frames(0):round_corner():padding():rotate():proportion():proportion(9999):proportion(0.0000000001):proportion(-10)/gopher-front.png"},
 			{name: "no-ops 2", path: "trim/filters:watermark():blur(2):sharpen(2):brightness():contrast():hue():saturation():rgb():modulate()/dancing-banana.gif"},
 			{name: "no-ops 3", path: "filters:proportion():proportion(9999):proportion(0.0000000001):proportion(-10)/gopher-front.png"},
@@ -87,6 +103,8 @@ func TestVipsProcessor(t *testing.T) {
 			{name: "crop stretch top flip", path: "10x20:3000x5000/stretch/100x200/filters:brightness(-20):contrast(50):rgb(10,-50,30):fill(black)/gopher.png"},
 			{name: "crop-percent stretch top flip", path: "0.006120x0.008993:1.0x1.0/stretch/100x200/filters:brightness(-20):contrast(50):rgb(10,-50,30):fill(black)/gopher.png"},
 			{name: "padding rotation fill blur grayscale", path: "/fit-in/200x210/20x20/filters:rotate(90):rotate(270):rotate(180):fill(blur):grayscale()/gopher.png"},
+			{name: "round_corner jpeg", path: "fit-in/0x210/filters:round_corner(40,white):format(jpeg)/gopher.png"},
+			{name: "fit-in background_color", path: "fit-in/300x200/filters:background_color(ffff00):format(jpeg)/gopher.png"},
 			{name: "fill round_corner", path: "fit-in/0x210/filters:fill(yellow):round_corner(40,60,green)/gopher.png"},
 			{name: "trim with crop", path: "trim:bottom-right/50x50:0x0/find_trim.png"},
 			{name: "trim right", path: "trim:bottom-right/500x500/filters:strip_exif():upscale():no_upscale()/find_trim.png"},
@@ -96,6 +114,8 @@ func TestVipsProcessor(t *testing.T) {
 			{name: "trim filter", path: "/fit-in/100x100/filters:fill(auto):trim(50)/find_trim.png"},
 			{name: "watermark", path: "fit-in/500x500/filters:fill(white):watermark(gopher.png,10p,repeat,30,20,20):watermark(gopher.png,repeat,bottom,30,30,30):watermark(gopher-front.png,center,-10p)/gopher.png"},
 			{name: "watermark float", path: "fit-in/500x500/filters:fill(white):watermark(gopher.png,0.1,repeat,30,20,20):watermark(gopher.png,repeat,bottom,30,30,30):watermark(gopher-front.png,center,-0.1)/gopher.png"},
+			{name: "watermark repeat angle", path: "fit-in/500x500/filters:fill(white):watermark(gopher-front.png,repeat,repeat,60,20,none,45)/gopher.png"},
+			{name: "label", path: "fit-in/500x500/filters:fill(white):label(imagor,10,-10,40,red):label(Hello%2C%0Agopher,center,top,30,white,,black)/gopher.png"},
 			{name: "watermark align", path: "fit-in/500x500/filters:fill(white):watermark(gopher.png,left,top,30,20,20):watermark(gopher.png,right,center,30,30,30):watermark(gopher-front.png,-20,-10)/gopher.png"},
 
 			{name: "original no animate", path: "filters:fill(white):format(jpeg)/dancing-banana.gif"},
@@ -106,6 +126,8 @@ func TestVipsProcessor(t *testing.T) {
 			{name: "smart focal animated", path: "100x30/smart/filters:focal(0.1x0:0.89x0.72)/dancing-banana.gif"},
 			{name: "watermark frames static", path: "fit-in/200x200/filters:fill(white):frames(3):watermark(dancing-banana.gif):format(jpeg)/gopher.png"},
 			{name: "padding", path: "fit-in/-180x180/10x10/filters:fill(yellow):padding(white,10,20,30,40):format(jpeg)/gopher.png"},
+			{name: "rotate arbitrary angle", path: "fit-in/200x200/filters:rotate(30):format(png)/gopher-front.png"},
+			{name: "rotate arbitrary angle color", path: "fit-in/200x200/filters:rotate(-45,yellow):format(jpeg)/gopher-front.png"},
 			{name: "rotate fill", path: "fit-in/100x210/10x20:15x3/filters:rotate(90):fill(yellow)/gopher-front.png"},
 			{name: "resize center animated", path: "100x100/dancing-banana.gif"},
 			{name: "resize top animated", path: "200x100/top/dancing-banana.gif"},
@@ -118,6 +140,9 @@ func TestVipsProcessor(t *testing.T) {
 			{name: "resize right animated", path: "100x200/right/top/dancing-banana.gif"},
 			{name: "stretch animated", path: "stretch/100x200/dancing-banana.gif"},
 			{name: "resize padding animated", path: "100x100/10x5/top/filters:fill(yellow)/dancing-banana.gif"},
+			{name: "blur animated", path: "fit-in/200x150/filters:blur(5)/dancing-banana.gif"},
+			{name: "sharpen animated", path: "fit-in/200x150/filters:sharpen(2)/dancing-banana.gif"},
+			{name: "sharpen flat jagged", path: "fit-in/200x150/filters:sharpen(2,0.5,4)/gopher.png", checkTypeOnly: true},
 			{name: "watermark animated", path: "fit-in/200x150/filters:fill(yellow):watermark(gopher-front.png,repeat,bottom,0,30,30)/dancing-banana.gif"},
 			{name: "watermark animated align bottom right", path: "fit-in/200x150/filters:fill(yellow):watermark(gopher-front.png,-20,-10,0,30,30)/dancing-banana.gif"},
 			{name: "watermark double animated", path: "fit-in/200x150/filters:fill(yellow):watermark(dancing-banana.gif,-20,-10,0,30,30):watermark(nyan-cat.gif,0,10,0,40,30)/dancing-banana.gif"},
@@ -221,6 +246,685 @@ func TestVipsProcessor(t *testing.T) {
 	})
 }
 
+func TestAnimatedWebP(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		opts  []Option
+		pages int
+	}{
+		{name: "animated", pages: 8},
+		{name: "max frames", opts: []Option{WithMaxAnimationFrames(3)}, pages: 3},
+		{name: "collapse", opts: []Option{WithMaxAnimationFrames(3), WithCollapseAnimation(true)}, pages: 1},
+		{name: "collapse within max frames", opts: []Option{WithMaxAnimationFrames(10), WithCollapseAnimation(true)}, pages: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.opts...)
+			require.NoError(t, v.Startup(ctx))
+			t.Cleanup(func() {
+				assert.NoError(t, v.Shutdown(ctx))
+			})
+			blob, err := v.Process(ctx,
+				imagor.NewBlobFromPath(filepath.Join(testDataDir, "dancing-banana.gif")),
+				imagorpath.Parse("fit-in/100x100/filters:format(webp)/dancing-banana.gif"), nil)
+			require.NoError(t, err)
+			assert.Equal(t, imagor.BlobTypeWEBP, blob.BlobType())
+			assert.Equal(t, "webp", blob.Meta.Format)
+			assert.Equal(t, tt.pages, blob.Meta.Pages)
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	tests := []struct {
+		path     string
+		maxBytes int
+	}{
+		{path: "filters:max_bytes(6000):format(jpg):fill(white)/gopher.png", maxBytes: 6000},
+		{path: "filters:max_bytes(20000)/gopher.png", maxBytes: 20000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			blob, err := v.Process(ctx,
+				imagor.NewBlobFromPath(filepath.Join(testDataDir, "gopher.png")),
+				imagorpath.Parse(tt.path), nil)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(buf), tt.maxBytes)
+		})
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		opts []Option
+		path string
+		exif bool
+	}{
+		{name: "preserve", path: "filters:format(jpeg)/demo1.jpg", exif: true},
+		{name: "strip_exif filter", path: "filters:format(jpeg):strip_exif()/demo1.jpg"},
+		{name: "strip metadata option", opts: []Option{WithStripMetadata(true)}, path: "filters:format(jpeg)/demo1.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.opts...)
+			require.NoError(t, v.Startup(ctx))
+			t.Cleanup(func() {
+				assert.NoError(t, v.Shutdown(ctx))
+			})
+			blob, err := v.Process(ctx,
+				imagor.NewBlobFromPath(filepath.Join(testDataDir, "demo1.jpg")),
+				imagorpath.Parse(tt.path), nil)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			assert.Equal(t, tt.exif, bytes.Contains(buf, []byte("Exif\x00\x00")))
+		})
+	}
+}
+
+func TestCMYKToSRGB(t *testing.T) {
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	src, err := vips.NewImageFromFile(filepath.Join(testDataDir, "demo1.jpg"))
+	require.NoError(t, err)
+	defer src.Close()
+	require.NoError(t, src.ToColorSpace(vips.InterpretationCMYK))
+	buf, _, err := src.ExportJpeg(vips.NewJpegExportParams())
+	require.NoError(t, err)
+
+	blob, err := v.Process(ctx, imagor.NewBlobFromBytes(buf),
+		imagorpath.Parse("100x100/filters:format(jpeg)/cmyk.jpg"), nil)
+	require.NoError(t, err)
+	out, err := blob.ReadAll()
+	require.NoError(t, err)
+	img, _, err := image.Decode(bytes.NewReader(out))
+	require.NoError(t, err)
+	assert.IsType(t, &image.YCbCr{}, img)
+}
+
+func TestProgressive(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		opts        []Option
+		path        string
+		progressive bool
+	}{
+		{name: "baseline jpeg", path: "filters:format(jpeg)/gopher.png"},
+		{name: "progressive jpeg", path: "filters:format(jpeg):progressive()/gopher.png", progressive: true},
+		{name: "progressive option", opts: []Option{WithProgressive(true)}, path: "filters:format(jpeg)/gopher.png", progressive: true},
+		{name: "progressive option disabled", opts: []Option{WithProgressive(true)}, path: "filters:format(jpeg):progressive(false)/gopher.png"},
+		{name: "interlaced png", path: "filters:format(png):progressive()/gopher.png", progressive: true},
+		{name: "non-interlaced png", path: "filters:format(png)/gopher.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.opts...)
+			require.NoError(t, v.Startup(ctx))
+			t.Cleanup(func() {
+				assert.NoError(t, v.Shutdown(ctx))
+			})
+			blob, err := v.Process(ctx,
+				imagor.NewBlobFromPath(filepath.Join(testDataDir, "gopher.png")),
+				imagorpath.Parse(tt.path), nil)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			if blob.BlobType() == imagor.BlobTypePNG {
+				// IHDR interlace method
+				require.Greater(t, len(buf), 28)
+				assert.Equal(t, tt.progressive, buf[28] == 1)
+			} else {
+				// SOF2 marker of progressive DCT
+				assert.Equal(t, tt.progressive, bytes.Contains(buf, []byte{0xFF, 0xC2}))
+			}
+		})
+	}
+}
+
+func TestFrame(t *testing.T) {
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	for _, path := range []string{
+		"filters:frame(1)/dancing-banana.gif",
+		"filters:frame(3)/dancing-banana.gif",
+		"fit-in/50x50/filters:page(3)/dancing-banana.gif",
+	} {
+		t.Run(path, func(t *testing.T) {
+			blob, err := v.Process(ctx,
+				imagor.NewBlobFromPath(filepath.Join(testDataDir, "dancing-banana.gif")),
+				imagorpath.Parse(path), nil)
+			require.NoError(t, err)
+			assert.Equal(t, 8, blob.Meta.Pages, "total frames of source")
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			g, err := gif.DecodeAll(bytes.NewReader(buf))
+			require.NoError(t, err)
+			assert.Len(t, g.Image, 1)
+		})
+	}
+}
+
+func TestLoop(t *testing.T) {
+	var buf bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White})
+	require.NoError(t, gif.EncodeAll(&buf, &gif.GIF{
+		Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: -1,
+	}))
+	once := buf.Bytes()
+	for _, tt := range []struct {
+		loop      int
+		loopCount int
+	}{
+		{0, 0},
+		{1, -1},
+		{2, 1},
+		{5, 4},
+	} {
+		// insert then update or remove the extension
+		out := gifLoop(append([]byte{}, once...), 3)
+		out = gifLoop(out, tt.loop)
+		g, err := gif.DecodeAll(bytes.NewReader(out))
+		require.NoError(t, err)
+		assert.Equal(t, tt.loopCount, g.LoopCount, "loop %d", tt.loop)
+		assert.Len(t, g.Image, 2)
+	}
+
+	// RIFF header, VP8X chunk then ANIM chunk of background color and loop count
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00" +
+		"\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"ANIM\x06\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	out := webpLoop(webp, 3)
+	assert.Equal(t, []byte{3, 0}, out[len(out)-2:])
+
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	blob, err := v.Process(ctx,
+		imagor.NewBlobFromPath(filepath.Join(testDataDir, "dancing-banana.gif")),
+		imagorpath.Parse("filters:frames(3):loop(2)/dancing-banana.gif"), nil)
+	require.NoError(t, err)
+	buf2, err := blob.ReadAll()
+	require.NoError(t, err)
+	g, err := gif.DecodeAll(bytes.NewReader(buf2))
+	require.NoError(t, err)
+	assert.Len(t, g.Image, 3)
+	assert.Equal(t, 1, g.LoopCount)
+}
+
+type detectorFunc func(ctx context.Context, buf []byte) ([]Region, error)
+
+func (f detectorFunc) Detect(ctx context.Context, buf []byte) ([]Region, error) {
+	return f(ctx, buf)
+}
+
+func TestDetector(t *testing.T) {
+	ctx := context.Background()
+	var calls int
+	v := New(WithDetector(detectorFunc(func(ctx context.Context, buf []byte) ([]Region, error) {
+		calls++
+		assert.Equal(t, imagor.BlobTypeJPEG, imagor.NewBlobFromBytes(buf).BlobType())
+		return []Region{{Left: 10, Top: 10, Right: 60, Bottom: 60}}, nil
+	})))
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	blob, err := v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "gopher.png")),
+		imagorpath.Parse("100x100/smart/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 100, blob.Meta.Width)
+	assert.Equal(t, 100, blob.Meta.Height)
+
+	_, err = v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "gopher.png")),
+		imagorpath.Parse("100x100/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "detect on smart crop only")
+}
+
+func TestHTTPDetector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "image/jpeg", r.Header.Get("Content-Type"))
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"left":10,"top":20,"right":110,"bottom":140}]`))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	regions, err := (&HTTPDetector{URL: ts.URL + "/faces"}).Detect(ctx, []byte("foo"))
+	require.NoError(t, err)
+	assert.Equal(t, []Region{{Left: 10, Top: 20, Right: 110, Bottom: 140}}, regions)
+
+	_, err = (&HTTPDetector{URL: ts.URL + "/fail"}).Detect(ctx, []byte("foo"))
+	assert.Error(t, err)
+}
+
+type upscalerFunc func(ctx context.Context, buf []byte, scale int) ([]byte, error)
+
+func (f upscalerFunc) Upscale(ctx context.Context, buf []byte, scale int) ([]byte, error) {
+	return f(ctx, buf, scale)
+}
+
+func TestUpscaler(t *testing.T) {
+	ctx := context.Background()
+	var scales []int
+	v := New(WithUpscaler(upscalerFunc(func(ctx context.Context, buf []byte, scale int) ([]byte, error) {
+		scales = append(scales, scale)
+		assert.Equal(t, imagor.BlobTypePNG, imagor.NewBlobFromBytes(buf).BlobType())
+		img, err := vips.NewImageFromBuffer(buf)
+		require.NoError(t, err)
+		defer img.Close()
+		require.NoError(t, img.Resize(float64(scale), vips.KernelNearest))
+		out, _, err := img.ExportPng(vips.NewPngExportParams())
+		return out, err
+	})))
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	tests := []struct {
+		path   string
+		width  int
+		height int
+		scales []int
+	}{
+		{path: "fit-in/500x500/gopher-front.png", width: 202, height: 259},
+		{path: "fit-in/1000x1000/filters:upscale()/gopher-front.png", width: 780, height: 1000, scales: []int{4}},
+		{path: "400x400/gopher-front.png", width: 400, height: 400},
+		{path: "600x600/gopher-front.png", width: 600, height: 600, scales: []int{3}},
+		{path: "100x100/gopher-front.png", width: 100, height: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			scales = nil
+			blob, err := v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "gopher-front.png")),
+				imagorpath.Parse(tt.path), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.scales, scales)
+			assert.Equal(t, tt.width, blob.Meta.Width)
+			assert.Equal(t, tt.height, blob.Meta.Height)
+		})
+	}
+}
+
+func TestImageSize(t *testing.T) {
+	tests := []struct {
+		file   string
+		width  int
+		height int
+		ok     bool
+	}{
+		{file: "gopher-front.png", width: 202, height: 259, ok: true},
+		{file: "demo3.webp", ok: true},
+		{file: "dancing-banana.gif", ok: true},
+		{file: "gopher-front.avif"},
+		{file: "sample.svg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			w, h, ok := imageSize(imagor.NewBlobFromPath(filepath.Join(testDataDir, tt.file)))
+			assert.Equal(t, tt.ok, ok)
+			if tt.width > 0 {
+				assert.Equal(t, tt.width, w)
+				assert.Equal(t, tt.height, h)
+			} else if ok {
+				assert.True(t, w > 0 && h > 0)
+			}
+		})
+	}
+}
+
+func TestEnlargement(t *testing.T) {
+	assert.Equal(t, 0.0, enlargement(100, 200, 50, 100, true, false, true))
+	assert.Equal(t, 2.0, enlargement(100, 200, 400, 400, true, false, true))
+	assert.Equal(t, 0.0, enlargement(100, 200, 400, 400, true, false, false))
+	assert.Equal(t, 4.0, enlargement(100, 200, 400, 100, false, false, false))
+	assert.Equal(t, 0.0, enlargement(100, 200, 400, 400, false, false, false))
+	assert.Equal(t, 4.0, enlargement(100, 200, 400, 400, false, true, true))
+	assert.Equal(t, 0.0, enlargement(100, 200, 400, 400, false, true, false))
+	assert.Equal(t, 3.0, enlargement(100, 200, 300, 0, false, false, true))
+	assert.Equal(t, 3.0, enlargement(100, 200, 0, 600, false, false, true))
+	assert.Equal(t, 0.0, enlargement(0, 0, 300, 300, false, false, true))
+}
+
+func TestHTTPUpscaler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "image/png", r.Header.Get("Content-Type"))
+		assert.Equal(t, "4", r.URL.Query().Get("scale"))
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("bar"))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	buf, err := (&HTTPUpscaler{URL: ts.URL + "/upscale?model=x4"}).Upscale(ctx, []byte("foo"), 4)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), buf)
+
+	_, err = (&HTTPUpscaler{URL: ts.URL + "/fail"}).Upscale(ctx, []byte("foo"), 4)
+	assert.Error(t, err)
+}
+
+type segmenterFunc func(ctx context.Context, buf []byte) ([]byte, error)
+
+func (f segmenterFunc) Segment(ctx context.Context, buf []byte) ([]byte, error) {
+	return f(ctx, buf)
+}
+
+func TestSegmenter(t *testing.T) {
+	ctx := context.Background()
+	// left half foreground
+	m := image.NewGray(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 5; x++ {
+			m.Pix[y*m.Stride+x] = 255
+		}
+	}
+	var mask bytes.Buffer
+	require.NoError(t, png.Encode(&mask, m))
+	v := New(WithSegmenter(segmenterFunc(func(ctx context.Context, buf []byte) ([]byte, error) {
+		assert.Equal(t, imagor.BlobTypePNG, imagor.NewBlobFromBytes(buf).BlobType())
+		return mask.Bytes(), nil
+	})))
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	blob, err := v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "demo1.jpg")),
+		imagorpath.Parse("100x100/filters:remove_bg()/demo1.jpg"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, imagor.BlobTypePNG, blob.BlobType())
+	buf, err := blob.ReadAll()
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(buf))
+	require.NoError(t, err)
+	_, _, _, a := img.At(10, 50).RGBA()
+	assert.Equal(t, uint32(0xffff), a)
+	_, _, _, a = img.At(90, 50).RGBA()
+	assert.Equal(t, uint32(0), a)
+
+	v = New(WithSegmenter(segmenterFunc(func(ctx context.Context, buf []byte) ([]byte, error) {
+		return nil, errors.New("unavailable")
+	})))
+	_, err = v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "demo1.jpg")),
+		imagorpath.Parse("100x100/filters:remove_bg()/demo1.jpg"), nil)
+	assert.Equal(t, http.StatusBadGateway, imagor.WrapError(err).Code)
+}
+
+func TestHTTPSegmenter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "image/png", r.Header.Get("Content-Type"))
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("mask"))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	buf, err := (&HTTPSegmenter{URL: ts.URL + "/remove"}).Segment(ctx, []byte("foo"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("mask"), buf)
+
+	_, err = (&HTTPSegmenter{URL: ts.URL + "/fail"}).Segment(ctx, []byte("foo"))
+	assert.Error(t, err)
+}
+
+func TestBlurHash(t *testing.T) {
+	x, y := blurHashComponents("")
+	assert.Equal(t, []int{4, 3}, []int{x, y})
+	x, y = blurHashComponents("5")
+	assert.Equal(t, []int{5, 5}, []int{x, y})
+	x, y = blurHashComponents("5,2")
+	assert.Equal(t, []int{5, 2}, []int{x, y})
+	x, y = blurHashComponents("0,20")
+	assert.Equal(t, []int{4, 3}, []int{x, y})
+
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	for path, ln := range map[string]int{
+		"meta/100x100/filters:blurhash()/gopher.png":         28,
+		"meta/fit-in/100x100/filters:blurhash(3)/gopher.png": 22,
+		"meta/100x100/filters:blurhash()/dancing-banana.gif": 28,
+		"meta/100x100/gopher.png":                            0,
+	} {
+		p := imagorpath.Parse(path)
+		blob, err := v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, p.Image)), p, nil)
+		require.NoError(t, err)
+		assert.Len(t, blob.Meta.BlurHash, ln, path)
+	}
+}
+
+func TestThumbHash(t *testing.T) {
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	for path, ok := range map[string]bool{
+		"meta/100x100/filters:thumbhash()/gopher.png":         true,
+		"meta/fit-in/300x200/filters:thumbhash()/gopher.png":  true,
+		"meta/100x100/filters:thumbhash()/dancing-banana.gif": true,
+		"meta/100x100/gopher.png":                             false,
+	} {
+		p := imagorpath.Parse(path)
+		blob, err := v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, p.Image)), p, nil)
+		require.NoError(t, err)
+		if !ok {
+			assert.Empty(t, blob.Meta.ThumbHash, path)
+			continue
+		}
+		hash, err := base64.StdEncoding.DecodeString(blob.Meta.ThumbHash)
+		require.NoError(t, err, path)
+		assert.GreaterOrEqual(t, len(hash), 5, path)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	var buf bytes.Buffer
+	red := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(red, red.Rect, image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	require.NoError(t, png.Encode(&buf, red))
+	blob, err := v.Process(ctx, imagor.NewBlobFromBytes(buf.Bytes()),
+		imagorpath.Parse("meta/filters:palette()/red.png"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#ff0000", blob.Meta.DominantColor)
+	assert.Equal(t, []string{"#ff0000"}, blob.Meta.Palette)
+
+	blob, err = v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "gopher.png")),
+		imagorpath.Parse("meta/100x100/filters:palette(3)/gopher.png"), nil)
+	require.NoError(t, err)
+	assert.Len(t, blob.Meta.Palette, 3)
+	assert.Equal(t, blob.Meta.Palette[0], blob.Meta.DominantColor)
+}
+
+func TestCollageColumns(t *testing.T) {
+	assert.Equal(t, 3, collageColumns("horizontal", 3))
+	assert.Equal(t, 1, collageColumns("v", 3))
+	assert.Equal(t, 2, collageColumns("grid", 4))
+	assert.Equal(t, 3, collageColumns("grid", 5))
+	assert.Equal(t, 2, collageColumns("2", 5))
+	assert.Equal(t, 3, collageColumns("5", 3))
+}
+
+func TestParseSharpen(t *testing.T) {
+	tests := []struct {
+		args                []string
+		sigma, flat, jagged float64
+	}{
+		{args: []string{"2"}, sigma: 5, flat: 1, jagged: 2},
+		{args: []string{"2", "0.5"}, sigma: 5, flat: 0.5, jagged: 2},
+		{args: []string{"2", "0.5", "4"}, sigma: 5, flat: 0.5, jagged: 4},
+		{args: []string{"1", "2", "true"}, sigma: 5, flat: 1, jagged: 2},
+		{args: []string{"1", "2", "false"}, sigma: 5, flat: 1, jagged: 2},
+		{args: []string{"2", "abc", "-1"}, sigma: 5, flat: 1, jagged: 2},
+	}
+	for _, tt := range tests {
+		sigma, flat, jagged := parseSharpen(tt.args...)
+		assert.Equal(t, tt.sigma, sigma, tt.args)
+		assert.Equal(t, tt.flat, flat, tt.args)
+		assert.Equal(t, tt.jagged, jagged, tt.args)
+	}
+}
+
+func TestCollage(t *testing.T) {
+	ctx := context.Background()
+	v := New()
+	require.NoError(t, v.Startup(ctx))
+	t.Cleanup(func() {
+		assert.NoError(t, v.Shutdown(ctx))
+	})
+	load := func(image string) (*imagor.Blob, error) {
+		return imagor.NewBlobFromPath(filepath.Join(testDataDir, image)), nil
+	}
+	for _, tt := range []struct {
+		path string
+		w, h int
+	}{
+		{"300x100/filters:collage(horizontal,10,white,gopher.png,demo1.jpg):format(png)/gopher-front.png", 300, 100},
+		{"200x200/filters:collage(grid,0,red,gopher.png,demo1.jpg,gopher-front.png):format(png)/demo1.jpg", 200, 200},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			blob, err := v.Process(ctx,
+				imagor.NewBlobFromPath(filepath.Join(testDataDir, path.Base(tt.path))),
+				imagorpath.Parse(tt.path), load)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			img, err := png.Decode(bytes.NewReader(buf))
+			require.NoError(t, err)
+			assert.Equal(t, tt.w, img.Bounds().Dx())
+			assert.Equal(t, tt.h, img.Bounds().Dy())
+		})
+	}
+
+	_, err := v.Process(ctx, imagor.NewBlobFromPath(filepath.Join(testDataDir, "demo1.jpg")),
+		imagorpath.Parse("200x100/filters:collage(h,0,white,missing.jpg)/demo1.jpg"),
+		func(image string) (*imagor.Blob, error) {
+			return nil, imagor.ErrNotFound
+		})
+	assert.Equal(t, imagor.ErrNotFound, err)
+}
+
+func TestRenderLabel(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	require.NoError(t, err)
+	img, err := renderLabel("foo\nfoo bar", f, 32, color.NRGBA{R: 255, A: 255}, nil, imagorpath.HAlignRight, 9999, 9999)
+	require.NoError(t, err)
+	b := img.Bounds()
+	assert.Greater(t, b.Dx(), 0)
+	assert.Greater(t, b.Dy(), 32)
+	var painted int
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] > 0 {
+			painted++
+		}
+	}
+	assert.Greater(t, painted, 0)
+
+	shadowed, err := renderLabel("foo", f, 32, color.NRGBA{A: 255}, &color.NRGBA{R: 255, A: 255}, "", 9999, 9999)
+	require.NoError(t, err)
+	plain, err := renderLabel("foo", f, 32, color.NRGBA{A: 255}, nil, "", 9999, 9999)
+	require.NoError(t, err)
+	assert.Equal(t, plain.Bounds().Dx()+2, shadowed.Bounds().Dx())
+
+	img, err = renderLabel(strings.Repeat("foo", 100), f, 32, color.NRGBA{A: 255}, nil, "", 100, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 100, img.Bounds().Dx())
+}
+
+func TestLoadFont(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.ttf"), goregular.TTF, 0644))
+	v := New(WithFontDir(dir))
+	load := func(image string) (*imagor.Blob, error) {
+		if image == "fonts/go.ttf" {
+			return imagor.NewBlobFromBytes(goregular.TTF), nil
+		}
+		if image == "fonts/bad.ttf" {
+			return imagor.NewBlobFromBytes([]byte("foo")), nil
+		}
+		return nil, imagor.ErrNotFound
+	}
+	for _, name := range []string{"", "go", "go.ttf", "../" + filepath.Base(dir) + "/go.ttf", "fonts/go.ttf"} {
+		_, err := v.loadFont(name, load)
+		assert.NoError(t, err, name)
+	}
+	_, err := v.loadFont("missing.ttf", load)
+	assert.Equal(t, imagor.ErrNotFound, err)
+	_, err = v.loadFont("fonts/bad.ttf", load)
+	assert.Error(t, err)
+}
+
+func TestAutoQuality(t *testing.T) {
+	assert.Equal(t, 80, autoQuality(vips.ImageTypeJPEG, 1000, 1000, false, ""))
+	assert.Equal(t, 55, autoQuality(vips.ImageTypeAVIF, 1000, 1000, false, ""))
+	assert.Equal(t, 70, autoQuality(vips.ImageTypeJPEG, 3000, 2000, false, ""))
+	assert.Equal(t, 90, autoQuality(vips.ImageTypeJPEG, 200, 200, true, ""))
+	assert.Equal(t, 60, autoQuality(vips.ImageTypeJPEG, 1000, 1000, false, "save-data"))
+	assert.Equal(t, 30, autoQuality(vips.ImageTypeAVIF, 3000, 2000, false, "2g"))
+}
+
+func TestDSSIM(t *testing.T) {
+	a := make([]byte, 20*10)
+	for i := range a {
+		a[i] = byte(i * 7 % 256)
+	}
+	assert.Equal(t, 0.0, dssim(a, a, 20))
+	b := make([]byte, len(a))
+	copy(b, a)
+	b[0], b[55] = b[0]+8, b[55]+8
+	c := make([]byte, len(a))
+	for i := range c {
+		c[i] = 128
+	}
+	assert.Greater(t, dssim(a, b, 20), 0.0)
+	assert.Greater(t, dssim(a, c, 20), dssim(a, b, 20))
+	assert.Equal(t, 1.0, dssim(a, c[:10], 20))
+	assert.Equal(t, 1.0, dssim(nil, nil, 0))
+}
+
 func doGoldenTests(t *testing.T, resultDir string, tests []test, opts ...Option) {
 	resStorage := filestorage.New(
 		resultDir,
@@ -297,3 +1001,36 @@ func pixelCompare(img1, img2 image.Image) (accuErr int64) {
 	}
 	return
 }
+
+func TestIsRawImage(t *testing.T) {
+	assert.True(t, isRawImage("photos/IMG_0001.CR2", nil))
+	assert.True(t, isRawImage("photos/DSC_0001.nef", nil))
+	assert.True(t, isRawImage("photos/DSC_0001.dng", nil))
+	assert.False(t, isRawImage("gopher.tiff", imagor.NewBlobFromPath("../../testdata/gopher.tiff")))
+	assert.True(t, isRawImage("raw", imagor.NewBlobFromBytes(
+		append(cr2Header, make([]byte, 32)...))))
+}
+
+func TestFitDPI(t *testing.T) {
+	assert.Equal(t, 300, fitDPI(100, 100, 300, 9999, 9999, 16800000))
+	assert.Equal(t, 720, fitDPI(1000, 500, 1200, 10000, 9999, 1000000000))
+	assert.Equal(t, 72, fitDPI(1000, 1000, 300, 9999, 9999, 1000000))
+	assert.Equal(t, 1, fitDPI(10000000, 10000000, 300, 9999, 9999, 16800000))
+	assert.Equal(t, 300, fitDPI(0, 0, 300, 9999, 9999, 16800000))
+}
+
+func TestRunJxl(t *testing.T) {
+	dir := t.TempDir()
+	copyBin := filepath.Join(dir, "copy")
+	require.NoError(t, os.WriteFile(copyBin, []byte("#!/bin/sh\ncp \"$1\" \"$2\"\n"), 0755))
+	failBin := filepath.Join(dir, "fail")
+	require.NoError(t, os.WriteFile(failBin, []byte("#!/bin/sh\necho bad input >&2\nexit 1\n"), 0755))
+
+	ctx := context.Background()
+	buf, err := runJxl(ctx, copyBin, []byte("foo"), ".png", ".jxl", "-q", "80")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	_, err = runJxl(ctx, failBin, []byte("foo"), ".jxl", ".png")
+	assert.Equal(t, imagor.NewError("jxl: bad input", http.StatusUnprocessableEntity), err)
+}
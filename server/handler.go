@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
@@ -19,6 +20,25 @@ func handleOk(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// healthChecker optional Service interface reporting health of its dependencies
+type healthChecker interface {
+	Health(ctx context.Context) error
+}
+
+func (s *Server) handleHealth(checker healthChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := checker.Health(r.Context()); err != nil {
+			s.Logger.Warn("health", zap.Error(err))
+			writeJSON(w, r, http.StatusServiceUnavailable, errResp{
+				Message: err.Error(),
+				Code:    http.StatusServiceUnavailable,
+			})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func (s *Server) panicHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -28,8 +48,7 @@ func (s *Server) panicHandler(next http.Handler) http.Handler {
 					err = fmt.Errorf("%v", rvr)
 				}
 				s.Logger.Error("panic", zap.Error(err))
-				w.WriteHeader(http.StatusInternalServerError)
-				writeJSON(w, r, errResp{
+				writeJSON(w, r, http.StatusInternalServerError, errResp{
 					Message: err.Error(),
 					Code:    http.StatusInternalServerError,
 				})
@@ -69,10 +88,27 @@ func stripQueryStringHandler(next http.Handler) http.Handler {
 	})
 }
 
-func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+// securityHeadersHandler sets hardening headers for image and JSON responses.
+// Content-Security-Policy prevents script execution for passthrough SVG opened as document
+func (s *Server) securityHeadersHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if s.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", s.ContentSecurityPolicy)
+		}
+		if s.CrossOriginResourcePolicy != "" {
+			h.Set("Cross-Origin-Resource-Policy", s.CrossOriginResourcePolicy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
 	buf, _ := json.Marshal(v)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(code)
 	if r.Method != http.MethodHead {
 		_, _ = w.Write(buf)
 	}
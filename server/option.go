@@ -94,3 +94,39 @@ func WithAccessLog(enabled bool) Option {
 		}
 	}
 }
+
+// WithHealthCheck enables /healthcheck to report unreachable loaders and storages with 503,
+// if the Service implements Health(ctx) error
+func WithHealthCheck(enabled bool) Option {
+	return func(s *Server) {
+		if checker, ok := s.App.(healthChecker); ok && enabled {
+			s.Handler = pathHandler(http.MethodGet, map[string]http.HandlerFunc{
+				"/healthcheck": s.handleHealth(checker),
+			})(s.Handler)
+		}
+	}
+}
+
+func WithSecurityHeaders(enabled bool) Option {
+	return func(s *Server) {
+		if enabled {
+			s.Handler = s.securityHeadersHandler(s.Handler)
+		}
+	}
+}
+
+func WithContentSecurityPolicy(csp string) Option {
+	return func(s *Server) {
+		if csp != "" {
+			s.ContentSecurityPolicy = csp
+		}
+	}
+}
+
+func WithCrossOriginResourcePolicy(corp string) Option {
+	return func(s *Server) {
+		if corp != "" {
+			s.CrossOriginResourcePolicy = corp
+		}
+	}
+}
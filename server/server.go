@@ -24,16 +24,18 @@ type Service interface {
 // Server wraps the Service with additional http and app lifecycle handling
 type Server struct {
 	http.Server
-	App             Service
-	Address         string
-	Port            int
-	CertFile        string
-	KeyFile         string
-	PathPrefix      string
-	StartupTimeout  time.Duration
-	ShutdownTimeout time.Duration
-	Logger          *zap.Logger
-	Debug           bool
+	App                       Service
+	Address                   string
+	Port                      int
+	CertFile                  string
+	KeyFile                   string
+	PathPrefix                string
+	StartupTimeout            time.Duration
+	ShutdownTimeout           time.Duration
+	ContentSecurityPolicy     string
+	CrossOriginResourcePolicy string
+	Logger                    *zap.Logger
+	Debug                     bool
 }
 
 // New create new Server
@@ -45,9 +47,10 @@ func New(app Service, options ...Option) *Server {
 	s.StartupTimeout = time.Second * 10
 	s.ShutdownTimeout = time.Second * 10
 	s.Logger = zap.NewNop()
+	s.ContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
+	s.CrossOriginResourcePolicy = "cross-origin"
 
 	s.Handler = pathHandler(http.MethodGet, map[string]http.HandlerFunc{
-		"/favicon.ico": handleOk,
 		"/healthcheck": handleOk,
 	})(s.App)
 
@@ -110,6 +110,22 @@ func TestServer(t *testing.T) {
 	assert.Equal(t, `{"message":"booooom","status":500}`, w.Body.String())
 }
 
+func TestServerFavicon(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00icon")
+	s := New(imagor.New(imagor.WithFavicon(icon)), WithPathPrefix("/imagor"))
+
+	w := httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/imagor/favicon.ico", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "image/x-icon", w.Header().Get("Content-Type"))
+	assert.Equal(t, icon, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "https://example.com/imagor/favicon.ico", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
 func TestWithStripQueryString(t *testing.T) {
 	s := New(imagor.New(),
 		WithAddr("https://example.com:1667"), WithPort(1234))
@@ -151,3 +167,56 @@ func TestWithPathPrefix(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	fmt.Println(w.Body.String())
 }
+
+func TestWithSecurityHeaders(t *testing.T) {
+	s := New(imagor.New())
+	w := httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	assert.Empty(t, w.Header().Get("X-Content-Type-Options"))
+
+	s = New(imagor.New(), WithSecurityHeaders(true))
+	w = httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "default-src 'none'; style-src 'unsafe-inline'; sandbox", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "cross-origin", w.Header().Get("Cross-Origin-Resource-Policy"))
+
+	s = New(imagor.New(),
+		WithSecurityHeaders(true),
+		WithContentSecurityPolicy("default-src 'none'"),
+		WithCrossOriginResourcePolicy("same-site"))
+	w = httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo", nil))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "default-src 'none'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "same-site", w.Header().Get("Cross-Origin-Resource-Policy"))
+}
+
+type healthLoader struct {
+	loaderFunc
+	err error
+}
+
+func (l *healthLoader) Health(ctx context.Context) error {
+	return l.err
+}
+
+func TestServerHealthCheck(t *testing.T) {
+	loader := &healthLoader{}
+	app := imagor.New(imagor.WithLoaders(loader))
+
+	w := httptest.NewRecorder()
+	New(app, WithHealthCheck(true)).Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/healthcheck", nil))
+	assert.Equal(t, 200, w.Code)
+
+	loader.err = fmt.Errorf("unreachable")
+	w = httptest.NewRecorder()
+	New(app, WithHealthCheck(false)).Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/healthcheck", nil))
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	New(app, WithHealthCheck(true)).Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/healthcheck", nil))
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, `{"message":"loader healthLoader: unreachable","status":503}`, w.Body.String())
+}
@@ -0,0 +1,341 @@
+package b2storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// B2Storage Backblaze B2 storage using B2 native API with application key auth.
+// File names are laid out as <base dir>/<image key> without leading slash,
+// such that bucket lifecycle rules can target the base dir as file name prefix
+type B2Storage struct {
+	Bucket     string
+	BaseDir    string
+	PathPrefix string
+	SafeChars  string
+	Expiration time.Duration
+
+	// HardDelete deletes all file versions on Delete.
+	// By default files are hidden, to be cleaned up by lifecycle rules
+	HardDelete bool
+
+	client    *client
+	safeChars imagorpath.SafeChars
+}
+
+const metaInfo = "imagor-meta"
+
+// maxMetaSize B2 limits total size of file info headers to 7000 bytes
+const maxMetaSize = 6000
+
+// New creates B2 storage of bucket, which may contain base dir e.g. mybucket/results
+func New(keyID, applicationKey, bucket string, options ...Option) *B2Storage {
+	baseDir := "/"
+	if idx := strings.Index(bucket, "/"); idx > -1 {
+		baseDir = bucket[idx:]
+		bucket = bucket[:idx]
+	}
+	s := &B2Storage{
+		Bucket:     bucket,
+		BaseDir:    baseDir,
+		PathPrefix: "/",
+		client: &client{
+			keyID:   keyID,
+			appKey:  applicationKey,
+			bucket:  bucket,
+			authURL: DefaultAuthURL,
+			http:    http.DefaultClient,
+		},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.safeChars = imagorpath.NewSafeChars(s.SafeChars)
+	return s
+}
+
+// Path returns B2 file name of image
+func (s *B2Storage) Path(image string) (string, bool) {
+	image = "/" + imagorpath.Normalize(image, s.safeChars)
+	if !strings.HasPrefix(image, s.PathPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(path.Join("/", s.BaseDir, strings.TrimPrefix(image, s.PathPrefix)), "/"), true
+}
+
+func (s *B2Storage) newDownloadRequest(ctx context.Context, auth *authorization, method, name string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method,
+		auth.DownloadURL+"/file/"+url.PathEscape(s.Bucket)+"/"+encodeName(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", auth.AuthorizationToken)
+	return req, nil
+}
+
+func (s *B2Storage) download(ctx context.Context, method, name string) (resp *http.Response, err error) {
+	err = s.client.do(ctx, func(auth *authorization) error {
+		req, err := s.newDownloadRequest(ctx, auth, method, name)
+		if err != nil {
+			return err
+		}
+		resp, err = s.client.send(req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodHead {
+		_ = resp.Body.Close()
+	}
+	if s.Expiration > 0 && time.Now().Sub(uploadTime(resp.Header)) > s.Expiration {
+		_ = resp.Body.Close()
+		return nil, imagor.ErrExpired
+	}
+	return resp, nil
+}
+
+func (s *B2Storage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	name, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	ctx := r.Context()
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		resp, err := s.download(ctx, http.MethodGet, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		return resp.Body, resp.ContentLength, nil
+	}), nil
+}
+
+func (s *B2Storage) Put(ctx context.Context, image string, blob *imagor.Blob) error {
+	name, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	// B2 uploads require content length and SHA1 upfront
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return err
+	}
+	sum := sha1.Sum(buf)
+	header := http.Header{}
+	header.Set("X-Bz-File-Name", encodeName(name))
+	header.Set("Content-Type", blob.ContentType())
+	header.Set("X-Bz-Content-Sha1", hex.EncodeToString(sum[:]))
+	if blob.Meta != nil {
+		if meta, _ := json.Marshal(blob.Meta); len(meta) > 0 && len(meta) <= maxMetaSize {
+			header.Set("X-Bz-Info-"+metaInfo, url.PathEscape(string(meta)))
+		}
+	}
+	return s.client.do(ctx, func(auth *authorization) (err error) {
+		// upload URL may be busy or expired, retry once with a new one
+		for i := 0; i < 2; i++ {
+			if err = s.upload(ctx, auth, header, buf); err == nil || isUnauthorized(err) {
+				return
+			}
+		}
+		return
+	})
+}
+
+func (s *B2Storage) upload(ctx context.Context, auth *authorization, header http.Header, buf []byte) error {
+	u, err := s.client.getUploadURL(ctx, auth)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.UploadURL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Authorization", u.AuthorizationToken)
+	req.ContentLength = int64(len(buf))
+	if err := s.client.decode(req, nil); err != nil {
+		return err
+	}
+	s.client.putUploadURL(auth, u)
+	return nil
+}
+
+func (s *B2Storage) Delete(ctx context.Context, image string) error {
+	name, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	if !s.HardDelete {
+		return s.client.do(ctx, func(auth *authorization) error {
+			return s.client.post(ctx, auth, "b2_hide_file", map[string]string{
+				"bucketId": auth.bucketID,
+				"fileName": name,
+			}, nil)
+		})
+	}
+	for {
+		var res struct {
+			Files []struct {
+				FileID   string `json:"fileId"`
+				FileName string `json:"fileName"`
+			} `json:"files"`
+		}
+		if err := s.client.do(ctx, func(auth *authorization) error {
+			return s.client.post(ctx, auth, "b2_list_file_versions", map[string]interface{}{
+				"bucketId":      auth.bucketID,
+				"startFileName": name,
+				"prefix":        name,
+				"maxFileCount":  100,
+			}, &res)
+		}); err != nil {
+			return err
+		}
+		var deleted int
+		for _, f := range res.Files {
+			if f.FileName != name {
+				continue
+			}
+			if err := s.client.call(ctx, "b2_delete_file_version", map[string]string{
+				"fileName": f.FileName,
+				"fileId":   f.FileID,
+			}, nil); err != nil {
+				return err
+			}
+			deleted++
+		}
+		if deleted == 0 {
+			return nil
+		}
+	}
+}
+
+// Expired reports whether object of stat is older than expiration
+func (s *B2Storage) Expired(stat *imagor.Stat) bool {
+	return s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration
+}
+
+// Health checks if bucket is accessible by listing at most one file
+func (s *B2Storage) Health(ctx context.Context) error {
+	return s.client.do(ctx, func(auth *authorization) error {
+		return s.client.post(ctx, auth, "b2_list_file_names", map[string]interface{}{
+			"bucketId":     auth.bucketID,
+			"maxFileCount": 1,
+		}, nil)
+	})
+}
+
+func (s *B2Storage) Stat(ctx context.Context, image string) (*imagor.Stat, error) {
+	name, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	resp, err := s.download(ctx, http.MethodHead, name)
+	if err != nil {
+		return nil, err
+	}
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return &imagor.Stat{
+		Size:         size,
+		ModifiedTime: uploadTime(resp.Header),
+		ETag:         resp.Header.Get("X-Bz-Content-Sha1"),
+	}, nil
+}
+
+func (s *B2Storage) Meta(ctx context.Context, image string) (*imagor.Meta, error) {
+	name, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	resp, err := s.download(ctx, http.MethodHead, name)
+	if err != nil {
+		return nil, err
+	}
+	v := resp.Header.Get("X-Bz-Info-" + metaInfo)
+	if v == "" {
+		return nil, imagor.ErrNotFound
+	}
+	if v, err = url.PathUnescape(v); err != nil {
+		return nil, err
+	}
+	meta := &imagor.Meta{}
+	if err := json.Unmarshal([]byte(v), meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (s *B2Storage) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	full, ok := s.Path(prefix)
+	if dir := "/" + strings.Trim(prefix, "/"); strings.HasPrefix(s.PathPrefix, strings.TrimSuffix(dir, "/")+"/") {
+		// prefix covers the whole path prefix
+		full, ok = strings.TrimPrefix(s.BaseDir, "/"), true
+	}
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	baseDir := strings.Trim(s.BaseDir, "/")
+	if baseDir != "" && !strings.HasPrefix(full, baseDir+"/") {
+		full = baseDir + "/"
+	}
+	var start string
+	for {
+		var res struct {
+			Files []struct {
+				FileName string `json:"fileName"`
+				Action   string `json:"action"`
+			} `json:"files"`
+			NextFileName *string `json:"nextFileName"`
+		}
+		if err := s.client.do(ctx, func(auth *authorization) error {
+			body := map[string]interface{}{
+				"bucketId":     auth.bucketID,
+				"prefix":       full,
+				"maxFileCount": 1000,
+			}
+			if start != "" {
+				body["startFileName"] = start
+			}
+			return s.client.post(ctx, auth, "b2_list_file_names", body, &res)
+		}); err != nil {
+			return err
+		}
+		for _, f := range res.Files {
+			if f.Action != "" && f.Action != "upload" {
+				continue
+			}
+			rel := f.FileName
+			if baseDir != "" {
+				rel = strings.TrimPrefix(rel, baseDir+"/")
+			}
+			key, err := url.QueryUnescape(s.PathPrefix + rel)
+			if err != nil {
+				continue
+			}
+			if err := fn(strings.TrimPrefix(key, "/")); err != nil {
+				return err
+			}
+		}
+		if res.NextFileName == nil || *res.NextFileName == "" {
+			return nil
+		}
+		start = *res.NextFileName
+	}
+}
+
+// uploadTime modified time of file from X-Bz-Upload-Timestamp in milliseconds
+func uploadTime(header http.Header) time.Time {
+	ms, _ := strconv.ParseInt(header.Get("X-Bz-Upload-Timestamp"), 10, 64)
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,309 @@
+package b2storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type b2File struct {
+	id      string
+	buf     []byte
+	info    http.Header
+	hidden  bool
+	created time.Time
+}
+
+// b2Handler minimal in-memory B2 native API server
+type b2Handler struct {
+	mu       sync.Mutex
+	url      string
+	token    int
+	files    map[string][]*b2File
+	nextID   int
+	restrict bool
+}
+
+func newB2Handler() *b2Handler {
+	return &b2Handler{files: map[string][]*b2File{}}
+}
+
+func (h *b2Handler) current(name string) *b2File {
+	if versions := h.files[name]; len(versions) > 0 {
+		if f := versions[len(versions)-1]; !f.hidden {
+			return f
+		}
+	}
+	return nil
+}
+
+func (h *b2Handler) expire() {
+	h.mu.Lock()
+	h.token++
+	h.mu.Unlock()
+}
+
+func (h *b2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	token := fmt.Sprintf("token-%d", h.token)
+	if r.URL.Path == "/b2api/v2/b2_authorize_account" {
+		if u, p, _ := r.BasicAuth(); u != "key-id" || p != "app-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		res := map[string]interface{}{
+			"accountId":          "account",
+			"authorizationToken": token,
+			"apiUrl":             h.url,
+			"downloadUrl":        h.url,
+		}
+		if h.restrict {
+			res["allowed"] = map[string]string{"bucketId": "bucket-id", "bucketName": "mybucket"}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+		return
+	}
+	if r.Header.Get("Authorization") != token {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": 401, "code": "expired_auth_token", "message": "Authorization token has expired",
+		})
+		return
+	}
+	var body map[string]interface{}
+	if strings.HasPrefix(r.URL.Path, "/b2api/") {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["bucketId"] != nil && body["bucketId"] != "bucket-id" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	switch r.URL.Path {
+	case "/b2api/v2/b2_list_buckets":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"buckets": []map[string]string{{"bucketId": "bucket-id", "bucketName": body["bucketName"].(string)}},
+		})
+	case "/b2api/v2/b2_get_upload_url":
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"uploadUrl": h.url + "/upload", "authorizationToken": token,
+		})
+	case "/upload":
+		name, _ := url.PathUnescape(r.Header.Get("X-Bz-File-Name"))
+		buf, _ := io.ReadAll(r.Body)
+		sum := sha1.Sum(buf)
+		if r.Header.Get("X-Bz-Content-Sha1") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		h.nextID++
+		h.files[name] = append(h.files[name], &b2File{
+			id: fmt.Sprintf("id-%d", h.nextID), buf: buf, info: r.Header.Clone(), created: time.Now(),
+		})
+		_ = json.NewEncoder(w).Encode(map[string]string{"fileName": name})
+	case "/b2api/v2/b2_hide_file":
+		name := body["fileName"].(string)
+		if h.current(name) == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		h.files[name] = append(h.files[name], &b2File{hidden: true, created: time.Now()})
+		_ = json.NewEncoder(w).Encode(map[string]string{"fileName": name})
+	case "/b2api/v2/b2_list_file_versions":
+		var files []map[string]string
+		for _, f := range h.files[body["prefix"].(string)] {
+			if !f.hidden {
+				files = append(files, map[string]string{"fileName": body["prefix"].(string), "fileId": f.id})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	case "/b2api/v2/b2_delete_file_version":
+		name := body["fileName"].(string)
+		var versions []*b2File
+		for _, f := range h.files[name] {
+			if f.id != body["fileId"] {
+				versions = append(versions, f)
+			}
+		}
+		h.files[name] = versions
+		_ = json.NewEncoder(w).Encode(body)
+	case "/b2api/v2/b2_list_file_names":
+		var names []string
+		for name := range h.files {
+			if h.current(name) != nil && strings.HasPrefix(name, body["prefix"].(string)) {
+				if start, _ := body["startFileName"].(string); name >= start {
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		res := map[string]interface{}{}
+		// paginate by 2 files
+		if len(names) > 2 {
+			res["nextFileName"] = names[2]
+			names = names[:2]
+		}
+		var files []map[string]string
+		for _, name := range names {
+			files = append(files, map[string]string{"fileName": name, "action": "upload"})
+		}
+		res["files"] = files
+		_ = json.NewEncoder(w).Encode(res)
+	default:
+		name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/file/mybucket/"))
+		f := h.current(name)
+		if err != nil || f == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(f.buf)))
+		w.Header().Set("X-Bz-Content-Sha1", f.info.Get("X-Bz-Content-Sha1"))
+		w.Header().Set("X-Bz-Upload-Timestamp", fmt.Sprint(f.created.UnixMilli()))
+		if v := f.info.Get("X-Bz-Info-Imagor-Meta"); v != "" {
+			w.Header().Set("X-Bz-Info-Imagor-Meta", v)
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(f.buf)
+		}
+	}
+}
+
+func newTestServer(t *testing.T) (*b2Handler, *httptest.Server) {
+	h := newB2Handler()
+	ts := httptest.NewServer(h)
+	h.url = ts.URL
+	t.Cleanup(ts.Close)
+	return h, ts
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		bucket     string
+		pathPrefix string
+		image      string
+		expected   string
+		ok         bool
+	}{
+		{name: "no base dir", bucket: "mybucket", image: "foo/bar.jpg", expected: "foo/bar.jpg", ok: true},
+		{name: "base dir", bucket: "mybucket/results", image: "/foo/bar.jpg", expected: "results/foo/bar.jpg", ok: true},
+		{name: "path prefix", bucket: "mybucket/results", pathPrefix: "foo", image: "foo/bar.jpg", expected: "results/bar.jpg", ok: true},
+		{name: "path prefix mismatch", bucket: "mybucket", pathPrefix: "foo", image: "bar/bar.jpg"},
+		{name: "escape", bucket: "mybucket", image: "fit-in/100x100/foo bar.jpg", expected: "fit-in/100x100/foo+bar.jpg", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("key-id", "app-key", tt.bucket, WithPathPrefix(tt.pathPrefix))
+			res, ok := s.Path(tt.image)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, res)
+		})
+	}
+	assert.Equal(t, "a%2Bb/c%20d", encodeName("a+b/c d"))
+}
+
+func TestB2Storage(t *testing.T) {
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h, ts := newTestServer(t)
+	s := New("key-id", "app-key", "mybucket/results", WithAuthURL(ts.URL))
+
+	_, err := s.Stat(ctx, "foo.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	b, err := s.Get(r, "foo.jpg")
+	require.NoError(t, err)
+	_, err = b.ReadAll()
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	blob := imagor.NewBlobFromBytes([]byte("bar"))
+	blob.Meta = &imagor.Meta{Format: "png", Width: 10, Height: 20}
+	require.NoError(t, s.Put(ctx, "fit-in/foo+bar.jpg", blob))
+	name, _ := s.Path("fit-in/foo+bar.jpg")
+	assert.Equal(t, "results/fit-in/foo%2Bbar.jpg", name)
+	assert.NotNil(t, h.current(name))
+
+	b, err = s.Get(r, "fit-in/foo+bar.jpg")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	stat, err := s.Stat(ctx, "fit-in/foo+bar.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stat.Size)
+	assert.Equal(t, "62cdb7020ff920e5aa642c3d4066950dd1f01f4d", stat.ETag)
+	assert.WithinDuration(t, time.Now(), stat.ModifiedTime, time.Minute)
+
+	meta, err := s.Meta(ctx, "fit-in/foo+bar.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, blob.Meta, meta)
+
+	// expired token re-authorized transparently
+	h.expire()
+	require.NoError(t, s.Put(ctx, "a/b.jpg", imagor.NewBlobFromBytes([]byte("ab"))))
+	require.NoError(t, s.Put(ctx, "a/c.jpg", imagor.NewBlobFromBytes([]byte("ac"))))
+	require.NoError(t, s.Put(ctx, "a/d.jpg", imagor.NewBlobFromBytes([]byte("ad"))))
+	h.expire()
+	stat, err = s.Stat(ctx, "a/b.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stat.Size)
+
+	var keys []string
+	require.NoError(t, s.List(ctx, "a", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"a/b.jpg", "a/c.jpg", "a/d.jpg"}, keys)
+
+	// hidden by default, versions kept for lifecycle rules
+	require.NoError(t, s.Delete(ctx, "a/b.jpg"))
+	_, err = s.Stat(ctx, "a/b.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	assert.Equal(t, 2, len(h.files["results/a/b.jpg"]))
+
+	s.HardDelete = true
+	require.NoError(t, s.Put(ctx, "a/c.jpg", imagor.NewBlobFromBytes([]byte("ac2"))))
+	assert.Equal(t, 2, len(h.files["results/a/c.jpg"]))
+	require.NoError(t, s.Delete(ctx, "a/c.jpg"))
+	assert.Equal(t, 0, len(h.files["results/a/c.jpg"]))
+}
+
+func TestB2StorageRestrictedKey(t *testing.T) {
+	ctx := context.Background()
+	h, ts := newTestServer(t)
+	h.restrict = true
+	s := New("key-id", "app-key", "mybucket",
+		WithAuthURL(ts.URL), WithPathPrefix("foo"), WithExpiration(time.Millisecond*50))
+	require.NoError(t, s.Put(ctx, "foo/bar.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	assert.NotNil(t, h.current("bar.jpg"))
+	_, err := s.Stat(ctx, "foo/bar.jpg")
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	_, err = s.Get(httptest.NewRequest(http.MethodGet, "/", nil), "foo/bar.jpg")
+	require.NoError(t, err)
+	_, err = s.Meta(ctx, "foo/bar.jpg")
+	assert.Equal(t, imagor.ErrExpired, err)
+	b, _ := s.Get(httptest.NewRequest(http.MethodGet, "/", nil), "foo/bar.jpg")
+	_, err = b.ReadAll()
+	assert.Equal(t, imagor.ErrExpired, err)
+
+	assert.Equal(t, imagor.ErrInvalid, s.Put(ctx, "bar.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	s = New("wrong", "app-key", "mybucket", WithAuthURL(ts.URL))
+	_, err = s.Stat(ctx, "foo/bar.jpg")
+	assert.True(t, isUnauthorized(err))
+}
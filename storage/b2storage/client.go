@@ -0,0 +1,232 @@
+package b2storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cshum/imagor"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultAuthURL B2 native API authorization endpoint
+const DefaultAuthURL = "https://api.backblazeb2.com"
+
+type authorization struct {
+	AccountID          string `json:"accountId"`
+	AuthorizationToken string `json:"authorizationToken"`
+	APIURL             string `json:"apiUrl"`
+	DownloadURL        string `json:"downloadUrl"`
+	Allowed            struct {
+		BucketID   string `json:"bucketId"`
+		BucketName string `json:"bucketName"`
+	} `json:"allowed"`
+
+	bucketID string
+}
+
+type uploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// client B2 native API client with lazy account authorization,
+// re-authorized once the token expired
+type client struct {
+	keyID   string
+	appKey  string
+	bucket  string
+	authURL string
+	http    *http.Client
+
+	mu      sync.Mutex
+	auth    *authorization
+	uploads []*uploadURL
+}
+
+func (c *client) authorize(ctx context.Context) (*authorization, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.auth != nil {
+		return c.auth, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(c.authURL, "/")+"/b2api/v2/b2_authorize_account", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.keyID, c.appKey)
+	auth := &authorization{}
+	if err := c.decode(req, auth); err != nil {
+		return nil, err
+	}
+	auth.bucketID = auth.Allowed.BucketID
+	if auth.bucketID == "" || auth.Allowed.BucketName != c.bucket {
+		// application key not restricted to the bucket, look up bucket ID by name
+		var res struct {
+			Buckets []struct {
+				BucketID   string `json:"bucketId"`
+				BucketName string `json:"bucketName"`
+			} `json:"buckets"`
+		}
+		if err := c.post(ctx, auth, "b2_list_buckets", map[string]string{
+			"accountId":  auth.AccountID,
+			"bucketName": c.bucket,
+		}, &res); err != nil {
+			return nil, err
+		}
+		auth.bucketID = ""
+		for _, b := range res.Buckets {
+			if b.BucketName == c.bucket {
+				auth.bucketID = b.BucketID
+			}
+		}
+		if auth.bucketID == "" {
+			return nil, imagor.NewError("b2: bucket not found: "+c.bucket, http.StatusNotFound)
+		}
+	}
+	c.auth = auth
+	c.uploads = nil
+	return auth, nil
+}
+
+// invalidate discards authorization if still current
+func (c *client) invalidate(auth *authorization) {
+	c.mu.Lock()
+	if c.auth == auth {
+		c.auth = nil
+		c.uploads = nil
+	}
+	c.mu.Unlock()
+}
+
+// do executes request built from authorization,
+// re-authorizes and retries once if token expired
+func (c *client) do(ctx context.Context, fn func(auth *authorization) error) error {
+	auth, err := c.authorize(ctx)
+	if err != nil {
+		return err
+	}
+	if err = fn(auth); err != nil && isUnauthorized(err) {
+		c.invalidate(auth)
+		if auth, err = c.authorize(ctx); err != nil {
+			return err
+		}
+		err = fn(auth)
+	}
+	return err
+}
+
+// call invokes B2 API operation with JSON request and response
+func (c *client) call(ctx context.Context, op string, body, res interface{}) error {
+	return c.do(ctx, func(auth *authorization) error {
+		return c.post(ctx, auth, op, body, res)
+	})
+}
+
+func (c *client) post(ctx context.Context, auth *authorization, op string, body, res interface{}) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		auth.APIURL+"/b2api/v2/"+op, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth.AuthorizationToken)
+	return c.decode(req, res)
+}
+
+func (c *client) decode(req *http.Request, res interface{}) error {
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// send executes HTTP request, maps error responses into imagor.Error
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, imagor.ErrNotFound
+	}
+	var e apiError
+	if req.Method != http.MethodHead {
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+	}
+	if e.Message != "" {
+		return nil, imagor.NewError("b2: "+e.Code+": "+e.Message, resp.StatusCode)
+	}
+	return nil, imagor.NewErrorFromStatusCode(resp.StatusCode)
+}
+
+// getUploadURL pops idle upload URL, or requests a new one.
+// Upload URLs cannot be used concurrently hence pooled
+func (c *client) getUploadURL(ctx context.Context, auth *authorization) (*uploadURL, error) {
+	c.mu.Lock()
+	if n := len(c.uploads); n > 0 && c.auth == auth {
+		u := c.uploads[n-1]
+		c.uploads = c.uploads[:n-1]
+		c.mu.Unlock()
+		return u, nil
+	}
+	c.mu.Unlock()
+	u := &uploadURL{}
+	if err := c.post(ctx, auth, "b2_get_upload_url", map[string]string{
+		"bucketId": auth.bucketID,
+	}, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (c *client) putUploadURL(auth *authorization, u *uploadURL) {
+	c.mu.Lock()
+	if c.auth == auth && len(c.uploads) < maxIdleUploadURLs {
+		c.uploads = append(c.uploads, u)
+	}
+	c.mu.Unlock()
+}
+
+const maxIdleUploadURLs = 16
+
+func isUnauthorized(err error) bool {
+	e, ok := err.(imagor.Error)
+	return ok && e.Code == http.StatusUnauthorized
+}
+
+// encodeName percent-encodes file name for URL path and X-Bz-File-Name header,
+// where "+" would otherwise be decoded as space
+func encodeName(name string) string {
+	segs := strings.Split(name, "/")
+	for i, seg := range segs {
+		segs[i] = strings.ReplaceAll(url.PathEscape(seg), "+", "%2B")
+	}
+	return strings.Join(segs, "/")
+}
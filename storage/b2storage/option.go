@@ -0,0 +1,67 @@
+package b2storage
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Option func(s *B2Storage)
+
+func WithBaseDir(baseDir string) Option {
+	return func(s *B2Storage) {
+		if baseDir != "" {
+			s.BaseDir = "/" + strings.Trim(baseDir, "/")
+		}
+	}
+}
+
+func WithPathPrefix(prefix string) Option {
+	return func(s *B2Storage) {
+		if prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/")
+			if prefix != "/" {
+				prefix += "/"
+			}
+			s.PathPrefix = prefix
+		}
+	}
+}
+
+func WithSafeChars(chars string) Option {
+	return func(s *B2Storage) {
+		if chars != "" {
+			s.SafeChars = chars
+		}
+	}
+}
+
+func WithExpiration(exp time.Duration) Option {
+	return func(s *B2Storage) {
+		if exp > 0 {
+			s.Expiration = exp
+		}
+	}
+}
+
+func WithHardDelete(hardDelete bool) Option {
+	return func(s *B2Storage) {
+		s.HardDelete = hardDelete
+	}
+}
+
+func WithAuthURL(authURL string) Option {
+	return func(s *B2Storage) {
+		if authURL != "" {
+			s.client.authURL = authURL
+		}
+	}
+}
+
+func WithClient(client *http.Client) Option {
+	return func(s *B2Storage) {
+		if client != nil {
+			s.client.http = client
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package dedupstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/cshum/imagor"
+	"net/http"
+	"path"
+)
+
+// indexHeader header of index objects referencing content objects
+const indexHeader = "imagor-dedup:"
+
+// refsSuffix suffix of directory of reference objects of content object
+const refsSuffix = ".refs/"
+
+var errReferenced = errors.New("dedup: referenced")
+
+// DedupStorage wraps Storage such that identical images stored under different keys
+// are stored once, as content object keyed by its SHA-256 under HashPrefix,
+// within PathPrefix of the wrapped storage.
+// Each key is stored as small index object referencing the content object, with meta of the image.
+//
+// If the wrapped storage implements imagor.Lister, each key also stores a reference object
+// alongside the content object, such that content object is deleted once no longer referenced.
+// Objects stored prior to wrapping remain readable
+type DedupStorage struct {
+	Storage    imagor.Storage
+	HashPrefix string
+	PathPrefix string
+}
+
+func New(storage imagor.Storage, options ...Option) *DedupStorage {
+	s := &DedupStorage{
+		Storage:    storage,
+		HashPrefix: "dedup",
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// HashKey key of content object of image buffer
+func (s *DedupStorage) HashKey(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	hash := hex.EncodeToString(sum[:])
+	return path.Join(s.PathPrefix, s.HashPrefix, hash[:2], hash[2:4], hash)
+}
+
+// refKey key of reference object of key to content object
+func refKey(hashKey, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashKey + refsSuffix + hex.EncodeToString(sum[:])
+}
+
+// parseIndex returns content object key if buf is an index object
+func parseIndex(buf []byte) (string, bool) {
+	if !bytes.HasPrefix(buf, []byte(indexHeader)) {
+		return "", false
+	}
+	return string(buf[len(indexHeader):]), true
+}
+
+func (s *DedupStorage) Get(r *http.Request, key string) (*imagor.Blob, error) {
+	blob, err := s.Storage.Get(r, key)
+	if err != nil || blob == nil {
+		return blob, err
+	}
+	if err = blob.Err(); err != nil {
+		return blob, err
+	}
+	// index objects fit into the sniffed bytes of blob
+	if hashKey, ok := parseIndex(blob.Sniff()); ok {
+		return s.Storage.Get(r, hashKey)
+	}
+	return blob, nil
+}
+
+func (s *DedupStorage) Put(ctx context.Context, key string, blob *imagor.Blob) error {
+	if blob.IsEmpty() {
+		// meta only blob
+		return s.Storage.Put(ctx, key, blob)
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return err
+	}
+	hashKey := s.HashKey(buf)
+	prevHashKey, _ := s.indexOf(ctx, key)
+	if _, ok := s.Storage.(imagor.Lister); ok {
+		// reference before content, such that content is not released concurrently
+		if err := s.Storage.Put(ctx, refKey(hashKey, key), imagor.NewBlobFromBytes([]byte(key))); err != nil {
+			return err
+		}
+	}
+	if !s.exists(ctx, hashKey) {
+		if err := s.Storage.Put(ctx, hashKey, blob); err != nil {
+			return err
+		}
+	}
+	index := imagor.NewBlobFromBytes([]byte(indexHeader + hashKey))
+	index.Meta = blob.Meta
+	if err := s.Storage.Put(ctx, key, index); err != nil {
+		return err
+	}
+	if prevHashKey != "" && prevHashKey != hashKey {
+		// key overwritten with different content
+		return s.release(ctx, prevHashKey, key)
+	}
+	return nil
+}
+
+// indexOf returns content object key referenced by index object of key
+func (s *DedupStorage) indexOf(ctx context.Context, key string) (string, bool) {
+	blob, err := s.Storage.Get((&http.Request{}).WithContext(ctx), key)
+	if err != nil || blob == nil || blob.Err() != nil {
+		return "", false
+	}
+	return parseIndex(blob.Sniff())
+}
+
+// exists checks if content object exists and not expired
+func (s *DedupStorage) exists(ctx context.Context, hashKey string) bool {
+	stat, err := s.Storage.Stat(ctx, hashKey)
+	if err != nil || stat == nil {
+		return false
+	}
+	if expirer, ok := s.Storage.(imagor.Expirer); ok && expirer.Expired(stat) {
+		return false
+	}
+	return true
+}
+
+// release deletes reference object of key, and the content object if no longer referenced
+func (s *DedupStorage) release(ctx context.Context, hashKey, key string) error {
+	lister, ok := s.Storage.(imagor.Lister)
+	if !ok {
+		return nil
+	}
+	if err := s.Storage.Delete(ctx, refKey(hashKey, key)); err != nil && !errors.Is(err, imagor.ErrNotFound) {
+		return err
+	}
+	if err := lister.List(ctx, hashKey+refsSuffix, func(string) error {
+		return errReferenced
+	}); err != nil {
+		if errors.Is(err, errReferenced) {
+			return nil
+		}
+		return err
+	}
+	if err := s.Storage.Delete(ctx, hashKey); err != nil && !errors.Is(err, imagor.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *DedupStorage) Delete(ctx context.Context, key string) error {
+	hashKey, ok := s.indexOf(ctx, key)
+	if err := s.Storage.Delete(ctx, key); err != nil {
+		return err
+	}
+	if ok {
+		return s.release(ctx, hashKey, key)
+	}
+	return nil
+}
+
+// Stat of index object of key, such that modified time reflects the time of key being stored
+func (s *DedupStorage) Stat(ctx context.Context, key string) (*imagor.Stat, error) {
+	return s.Storage.Stat(ctx, key)
+}
+
+func (s *DedupStorage) Meta(ctx context.Context, key string) (*imagor.Meta, error) {
+	return s.Storage.Meta(ctx, key)
+}
+
+// List delegates to the underlying storage if it implements imagor.Lister,
+// which includes content and reference objects under HashPrefix
+func (s *DedupStorage) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	if lister, ok := s.Storage.(imagor.Lister); ok {
+		return lister.List(ctx, prefix, fn)
+	}
+	return nil
+}
+
+// Expired delegates to the underlying storage if it implements imagor.Expirer
+func (s *DedupStorage) Expired(stat *imagor.Stat) bool {
+	if expirer, ok := s.Storage.(imagor.Expirer); ok {
+		return expirer.Expired(stat)
+	}
+	return false
+}
+
+// Health delegates health check to the underlying storage if supported
+func (s *DedupStorage) Health(ctx context.Context) error {
+	if checker, ok := s.Storage.(imagor.HealthChecker); ok {
+		return checker.Health(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package dedupstorage
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/filestorage"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestDedupStorage(t *testing.T) {
+	ctx := context.Background()
+	mem := memorystorage.New()
+	s := New(mem, WithHashPrefix("/hashes/"))
+	assert.Equal(t, "hashes", s.HashPrefix)
+
+	buf := []byte("identical image content")
+	hashKey := s.HashKey(buf)
+	assert.Regexp(t, "^hashes/[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{64}$", hashKey)
+
+	for _, key := range []string{"fit-in/100x100/a.jpg", "fit-in/200x200/a.jpg"} {
+		blob := imagor.NewBlobFromBytes(buf)
+		blob.Meta = &imagor.Meta{Format: "jpeg", Width: 10, Height: 10}
+		require.NoError(t, s.Put(ctx, key, blob))
+	}
+	require.NoError(t, mem.Put(ctx, "legacy.jpg", imagor.NewBlobFromBytes([]byte("legacy"))))
+
+	raw, err := mem.Get(&http.Request{}, "fit-in/100x100/a.jpg")
+	require.NoError(t, err)
+	index, err := raw.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, indexHeader+hashKey, string(index))
+
+	for key, expected := range map[string]string{
+		"fit-in/100x100/a.jpg": string(buf),
+		"fit-in/200x200/a.jpg": string(buf),
+		"legacy.jpg":           "legacy",
+	} {
+		b, err := s.Get(&http.Request{}, key)
+		require.NoError(t, err)
+		res, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(res))
+	}
+
+	meta, err := s.Meta(ctx, "fit-in/200x200/a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 10, meta.Width)
+
+	require.NoError(t, s.Delete(ctx, "fit-in/100x100/a.jpg"))
+	_, err = s.Get(&http.Request{}, "fit-in/100x100/a.jpg")
+	assert.ErrorIs(t, err, imagor.ErrNotFound)
+	b, err := s.Get(&http.Request{}, "fit-in/200x200/a.jpg")
+	require.NoError(t, err)
+	res, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, string(buf), string(res))
+}
+
+func TestDedupStorageRelease(t *testing.T) {
+	ctx := context.Background()
+	file := filestorage.New(t.TempDir(), filestorage.WithPathPrefix("/results/"))
+	s := New(file, WithPathPrefix(file.PathPrefix))
+	assert.Equal(t, "results", s.PathPrefix)
+
+	buf := []byte("identical image content")
+	hashKey := s.HashKey(buf)
+	assert.Regexp(t, "^results/dedup/[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{64}$", hashKey)
+
+	keys := []string{"results/fit-in/100x100/a.jpg", "results/fit-in/200x200/a.jpg"}
+	for _, key := range keys {
+		require.NoError(t, s.Put(ctx, key, imagor.NewBlobFromBytes(buf)))
+	}
+	_, err := file.Stat(ctx, hashKey)
+	require.NoError(t, err)
+
+	// content kept while referenced
+	require.NoError(t, s.Delete(ctx, keys[0]))
+	_, err = file.Stat(ctx, hashKey)
+	require.NoError(t, err)
+
+	// content released once key overwritten with different content
+	require.NoError(t, s.Put(ctx, keys[1], imagor.NewBlobFromBytes([]byte("other content"))))
+	_, err = file.Stat(ctx, hashKey)
+	assert.ErrorIs(t, err, imagor.ErrNotFound)
+
+	otherKey := s.HashKey([]byte("other content"))
+	require.NoError(t, s.Delete(ctx, keys[1]))
+	_, err = file.Stat(ctx, otherKey)
+	assert.ErrorIs(t, err, imagor.ErrNotFound)
+	_, err = s.Get(&http.Request{}, keys[1])
+	assert.ErrorIs(t, err, imagor.ErrNotFound)
+}
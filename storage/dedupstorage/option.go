@@ -0,0 +1,22 @@
+package dedupstorage
+
+import "strings"
+
+type Option func(s *DedupStorage)
+
+// WithHashPrefix key prefix of content objects
+func WithHashPrefix(prefix string) Option {
+	return func(s *DedupStorage) {
+		if prefix = strings.Trim(prefix, "/"); prefix != "" {
+			s.HashPrefix = prefix
+		}
+	}
+}
+
+// WithPathPrefix key prefix of the wrapped storage, such that content objects
+// are stored within the key space accepted by the wrapped storage
+func WithPathPrefix(prefix string) Option {
+	return func(s *DedupStorage) {
+		s.PathPrefix = strings.Trim(prefix, "/")
+	}
+}
@@ -1,13 +1,17 @@
 package filestorage
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/imagorpath"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -94,33 +98,52 @@ func (s *FileStorage) Put(_ context.Context, image string, blob *imagor.Blob) (e
 	defer func() {
 		_ = reader.Close()
 	}()
-	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
-	if s.SaveErrIfExists {
-		flag = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	if err = s.writeFile(image, reader); err != nil {
+		return
+	}
+	if blob.Meta != nil {
+		if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
+			if err = s.writeFile(image+".meta.json", bytes.NewReader(buf)); err != nil {
+				return
+			}
+		}
 	}
-	w, err := os.OpenFile(image, flag, s.WritePermission)
+	return
+}
+
+// writeFile writes atomically via temp file rename,
+// such that readers never see partially written files
+func (s *FileStorage) writeFile(name string, reader io.Reader) (err error) {
+	// dot file temp is blacklisted from being read or listed
+	suffix := make([]byte, 8)
+	if _, err = rand.Read(suffix); err != nil {
+		return
+	}
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp-"+hex.EncodeToString(suffix))
+	w, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, s.WritePermission)
 	if err != nil {
 		return
 	}
 	defer func() {
-		_ = w.Close()
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
 	}()
 	if _, err = io.Copy(w, reader); err != nil {
+		_ = w.Close()
 		return
 	}
-	if blob.Meta != nil {
-		if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
-			w, err := os.OpenFile(image+".meta.json", flag, s.WritePermission)
-			if err != nil {
-				return err
-			}
-			defer w.Close()
-			if _, err = w.Write(buf); err != nil {
-				return err
-			}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if s.SaveErrIfExists {
+		// link fails if target exists
+		if err = os.Link(tmp, name); err != nil {
+			return
 		}
+		return os.Remove(tmp)
 	}
-	return
+	return os.Rename(tmp, name)
 }
 
 func (s *FileStorage) Delete(_ context.Context, image string) error {
@@ -128,9 +151,25 @@ func (s *FileStorage) Delete(_ context.Context, image string) error {
 	if !ok {
 		return imagor.ErrInvalid
 	}
+	if err := os.Remove(image + ".meta.json"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return os.Remove(image)
 }
 
+// Expired reports whether object of stat is older than expiration
+func (s *FileStorage) Expired(stat *imagor.Stat) bool {
+	return s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration
+}
+
+// Health checks if base directory is accessible. Missing base directory is created on Put
+func (s *FileStorage) Health(_ context.Context) error {
+	if _, err := os.Stat(s.BaseDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *FileStorage) Stat(_ context.Context, image string) (stat *imagor.Stat, err error) {
 	image, ok := s.Path(image)
 	if !ok {
@@ -181,3 +220,50 @@ func (s *FileStorage) Meta(_ context.Context, image string) (*imagor.Meta, error
 	}
 	return meta, nil
 }
+
+func (s *FileStorage) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	full, ok := s.Path(prefix)
+	if dir := "/" + strings.Trim(prefix, "/"); strings.HasPrefix(s.PathPrefix, strings.TrimSuffix(dir, "/")+"/") {
+		// prefix covers the whole path prefix
+		full, ok = s.BaseDir, true
+	}
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	// match on path separator boundary, such that "a/b" does not cover "a/bc"
+	dirPrefix := strings.TrimSuffix(full, string(filepath.Separator)) + string(filepath.Separator)
+	root := full
+	if stats, err := os.Stat(root); err != nil || !stats.IsDir() {
+		root = filepath.Dir(root)
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".meta.json") ||
+			(path != full && !strings.HasPrefix(path, dirPrefix)) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.BaseDir, path)
+		if err != nil {
+			return nil
+		}
+		key, err := url.QueryUnescape(s.PathPrefix + filepath.ToSlash(rel))
+		if err != nil {
+			return nil
+		}
+		key = strings.TrimPrefix(key, "/")
+		if _, ok := s.Path(key); !ok {
+			// skip blacklisted e.g. dot files
+			return nil
+		}
+		return fn(key)
+	})
+	return err
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -201,6 +203,21 @@ func TestFileStorage_Load_Save(t *testing.T) {
 		assert.Equal(t, imagor.ErrNotFound, err)
 	})
 
+	t.Run("atomic write", func(t *testing.T) {
+		s := New(dir)
+		require.NoError(t, s.Put(ctx, "/atomic/asdf", imagor.NewBlobFromBytes([]byte("bar"))))
+		require.NoError(t, s.Put(ctx, "/atomic/asdf", imagor.NewBlobFromBytes([]byte("boo"))))
+		files, err := ioutil.ReadDir(filepath.Join(dir, "atomic"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, "asdf", files[0].Name())
+		b, err := s.Get(&http.Request{}, "/atomic/asdf")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "boo", string(buf))
+	})
+
 	t.Run("expiration", func(t *testing.T) {
 		s := New(dir, WithExpiration(time.Millisecond*10))
 		var err error
@@ -234,3 +251,70 @@ func TestFileStorage_Load_Save(t *testing.T) {
 		require.ErrorIs(t, err, imagor.ErrExpired)
 	})
 }
+
+func TestFileStorage_List(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+
+	s := New(dir, WithPathPrefix("/foo"))
+	blob := imagor.NewBlobFromBytes([]byte("bar"))
+	blob.Meta = &imagor.Meta{Format: "jpeg"}
+	require.NoError(t, s.Put(ctx, "/foo/a/b:c.jpg", blob))
+	require.NoError(t, s.Put(ctx, "/foo/a/d.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	require.NoError(t, s.Put(ctx, "/foo/e.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	require.NoError(t, s.Put(ctx, "/foo/ab/f.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	var keys []string
+	require.NoError(t, s.List(ctx, "", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/a/b:c.jpg", "foo/a/d.jpg", "foo/ab/f.jpg", "foo/e.jpg"}, keys)
+
+	keys = nil
+	require.NoError(t, s.List(ctx, "foo/a", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/a/b:c.jpg", "foo/a/d.jpg"}, keys)
+
+	keys = nil
+	require.NoError(t, s.List(ctx, "foo/e.jpg", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/e.jpg"}, keys)
+
+	assert.Equal(t, imagor.ErrInvalid, s.List(ctx, "bar", func(key string) error {
+		return nil
+	}))
+	assert.Equal(t, imagor.ErrNotFound, s.List(ctx, "", func(key string) error {
+		return imagor.ErrNotFound
+	}))
+}
+
+func TestFileStorage_Expired(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "imagor-test")
+	require.NoError(t, err)
+
+	s := New(dir, WithExpiration(time.Hour))
+	blob := imagor.NewBlobFromBytes([]byte("bar"))
+	blob.Meta = &imagor.Meta{Format: "jpeg"}
+	require.NoError(t, s.Put(ctx, "/foo/bar.jpg", blob))
+	stat, err := s.Stat(ctx, "/foo/bar.jpg")
+	require.NoError(t, err)
+	assert.False(t, s.Expired(stat))
+
+	past := time.Now().Add(-time.Hour * 2)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "foo/bar.jpg"), past, past))
+	stat, err = s.Stat(ctx, "/foo/bar.jpg")
+	require.NoError(t, err)
+	assert.True(t, s.Expired(stat))
+	assert.False(t, New(dir).Expired(stat))
+
+	require.NoError(t, s.Delete(ctx, "/foo/bar.jpg"))
+	_, err = os.Stat(filepath.Join(dir, "foo/bar.jpg.meta.json"))
+	assert.True(t, os.IsNotExist(err))
+}
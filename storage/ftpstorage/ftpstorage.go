@@ -0,0 +1,303 @@
+package ftpstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/jlaffaye/ftp"
+	"io"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+)
+
+type FTPStorage struct {
+	Addr         string
+	Username     string
+	Password     string
+	BaseDir      string
+	PathPrefix   string
+	SafeChars    string
+	Timeout      time.Duration
+	MaxIdleConns int
+	Expiration   time.Duration
+	TLSConfig    *tls.Config
+	ImplicitTLS  bool
+
+	safeChars imagorpath.SafeChars
+	idle      chan *ftp.ServerConn
+}
+
+func New(addr string, options ...Option) *FTPStorage {
+	s := &FTPStorage{
+		Addr:         addr,
+		BaseDir:      "/",
+		PathPrefix:   "/",
+		Timeout:      time.Second * 30,
+		MaxIdleConns: 4,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.safeChars = imagorpath.NewSafeChars(s.SafeChars)
+	s.idle = make(chan *ftp.ServerConn, s.MaxIdleConns)
+	return s
+}
+
+func (s *FTPStorage) Path(image string) (string, bool) {
+	image = "/" + imagorpath.Normalize(image, s.safeChars)
+	if !strings.HasPrefix(image, s.PathPrefix) {
+		return "", false
+	}
+	return path.Join(s.BaseDir, strings.TrimPrefix(image, s.PathPrefix)), true
+}
+
+func (s *FTPStorage) dial() (*ftp.ServerConn, error) {
+	opts := []ftp.DialOption{ftp.DialWithTimeout(s.Timeout)}
+	if s.TLSConfig != nil {
+		if s.ImplicitTLS {
+			opts = append(opts, ftp.DialWithTLS(s.TLSConfig))
+		} else {
+			opts = append(opts, ftp.DialWithExplicitTLS(s.TLSConfig))
+		}
+	}
+	c, err := ftp.Dial(s.Addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	username := s.Username
+	if username == "" {
+		username = "anonymous"
+	}
+	if err := c.Login(username, s.Password); err != nil {
+		_ = c.Quit()
+		return nil, err
+	}
+	return c, nil
+}
+
+// acquire returns idle connection from pool if still alive, otherwise dials new connection
+func (s *FTPStorage) acquire() (*ftp.ServerConn, error) {
+	for {
+		select {
+		case c := <-s.idle:
+			if err := c.NoOp(); err != nil {
+				_ = c.Quit()
+				continue
+			}
+			return c, nil
+		default:
+			return s.dial()
+		}
+	}
+}
+
+// release returns connection to pool unless it is broken or pool is full
+func (s *FTPStorage) release(c *ftp.ServerConn, err error) {
+	if err != nil && !isProtocolErr(err) {
+		_ = c.Quit()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		_ = c.Quit()
+	}
+}
+
+// do runs fn with a pooled connection,
+// retried once with a new connection if the connection is broken
+func (s *FTPStorage) do(fn func(c *ftp.ServerConn) error) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		var c *ftp.ServerConn
+		if c, err = s.acquire(); err != nil {
+			return err
+		}
+		err = fn(c)
+		s.release(c, err)
+		if err == nil || isProtocolErr(err) {
+			break
+		}
+	}
+	return wrapErr(err)
+}
+
+func (s *FTPStorage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	stat, err := s.stat(image)
+	if err != nil {
+		return nil, err
+	}
+	if s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration {
+		return nil, imagor.ErrExpired
+	}
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		c, err := s.acquire()
+		if err != nil {
+			return nil, 0, err
+		}
+		reader, err := c.Retr(image)
+		if err != nil {
+			s.release(c, err)
+			return nil, 0, wrapErr(err)
+		}
+		return &releaseReader{ReadCloser: reader, release: func(err error) {
+			s.release(c, err)
+		}}, stat.Size, nil
+	}), nil
+}
+
+type releaseReader struct {
+	io.ReadCloser
+	release func(err error)
+}
+
+func (r *releaseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.release(err)
+	return err
+}
+
+func (s *FTPStorage) Put(_ context.Context, image string, blob *imagor.Blob) error {
+	image, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	return s.do(func(c *ftp.ServerConn) error {
+		if err := mkdirAll(c, path.Dir(image)); err != nil {
+			return err
+		}
+		reader, _, err := blob.NewReader()
+		if err != nil {
+			return err
+		}
+		err = c.Stor(image, reader)
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+		if blob.Meta != nil {
+			if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
+				return c.Stor(image+".meta.json", bytes.NewReader(buf))
+			}
+		}
+		return nil
+	})
+}
+
+func (s *FTPStorage) Delete(_ context.Context, image string) error {
+	image, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	return s.do(func(c *ftp.ServerConn) error {
+		return c.Delete(image)
+	})
+}
+
+func (s *FTPStorage) Stat(_ context.Context, image string) (*imagor.Stat, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	return s.stat(image)
+}
+
+func (s *FTPStorage) stat(image string) (stat *imagor.Stat, err error) {
+	err = s.do(func(c *ftp.ServerConn) (err error) {
+		stat = &imagor.Stat{}
+		if c.IsGetTimeSupported() {
+			if stat.ModifiedTime, err = c.GetTime(image); err != nil {
+				return
+			}
+		} else {
+			var entry *ftp.Entry
+			if entry, err = c.GetEntry(image); err != nil {
+				return
+			}
+			stat.ModifiedTime = entry.Time
+		}
+		stat.Size, err = c.FileSize(image)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *FTPStorage) Meta(_ context.Context, image string) (*imagor.Meta, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	key := image + ".meta.json"
+	if s.Expiration > 0 {
+		stat, err := s.stat(key)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().Sub(stat.ModifiedTime) > s.Expiration {
+			return nil, imagor.ErrExpired
+		}
+	}
+	var buf []byte
+	if err := s.do(func(c *ftp.ServerConn) error {
+		reader, err := c.Retr(key)
+		if err != nil {
+			return err
+		}
+		buf, err = io.ReadAll(reader)
+		if cerr := reader.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	meta := &imagor.Meta{}
+	if err := json.Unmarshal(buf, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// mkdirAll creates parent directories, existing directories are ignored
+func mkdirAll(c *ftp.ServerConn, dir string) error {
+	var p string
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		p += "/" + part
+		if err := c.MakeDir(p); err != nil && !isProtocolErr(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapErr maps FTP file unavailable errors into imagor.ErrNotFound
+func wrapErr(err error) error {
+	var e *textproto.Error
+	if errors.As(err, &e) && e.Code == ftp.StatusFileUnavailable {
+		return imagor.ErrNotFound
+	}
+	return err
+}
+
+// isProtocolErr checks if error is FTP response error, such that connection can be reused
+func isProtocolErr(err error) bool {
+	var e *textproto.Error
+	return errors.As(err, &e)
+}
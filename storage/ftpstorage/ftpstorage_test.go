@@ -0,0 +1,402 @@
+package ftpstorage
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeFile struct {
+	buf     []byte
+	modTime time.Time
+}
+
+// fakeServer minimal in-memory FTP server supporting passive mode
+type fakeServer struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	files map[string]fakeFile
+	conns map[net.Conn]bool
+	dials int
+
+	// noEPSV rejects EPSV such that client falls back to PASV
+	noEPSV bool
+	// tlsConfig enables AUTH TLS, or implicit TLS if implicitTLS
+	tlsConfig   *tls.Config
+	implicitTLS bool
+}
+
+func newFakeServer(t *testing.T, options ...func(s *fakeServer)) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{ln: ln, files: map[string]fakeFile{}, conns: map[net.Conn]bool{}}
+	for _, option := range options {
+		option(s)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.dials++
+			s.conns[c] = true
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	return s
+}
+
+// closeConns closes all control connections, as if server restarted
+func (s *fakeServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		_ = c.Close()
+		delete(s.conns, c)
+	}
+}
+
+func newTLSConfig(t *testing.T) *tls.Config {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return &tls.Config{Certificates: ts.TLS.Certificates}
+}
+
+// listenData listens for data connection, accepted in background
+// as TLS clients handshake before sending transfer command
+func (s *fakeServer) listenData(secure bool) (net.Listener, chan net.Conn) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	ch := make(chan net.Conn, 1)
+	go func() {
+		defer close(ch)
+		defer ln.Close()
+		dc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		if secure {
+			tc := tls.Server(dc, s.tlsConfig)
+			if err := tc.Handshake(); err != nil {
+				_ = dc.Close()
+				return
+			}
+			dc = tc
+		}
+		ch <- dc
+	}()
+	return ln, ch
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer func() {
+		_ = c.Close()
+	}()
+	secure := false
+	if s.implicitTLS {
+		c = tls.Server(c, s.tlsConfig)
+		secure = true
+	}
+	r := bufio.NewReader(c)
+	reply := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(c, format+"\r\n", args...)
+	}
+	var data chan net.Conn
+	reply("220 ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch cmd {
+		case "AUTH":
+			if s.tlsConfig == nil {
+				reply("502 not implemented")
+				continue
+			}
+			reply("234 ok")
+			c = tls.Server(c, s.tlsConfig)
+			r = bufio.NewReader(c)
+			secure = true
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			if arg != "pass" {
+				reply("530 login incorrect")
+			} else {
+				reply("230 logged in")
+			}
+		case "FEAT":
+			reply("211-Features:\r\n MDTM\r\n SIZE\r\n211 End")
+		case "TYPE", "NOOP", "PBSZ", "PROT":
+			reply("200 ok")
+		case "MKD":
+			reply("257 created")
+		case "EPSV":
+			if s.noEPSV {
+				reply("502 not implemented")
+				continue
+			}
+			var ln net.Listener
+			ln, data = s.listenData(secure)
+			reply("229 Entering Extended Passive Mode (|||%d|)", ln.Addr().(*net.TCPAddr).Port)
+		case "PASV":
+			var ln net.Listener
+			ln, data = s.listenData(secure)
+			port := ln.Addr().(*net.TCPAddr).Port
+			reply("227 Entering Passive Mode (127,0,0,1,%d,%d)", port/256, port%256)
+		case "RETR", "STOR":
+			s.mu.Lock()
+			f, ok := s.files[arg]
+			s.mu.Unlock()
+			if cmd == "RETR" && !ok {
+				reply("550 not found")
+				continue
+			}
+			reply("150 opening data connection")
+			dc, ok := <-data
+			if !ok {
+				return
+			}
+			if cmd == "RETR" {
+				_, _ = dc.Write(f.buf)
+			} else {
+				buf, _ := io.ReadAll(dc)
+				s.mu.Lock()
+				s.files[arg] = fakeFile{buf: buf, modTime: time.Now().UTC()}
+				s.mu.Unlock()
+			}
+			_ = dc.Close()
+			reply("226 transfer complete")
+		case "DELE", "MDTM", "SIZE":
+			s.mu.Lock()
+			f, ok := s.files[arg]
+			if ok && cmd == "DELE" {
+				delete(s.files, arg)
+			}
+			s.mu.Unlock()
+			if !ok {
+				reply("550 not found")
+			} else if cmd == "DELE" {
+				reply("250 deleted")
+			} else if cmd == "MDTM" {
+				reply("213 %s", f.modTime.Format("20060102150405"))
+			} else {
+				reply("213 %d", len(f.buf))
+			}
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTPStorage_Path(t *testing.T) {
+	tests := []struct {
+		name       string
+		baseDir    string
+		prefix     string
+		image      string
+		expected   string
+		expectedOk bool
+	}{
+		{
+			name:       "path under base dir",
+			baseDir:    "/home/imagor",
+			image:      "/foo/bar",
+			expected:   "/home/imagor/foo/bar",
+			expectedOk: true,
+		},
+		{
+			name:       "path under with prefix",
+			baseDir:    "/home/imagor",
+			prefix:     "/foo",
+			image:      "/foo/bar",
+			expected:   "/home/imagor/bar",
+			expectedOk: true,
+		},
+		{
+			name:    "path not under prefix",
+			baseDir: "/home/imagor",
+			prefix:  "/foo",
+			image:   "/fooo/bar",
+		},
+		{
+			name:       "escape unsafe chars",
+			image:      "/foo/b{:}ar",
+			expected:   "/foo/b%7B%3A%7Dar",
+			expectedOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := New("localhost:21", WithBaseDir(tt.baseDir), WithPathPrefix(tt.prefix)).Path(tt.image)
+			assert.Equal(t, tt.expected, res)
+			assert.Equal(t, tt.expectedOk, ok)
+		})
+	}
+}
+
+func TestFTPStorage_Load_Save(t *testing.T) {
+	srv := newFakeServer(t)
+	ctx := context.Background()
+	r := &http.Request{}
+
+	t.Run("login failed", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(), WithCredentials("user", "wrong"))
+		_, err := s.Stat(ctx, "foo")
+		assert.Error(t, err)
+	})
+
+	t.Run("CRUD", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(),
+			WithCredentials("user", "pass"),
+			WithBaseDir("/imagor"), WithTimeout(time.Second))
+
+		_, err := s.Get(r, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Stat(ctx, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Meta(ctx, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+
+		blob := imagor.NewBlobFromBytes([]byte("bar"))
+		require.NoError(t, s.Put(ctx, "/foo/fooo/asdf", blob))
+		assert.Contains(t, srv.files, "/imagor/foo/fooo/asdf")
+
+		b, err := s.Get(r, "/foo/fooo/asdf")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+
+		stat, err := s.Stat(ctx, "/foo/fooo/asdf")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stat.Size)
+		assert.WithinDuration(t, time.Now(), stat.ModifiedTime, time.Minute)
+
+		require.NoError(t, s.Delete(ctx, "/foo/fooo/asdf"))
+		_, err = s.Get(r, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("meta", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(), WithCredentials("user", "pass"))
+		blob := imagor.NewBlobFromBytes([]byte("bar"))
+		blob.Meta = &imagor.Meta{Format: "png", Width: 10, Height: 20}
+		require.NoError(t, s.Put(ctx, "meta", blob))
+		meta, err := s.Meta(ctx, "meta")
+		require.NoError(t, err)
+		assert.Equal(t, blob.Meta, meta)
+	})
+
+	t.Run("connection pool", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(), WithCredentials("user", "pass"), WithMaxIdleConns(1))
+		srv.mu.Lock()
+		dials := srv.dials
+		srv.mu.Unlock()
+		for i := 0; i < 5; i++ {
+			_, err := s.Stat(ctx, "meta")
+			require.NoError(t, err)
+		}
+		srv.mu.Lock()
+		assert.Equal(t, dials+1, srv.dials)
+		srv.mu.Unlock()
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(), WithCredentials("user", "pass"), WithExpiration(time.Millisecond))
+		require.NoError(t, s.Put(ctx, "exp", imagor.NewBlobFromBytes([]byte("bar"))))
+		time.Sleep(time.Second)
+		_, err := s.Get(r, "exp")
+		assert.Equal(t, imagor.ErrExpired, err)
+	})
+	t.Run("reconnect", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(), WithCredentials("user", "pass"))
+		require.NoError(t, s.Put(ctx, "reconnect", imagor.NewBlobFromBytes([]byte("bar"))))
+		srv.closeConns()
+		_, err := s.Stat(ctx, "reconnect")
+		require.NoError(t, err)
+		srv.closeConns()
+		require.NoError(t, s.Put(ctx, "reconnect", imagor.NewBlobFromBytes([]byte("baz"))))
+		srv.closeConns()
+		b, err := s.Get(r, "reconnect")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "baz", string(buf))
+	})
+}
+
+func TestFTPStorage_Modes(t *testing.T) {
+	ctx := context.Background()
+	r := &http.Request{}
+	tlsConfig := newTLSConfig(t)
+	tests := []struct {
+		name   string
+		server func(s *fakeServer)
+		option Option
+	}{
+		{
+			name: "PASV fallback",
+			server: func(s *fakeServer) {
+				s.noEPSV = true
+			},
+		},
+		{
+			name: "explicit TLS",
+			server: func(s *fakeServer) {
+				s.tlsConfig = tlsConfig
+			},
+			option: WithTLS(&tls.Config{InsecureSkipVerify: true}, false),
+		},
+		{
+			name: "implicit TLS",
+			server: func(s *fakeServer) {
+				s.tlsConfig = tlsConfig
+				s.implicitTLS = true
+			},
+			option: WithTLS(&tls.Config{InsecureSkipVerify: true}, true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t, tt.server)
+			options := []Option{WithCredentials("user", "pass"), WithTimeout(time.Second)}
+			if tt.option != nil {
+				options = append(options, tt.option)
+			}
+			s := New(srv.ln.Addr().String(), options...)
+			require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+			b, err := s.Get(r, "foo")
+			require.NoError(t, err)
+			buf, err := b.ReadAll()
+			require.NoError(t, err)
+			assert.Equal(t, "bar", string(buf))
+			stat, err := s.Stat(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), stat.Size)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package ftpstorage
+
+import (
+	"crypto/tls"
+	"strings"
+	"time"
+)
+
+type Option func(h *FTPStorage)
+
+func WithCredentials(username, password string) Option {
+	return func(s *FTPStorage) {
+		s.Username = username
+		s.Password = password
+	}
+}
+
+func WithBaseDir(baseDir string) Option {
+	return func(s *FTPStorage) {
+		if baseDir != "" {
+			s.BaseDir = "/" + strings.Trim(baseDir, "/")
+		}
+	}
+}
+
+func WithPathPrefix(prefix string) Option {
+	return func(s *FTPStorage) {
+		if prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/")
+			if prefix != "/" {
+				prefix += "/"
+			}
+			s.PathPrefix = prefix
+		}
+	}
+}
+
+func WithSafeChars(chars string) Option {
+	return func(s *FTPStorage) {
+		if chars != "" {
+			s.SafeChars = chars
+		}
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *FTPStorage) {
+		if timeout > 0 {
+			s.Timeout = timeout
+		}
+	}
+}
+
+func WithMaxIdleConns(n int) Option {
+	return func(s *FTPStorage) {
+		if n >= 0 {
+			s.MaxIdleConns = n
+		}
+	}
+}
+
+func WithExpiration(exp time.Duration) Option {
+	return func(s *FTPStorage) {
+		if exp > 0 {
+			s.Expiration = exp
+		}
+	}
+}
+
+// WithTLS enables FTPS, explicit via AUTH TLS, or implicit TLS if implicit is true
+func WithTLS(config *tls.Config, implicit bool) Option {
+	return func(s *FTPStorage) {
+		if config != nil {
+			s.TLSConfig = config
+			s.ImplicitTLS = implicit
+		}
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/imagorpath"
+	"google.golang.org/api/iterator"
 	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
@@ -131,6 +133,17 @@ func (s *GCloudStorage) attrs(ctx context.Context, image string) (attrs *storage
 	return attrs, err
 }
 
+// Expired reports whether object of stat is older than expiration
+func (s *GCloudStorage) Expired(stat *imagor.Stat) bool {
+	return s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration
+}
+
+// Health checks if bucket exists and is accessible
+func (s *GCloudStorage) Health(ctx context.Context) error {
+	_, err := s.client.Bucket(s.Bucket).Attrs(ctx)
+	return err
+}
+
 func (s *GCloudStorage) Stat(ctx context.Context, image string) (stat *imagor.Stat, err error) {
 	attrs, err := s.attrs(ctx, image)
 	if err != nil {
@@ -139,6 +152,7 @@ func (s *GCloudStorage) Stat(ctx context.Context, image string) (stat *imagor.St
 	return &imagor.Stat{
 		Size:         attrs.Size,
 		ModifiedTime: attrs.Updated,
+		ETag:         attrs.Etag,
 	}, nil
 }
 
@@ -161,3 +175,38 @@ func (s *GCloudStorage) Meta(ctx context.Context, image string) (meta *imagor.Me
 	}
 	return meta, nil
 }
+
+func (s *GCloudStorage) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	full, ok := s.Path(prefix)
+	if dir := "/" + strings.Trim(prefix, "/"); strings.HasPrefix("/"+strings.TrimPrefix(s.PathPrefix, "/"), strings.TrimSuffix(dir, "/")+"/") {
+		// prefix covers the whole path prefix
+		full, ok = s.BaseDir, true
+	}
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	baseDir := strings.Trim(s.BaseDir, "/")
+	it := s.client.Bucket(s.Bucket).Objects(ctx, &storage.Query{Prefix: full})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(attrs.Name, "/")
+		if baseDir != "" {
+			if !strings.HasPrefix(rel, baseDir+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(rel, baseDir+"/")
+		}
+		key, err := url.QueryUnescape(s.PathPrefix + rel)
+		if err != nil {
+			continue
+		}
+		if err := fn(strings.TrimPrefix(key, "/")); err != nil {
+			return err
+		}
+	}
+}
@@ -194,3 +194,31 @@ func TestExpiration(t *testing.T) {
 	_, err = s.Meta(context.Background(), "/foo/bar/asdf")
 	require.ErrorIs(t, err, imagor.ErrExpired)
 }
+
+func TestList(t *testing.T) {
+	srv := fakestorage.NewServer([]fakestorage.Object{{
+		ObjectAttrs: fakestorage.ObjectAttrs{
+			BucketName: "test",
+			Name:       "placeholder",
+		},
+		Content: []byte(""),
+	}})
+	ctx := context.Background()
+	s := New(srv.Client(), "test", WithPathPrefix("/foo"), WithBaseDir("images"))
+	require.NoError(t, s.Put(ctx, "/foo/a/b:c.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	require.NoError(t, s.Put(ctx, "/foo/d.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	var keys []string
+	require.NoError(t, s.List(ctx, "", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/a/b:c.jpg", "foo/d.jpg"}, keys)
+
+	keys = nil
+	require.NoError(t, s.List(ctx, "/foo/a", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/a/b:c.jpg"}, keys)
+}
@@ -0,0 +1,194 @@
+package gzipstorage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+)
+
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+var (
+	// gzipHeader magic bytes of gzip stream
+	gzipHeader = []byte("\x1f\x8b")
+	// zstdHeader magic bytes of zstd frame
+	zstdHeader = []byte("\x28\xb5\x2f\xfd")
+)
+
+// GzipStorage wraps Storage with gzip or zstd compression of compressible images
+// e.g. SVG, PNG and TIFF, while already compressed formats are stored as-is.
+// Compressed objects are detected by magic bytes and decompressed on Get transparently,
+// such that objects stored prior to wrapping or with another encoding remain readable
+type GzipStorage struct {
+	Storage  imagor.Storage
+	Encoding string
+	Level    int
+	// MinSize minimum size in bytes to be compressed
+	MinSize int
+
+	zstdEncoder *zstd.Encoder
+}
+
+func New(storage imagor.Storage, options ...Option) *GzipStorage {
+	s := &GzipStorage{
+		Storage:  storage,
+		Encoding: EncodingGzip,
+		Level:    gzip.DefaultCompression,
+		MinSize:  1024,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.Encoding == EncodingZstd {
+		level := zstd.SpeedDefault
+		if s.Level != gzip.DefaultCompression {
+			level = zstd.EncoderLevelFromZstd(s.Level)
+		}
+		// encoder without writer is only used for EncodeAll which is safe for concurrent use
+		s.zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	}
+	return s
+}
+
+func isCompressible(blob *imagor.Blob) bool {
+	switch blob.BlobType() {
+	case imagor.BlobTypeJPEG, imagor.BlobTypeGIF, imagor.BlobTypeWEBP,
+		imagor.BlobTypeAVIF, imagor.BlobTypeHEIF, imagor.BlobTypeJXL, imagor.BlobTypeMP4, imagor.BlobTypeWEBM, imagor.BlobTypeEmpty:
+		return false
+	}
+	return true
+}
+
+func (s *GzipStorage) Get(r *http.Request, key string) (*imagor.Blob, error) {
+	blob, err := s.Storage.Get(r, key)
+	if err != nil || blob == nil {
+		return blob, err
+	}
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		reader, size, err := blob.NewReader()
+		if err != nil || reader == nil {
+			return reader, size, err
+		}
+		br := bufio.NewReader(reader)
+		magic, _ := br.Peek(len(zstdHeader))
+		switch {
+		case bytes.HasPrefix(magic, gzipHeader):
+			gr, err := gzip.NewReader(br)
+			if err != nil {
+				_ = reader.Close()
+				return nil, 0, err
+			}
+			// decompressed size unknown
+			return &readCloser{Reader: gr, Closer: reader}, 0, nil
+		case bytes.Equal(magic, zstdHeader):
+			zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				_ = reader.Close()
+				return nil, 0, err
+			}
+			return &readCloser{Reader: zr, Closer: closerFunc(func() error {
+				zr.Close()
+				return reader.Close()
+			})}, 0, nil
+		default:
+			return &readCloser{Reader: br, Closer: reader}, size, nil
+		}
+	}), nil
+}
+
+func (s *GzipStorage) Put(ctx context.Context, key string, blob *imagor.Blob) error {
+	if !isCompressible(blob) {
+		return s.Storage.Put(ctx, key, blob)
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(buf) < s.MinSize {
+		return s.Storage.Put(ctx, key, blob)
+	}
+	out, err := s.compress(buf)
+	if err != nil {
+		return err
+	}
+	if len(out) >= len(buf) {
+		return s.Storage.Put(ctx, key, blob)
+	}
+	compressed := imagor.NewBlobFromBytes(out)
+	compressed.Meta = blob.Meta
+	return s.Storage.Put(ctx, key, compressed)
+}
+
+func (s *GzipStorage) compress(buf []byte) ([]byte, error) {
+	if s.zstdEncoder != nil {
+		return s.zstdEncoder.EncodeAll(buf, make([]byte, 0, len(buf)/2)), nil
+	}
+	var out bytes.Buffer
+	w, err := gzip.NewWriterLevel(&out, s.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (s *GzipStorage) Delete(ctx context.Context, key string) error {
+	return s.Storage.Delete(ctx, key)
+}
+
+// Stat of underlying storage, with size of the stored object which may be compressed
+func (s *GzipStorage) Stat(ctx context.Context, key string) (*imagor.Stat, error) {
+	return s.Storage.Stat(ctx, key)
+}
+
+func (s *GzipStorage) Meta(ctx context.Context, key string) (*imagor.Meta, error) {
+	return s.Storage.Meta(ctx, key)
+}
+
+// List delegates to the underlying storage if it implements imagor.Lister, as keys are unchanged
+func (s *GzipStorage) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	if lister, ok := s.Storage.(imagor.Lister); ok {
+		return lister.List(ctx, prefix, fn)
+	}
+	return nil
+}
+
+// Expired delegates to the underlying storage if it implements imagor.Expirer
+func (s *GzipStorage) Expired(stat *imagor.Stat) bool {
+	if expirer, ok := s.Storage.(imagor.Expirer); ok {
+		return expirer.Expired(stat)
+	}
+	return false
+}
+
+// Health delegates health check to the underlying storage if supported
+func (s *GzipStorage) Health(ctx context.Context) error {
+	if checker, ok := s.Storage.(imagor.HealthChecker); ok {
+		return checker.Health(ctx)
+	}
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
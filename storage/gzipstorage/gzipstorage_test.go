@@ -0,0 +1,104 @@
+package gzipstorage
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestGzipStorage(t *testing.T) {
+	ctx := context.Background()
+	mem := memorystorage.New()
+	s := New(mem, WithLevel(9), WithMinSize(100))
+	assert.Equal(t, 9, s.Level)
+
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg">` + string(bytes.Repeat([]byte(`<rect width="10" height="10"/>`), 100)) + `</svg>`)
+	jpg, err := os.ReadFile("../../testdata/demo1.jpg")
+	require.NoError(t, err)
+
+	blob := imagor.NewBlobFromBytes(svg)
+	blob.Meta = &imagor.Meta{Format: "svg", ContentType: "image/svg+xml"}
+	require.NoError(t, s.Put(ctx, "a.svg", blob))
+	require.NoError(t, s.Put(ctx, "b.jpg", imagor.NewBlobFromBytes(jpg)))
+	require.NoError(t, s.Put(ctx, "c.svg", imagor.NewBlobFromBytes(svg[:50])))
+
+	raw, err := mem.Get(&http.Request{}, "a.svg")
+	require.NoError(t, err)
+	buf, err := raw.ReadAll()
+	require.NoError(t, err)
+	assert.Less(t, len(buf), len(svg)/4)
+	assert.True(t, bytes.HasPrefix(buf, gzipHeader))
+
+	for key, expected := range map[string][]byte{
+		"a.svg": svg,
+		"b.jpg": jpg,
+		"c.svg": svg[:50],
+	} {
+		b, err := s.Get(&http.Request{}, key)
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, expected, buf, key)
+	}
+	b, err := s.Get(&http.Request{}, "a.svg")
+	require.NoError(t, err)
+	assert.Equal(t, imagor.BlobTypeSVG, b.BlobType())
+
+	meta, err := s.Meta(ctx, "a.svg")
+	require.NoError(t, err)
+	assert.Equal(t, blob.Meta, meta)
+
+	// objects stored prior to wrapping remain readable
+	require.NoError(t, mem.Put(ctx, "d.svg", imagor.NewBlobFromBytes(svg)))
+	b, err = s.Get(&http.Request{}, "d.svg")
+	require.NoError(t, err)
+	buf, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, svg, buf)
+
+	b, err = s.Get(&http.Request{}, "missing")
+	if err == nil {
+		_, err = b.ReadAll()
+	}
+	assert.ErrorIs(t, err, imagor.ErrNotFound)
+}
+
+func TestGzipStorageZstd(t *testing.T) {
+	ctx := context.Background()
+	mem := memorystorage.New()
+	s := New(mem, WithEncoding(EncodingZstd), WithLevel(9), WithMinSize(100))
+	assert.Equal(t, EncodingZstd, s.Encoding)
+	assert.Equal(t, EncodingGzip, New(mem, WithEncoding("br")).Encoding)
+
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg">` + string(bytes.Repeat([]byte(`<rect width="10" height="10"/>`), 100)) + `</svg>`)
+	require.NoError(t, s.Put(ctx, "a.svg", imagor.NewBlobFromBytes(svg)))
+	raw, err := mem.Get(&http.Request{}, "a.svg")
+	require.NoError(t, err)
+	buf, err := raw.ReadAll()
+	require.NoError(t, err)
+	assert.Less(t, len(buf), len(svg)/4)
+	assert.True(t, bytes.HasPrefix(buf, zstdHeader))
+
+	// objects stored with gzip remain readable after switching to zstd
+	require.NoError(t, New(mem, WithMinSize(100)).Put(ctx, "b.svg", imagor.NewBlobFromBytes(svg)))
+
+	for _, key := range []string{"a.svg", "b.svg"} {
+		b, err := s.Get(&http.Request{}, key)
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, svg, buf, key)
+		assert.Equal(t, imagor.BlobTypeSVG, b.BlobType(), key)
+	}
+	b, err := New(mem).Get(&http.Request{}, "a.svg")
+	require.NoError(t, err)
+	buf, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, svg, buf)
+}
@@ -0,0 +1,33 @@
+package gzipstorage
+
+import "compress/gzip"
+
+type Option func(s *GzipStorage)
+
+// WithEncoding compression encoding of stored objects, either gzip or zstd
+func WithEncoding(encoding string) Option {
+	return func(s *GzipStorage) {
+		if encoding == EncodingGzip || encoding == EncodingZstd {
+			s.Encoding = encoding
+		}
+	}
+}
+
+// WithLevel compression level from 1 best speed to 9 best compression,
+// mapped to the closest zstd encoder level if encoding is zstd
+func WithLevel(level int) Option {
+	return func(s *GzipStorage) {
+		if level >= gzip.BestSpeed && level <= gzip.BestCompression {
+			s.Level = level
+		}
+	}
+}
+
+// WithMinSize minimum size in bytes of images to be compressed
+func WithMinSize(size int) Option {
+	return func(s *GzipStorage) {
+		if size >= 0 {
+			s.MinSize = size
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package memcachedstorage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/cshum/imagor"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxKeyLength memcached key length limit, with room for chunk suffix
+	maxKeyLength = 220
+	// maxRelativeExp memcached treats expiration over 30 days as unix timestamp
+	maxRelativeExp = time.Hour * 24 * 30
+
+	valueInline  byte = 0
+	valueChunked byte = 1
+
+	metaSuffix = ":meta"
+)
+
+// MemcachedStorage memcached storage for caching results in front of slower result storages.
+// Values exceeding ChunkSize are split into chunks. Delete is best-effort,
+// orphaned chunks are left to expire by TTL
+type MemcachedStorage struct {
+	Addr         string
+	Prefix       string
+	TTL          time.Duration
+	ChunkSize    int
+	MaxChunks    int
+	Timeout      time.Duration
+	MaxIdleConns int
+
+	client *memcache.Client
+}
+
+func New(addr string, options ...Option) *MemcachedStorage {
+	s := &MemcachedStorage{
+		Addr: addr,
+		// memcached 1MB item limit including item header and key
+		ChunkSize:    1000 * 1000,
+		MaxChunks:    32,
+		Timeout:      time.Second,
+		MaxIdleConns: 10,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.client = memcache.New(addr)
+	s.client.Timeout = s.Timeout
+	s.client.MaxIdleConns = s.MaxIdleConns
+	return s
+}
+
+// Key returns memcached key of image, hashed if not a valid memcached key
+func (s *MemcachedStorage) Key(image string) string {
+	key := s.Prefix + image
+	if len(key) > maxKeyLength || !isValidKey(key) {
+		h := sha1.Sum([]byte(image))
+		key = s.Prefix + hex.EncodeToString(h[:])
+	}
+	return key
+}
+
+func isValidKey(key string) bool {
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemcachedStorage) exp() int32 {
+	if s.TTL <= 0 {
+		return 0
+	}
+	if s.TTL > maxRelativeExp {
+		return int32(time.Now().Add(s.TTL).Unix())
+	}
+	return int32(s.TTL / time.Second)
+}
+
+// do runs fn and retries once on connection error,
+// such that stale idle connections e.g. after memcached restart are redialed
+func do(fn func() error) error {
+	err := fn()
+	if isConnError(err) {
+		err = fn()
+	}
+	if err == memcache.ErrCacheMiss {
+		return imagor.ErrNotFound
+	}
+	return err
+}
+
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		// server reachable but slow, retry would double the latency
+		return false
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func (s *MemcachedStorage) get(key string) (it *memcache.Item, err error) {
+	err = do(func() error {
+		it, err = s.client.Get(key)
+		return err
+	})
+	return
+}
+
+func (s *MemcachedStorage) set(it *memcache.Item) error {
+	return do(func() error {
+		return s.client.Set(it)
+	})
+}
+
+func (s *MemcachedStorage) delete(key string) error {
+	return do(func() error {
+		return s.client.Delete(key)
+	})
+}
+
+func (s *MemcachedStorage) Get(_ *http.Request, image string) (*imagor.Blob, error) {
+	key := s.Key(image)
+	it, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(it.Value) == 0 {
+		return nil, imagor.ErrNotFound
+	}
+	if it.Value[0] == valueInline {
+		return imagor.NewBlobFromBytes(it.Value[1:]), nil
+	}
+	var count, size int
+	var gen int64
+	if _, err := fmt.Sscanf(string(it.Value[1:]), "%d %d %d", &count, &size, &gen); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, size)
+	for i := 0; i < count; i++ {
+		chunk, err := s.get(chunkKey(key, gen, i))
+		if err != nil {
+			// chunk evicted
+			return nil, err
+		}
+		buf = append(buf, chunk.Value...)
+	}
+	if len(buf) != size {
+		return nil, imagor.ErrNotFound
+	}
+	return imagor.NewBlobFromBytes(buf), nil
+}
+
+func chunkKey(key string, gen int64, i int) string {
+	return fmt.Sprintf("%s:%x:%d", key, gen, i)
+}
+
+func (s *MemcachedStorage) Put(_ context.Context, image string, blob *imagor.Blob) error {
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return err
+	}
+	count := (len(buf) + s.ChunkSize - 1) / s.ChunkSize
+	if count > s.MaxChunks {
+		// skip caching blobs exceeding max chunks
+		return nil
+	}
+	key := s.Key(image)
+	exp := s.exp()
+	now := time.Now()
+	flags := uint32(now.Unix())
+	if len(buf) < s.ChunkSize {
+		if err := s.set(&memcache.Item{
+			Key: key, Value: append([]byte{valueInline}, buf...), Flags: flags, Expiration: exp,
+		}); err != nil {
+			return err
+		}
+	} else {
+		// chunks are written before manifest, keyed by generation
+		// such that readers never see mixed chunks of concurrent writes
+		gen := now.UnixNano()
+		for i := 0; i < count; i++ {
+			end := (i + 1) * s.ChunkSize
+			if end > len(buf) {
+				end = len(buf)
+			}
+			if err := s.set(&memcache.Item{
+				Key: chunkKey(key, gen, i), Value: buf[i*s.ChunkSize : end], Expiration: exp,
+			}); err != nil {
+				return err
+			}
+		}
+		manifest := append([]byte{valueChunked}, fmt.Sprintf("%d %d %d", count, len(buf), gen)...)
+		if err := s.set(&memcache.Item{
+			Key: key, Value: manifest, Flags: flags, Expiration: exp,
+		}); err != nil {
+			return err
+		}
+	}
+	if blob.Meta != nil {
+		if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
+			return s.set(&memcache.Item{
+				Key: key + metaSuffix, Value: buf, Flags: flags, Expiration: exp,
+			})
+		}
+	}
+	return nil
+}
+
+func (s *MemcachedStorage) Delete(_ context.Context, image string) error {
+	key := s.Key(image)
+	if err := s.delete(key); err != nil && err != imagor.ErrNotFound {
+		return err
+	}
+	if err := s.delete(key + metaSuffix); err != nil && err != imagor.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Health checks if memcached server is reachable
+func (s *MemcachedStorage) Health(_ context.Context) error {
+	return do(s.client.Ping)
+}
+
+func (s *MemcachedStorage) Stat(_ context.Context, image string) (*imagor.Stat, error) {
+	it, err := s.get(s.Key(image))
+	if err != nil {
+		return nil, err
+	}
+	if len(it.Value) == 0 {
+		return nil, imagor.ErrNotFound
+	}
+	stat := &imagor.Stat{
+		Size:         int64(len(it.Value) - 1),
+		ModifiedTime: time.Unix(int64(it.Flags), 0),
+	}
+	if it.Value[0] == valueChunked {
+		var count int
+		if _, err := fmt.Sscanf(string(it.Value[1:]), "%d %d", &count, &stat.Size); err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
+}
+
+func (s *MemcachedStorage) Meta(_ context.Context, image string) (*imagor.Meta, error) {
+	it, err := s.get(s.Key(image) + metaSuffix)
+	if err != nil {
+		return nil, err
+	}
+	meta := &imagor.Meta{}
+	if err := json.Unmarshal(it.Value, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,226 @@
+package memcachedstorage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type item struct {
+	Value []byte
+	Flags uint32
+}
+
+// fakeServer minimal in-memory memcached server
+type fakeServer struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	items   map[string]item
+	conns   map[net.Conn]bool
+	maxSize int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{ln: ln, items: map[string]item{}, conns: map[net.Conn]bool{}, maxSize: 1000}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[c] = true
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	return s
+}
+
+// closeConns closes all client connections, as if server restarted
+func (s *fakeServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		_ = c.Close()
+		delete(s.conns, c)
+	}
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		s.mu.Lock()
+		switch fields[0] {
+		case "get", "gets":
+			if it, ok := s.items[fields[1]]; ok {
+				_, _ = fmt.Fprintf(c, "VALUE %s %d %d\r\n%s\r\n", fields[1], it.Flags, len(it.Value), it.Value)
+			}
+			_, _ = fmt.Fprint(c, "END\r\n")
+		case "set":
+			flags, _ := strconv.Atoi(fields[2])
+			size, _ := strconv.Atoi(fields[4])
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				s.mu.Unlock()
+				return
+			}
+			if size > s.maxSize {
+				_, _ = fmt.Fprint(c, "SERVER_ERROR object too large for cache\r\n")
+			} else {
+				s.items[fields[1]] = item{Value: buf[:size], Flags: uint32(flags)}
+				_, _ = fmt.Fprint(c, "STORED\r\n")
+			}
+		case "delete":
+			if _, ok := s.items[fields[1]]; ok {
+				delete(s.items, fields[1])
+				_, _ = fmt.Fprint(c, "DELETED\r\n")
+			} else {
+				_, _ = fmt.Fprint(c, "NOT_FOUND\r\n")
+			}
+		case "version":
+			_, _ = fmt.Fprint(c, "VERSION 1.6.0\r\n")
+		default:
+			_, _ = fmt.Fprint(c, "ERROR\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestMemcachedStorage_Key(t *testing.T) {
+	s := New("localhost:11211", WithPrefix("imagor:"))
+	assert.Equal(t, "imagor:fit-in/100x100/foo.jpg", s.Key("fit-in/100x100/foo.jpg"))
+	assert.Equal(t, "imagor:3773dea65156909838fa6c22825cafe090ff8030", s.Key("foo bar"))
+	assert.Len(t, s.Key(strings.Repeat("a", 300)), 47)
+}
+
+func TestMemcachedStorage(t *testing.T) {
+	srv := newFakeServer(t)
+	ctx := context.Background()
+	r := &http.Request{}
+	s := New(srv.ln.Addr().String(), WithChunkSize(100), WithMaxChunks(5), WithTTL(time.Hour))
+
+	t.Run("CRUD", func(t *testing.T) {
+		_, err := s.Get(r, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Stat(ctx, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Meta(ctx, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+
+		blob := imagor.NewBlobFromBytes([]byte("bar"))
+		blob.Meta = &imagor.Meta{Format: "png", Width: 10, Height: 20}
+		require.NoError(t, s.Put(ctx, "foo/bar", blob))
+
+		b, err := s.Get(r, "foo/bar")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+
+		stat, err := s.Stat(ctx, "foo/bar")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stat.Size)
+		assert.WithinDuration(t, time.Now(), stat.ModifiedTime, time.Minute)
+
+		meta, err := s.Meta(ctx, "foo/bar")
+		require.NoError(t, err)
+		assert.Equal(t, blob.Meta, meta)
+
+		require.NoError(t, s.Delete(ctx, "foo/bar"))
+		require.NoError(t, s.Delete(ctx, "foo/bar"))
+		_, err = s.Get(r, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		large := bytes.Repeat([]byte("0123456789"), 45)
+		require.NoError(t, s.Put(ctx, "large", imagor.NewBlobFromBytes(large)))
+		srv.mu.Lock()
+		assert.Len(t, srv.items, 6)
+		srv.mu.Unlock()
+
+		b, err := s.Get(r, "large")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, large, buf)
+
+		stat, err := s.Stat(ctx, "large")
+		require.NoError(t, err)
+		assert.Equal(t, int64(450), stat.Size)
+
+		// evict a chunk
+		srv.mu.Lock()
+		for key := range srv.items {
+			if strings.HasSuffix(key, ":2") {
+				delete(srv.items, key)
+			}
+		}
+		srv.mu.Unlock()
+		_, err = s.Get(r, "large")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("exceeds max chunks", func(t *testing.T) {
+		require.NoError(t, s.Put(ctx, "huge", imagor.NewBlobFromBytes(make([]byte, 501))))
+		_, err := s.Get(r, "huge")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		s := New(srv.ln.Addr().String(), WithChunkSize(2000))
+		err := s.Put(ctx, "too-large", imagor.NewBlobFromBytes(make([]byte, 1500)))
+		assert.ErrorContains(t, err, "object too large")
+		// connection remains usable after server error
+		require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+	})
+
+	t.Run("reconnect stale connections", func(t *testing.T) {
+		s := New(srv.ln.Addr().String())
+		require.NoError(t, s.Health(ctx))
+		require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+		srv.closeConns()
+		b, err := s.Get(r, "foo")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+		srv.closeConns()
+		require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("baz"))))
+		srv.closeConns()
+		require.NoError(t, s.Delete(ctx, "foo"))
+	})
+
+	t.Run("health", func(t *testing.T) {
+		require.NoError(t, New(srv.ln.Addr().String()).Health(ctx))
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+		assert.Error(t, New(addr).Health(ctx))
+	})
+}
@@ -0,0 +1,51 @@
+package memcachedstorage
+
+import "time"
+
+type Option func(s *MemcachedStorage)
+
+func WithPrefix(prefix string) Option {
+	return func(s *MemcachedStorage) {
+		s.Prefix = prefix
+	}
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(s *MemcachedStorage) {
+		if ttl > 0 {
+			s.TTL = ttl
+		}
+	}
+}
+
+func WithChunkSize(size int) Option {
+	return func(s *MemcachedStorage) {
+		if size > 0 {
+			s.ChunkSize = size
+		}
+	}
+}
+
+func WithMaxChunks(n int) Option {
+	return func(s *MemcachedStorage) {
+		if n > 0 {
+			s.MaxChunks = n
+		}
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *MemcachedStorage) {
+		if timeout > 0 {
+			s.Timeout = timeout
+		}
+	}
+}
+
+func WithMaxIdleConns(n int) Option {
+	return func(s *MemcachedStorage) {
+		if n >= 0 {
+			s.MaxIdleConns = n
+		}
+	}
+}
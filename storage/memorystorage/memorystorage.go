@@ -0,0 +1,147 @@
+package memorystorage
+
+import (
+	"container/list"
+	"context"
+	"github.com/cshum/imagor"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key          string
+	buf          []byte
+	meta         *imagor.Meta
+	modifiedTime time.Time
+}
+
+// MemoryStorage in-process LRU storage bounded by total bytes,
+// for caching results in front of other result storages
+type MemoryStorage struct {
+	MaxSize     int64
+	MaxItemSize int64
+	Expiration  time.Duration
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func New(options ...Option) *MemoryStorage {
+	s := &MemoryStorage{
+		MaxSize:     64 << 20,
+		MaxItemSize: 1 << 20,
+		ll:          list.New(),
+		items:       map[string]*list.Element{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// get returns entry and marks it as recently used
+func (s *MemoryStorage) get(key string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, imagor.ErrNotFound
+	}
+	e := el.Value.(*entry)
+	if s.Expiration > 0 && time.Now().Sub(e.modifiedTime) > s.Expiration {
+		s.remove(el)
+		return nil, imagor.ErrExpired
+	}
+	s.ll.MoveToFront(el)
+	return e, nil
+}
+
+func (s *MemoryStorage) remove(el *list.Element) {
+	e := s.ll.Remove(el).(*entry)
+	delete(s.items, e.key)
+	s.size -= int64(len(e.buf))
+}
+
+func (s *MemoryStorage) Get(_ *http.Request, key string) (*imagor.Blob, error) {
+	e, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return imagor.NewBlobFromBytes(e.buf), nil
+}
+
+func (s *MemoryStorage) Put(_ context.Context, key string, blob *imagor.Blob) error {
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return err
+	}
+	size := int64(len(buf))
+	if size > s.MaxItemSize || size > s.MaxSize {
+		// skip caching blobs exceeding max item size
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	s.items[key] = s.ll.PushFront(&entry{
+		key:          key,
+		buf:          buf,
+		meta:         blob.Meta,
+		modifiedTime: time.Now(),
+	})
+	s.size += size
+	for s.size > s.MaxSize {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Stat(_ context.Context, key string) (*imagor.Stat, error) {
+	e, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return &imagor.Stat{
+		Size:         int64(len(e.buf)),
+		ModifiedTime: e.modifiedTime,
+	}, nil
+}
+
+func (s *MemoryStorage) Meta(_ context.Context, key string) (*imagor.Meta, error) {
+	e, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if e.meta == nil {
+		return nil, imagor.ErrNotFound
+	}
+	return e.meta, nil
+}
+
+// Size returns total bytes of cached items
+func (s *MemoryStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Len returns number of cached items
+func (s *MemoryStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
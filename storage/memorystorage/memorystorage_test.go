@@ -0,0 +1,83 @@
+package memorystorage
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	r := &http.Request{}
+
+	t.Run("CRUD", func(t *testing.T) {
+		s := New()
+		_, err := s.Get(r, "foo")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Stat(ctx, "foo")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Meta(ctx, "foo")
+		assert.Equal(t, imagor.ErrNotFound, err)
+
+		blob := imagor.NewBlobFromBytes([]byte("bar"))
+		blob.Meta = &imagor.Meta{Format: "png", Width: 10, Height: 20}
+		require.NoError(t, s.Put(ctx, "foo", blob))
+
+		b, err := s.Get(r, "foo")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+
+		stat, err := s.Stat(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stat.Size)
+
+		meta, err := s.Meta(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, blob.Meta, meta)
+
+		require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("barbar"))))
+		assert.Equal(t, int64(6), s.Size())
+		assert.Equal(t, 1, s.Len())
+
+		require.NoError(t, s.Delete(ctx, "foo"))
+		_, err = s.Get(r, "foo")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		assert.Equal(t, int64(0), s.Size())
+	})
+
+	t.Run("evict least recently used", func(t *testing.T) {
+		s := New(WithMaxSize(10), WithMaxItemSize(5))
+		require.NoError(t, s.Put(ctx, "a", imagor.NewBlobFromBytes([]byte("aaaa"))))
+		require.NoError(t, s.Put(ctx, "b", imagor.NewBlobFromBytes([]byte("bbbb"))))
+		_, err := s.Get(r, "a")
+		require.NoError(t, err)
+		require.NoError(t, s.Put(ctx, "c", imagor.NewBlobFromBytes([]byte("cccc"))))
+
+		_, err = s.Get(r, "b")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Get(r, "a")
+		assert.NoError(t, err)
+		_, err = s.Get(r, "c")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), s.Size())
+
+		require.NoError(t, s.Put(ctx, "d", imagor.NewBlobFromBytes([]byte("dddddd"))))
+		_, err = s.Get(r, "d")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		s := New(WithExpiration(time.Millisecond))
+		require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+		time.Sleep(time.Millisecond * 10)
+		_, err := s.Get(r, "foo")
+		assert.Equal(t, imagor.ErrExpired, err)
+		assert.Equal(t, 0, s.Len())
+	})
+}
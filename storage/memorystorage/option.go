@@ -0,0 +1,29 @@
+package memorystorage
+
+import "time"
+
+type Option func(s *MemoryStorage)
+
+func WithMaxSize(size int64) Option {
+	return func(s *MemoryStorage) {
+		if size > 0 {
+			s.MaxSize = size
+		}
+	}
+}
+
+func WithMaxItemSize(size int64) Option {
+	return func(s *MemoryStorage) {
+		if size > 0 {
+			s.MaxItemSize = size
+		}
+	}
+}
+
+func WithExpiration(exp time.Duration) Option {
+	return func(s *MemoryStorage) {
+		if exp > 0 {
+			s.Expiration = exp
+		}
+	}
+}
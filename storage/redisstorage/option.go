@@ -0,0 +1,57 @@
+package redisstorage
+
+import "time"
+
+type Option func(s *RedisStorage)
+
+func WithPassword(password string) Option {
+	return func(s *RedisStorage) {
+		s.Password = password
+	}
+}
+
+func WithDB(db int) Option {
+	return func(s *RedisStorage) {
+		if db >= 0 {
+			s.DB = db
+		}
+	}
+}
+
+func WithPrefix(prefix string) Option {
+	return func(s *RedisStorage) {
+		s.Prefix = prefix
+	}
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(s *RedisStorage) {
+		if ttl > 0 {
+			s.TTL = ttl
+		}
+	}
+}
+
+func WithMaxSize(size int64) Option {
+	return func(s *RedisStorage) {
+		if size > 0 {
+			s.MaxSize = size
+		}
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *RedisStorage) {
+		if timeout > 0 {
+			s.Timeout = timeout
+		}
+	}
+}
+
+func WithMaxIdleConns(n int) Option {
+	return func(s *RedisStorage) {
+		if n >= 0 {
+			s.MaxIdleConns = n
+		}
+	}
+}
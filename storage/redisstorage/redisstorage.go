@@ -0,0 +1,136 @@
+package redisstorage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/cshum/imagor"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"time"
+)
+
+// headerSize size of modified time header prepended to stored values
+const headerSize = 8
+
+const metaSuffix = ":meta"
+
+type RedisStorage struct {
+	Addr         string
+	Password     string
+	DB           int
+	Prefix       string
+	TTL          time.Duration
+	MaxSize      int64
+	Timeout      time.Duration
+	MaxIdleConns int
+
+	client *redis.Client
+}
+
+func New(addr string, options ...Option) *RedisStorage {
+	s := &RedisStorage{
+		Addr:         addr,
+		Timeout:      time.Second * 5,
+		MaxIdleConns: 10,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.client = redis.NewClient(&redis.Options{
+		Addr:         s.Addr,
+		Password:     s.Password,
+		DB:           s.DB,
+		DialTimeout:  s.Timeout,
+		ReadTimeout:  s.Timeout,
+		WriteTimeout: s.Timeout,
+		MaxIdleConns: s.MaxIdleConns,
+		// deadlines of request context are respected
+		ContextTimeoutEnabled: true,
+	})
+	return s
+}
+
+func wrapErr(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return imagor.ErrNotFound
+	}
+	return err
+}
+
+func (s *RedisStorage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	buf, err := s.client.Get(r.Context(), s.Prefix+image).Bytes()
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	if len(buf) < headerSize {
+		return nil, imagor.ErrNotFound
+	}
+	return imagor.NewBlobFromBytes(buf[headerSize:]), nil
+}
+
+func (s *RedisStorage) Put(ctx context.Context, image string, blob *imagor.Blob) error {
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return err
+	}
+	if s.MaxSize > 0 && int64(len(buf)) > s.MaxSize {
+		// skip caching blobs exceeding max value size
+		return nil
+	}
+	value := make([]byte, headerSize, headerSize+len(buf))
+	binary.BigEndian.PutUint64(value, uint64(time.Now().UnixNano()))
+	if err := s.client.Set(ctx, s.Prefix+image, append(value, buf...), s.TTL).Err(); err != nil {
+		return err
+	}
+	if blob.Meta != nil {
+		if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
+			return s.client.Set(ctx, s.Prefix+image+metaSuffix, buf, s.TTL).Err()
+		}
+	}
+	return nil
+}
+
+func (s *RedisStorage) Delete(ctx context.Context, image string) error {
+	return s.client.Del(ctx, s.Prefix+image, s.Prefix+image+metaSuffix).Err()
+}
+
+// Health pings redis server
+func (s *RedisStorage) Health(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *RedisStorage) Stat(ctx context.Context, image string) (*imagor.Stat, error) {
+	key := s.Prefix + image
+	var header *redis.StringCmd
+	var size *redis.IntCmd
+	if _, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		header = pipe.GetRange(ctx, key, 0, headerSize-1)
+		size = pipe.StrLen(ctx, key)
+		return nil
+	}); err != nil {
+		return nil, wrapErr(err)
+	}
+	buf, _ := header.Bytes()
+	if len(buf) < headerSize {
+		// GETRANGE replies empty string for missing key
+		return nil, imagor.ErrNotFound
+	}
+	return &imagor.Stat{
+		Size:         size.Val() - headerSize,
+		ModifiedTime: time.Unix(0, int64(binary.BigEndian.Uint64(buf))),
+	}, nil
+}
+
+func (s *RedisStorage) Meta(ctx context.Context, image string) (*imagor.Meta, error) {
+	buf, err := s.client.Get(ctx, s.Prefix+image+metaSuffix).Bytes()
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	meta := &imagor.Meta{}
+	if err := json.Unmarshal(buf, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
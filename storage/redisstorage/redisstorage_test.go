@@ -0,0 +1,97 @@
+package redisstorage
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRedisStorage(t *testing.T) {
+	srv := miniredis.RunT(t)
+	srv.RequireAuth("secret")
+	ctx := context.Background()
+	r := &http.Request{}
+
+	t.Run("auth failed", func(t *testing.T) {
+		s := New(srv.Addr(), WithPassword("wrong"))
+		_, err := s.Stat(ctx, "foo")
+		assert.Error(t, err)
+		assert.NotEqual(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("CRUD", func(t *testing.T) {
+		s := New(srv.Addr(), WithPassword("secret"), WithDB(1), WithPrefix("imagor:"))
+		require.NoError(t, s.Health(ctx))
+
+		_, err := s.Get(r, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Stat(ctx, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Meta(ctx, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+
+		blob := imagor.NewBlobFromBytes([]byte("bar"))
+		blob.Meta = &imagor.Meta{Format: "png", Width: 10, Height: 20}
+		require.NoError(t, s.Put(ctx, "foo/bar", blob))
+		srv.Select(1)
+		assert.True(t, srv.Exists("imagor:foo/bar"))
+
+		b, err := s.Get(r, "foo/bar")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+
+		stat, err := s.Stat(ctx, "foo/bar")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stat.Size)
+		assert.WithinDuration(t, time.Now(), stat.ModifiedTime, time.Minute)
+
+		meta, err := s.Meta(ctx, "foo/bar")
+		require.NoError(t, err)
+		assert.Equal(t, blob.Meta, meta)
+
+		require.NoError(t, s.Delete(ctx, "foo/bar"))
+		_, err = s.Get(r, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Meta(ctx, "foo/bar")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		s := New(srv.Addr(), WithPassword("secret"), WithMaxSize(2))
+		require.NoError(t, s.Put(ctx, "large", imagor.NewBlobFromBytes([]byte("bar"))))
+		_, err := s.Get(r, "large")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		s := New(srv.Addr(), WithPassword("secret"), WithTTL(time.Minute))
+		require.NoError(t, s.Put(ctx, "ttl", imagor.NewBlobFromBytes([]byte("bar"))))
+		srv.FastForward(time.Minute * 2)
+		_, err := s.Get(r, "ttl")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		s := New(srv.Addr(), WithPassword("secret"))
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := s.Get(r.WithContext(ctx), "foo")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		s := New(srv.Addr(), WithPassword("secret"))
+		require.NoError(t, s.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+		// server restart drops pooled connections
+		srv.Restart()
+		_, err := s.Get(r, "foo")
+		assert.NoError(t, err)
+	})
+}
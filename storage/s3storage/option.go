@@ -2,6 +2,7 @@ package s3storage
 
 import (
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"strings"
 	"time"
 )
@@ -48,6 +49,14 @@ func WithACL(acl string) Option {
 	}
 }
 
+// WithoutACL omits ACL of uploaded objects,
+// for S3 compatibles that do not support ACL e.g. Cloudflare R2
+func WithoutACL() Option {
+	return func(h *S3Storage) {
+		h.ACL = ""
+	}
+}
+
 func WithSafeChars(chars string) Option {
 	return func(h *S3Storage) {
 		if chars != "" {
@@ -63,3 +72,46 @@ func WithExpiration(exp time.Duration) Option {
 		}
 	}
 }
+
+func WithPublicURL(publicURL string) Option {
+	return func(h *S3Storage) {
+		if publicURL != "" {
+			h.PublicURL = strings.TrimSuffix(publicURL, "/")
+		}
+	}
+}
+
+func WithPresignExpiration(exp time.Duration) Option {
+	return func(h *S3Storage) {
+		if exp > 0 {
+			h.PresignExpiration = exp
+		}
+	}
+}
+
+// WithMultipartThreshold size in bytes from which objects are uploaded by multipart upload
+func WithMultipartThreshold(size int64) Option {
+	return func(h *S3Storage) {
+		if size > 0 {
+			h.MultipartThreshold = size
+		}
+	}
+}
+
+// WithMultipartPartSize part size in bytes of multipart upload, minimum 5MB
+func WithMultipartPartSize(size int64) Option {
+	return func(h *S3Storage) {
+		if size >= s3manager.MinUploadPartSize {
+			h.MultipartPartSize = size
+		}
+	}
+}
+
+// WithMultipartConcurrency number of parts uploaded concurrently per multipart upload
+func WithMultipartConcurrency(n int) Option {
+	return func(h *S3Storage) {
+		if n > 0 {
+			h.MultipartConcurrency = n
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package s3storage
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,6 +13,7 @@ import (
 	"github.com/cshum/imagor/imagorpath"
 	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
@@ -29,6 +31,13 @@ type S3Storage struct {
 	SafeChars  string
 	Expiration time.Duration
 
+	MultipartThreshold   int64
+	MultipartPartSize    int64
+	MultipartConcurrency int
+
+	PublicURL         string
+	PresignExpiration time.Duration
+
 	safeChars imagorpath.SafeChars
 }
 
@@ -48,6 +57,12 @@ func New(sess *session.Session, bucket string, options ...Option) *S3Storage {
 		BaseDir:    baseDir,
 		PathPrefix: "/",
 		ACL:        s3.ObjectCannedACLPublicRead,
+
+		MultipartThreshold:   s3manager.DefaultUploadPartSize,
+		MultipartPartSize:    s3manager.DefaultUploadPartSize,
+		MultipartConcurrency: s3manager.DefaultUploadConcurrency,
+
+		PresignExpiration: time.Minute * 15,
 	}
 	for _, option := range options {
 		option(s)
@@ -100,7 +115,7 @@ func (s *S3Storage) Put(ctx context.Context, image string, blob *imagor.Blob) er
 	if !ok {
 		return imagor.ErrInvalid
 	}
-	reader, _, err := blob.NewReader()
+	reader, size, err := blob.NewReader()
 	if err != nil {
 		return err
 	}
@@ -115,15 +130,40 @@ func (s *S3Storage) Put(ctx context.Context, image string, blob *imagor.Blob) er
 			}
 		}
 	}
-	input := &s3manager.UploadInput{
-		ACL:         aws.String(s.ACL),
+	var acl *string
+	if s.ACL != "" {
+		// S3 compatibles such as Cloudflare R2 do not support ACL
+		acl = aws.String(s.ACL)
+	}
+	if size > 0 && size < s.MultipartThreshold {
+		// small object uploaded by single request
+		buf, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		_, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			ACL:         acl,
+			Body:        bytes.NewReader(buf),
+			Bucket:      aws.String(s.Bucket),
+			ContentType: aws.String(blob.ContentType()),
+			Metadata:    metadata,
+			Key:         aws.String(image),
+		})
+		return err
+	}
+	// large or unknown size object streamed from blob reader by multipart upload,
+	// buffering at most concurrency number of parts in memory
+	_, err = s.Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		ACL:         acl,
 		Body:        reader,
 		Bucket:      aws.String(s.Bucket),
 		ContentType: aws.String(blob.ContentType()),
 		Metadata:    metadata,
 		Key:         aws.String(image),
-	}
-	_, err = s.Uploader.UploadWithContext(ctx, input)
+	}, func(u *s3manager.Uploader) {
+		u.PartSize = s.MultipartPartSize
+		u.Concurrency = s.MultipartConcurrency
+	})
 	return err
 }
 
@@ -139,6 +179,25 @@ func (s *S3Storage) Delete(ctx context.Context, image string) error {
 	return err
 }
 
+// URL returns URL of the image object, which can be used for redirecting clients
+// to the storage directly. Returns public URL if PublicURL is set,
+// otherwise presigned URL valid for PresignExpiration
+func (s *S3Storage) URL(ctx context.Context, image string) (string, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return "", imagor.ErrInvalid
+	}
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + strings.TrimPrefix(image, "/"), nil
+	}
+	req, _ := s.S3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(image),
+	})
+	req.SetContext(ctx)
+	return req.Presign(s.PresignExpiration)
+}
+
 func (s *S3Storage) head(ctx context.Context, image string) (*s3.HeadObjectOutput, error) {
 	image, ok := s.Path(image)
 	if !ok {
@@ -149,7 +208,8 @@ func (s *S3Storage) head(ctx context.Context, image string) (*s3.HeadObjectOutpu
 		Key:    aws.String(image),
 	}
 	head, err := s.S3.HeadObjectWithContext(ctx, input)
-	if e, ok := err.(awserr.Error); ok && e.Code() == s3.ErrCodeNoSuchKey {
+	// HEAD responses have no body, such that missing key is reported as NotFound instead of NoSuchKey
+	if e, ok := err.(awserr.Error); ok && (e.Code() == s3.ErrCodeNoSuchKey || e.Code() == "NotFound") {
 		return nil, imagor.ErrNotFound
 	} else if err != nil {
 		return nil, err
@@ -157,6 +217,19 @@ func (s *S3Storage) head(ctx context.Context, image string) (*s3.HeadObjectOutpu
 	return head, nil
 }
 
+// Expired reports whether object of stat is older than expiration
+func (s *S3Storage) Expired(stat *imagor.Stat) bool {
+	return s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration
+}
+
+// Health checks if bucket exists and is accessible
+func (s *S3Storage) Health(ctx context.Context) error {
+	_, err := s.S3.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.Bucket),
+	})
+	return err
+}
+
 func (s *S3Storage) Stat(ctx context.Context, image string) (stat *imagor.Stat, err error) {
 	head, err := s.head(ctx, image)
 	if err != nil {
@@ -165,6 +238,7 @@ func (s *S3Storage) Stat(ctx context.Context, image string) (stat *imagor.Stat,
 	return &imagor.Stat{
 		Size:         *head.ContentLength,
 		ModifiedTime: *head.LastModified,
+		ETag:         aws.StringValue(head.ETag),
 	}, nil
 }
 
@@ -187,3 +261,45 @@ func (s *S3Storage) Meta(ctx context.Context, image string) (meta *imagor.Meta,
 	}
 	return meta, nil
 }
+
+func (s *S3Storage) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	full, ok := s.Path(prefix)
+	if dir := "/" + strings.Trim(prefix, "/"); strings.HasPrefix(s.PathPrefix, strings.TrimSuffix(dir, "/")+"/") {
+		// prefix covers the whole path prefix
+		full, ok = s.BaseDir, true
+	}
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	baseDir := strings.Trim(s.BaseDir, "/")
+	var fnErr error
+	err := s.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(strings.TrimPrefix(full, "/")),
+	}, func(out *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range out.Contents {
+			if obj.Key == nil {
+				continue
+			}
+			rel := strings.TrimPrefix(*obj.Key, "/")
+			if baseDir != "" {
+				if !strings.HasPrefix(rel, baseDir+"/") {
+					continue
+				}
+				rel = strings.TrimPrefix(rel, baseDir+"/")
+			}
+			key, err := url.QueryUnescape(s.PathPrefix + rel)
+			if err != nil {
+				continue
+			}
+			if fnErr = fn(strings.TrimPrefix(key, "/")); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
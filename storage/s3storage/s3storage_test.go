@@ -1,18 +1,22 @@
 package s3storage
 
 import (
+	"bytes"
 	"context"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/cshum/imagor"
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -201,12 +205,51 @@ func TestCRUD(t *testing.T) {
 	_, err = b.ReadAll()
 	assert.Equal(t, imagor.ErrNotFound, err)
 
+	_, err = s.Stat(ctx, "/foo/fooo/asdf")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
 	require.NoError(t, s.Put(ctx, "/foo/boo/asdf", imagor.NewBlobFromBytes([]byte("bar"))))
 
 	_, err = s.Meta(context.Background(), "/foo/boo/asdf")
 	assert.Equal(t, imagor.ErrNotFound, err)
 }
 
+func TestACL(t *testing.T) {
+	sess, err := session.NewSession()
+	require.NoError(t, err)
+	assert.Equal(t, s3.ObjectCannedACLPublicRead, New(sess, "test").ACL)
+	assert.Equal(t, s3.ObjectCannedACLPublicRead, New(sess, "test", WithACL("")).ACL)
+	assert.Equal(t, s3.ObjectCannedACLPublicRead, New(sess, "test", WithACL("foo")).ACL)
+	assert.Equal(t, s3.ObjectCannedACLPrivate, New(sess, "test", WithACL("private")).ACL)
+	assert.Equal(t, "", New(sess, "test", WithoutACL()).ACL)
+}
+
+func TestURL(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	ctx := context.Background()
+	s := New(fakeS3Session(ts, "test"), "test", WithPathPrefix("/foo"), WithPresignExpiration(time.Hour))
+	_, err := s.URL(ctx, "/bar/abc.jpg")
+	assert.Equal(t, imagor.ErrInvalid, err)
+
+	require.NoError(t, s.Put(ctx, "/foo/abc.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	u, err := s.URL(ctx, "/foo/abc.jpg")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, ts.URL+"/test/"))
+	assert.Contains(t, u, "X-Amz-Expires=3600")
+	resp, err := http.Get(u)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	s = New(fakeS3Session(ts, "test2"), "test2", WithPublicURL("https://pub.example.com/"))
+	u, err = s.URL(ctx, "/abc.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "https://pub.example.com/abc.jpg", u)
+}
+
 func TestExpiration(t *testing.T) {
 	ts := fakeS3Server()
 	defer ts.Close()
@@ -243,3 +286,60 @@ func TestExpiration(t *testing.T) {
 	_, err = s.Meta(context.Background(), "/foo/bar/asdf")
 	require.ErrorIs(t, err, imagor.ErrExpired)
 }
+
+func TestList(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	ctx := context.Background()
+	s := New(fakeS3Session(ts, "test"), "test", WithPathPrefix("/foo"), WithBaseDir("images"))
+	require.NoError(t, s.Put(ctx, "/foo/a/b:c.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	require.NoError(t, s.Put(ctx, "/foo/d.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	var keys []string
+	require.NoError(t, s.List(ctx, "", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/a/b:c.jpg", "foo/d.jpg"}, keys)
+
+	keys = nil
+	require.NoError(t, s.List(ctx, "/foo/a", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo/a/b:c.jpg"}, keys)
+}
+
+func TestMultipart(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	ctx := context.Background()
+	s := New(fakeS3Session(ts, "test"), "test",
+		WithMultipartThreshold(1024), WithMultipartPartSize(1024), WithMultipartConcurrency(2))
+	assert.Equal(t, int64(1024), s.MultipartThreshold)
+	assert.Equal(t, int64(s3manager.DefaultUploadPartSize), s.MultipartPartSize)
+	assert.Equal(t, 2, s.MultipartConcurrency)
+
+	buf := bytes.Repeat([]byte("a"), 6<<20)
+	blob := imagor.NewBlobFromBytes(buf)
+	blob.Meta = &imagor.Meta{Format: "tiff", Width: 167, Height: 169}
+	require.NoError(t, s.Put(ctx, "/large", blob))
+	require.NoError(t, s.Put(ctx, "/small", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	b, err := s.Get(&http.Request{}, "/large")
+	require.NoError(t, err)
+	res, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), len(res))
+	meta, err := s.Meta(ctx, "/large")
+	require.NoError(t, err)
+	assert.Equal(t, blob.Meta, meta)
+
+	b, err = s.Get(&http.Request{}, "/small")
+	require.NoError(t, err)
+	res, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(res))
+}
@@ -0,0 +1,86 @@
+package sftpstorage
+
+import (
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"time"
+)
+
+type Option func(h *SFTPStorage)
+
+func WithCredentials(username, password string) Option {
+	return func(s *SFTPStorage) {
+		s.Username = username
+		s.Password = password
+	}
+}
+
+// WithPrivateKey PEM encoded private key for public key authentication
+func WithPrivateKey(key []byte) Option {
+	return func(s *SFTPStorage) {
+		if len(key) > 0 {
+			s.PrivateKey = key
+		}
+	}
+}
+
+// WithHostKeyCallback verifies server host key, connections are refused if not set
+func WithHostKeyCallback(cb ssh.HostKeyCallback) Option {
+	return func(s *SFTPStorage) {
+		if cb != nil {
+			s.HostKeyCallback = cb
+		}
+	}
+}
+
+func WithBaseDir(baseDir string) Option {
+	return func(s *SFTPStorage) {
+		if baseDir != "" {
+			s.BaseDir = "/" + strings.Trim(baseDir, "/")
+		}
+	}
+}
+
+func WithPathPrefix(prefix string) Option {
+	return func(s *SFTPStorage) {
+		if prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/")
+			if prefix != "/" {
+				prefix += "/"
+			}
+			s.PathPrefix = prefix
+		}
+	}
+}
+
+func WithSafeChars(chars string) Option {
+	return func(s *SFTPStorage) {
+		if chars != "" {
+			s.SafeChars = chars
+		}
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SFTPStorage) {
+		if timeout > 0 {
+			s.Timeout = timeout
+		}
+	}
+}
+
+func WithMaxIdleConns(n int) Option {
+	return func(s *SFTPStorage) {
+		if n >= 0 {
+			s.MaxIdleConns = n
+		}
+	}
+}
+
+func WithExpiration(exp time.Duration) Option {
+	return func(s *SFTPStorage) {
+		if exp > 0 {
+			s.Expiration = exp
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package sftpstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type SFTPStorage struct {
+	Addr            string
+	Username        string
+	Password        string
+	PrivateKey      []byte
+	HostKeyCallback ssh.HostKeyCallback
+	BaseDir         string
+	PathPrefix      string
+	SafeChars       string
+	Timeout         time.Duration
+	MaxIdleConns    int
+	Expiration      time.Duration
+
+	safeChars imagorpath.SafeChars
+	idle      chan *conn
+}
+
+// conn SFTP session over SSH connection
+type conn struct {
+	*sftp.Client
+	ssh *ssh.Client
+}
+
+func (c *conn) Close() error {
+	_ = c.Client.Close()
+	return c.ssh.Close()
+}
+
+func New(addr string, options ...Option) *SFTPStorage {
+	s := &SFTPStorage{
+		Addr:         addr,
+		BaseDir:      "/",
+		PathPrefix:   "/",
+		Timeout:      time.Second * 30,
+		MaxIdleConns: 4,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.safeChars = imagorpath.NewSafeChars(s.SafeChars)
+	s.idle = make(chan *conn, s.MaxIdleConns)
+	return s
+}
+
+func (s *SFTPStorage) Path(image string) (string, bool) {
+	image = path.Clean("/" + imagorpath.Normalize(image, s.safeChars))
+	if !strings.HasPrefix(image, s.PathPrefix) {
+		return "", false
+	}
+	return path.Join(s.BaseDir, strings.TrimPrefix(image, s.PathPrefix)), true
+}
+
+func (s *SFTPStorage) dial() (*conn, error) {
+	var auth []ssh.AuthMethod
+	if len(s.PrivateKey) > 0 {
+		signer, err := ssh.ParsePrivateKey(s.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.Password != "" {
+		auth = append(auth, ssh.Password(s.Password))
+	}
+	sshClient, err := ssh.Dial("tcp", s.Addr, &ssh.ClientConfig{
+		User:            s.Username,
+		Auth:            auth,
+		HostKeyCallback: s.HostKeyCallback,
+		Timeout:         s.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, err
+	}
+	return &conn{Client: client, ssh: sshClient}, nil
+}
+
+// acquire returns idle connection from pool if still alive, otherwise dials new connection
+func (s *SFTPStorage) acquire() (*conn, error) {
+	for {
+		select {
+		case c := <-s.idle:
+			if _, err := c.Getwd(); err != nil {
+				_ = c.Close()
+				continue
+			}
+			return c, nil
+		default:
+			return s.dial()
+		}
+	}
+}
+
+// release returns connection to pool unless it is broken or pool is full
+func (s *SFTPStorage) release(c *conn, err error) {
+	var statusErr *sftp.StatusError
+	if err != nil && !errors.As(err, &statusErr) && !errors.Is(err, os.ErrNotExist) {
+		_ = c.Close()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		_ = c.Close()
+	}
+}
+
+func (s *SFTPStorage) do(fn func(c *conn) error) error {
+	c, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	err = fn(c)
+	s.release(c, err)
+	return wrapErr(err)
+}
+
+func wrapErr(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return imagor.ErrNotFound
+	}
+	return err
+}
+
+func (s *SFTPStorage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	stat, err := s.stat(image)
+	if err != nil {
+		return nil, err
+	}
+	if s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration {
+		return nil, imagor.ErrExpired
+	}
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		c, err := s.acquire()
+		if err != nil {
+			return nil, 0, err
+		}
+		file, err := c.Open(image)
+		if err != nil {
+			s.release(c, err)
+			return nil, 0, wrapErr(err)
+		}
+		return &releaseReader{ReadCloser: file, release: func(err error) {
+			s.release(c, err)
+		}}, stat.Size, nil
+	}), nil
+}
+
+type releaseReader struct {
+	io.ReadCloser
+	release func(err error)
+}
+
+func (r *releaseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.release(err)
+	return err
+}
+
+func (s *SFTPStorage) Put(_ context.Context, image string, blob *imagor.Blob) error {
+	image, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	reader, _, err := blob.NewReader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return s.do(func(c *conn) error {
+		if err := c.MkdirAll(path.Dir(image)); err != nil {
+			return err
+		}
+		if err := store(c, image, reader); err != nil {
+			return err
+		}
+		if blob.Meta != nil {
+			if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
+				return store(c, image+".meta.json", bytes.NewReader(buf))
+			}
+		}
+		return nil
+	})
+}
+
+func store(c *conn, name string, reader io.Reader) error {
+	file, err := c.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.ReadFrom(reader)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *SFTPStorage) Delete(_ context.Context, image string) error {
+	image, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	return s.do(func(c *conn) error {
+		return c.Remove(image)
+	})
+}
+
+func (s *SFTPStorage) Stat(_ context.Context, image string) (*imagor.Stat, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	return s.stat(image)
+}
+
+func (s *SFTPStorage) stat(image string) (stat *imagor.Stat, err error) {
+	err = s.do(func(c *conn) error {
+		info, err := c.Stat(image)
+		if err != nil {
+			return err
+		}
+		stat = &imagor.Stat{
+			Size:         info.Size(),
+			ModifiedTime: info.ModTime(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *SFTPStorage) Meta(_ context.Context, image string) (*imagor.Meta, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	key := image + ".meta.json"
+	if s.Expiration > 0 {
+		stat, err := s.stat(key)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().Sub(stat.ModifiedTime) > s.Expiration {
+			return nil, imagor.ErrExpired
+		}
+	}
+	var buf []byte
+	if err := s.do(func(c *conn) error {
+		file, err := c.Open(key)
+		if err != nil {
+			return err
+		}
+		buf, err = io.ReadAll(file)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	meta := &imagor.Meta{}
+	if err := json.Unmarshal(buf, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,208 @@
+package sftpstorage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/cshum/imagor"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer in-memory SFTP server over SSH with password authentication
+type fakeServer struct {
+	ln      net.Listener
+	hostKey ssh.PublicKey
+	mu      sync.Mutex
+	dials   int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "user" && string(password) == "pass" {
+				return nil, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{ln: ln, hostKey: signer.PublicKey()}
+	handlers := sftp.InMemHandler()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.dials++
+			s.mu.Unlock()
+			go s.serve(c, config, handlers)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	return s
+}
+
+func (s *fakeServer) serve(c net.Conn, config *ssh.ServerConfig, handlers sftp.Handlers) {
+	_, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for ch := range chans {
+		if ch.ChannelType() != "session" {
+			_ = ch.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					server := sftp.NewRequestServer(channel, handlers)
+					_ = server.Serve()
+					_ = server.Close()
+				}
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) dialCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+func newStorage(s *fakeServer, options ...Option) *SFTPStorage {
+	return New(s.ln.Addr().String(), append([]Option{
+		WithCredentials("user", "pass"),
+		WithHostKeyCallback(ssh.FixedHostKey(s.hostKey)),
+		WithTimeout(time.Second * 5),
+	}, options...)...)
+}
+
+func TestSFTPStorage_Path(t *testing.T) {
+	tests := []struct {
+		name         string
+		baseDir      string
+		prefix       string
+		image        string
+		expectedPath string
+		expectedOk   bool
+	}{
+		{name: "base dir", baseDir: "/home/imagor", image: "abc.jpg", expectedPath: "/home/imagor/abc.jpg", expectedOk: true},
+		{name: "path prefix", baseDir: "/home/imagor", prefix: "/foo", image: "foo/abc.jpg", expectedPath: "/home/imagor/abc.jpg", expectedOk: true},
+		{name: "prefix mismatch", baseDir: "/home/imagor", prefix: "/foo", image: "bar/abc.jpg"},
+		{name: "escape parent", baseDir: "/home/imagor", image: "../../etc/passwd", expectedPath: "/home/imagor/etc/passwd", expectedOk: true},
+		{name: "escape prefix", baseDir: "/home/imagor", prefix: "/foo", image: "foo/../bar/abc.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("example.com:22", WithBaseDir(tt.baseDir), WithPathPrefix(tt.prefix))
+			res, ok := s.Path(tt.image)
+			assert.Equal(t, tt.expectedOk, ok)
+			assert.Equal(t, tt.expectedPath, res)
+		})
+	}
+}
+
+func TestSFTPStorage(t *testing.T) {
+	srv := newFakeServer(t)
+	s := newStorage(srv, WithBaseDir("/home/imagor"), WithMaxIdleConns(1))
+	ctx := context.Background()
+	r := (&http.Request{}).WithContext(ctx)
+
+	_, err := s.Get(r, "foo/bar.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	blob := imagor.NewBlobFromBytes([]byte("bar"))
+	blob.Meta = &imagor.Meta{Format: "jpeg", Width: 10, Height: 20}
+	require.NoError(t, s.Put(ctx, "foo/bar.jpg", blob))
+
+	b, err := s.Get(r, "foo/bar.jpg")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	stat, err := s.Stat(ctx, "foo/bar.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stat.Size)
+	assert.False(t, stat.ModifiedTime.IsZero())
+
+	meta, err := s.Meta(ctx, "foo/bar.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, blob.Meta, meta)
+
+	// connections reused from pool
+	dials := srv.dialCount()
+	for i := 0; i < 5; i++ {
+		_, err := s.Stat(ctx, "foo/bar.jpg")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, dials, srv.dialCount())
+
+	require.NoError(t, s.Delete(ctx, "foo/bar.jpg"))
+	_, err = s.Get(r, "foo/bar.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+}
+
+func TestSFTPStorageExpiration(t *testing.T) {
+	srv := newFakeServer(t)
+	// SFTP file times are of second precision
+	s := newStorage(srv, WithExpiration(time.Second*2))
+	ctx := context.Background()
+	r := (&http.Request{}).WithContext(ctx)
+	require.NoError(t, s.Put(ctx, "foo.jpg", imagor.NewBlobFromBytes([]byte("foo"))))
+	b, err := s.Get(r, "foo.jpg")
+	require.NoError(t, err)
+	reader, _, err := b.NewReader()
+	require.NoError(t, err)
+	buf, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "foo", string(buf))
+
+	time.Sleep(time.Second * 2)
+	_, err = s.Get(r, "foo.jpg")
+	assert.Equal(t, imagor.ErrExpired, err)
+}
+
+func TestSFTPStorageAuth(t *testing.T) {
+	srv := newFakeServer(t)
+	r := (&http.Request{}).WithContext(context.Background())
+
+	_, err := newStorage(srv, WithCredentials("user", "wrong")).Get(r, "foo.jpg")
+	assert.Error(t, err)
+	assert.NotEqual(t, imagor.ErrNotFound, err)
+
+	// host key mismatch
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewSignerFromKey(priv)
+	_, err = newStorage(srv, WithHostKeyCallback(ssh.FixedHostKey(other.PublicKey()))).Get(r, "foo.jpg")
+	assert.Error(t, err)
+	assert.NotEqual(t, imagor.ErrNotFound, err)
+}
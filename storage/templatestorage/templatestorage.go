@@ -0,0 +1,113 @@
+package templatestorage
+
+import (
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// TemplateStorage maps keys of underlying Storage by key template,
+// e.g. results/{year}/{month}/{key}.{ext}
+//
+// Placeholders:
+//
+//	{key}   original key
+//	{ext}   format filter or source image extension, with its leading dot dropped if empty
+//	{year}, {month}, {day}, {hour} current UTC time
+//
+// Date placeholders resolve to the time of access, such that objects
+// rotate into a new prefix every period and prefixes of past periods
+// can be cleaned up by bucket lifecycle rules
+type TemplateStorage struct {
+	Storage  imagor.Storage
+	Template string
+
+	now func() time.Time
+}
+
+func New(storage imagor.Storage, template string) *TemplateStorage {
+	return &TemplateStorage{
+		Storage:  storage,
+		Template: template,
+		now:      time.Now,
+	}
+}
+
+// Key returns key of underlying storage
+func (s *TemplateStorage) Key(key string) string {
+	t := s.now().UTC()
+	ext := keyExt(key)
+	tmpl := s.Template
+	if ext == "" {
+		tmpl = strings.ReplaceAll(tmpl, ".{ext}", "")
+	}
+	return strings.NewReplacer(
+		"{key}", key,
+		"{ext}", ext,
+		"{year}", fmt.Sprintf("%04d", t.Year()),
+		"{month}", fmt.Sprintf("%02d", t.Month()),
+		"{day}", fmt.Sprintf("%02d", t.Day()),
+		"{hour}", fmt.Sprintf("%02d", t.Hour()),
+	).Replace(tmpl)
+}
+
+// keyExt resolves extension from format filter, or source image of key
+func keyExt(key string) string {
+	p := imagorpath.Parse(key)
+	var format string
+	for _, f := range p.Filters {
+		if f.Name == "format" {
+			format = f.Args
+		}
+	}
+	if format == "" {
+		image := p.Image
+		if image == "" {
+			image = key
+		}
+		format = strings.TrimPrefix(path.Ext(image), ".")
+	}
+	format = strings.ToLower(format)
+	if len(format) > 5 {
+		return ""
+	}
+	for i := 0; i < len(format); i++ {
+		if c := format[i]; !('a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return ""
+		}
+	}
+	return format
+}
+
+func (s *TemplateStorage) Get(r *http.Request, key string) (*imagor.Blob, error) {
+	return s.Storage.Get(r, s.Key(key))
+}
+
+func (s *TemplateStorage) Put(ctx context.Context, key string, blob *imagor.Blob) error {
+	return s.Storage.Put(ctx, s.Key(key), blob)
+}
+
+func (s *TemplateStorage) Delete(ctx context.Context, key string) error {
+	return s.Storage.Delete(ctx, s.Key(key))
+}
+
+// Health delegates health check to the underlying storage if supported
+func (s *TemplateStorage) Health(ctx context.Context) error {
+	if checker, ok := s.Storage.(imagor.HealthChecker); ok {
+		return checker.Health(ctx)
+	}
+	return nil
+}
+
+func (s *TemplateStorage) Stat(ctx context.Context, key string) (*imagor.Stat, error) {
+	return s.Storage.Stat(ctx, s.Key(key))
+}
+
+func (s *TemplateStorage) Meta(ctx context.Context, key string) (*imagor.Meta, error) {
+	return s.Storage.Meta(ctx, s.Key(key))
+}
@@ -0,0 +1,92 @@
+package templatestorage
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		key      string
+		expected string
+	}{
+		{
+			name:     "source ext",
+			template: "results/{year}/{month}/{day}/{key}.{ext}",
+			key:      "fit-in/100x100/foo/bar.JPG",
+			expected: "results/2022/03/07/fit-in/100x100/foo/bar.JPG.jpg",
+		},
+		{
+			name:     "format filter",
+			template: "{hour}/{key}.{ext}",
+			key:      "fit-in/100x100/filters:format(webp):quality(80)/foo/bar.jpg",
+			expected: "09/fit-in/100x100/filters:format(webp):quality(80)/foo/bar.jpg.webp",
+		},
+		{
+			name:     "no ext",
+			template: "results/{key}.{ext}",
+			key:      "fit-in/100x100/https://example.com/image",
+			expected: "results/fit-in/100x100/https://example.com/image",
+		},
+		{
+			name:     "digest key",
+			template: "{year}/{key}",
+			key:      "ab/cd/abcdef.webp",
+			expected: "2022/ab/cd/abcdef.webp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(nil, tt.template)
+			s.now = func() time.Time {
+				return time.Date(2022, 3, 7, 9, 30, 0, 0, time.UTC)
+			}
+			assert.Equal(t, tt.expected, s.Key(tt.key))
+		})
+	}
+}
+
+func TestTemplateStorage(t *testing.T) {
+	ctx := context.Background()
+	r := &http.Request{}
+	memory := memorystorage.New()
+	s := New(memory, "results/{year}/{key}.{ext}")
+	now := time.Date(2022, 3, 7, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		return now
+	}
+
+	blob := imagor.NewBlobFromBytes([]byte("bar"))
+	blob.Meta = &imagor.Meta{Format: "png"}
+	require.NoError(t, s.Put(ctx, "fit-in/foo.png", blob))
+	b, err := memory.Get(r, "results/2022/fit-in/foo.png.png")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	b, err = s.Get(r, "fit-in/foo.png")
+	require.NoError(t, err)
+	buf, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+	_, err = s.Stat(ctx, "fit-in/foo.png")
+	require.NoError(t, err)
+
+	// rotates into new prefix
+	now = now.AddDate(1, 0, 0)
+	_, err = s.Get(r, "fit-in/foo.png")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	now = now.AddDate(-1, 0, 0)
+	require.NoError(t, s.Delete(ctx, "fit-in/foo.png"))
+	assert.Equal(t, 0, memory.Len())
+}
@@ -0,0 +1,24 @@
+package tieredstorage
+
+import (
+	"go.uber.org/zap"
+	"time"
+)
+
+type Option func(s *TieredStorage)
+
+func WithBackfillTimeout(timeout time.Duration) Option {
+	return func(s *TieredStorage) {
+		if timeout > 0 {
+			s.BackfillTimeout = timeout
+		}
+	}
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *TieredStorage) {
+		if logger != nil {
+			s.Logger = logger
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package tieredstorage
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// TieredStorage reads from Fast storage first and falls back to Slow storage,
+// back-filling Fast storage asynchronously on Slow storage hits.
+// Tiers can be nested e.g. New(memory, New(disk, s3))
+type TieredStorage struct {
+	Fast            imagor.Storage
+	Slow            imagor.Storage
+	BackfillTimeout time.Duration
+	Logger          *zap.Logger
+}
+
+func New(fast, slow imagor.Storage, options ...Option) *TieredStorage {
+	s := &TieredStorage{
+		Fast:            fast,
+		Slow:            slow,
+		BackfillTimeout: time.Second * 20,
+		Logger:          zap.NewNop(),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *TieredStorage) Get(r *http.Request, key string) (*imagor.Blob, error) {
+	if blob, err := s.Fast.Get(r, key); err == nil && blob != nil {
+		return blob, nil
+	}
+	blob, err := s.Slow.Get(r, key)
+	if err != nil {
+		return blob, err
+	}
+	// blob is buffered as storage blobs may not be readable after request ends
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	res := imagor.NewBlobFromBytes(buf)
+	res.Meta = blob.Meta
+	res.SetETag(blob.ETag())
+	go s.backfill(key, res)
+	return res, nil
+}
+
+// backfill puts blob into Fast storage, detached from request context
+func (s *TieredStorage) backfill(key string, blob *imagor.Blob) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.BackfillTimeout)
+	defer cancel()
+	if err := s.Fast.Put(ctx, key, blob); err != nil {
+		s.Logger.Warn("backfill", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// Put writes through Slow storage then Fast storage
+func (s *TieredStorage) Put(ctx context.Context, key string, blob *imagor.Blob) error {
+	if err := s.Slow.Put(ctx, key, blob); err != nil {
+		return err
+	}
+	return s.Fast.Put(ctx, key, blob)
+}
+
+// Delete deletes from both tiers, Fast storage deletion is best-effort
+// as the key may not have been back-filled
+func (s *TieredStorage) Delete(ctx context.Context, key string) error {
+	_ = s.Fast.Delete(ctx, key)
+	return s.Slow.Delete(ctx, key)
+}
+
+func (s *TieredStorage) Stat(ctx context.Context, key string) (*imagor.Stat, error) {
+	if stat, err := s.Fast.Stat(ctx, key); err == nil && stat != nil {
+		return stat, nil
+	}
+	return s.Slow.Stat(ctx, key)
+}
+
+func (s *TieredStorage) Meta(ctx context.Context, key string) (*imagor.Meta, error) {
+	if meta, err := s.Fast.Meta(ctx, key); err == nil && meta != nil {
+		return meta, nil
+	}
+	return s.Slow.Meta(ctx, key)
+}
@@ -0,0 +1,101 @@
+package tieredstorage
+
+import (
+	"context"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTieredStorage(t *testing.T) {
+	ctx := context.Background()
+	r := &http.Request{}
+	memory := memorystorage.New()
+	disk := memorystorage.New()
+	remote := memorystorage.New()
+	s := New(memory, New(disk, remote))
+
+	_, err := s.Get(r, "foo")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	_, err = s.Stat(ctx, "foo")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	require.NoError(t, remote.Put(ctx, "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	b, err := s.Get(r, "foo")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	// back-filled asynchronously to all faster tiers
+	assert.Eventually(t, func() bool {
+		return memory.Len() == 1 && disk.Len() == 1
+	}, time.Second, time.Millisecond*10)
+
+	stat, err := s.Stat(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stat.Size)
+
+	require.NoError(t, s.Put(ctx, "bar", imagor.NewBlobFromBytes([]byte("baz"))))
+	assert.Equal(t, 2, memory.Len())
+	assert.Equal(t, 2, disk.Len())
+	assert.Equal(t, 2, remote.Len())
+
+	require.NoError(t, s.Delete(ctx, "foo"))
+	assert.Equal(t, 1, memory.Len())
+	assert.Equal(t, 1, disk.Len())
+	assert.Equal(t, 1, remote.Len())
+	_, err = s.Get(r, "foo")
+	assert.Equal(t, imagor.ErrNotFound, err)
+}
+
+// requestStorage storage of blobs only readable before request ends, e.g. S3 object body
+type requestStorage struct {
+	imagor.Storage
+}
+
+func (s requestStorage) Get(r *http.Request, key string) (*imagor.Blob, error) {
+	blob, err := s.Storage.Get(r, key)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context()
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		return blob.NewReader()
+	}), nil
+}
+
+func TestTieredStorageBackfillRequestEnded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := (&http.Request{}).WithContext(ctx)
+	memory := memorystorage.New()
+	remote := memorystorage.New()
+	s := New(memory, requestStorage{remote})
+	require.NoError(t, remote.Put(context.Background(), "foo", imagor.NewBlobFromBytes([]byte("bar"))))
+
+	b, err := s.Get(r, "foo")
+	require.NoError(t, err)
+	// request ends before back-fill
+	cancel()
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	assert.Eventually(t, func() bool {
+		return memory.Len() == 1
+	}, time.Second, time.Millisecond*10)
+	b, err = memory.Get(&http.Request{}, "foo")
+	require.NoError(t, err)
+	buf, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+}
@@ -0,0 +1,58 @@
+package webdavstorage
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Option func(s *WebDAVStorage)
+
+func WithPathPrefix(prefix string) Option {
+	return func(s *WebDAVStorage) {
+		if prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/")
+			if prefix != "/" {
+				prefix += "/"
+			}
+			s.PathPrefix = prefix
+		}
+	}
+}
+
+func WithBasicAuth(username, password string) Option {
+	return func(s *WebDAVStorage) {
+		s.Username = username
+		s.Password = password
+	}
+}
+
+func WithBearerToken(token string) Option {
+	return func(s *WebDAVStorage) {
+		s.BearerToken = token
+	}
+}
+
+func WithSafeChars(chars string) Option {
+	return func(s *WebDAVStorage) {
+		if chars != "" {
+			s.SafeChars = chars
+		}
+	}
+}
+
+func WithExpiration(exp time.Duration) Option {
+	return func(s *WebDAVStorage) {
+		if exp > 0 {
+			s.Expiration = exp
+		}
+	}
+}
+
+func WithClient(client *http.Client) Option {
+	return func(s *WebDAVStorage) {
+		if client != nil {
+			s.Client = client
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package webdavstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type WebDAVStorage struct {
+	BaseURL     *url.URL
+	PathPrefix  string
+	Username    string
+	Password    string
+	BearerToken string
+	SafeChars   string
+	Expiration  time.Duration
+	Client      *http.Client
+
+	safeChars imagorpath.SafeChars
+}
+
+// New creates WebDAV storage of base URL
+// e.g. https://cloud.example.com/remote.php/dav/files/user/imagor
+func New(baseURL *url.URL, options ...Option) *WebDAVStorage {
+	s := &WebDAVStorage{
+		BaseURL:    baseURL,
+		PathPrefix: "/",
+		Client:     http.DefaultClient,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.safeChars = imagorpath.NewSafeChars(s.SafeChars)
+	return s
+}
+
+func (s *WebDAVStorage) Path(image string) (string, bool) {
+	image = "/" + imagorpath.Normalize(image, s.safeChars)
+	if !strings.HasPrefix(image, s.PathPrefix) {
+		return "", false
+	}
+	return path.Join("/", s.BaseURL.Path, strings.TrimPrefix(image, s.PathPrefix)), true
+}
+
+func (s *WebDAVStorage) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	u := *s.BaseURL
+	u.Path = p
+	u.RawPath = ""
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if s.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.BearerToken)
+	} else if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	return req, nil
+}
+
+func (s *WebDAVStorage) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, imagor.ErrNotFound
+		}
+		return nil, imagor.NewErrorFromStatusCode(resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (s *WebDAVStorage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	ctx := r.Context()
+	stat, err := s.propfind(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if s.Expiration > 0 && time.Now().Sub(stat.ModifiedTime) > s.Expiration {
+		return nil, imagor.ErrExpired
+	}
+	return imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		req, err := s.newRequest(ctx, http.MethodGet, image, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+		return resp.Body, stat.Size, nil
+	}), nil
+}
+
+func (s *WebDAVStorage) Put(ctx context.Context, image string, blob *imagor.Blob) error {
+	image, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	if err := s.mkcolAll(ctx, path.Dir(image)); err != nil {
+		return err
+	}
+	reader, size, err := blob.NewReader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	if err := s.put(ctx, image, reader, size, blob.ContentType()); err != nil {
+		return err
+	}
+	if blob.Meta != nil {
+		if buf, _ := json.Marshal(blob.Meta); len(buf) > 0 {
+			return s.put(ctx, image+".meta.json", bytes.NewReader(buf), int64(len(buf)), "application/json")
+		}
+	}
+	return nil
+}
+
+func (s *WebDAVStorage) put(ctx context.Context, p string, reader io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, p, reader)
+	if err != nil {
+		return err
+	}
+	if size > 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// mkcolAll creates collections under base URL path, existing collections are ignored
+func (s *WebDAVStorage) mkcolAll(ctx context.Context, dir string) error {
+	p := path.Join("/", s.BaseURL.Path)
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(dir, p), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		p = path.Join(p, part)
+		req, err := s.newRequest(ctx, "MKCOL", p+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := s.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		// 405 Method Not Allowed if collection already exists
+		if resp.StatusCode >= 400 && resp.StatusCode != http.StatusMethodNotAllowed {
+			return imagor.NewErrorFromStatusCode(resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+func (s *WebDAVStorage) Delete(ctx context.Context, image string) error {
+	image, ok := s.Path(image)
+	if !ok {
+		return imagor.ErrInvalid
+	}
+	req, err := s.newRequest(ctx, http.MethodDelete, image, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *WebDAVStorage) Stat(ctx context.Context, image string) (*imagor.Stat, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	return s.propfind(ctx, image)
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<d:propfind xmlns:d="DAV:"><d:prop>` +
+	`<d:getlastmodified/><d:getcontentlength/><d:getetag/>` +
+	`</d:prop></d:propfind>`
+
+type multistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				LastModified  string `xml:"getlastmodified"`
+				ContentLength string `xml:"getcontentlength"`
+				ETag          string `xml:"getetag"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (s *WebDAVStorage) propfind(ctx context.Context, p string) (*imagor.Stat, error) {
+	req, err := s.newRequest(ctx, "PROPFIND", p, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "0")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+	stat := &imagor.Stat{}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.LastModified != "" {
+				if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+					stat.ModifiedTime = t
+				}
+			}
+			if ps.Prop.ContentLength != "" {
+				stat.Size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			}
+			if ps.Prop.ETag != "" {
+				stat.ETag = ps.Prop.ETag
+			}
+		}
+	}
+	return stat, nil
+}
+
+func (s *WebDAVStorage) Meta(ctx context.Context, image string) (*imagor.Meta, error) {
+	image, ok := s.Path(image)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	key := image + ".meta.json"
+	if s.Expiration > 0 {
+		stat, err := s.propfind(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().Sub(stat.ModifiedTime) > s.Expiration {
+			return nil, imagor.ErrExpired
+		}
+	}
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	meta := &imagor.Meta{}
+	if err := json.NewDecoder(resp.Body).Decode(meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
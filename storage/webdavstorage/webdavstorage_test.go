@@ -0,0 +1,205 @@
+package webdavstorage
+
+import (
+	"context"
+	"fmt"
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+type davFile struct {
+	buf     []byte
+	modTime time.Time
+}
+
+// davHandler minimal in-memory WebDAV server
+type davHandler struct {
+	mu    sync.Mutex
+	files map[string]davFile
+	cols  map[string]bool
+	auth  string
+}
+
+func newDAVHandler(auth string) *davHandler {
+	return &davHandler{files: map[string]davFile{}, cols: map[string]bool{"/": true}, auth: auth}
+}
+
+func (h *davHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != h.auth {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := path.Clean(r.URL.Path)
+	f, ok := h.files[p]
+	switch r.Method {
+	case "MKCOL":
+		if h.cols[p] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		} else if !h.cols[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			h.cols[p] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodPut:
+		if !h.cols[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		buf, _ := io.ReadAll(r.Body)
+		h.files[p] = davFile{buf: buf, modTime: time.Now()}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(f.buf)
+	case http.MethodDelete:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(h.files, p)
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:"><d:response><d:href>%s</d:href>
+<d:propstat><d:prop><d:getlastmodified>%s</d:getlastmodified><d:getcontentlength>%d</d:getcontentlength><d:getetag>"%x"</d:getetag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response></d:multistatus>`, p, f.modTime.UTC().Format(http.TimeFormat), len(f.buf), len(f.buf))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebDAVStorage_Path(t *testing.T) {
+	tests := []struct {
+		name       string
+		baseURL    string
+		prefix     string
+		image      string
+		expected   string
+		expectedOk bool
+	}{
+		{
+			name:       "path under base url",
+			baseURL:    "https://example.com/dav/files/user",
+			image:      "/foo/bar",
+			expected:   "/dav/files/user/foo/bar",
+			expectedOk: true,
+		},
+		{
+			name:       "path under with prefix",
+			baseURL:    "https://example.com/dav",
+			prefix:     "/foo",
+			image:      "/foo/bar",
+			expected:   "/dav/bar",
+			expectedOk: true,
+		},
+		{
+			name:    "path not under prefix",
+			baseURL: "https://example.com/dav",
+			prefix:  "/foo",
+			image:   "/fooo/bar",
+		},
+		{
+			name:       "escape unsafe chars",
+			baseURL:    "https://example.com",
+			image:      "/foo/b{:}ar",
+			expected:   "/foo/b%7B%3A%7Dar",
+			expectedOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.baseURL)
+			require.NoError(t, err)
+			res, ok := New(u, WithPathPrefix(tt.prefix)).Path(tt.image)
+			assert.Equal(t, tt.expected, res)
+			assert.Equal(t, tt.expectedOk, ok)
+		})
+	}
+}
+
+func TestWebDAVStorage_Load_Save(t *testing.T) {
+	ctx := context.Background()
+	r := &http.Request{}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		ts := httptest.NewServer(newDAVHandler("Bearer abc"))
+		defer ts.Close()
+		u, _ := url.Parse(ts.URL)
+		s := New(u, WithBearerToken("wrong"))
+		_, err := s.Stat(ctx, "foo")
+		assert.Equal(t, imagor.NewErrorFromStatusCode(http.StatusUnauthorized), err)
+	})
+
+	t.Run("CRUD", func(t *testing.T) {
+		h := newDAVHandler("Basic dXNlcjpwYXNz")
+		ts := httptest.NewServer(h)
+		defer ts.Close()
+		u, _ := url.Parse(ts.URL + "/dav/")
+		s := New(u, WithBasicAuth("user", "pass"))
+		h.cols["/dav"] = true
+
+		_, err := s.Get(r, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Stat(ctx, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = s.Meta(ctx, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+
+		blob := imagor.NewBlobFromBytes([]byte("bar"))
+		blob.Meta = &imagor.Meta{Format: "png", Width: 10, Height: 20}
+		require.NoError(t, s.Put(ctx, "/foo/fooo/asdf", blob))
+		assert.Contains(t, h.files, "/dav/foo/fooo/asdf")
+
+		b, err := s.Get(r, "/foo/fooo/asdf")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+
+		stat, err := s.Stat(ctx, "/foo/fooo/asdf")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stat.Size)
+		assert.Equal(t, `"3"`, stat.ETag)
+		assert.WithinDuration(t, time.Now(), stat.ModifiedTime, time.Minute)
+
+		meta, err := s.Meta(ctx, "/foo/fooo/asdf")
+		require.NoError(t, err)
+		assert.Equal(t, blob.Meta, meta)
+
+		require.NoError(t, s.Delete(ctx, "/foo/fooo/asdf"))
+		_, err = s.Get(r, "/foo/fooo/asdf")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		h := newDAVHandler("")
+		ts := httptest.NewServer(h)
+		defer ts.Close()
+		u, _ := url.Parse(ts.URL)
+		s := New(u, WithExpiration(time.Millisecond))
+		require.NoError(t, s.Put(ctx, "exp", imagor.NewBlobFromBytes([]byte("bar"))))
+		time.Sleep(time.Second * 2)
+		_, err := s.Get(r, "exp")
+		assert.Equal(t, imagor.ErrExpired, err)
+	})
+}
@@ -0,0 +1,157 @@
+package imagor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+var svgTag = []byte("<svg")
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+func isSVG(buf []byte) bool {
+	buf = bytes.TrimPrefix(bytes.TrimSpace(buf), utf8BOM)
+	if len(buf) == 0 || buf[0] != '<' {
+		return false
+	}
+	return bytes.Contains(bytes.ToLower(buf), svgTag)
+}
+
+// svgUnsafeElements elements to be stripped including their content
+var svgUnsafeElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// SanitizeSVG strips scripts, event handlers and external references from SVG,
+// such that untrusted SVG can be served without being an XSS vector.
+// DOCTYPE and entity declarations are also dropped
+func SanitizeSVG(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	var skip int
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 || svgUnsafeElements[strings.ToLower(t.Name.Local)] {
+				skip++
+				continue
+			}
+			buf.WriteByte('<')
+			buf.WriteString(qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if !isSafeSVGAttr(attr) {
+					continue
+				}
+				buf.WriteByte(' ')
+				buf.WriteString(qualifiedName(attr.Name))
+				buf.WriteString(`="`)
+				_ = xml.EscapeText(&buf, []byte(attr.Value))
+				buf.WriteByte('"')
+			}
+			buf.WriteByte('>')
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			buf.WriteString("</")
+			buf.WriteString(qualifiedName(t.Name))
+			buf.WriteByte('>')
+		case xml.CharData:
+			if skip > 0 {
+				continue
+			}
+			if hasExternalURL(string(t)) {
+				continue
+			}
+			_ = xml.EscapeText(&buf, t)
+		case xml.ProcInst:
+			if skip > 0 || t.Target != "xml" {
+				continue
+			}
+			buf.WriteString("<?xml ")
+			buf.Write(t.Inst)
+			buf.WriteString("?>")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func isSafeSVGAttr(attr xml.Attr) bool {
+	local := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(local, "on") {
+		return false
+	}
+	value := strings.ToLower(strings.TrimSpace(attr.Value))
+	switch local {
+	case "href", "src", "action", "formaction":
+		// allow same document fragment and embedded raster images only
+		return strings.HasPrefix(value, "#") ||
+			strings.HasPrefix(value, "data:image/png") ||
+			strings.HasPrefix(value, "data:image/jpeg") ||
+			strings.HasPrefix(value, "data:image/gif") ||
+			strings.HasPrefix(value, "data:image/webp")
+	case "style":
+		return !hasExternalURL(value)
+	}
+	if strings.Contains(value, "javascript:") {
+		return false
+	}
+	return !hasExternalURL(value)
+}
+
+// hasExternalURL checks for style references other than same document fragment
+func hasExternalURL(s string) bool {
+	s = strings.ToLower(s)
+	if strings.Contains(s, "@import") || strings.Contains(s, "javascript:") || strings.Contains(s, "expression(") {
+		return true
+	}
+	for {
+		i := strings.Index(s, "url(")
+		if i < 0 {
+			return false
+		}
+		s = strings.TrimLeft(s[i+4:], " \t\r\n'\"")
+		if !strings.HasPrefix(s, "#") {
+			return true
+		}
+	}
+}
+
+func sanitizeSVGBlob(blob *Blob) (*Blob, error) {
+	reader, _, err := blob.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	buf, err := SanitizeSVG(reader)
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	return NewBlobFromBytes(buf), nil
+}
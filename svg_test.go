@@ -0,0 +1,59 @@
+package imagor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name   string
+		svg    string
+		expect string
+	}{
+		{
+			name:   "safe",
+			svg:    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"/><rect fill="url(#g)"/></svg>`,
+			expect: `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#a"></use><rect fill="url(#g)"></rect></svg>`,
+		},
+		{
+			name:   "script",
+			svg:    `<svg><script type="text/javascript">alert(1)</script><g><script><![CDATA[alert(2)]]></script></g></svg>`,
+			expect: `<svg><g></g></svg>`,
+		},
+		{
+			name:   "event handlers",
+			svg:    `<svg onload="alert(1)"><rect onClick="alert(2)" width="1"/></svg>`,
+			expect: `<svg><rect width="1"></rect></svg>`,
+		},
+		{
+			name:   "external references",
+			svg:    `<svg><image href="https://evil.com/a.png"/><a xlink:href="javascript:alert(1)">x</a><rect style="fill:url(https://evil.com/a)"/></svg>`,
+			expect: `<svg><image></image><a>x</a><rect></rect></svg>`,
+		},
+		{
+			name:   "foreign object",
+			svg:    `<svg><foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><iframe src="https://evil.com"/></body></foreignObject></svg>`,
+			expect: `<svg></svg>`,
+		},
+		{
+			name:   "style import",
+			svg:    `<svg><style>@import url(https://evil.com/a.css);</style><style>rect{fill:url(#g)}</style></svg>`,
+			expect: `<svg><style></style><style>rect{fill:url(#g)}</style></svg>`,
+		},
+		{
+			name:   "doctype entities",
+			svg:    `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY a "b">]><svg></svg>`,
+			expect: `<?xml version="1.0"?><svg></svg>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := SanitizeSVG(strings.NewReader(tt.svg))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, string(buf))
+		})
+	}
+}
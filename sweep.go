@@ -0,0 +1,53 @@
+package imagor
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+func (app *Imagor) sweepLoop(ctx context.Context) {
+	ticker := time.NewTicker(app.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep deletes expired objects from result storages and meta storages
+// that implement both Lister and Expirer, returns number of deleted objects
+func (app *Imagor) Sweep(ctx context.Context) (cnt int) {
+	for _, storage := range append(app.ResultStorages, app.MetaStorages...) {
+		lister, ok := storage.(Lister)
+		if !ok {
+			continue
+		}
+		expirer, ok := storage.(Expirer)
+		if !ok {
+			continue
+		}
+		if err := lister.List(ctx, "", func(key string) error {
+			stat, err := storage.Stat(ctx, key)
+			if err != nil || stat == nil || !expirer.Expired(stat) {
+				return ctx.Err()
+			}
+			if err := storage.Delete(ctx, key); err != nil {
+				app.Logger.Warn("sweep", zap.String("key", key), zap.Error(err))
+			} else {
+				cnt++
+			}
+			return ctx.Err()
+		}); err != nil && ctx.Err() == nil {
+			app.Logger.Warn("sweep", zap.Error(err))
+		}
+	}
+	if app.Debug {
+		app.Logger.Debug("swept", zap.Int("count", cnt))
+	}
+	return
+}
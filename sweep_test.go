@@ -0,0 +1,46 @@
+package imagor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type expirerMapStore struct {
+	listMapStore
+	Before time.Time
+}
+
+func (s expirerMapStore) Expired(stat *Stat) bool {
+	return stat.ModifiedTime.Before(s.Before)
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	resultStore := expirerMapStore{listMapStore: listMapStore{newMapStore()}}
+	nonExpirer := listMapStore{newMapStore()}
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, resultStore.Put(ctx, key, NewBlobFromBytes([]byte(key))))
+		require.NoError(t, nonExpirer.Put(ctx, key, NewBlobFromBytes([]byte(key))))
+	}
+	resultStore.Before = resultStore.ModTime["c"]
+	app := New(
+		WithResultStorages(resultStore, nonExpirer),
+		WithSweepInterval(time.Hour),
+	)
+	assert.Equal(t, time.Hour, app.SweepInterval)
+
+	assert.Equal(t, 2, app.Sweep(ctx))
+	assert.Equal(t, 1, resultStore.DelCnt["a"])
+	assert.Equal(t, 1, resultStore.DelCnt["b"])
+	assert.Equal(t, 0, resultStore.DelCnt["c"])
+	assert.Equal(t, 1, len(resultStore.Map))
+	assert.Equal(t, 3, len(nonExpirer.Map))
+	assert.Equal(t, 0, app.Sweep(ctx))
+
+	require.NoError(t, app.Startup(ctx))
+	assert.NotNil(t, app.bgCancel)
+	require.NoError(t, app.Shutdown(ctx))
+}
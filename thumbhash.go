@@ -0,0 +1,140 @@
+package imagor
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// ThumbHash encodes image into ThumbHash, which preserves alpha and aspect ratio.
+// Image is expected to be within 100x100 e.g. 100px thumbnail, otherwise nil is returned
+func ThumbHash(img image.Image) []byte {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 || w > 100 || h > 100 {
+		return nil
+	}
+	// rgb of pixels in 0 to 255 not premultiplied, alpha in 0 to 1
+	pixels := make([][4]float64, w*h)
+	var avgR, avgG, avgB, avgA float64
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+px, bounds.Min.Y+py)).(color.NRGBA)
+			alpha := float64(c.A) / 255
+			pixels[py*w+px] = [4]float64{float64(c.R), float64(c.G), float64(c.B), alpha}
+			avgR += alpha / 255 * float64(c.R)
+			avgG += alpha / 255 * float64(c.G)
+			avgB += alpha / 255 * float64(c.B)
+			avgA += alpha
+		}
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+	hasAlpha := avgA < float64(w*h)
+	// fewer luminance bits if there is alpha
+	lLimit := 7.0
+	if hasAlpha {
+		lLimit = 5
+	}
+	maxWH := float64(max(w, h))
+	lx := max(1, int(jsRound(lLimit*float64(w)/maxWH)))
+	ly := max(1, int(jsRound(lLimit*float64(h)/maxWH)))
+
+	// LPQA channels, composited atop the average color
+	l := make([]float64, w*h)
+	p := make([]float64, w*h)
+	q := make([]float64, w*h)
+	a := make([]float64, w*h)
+	for i, px := range pixels {
+		alpha := px[3]
+		r := avgR*(1-alpha) + alpha/255*px[0]
+		g := avgG*(1-alpha) + alpha/255*px[1]
+		b := avgB*(1-alpha) + alpha/255*px[2]
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+	lDC, lAC, lScale := thumbHashChannel(l, w, h, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := thumbHashChannel(p, w, h, 3, 3)
+	qDC, qAC, qScale := thumbHashChannel(q, w, h, 3, 3)
+
+	isLandscape := w > h
+	header24 := int(jsRound(63*lDC)) |
+		int(jsRound(31.5+31.5*pDC))<<6 |
+		int(jsRound(31.5+31.5*qDC))<<12 |
+		int(jsRound(31*lScale))<<18
+	header16 := int(jsRound(63*pScale))<<3 | int(jsRound(63*qScale))<<9
+	if isLandscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+	acs := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+	hash := []byte{
+		byte(header24), byte(header24 >> 8), byte(header24 >> 16),
+		byte(header16), byte(header16 >> 8),
+	}
+	if hasAlpha {
+		aDC, aAC, aScale := thumbHashChannel(a, w, h, 5, 5)
+		hash = append(hash, byte(int(jsRound(15*aDC))|int(jsRound(15*aScale))<<4))
+		acs = append(acs, aAC)
+	}
+	// AC terms packed as 4 bits each
+	start := len(hash)
+	var n int
+	for _, ac := range acs {
+		for _, f := range ac {
+			i := start + n>>1
+			if i >= len(hash) {
+				hash = append(hash, 0)
+			}
+			hash[i] |= byte(int(jsRound(15*f)) << ((n & 1) << 2))
+			n++
+		}
+	}
+	return hash
+}
+
+// thumbHashChannel encodes channel using DCT into DC and normalized AC terms
+func thumbHashChannel(channel []float64, w, h, nx, ny int) (dc float64, ac []float64, scale float64) {
+	fx := make([]float64, w)
+	for cy := 0; cy < ny; cy++ {
+		for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+			for x := 0; x < w; x++ {
+				fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+			}
+			var f float64
+			for y := 0; y < h; y++ {
+				fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+				for x := 0; x < w; x++ {
+					f += channel[x+y*w] * fx[x] * fy
+				}
+			}
+			f /= float64(w * h)
+			if cx > 0 || cy > 0 {
+				ac = append(ac, f)
+				scale = math.Max(scale, math.Abs(f))
+			} else {
+				dc = f
+			}
+		}
+	}
+	if scale > 0 {
+		for i := range ac {
+			ac[i] = 0.5 + 0.5/scale*ac[i]
+		}
+	}
+	return
+}
+
+// jsRound rounds half up as of the ThumbHash reference implementation
+func jsRound(v float64) float64 {
+	return math.Floor(v + 0.5)
+}
@@ -0,0 +1,56 @@
+package imagor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// thumbHashAverage decodes average color of ThumbHash as of the reference implementation
+func thumbHashAverage(hash []byte) (r, g, b, a float64) {
+	header := int(hash[0]) | int(hash[1])<<8 | int(hash[2])<<16
+	l := float64(header&63) / 63
+	p := float64(header>>6&63)/31.5 - 1
+	q := float64(header>>12&63)/31.5 - 1
+	a = 1
+	if header>>23 != 0 {
+		a = float64(hash[5]&15) / 15
+	}
+	b = l - 2.0/3*p
+	r = (3*l - b + q) / 2
+	g = r - q
+	return
+}
+
+func TestThumbHash(t *testing.T) {
+	red := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(red, red.Rect, image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	hash := ThumbHash(red)
+	assert.Len(t, hash, 5+(18+5+5)/2, "header and AC terms of 7x4 luminance")
+	assert.Equal(t, byte(0), hash[2]>>7, "no alpha")
+	assert.Equal(t, byte(1), hash[4]>>7, "landscape")
+	r, g, b, a := thumbHashAverage(hash)
+	assert.InDelta(t, 1, r, 0.05)
+	assert.InDelta(t, 0, g, 0.05)
+	assert.InDelta(t, 0, b, 0.05)
+	assert.Equal(t, 1.0, a)
+
+	// reference implementation output of gradient with alpha
+	img := image.NewNRGBA(image.Rect(0, 0, 37, 37))
+	for y := 0; y < 37; y++ {
+		for x := 0; x < 37; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(x * 13 % 256), G: uint8(y * 29 % 256), B: uint8(x * y * 7 % 256), A: uint8((x*11 + y*5) % 256),
+			})
+		}
+	}
+	assert.Equal(t, []byte{
+		0xdf, 0xf7, 0x85, 0x0d, 0x06, 0x18, 0x64, 0xa0, 0x87, 0x78, 0x87, 0x48, 0x67,
+		0x20, 0xcb, 0x24, 0xf4, 0x78, 0xa7, 0x43, 0x75, 0x03, 0x85, 0x84, 0x77,
+	}, ThumbHash(img))
+
+	assert.Nil(t, ThumbHash(image.NewNRGBA(image.Rect(0, 0, 101, 10))))
+	assert.Nil(t, ThumbHash(image.NewNRGBA(image.Rect(0, 0, 0, 0))))
+}
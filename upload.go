@@ -0,0 +1,199 @@
+package imagor
+
+import (
+	"context"
+	"errors"
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UploadTokenHeader header of upload token, alternatively via token query param
+const UploadTokenHeader = "X-Imagor-Upload-Token"
+
+// UploadResult upload endpoint response
+type UploadResult struct {
+	Key         string `json:"key"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// serveUpload handles PUT raw body or POST multipart file uploads,
+// authenticated by one-time upload token, then writes image into storages
+func (app *Imagor) serveUpload(w http.ResponseWriter, r *http.Request) {
+	writeErr := func(err error) {
+		e := WrapError(err)
+		if app.DisableErrorBody {
+			w.WriteHeader(e.Code)
+		} else {
+			writeJSON(w, r, e.Code, e)
+		}
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		writeErr(ErrMethodNotAllowed)
+		return
+	}
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, app.UploadPath), "/")
+	if !isUploadKeyValid(key) {
+		writeErr(ErrInvalid)
+		return
+	}
+	token := r.Header.Get(UploadTokenHeader)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if app.UploadMaxSize > 0 && r.ContentLength > app.UploadMaxSize {
+		writeErr(ErrRequestTooLarge)
+		return
+	}
+	scope, err := app.UploadSigner.Verify(token, key, r.ContentLength)
+	if err != nil {
+		writeErr(err)
+		return
+	}
+	if len(app.Storages) == 0 {
+		writeErr(NewError("storage not configured", http.StatusNotImplemented))
+		return
+	}
+	if app.UploadMaxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, app.UploadMaxSize)
+	}
+	var body io.Reader = r.Body
+	if r.Method == http.MethodPost {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeErr(uploadReadErr(err))
+			return
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		body = file
+	}
+	if scope.MaxSize > 0 {
+		body = io.LimitReader(body, scope.MaxSize+1)
+	}
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		writeErr(uploadReadErr(err))
+		return
+	}
+	if err = scope.Allow(key, int64(len(buf))); err != nil {
+		writeErr(err)
+		return
+	}
+	blob := NewBlobFromBytes(buf)
+	switch blob.BlobType() {
+	case BlobTypeUnknown, BlobTypeEmpty:
+		writeErr(ErrUnsupportedFormat)
+		return
+	case BlobTypeSVG:
+		if app.SanitizeSVG {
+			if blob, err = sanitizeSVGBlob(blob); err != nil {
+				writeErr(err)
+				return
+			}
+		}
+	}
+	ctx := r.Context()
+	if scope.Params != "" {
+		if blob, err = app.processUpload(r, key, scope.Params, blob); err != nil {
+			writeErr(err)
+			return
+		}
+	}
+	if err = app.put(ctx, app.Storages, key, blob); err != nil {
+		app.Logger.Warn("upload", zap.String("key", key), zap.Error(err))
+		writeErr(err)
+		return
+	}
+	// invalidates derived results of overwritten image in background
+	go app.purgeResults(context.Background(), key)
+	if app.Debug {
+		app.Logger.Debug("uploaded", zap.String("key", key))
+	}
+	buf, _ = blob.ReadAll()
+	writeJSON(w, r, http.StatusCreated, UploadResult{
+		Key:         key,
+		Size:        len(buf),
+		ContentType: blob.ContentType(),
+	})
+}
+
+// processUpload applies imagor params of upload token scope to uploaded image
+func (app *Imagor) processUpload(r *http.Request, key, params string, blob *Blob) (*Blob, error) {
+	p := imagorpath.Parse(strings.Trim(params, "/") + "/" + key)
+	processors, err := app.selectProcessors(p)
+	if err != nil {
+		return nil, err
+	}
+	ctx := r.Context()
+	if app.MaxLoads > 0 {
+		ctx = withLoadCount(ctx)
+		r = r.WithContext(ctx)
+	}
+	if app.ProcessTimeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, app.ProcessTimeout)
+		defer cancel()
+	}
+	load := app.limitLoad(ctx, func(image string) (*Blob, error) {
+		b, _, err := app.loadSource(r, image)
+		return b, err
+	})
+	for _, processor := range processors {
+		b, err := checkBlob(processor.Process(ctx, blob, p, load))
+		if err == nil {
+			return b, nil
+		}
+		if err != ErrPass {
+			return nil, err
+		}
+		if !isBlobEmpty(b) {
+			blob = b
+		}
+	}
+	return blob, nil
+}
+
+// put saves blob into all storages, unlike save it returns the first error
+func (app *Imagor) put(ctx context.Context, storages []Storage, key string, blob *Blob) error {
+	var cancel func()
+	if app.SaveTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, app.SaveTimeout)
+		defer cancel()
+	}
+	for _, storage := range storages {
+		start := time.Now()
+		err := storage.Put(ctx, key, blob)
+		app.observe(storage, "put", start, blobSize(blob), err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isUploadKeyValid(key string) bool {
+	if key == "" || strings.ContainsRune(key, 0) {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// uploadReadErr maps request body read error, 413 if exceeded upload max size
+func uploadReadErr(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrRequestTooLarge
+	}
+	return ErrInvalid
+}
@@ -0,0 +1,176 @@
+package imagor
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUpload(t *testing.T) {
+	buf, err := os.ReadFile("testdata/demo1.jpg")
+	require.NoError(t, err)
+	store := newMapStore()
+	var processed []string
+	app := New(
+		WithStorages(store),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			processed = append(processed, p.Path)
+			return blob, nil
+		})),
+		WithUpload("/upload/", "s3cr3t"),
+	)
+	assert.Equal(t, "/upload", app.UploadPath)
+	signer := NewUploadTokenSigner("s3cr3t")
+	sign := func(scope UploadScope) string {
+		token, err := signer.Sign(scope, time.Minute)
+		require.NoError(t, err)
+		return token
+	}
+	put := func(key, token string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "https://example.com/upload/"+key, bytes.NewReader(body))
+		if token != "" {
+			r.Header.Set(UploadTokenHeader, token)
+		}
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	w := put("users/1/a.jpg", "", buf)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = put("users/1/a.jpg", sign(UploadScope{KeyPrefix: "users/2/"}), buf)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = put("users/1/a.jpg", sign(UploadScope{MaxSize: 100}), buf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = put("users/1/a.txt", sign(UploadScope{}), []byte("not an image at all, plain text"))
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	w = put("users/../a.jpg", sign(UploadScope{}), buf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, store.Map)
+
+	token := sign(UploadScope{KeyPrefix: "users/1/", Params: "fit-in/100x100"})
+	w = put("users/1/a.jpg", token, buf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"key":"users/1/a.jpg","size":6635,"content_type":"image/jpeg"}`, w.Body.String())
+	assert.Equal(t, 1, store.SaveCnt["users/1/a.jpg"])
+	assert.Equal(t, []string{"fit-in/100x100/users/1/a.jpg"}, processed)
+
+	// token is one-time
+	w = put("users/1/a.jpg", token, buf)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "b.jpg")
+	require.NoError(t, err)
+	_, _ = fw.Write(buf)
+	require.NoError(t, mw.Close())
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "https://example.com/upload/b.jpg?token="+sign(UploadScope{}), body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 1, store.SaveCnt["b.jpg"])
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "https://example.com/upload/b.jpg", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestUploadMaxSize(t *testing.T) {
+	buf, err := os.ReadFile("testdata/demo1.jpg")
+	require.NoError(t, err)
+	store := newMapStore()
+	app := New(
+		WithStorages(store),
+		WithUpload("/upload", "s3cr3t"),
+		WithUploadMaxSize(1000),
+	)
+	signer := NewUploadTokenSigner("s3cr3t")
+	token, err := signer.Sign(UploadScope{}, time.Minute)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "https://example.com/upload/a.jpg", bytes.NewReader(buf))
+	r.Header.Set(UploadTokenHeader, token)
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// body without content length capped by reader
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPut, "https://example.com/upload/a.jpg", bytes.NewReader(buf))
+	r.ContentLength = -1
+	r.Header.Set(UploadTokenHeader, token)
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// multipart body capped by reader
+	token, err = signer.Sign(UploadScope{}, time.Minute)
+	require.NoError(t, err)
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "a.jpg")
+	require.NoError(t, err)
+	_, _ = fw.Write(buf)
+	require.NoError(t, mw.Close())
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "https://example.com/upload/a.jpg", body)
+	r.ContentLength = -1
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set(UploadTokenHeader, token)
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, store.Map)
+}
+
+func TestUploadPurge(t *testing.T) {
+	buf, err := os.ReadFile("testdata/demo1.jpg")
+	require.NoError(t, err)
+	store := newMapStore()
+	resultStore := &deleteNotifyStore{listMapStore{newMapStore()}, make(chan string, 10)}
+	app := New(
+		WithStorages(store),
+		WithResultStorages(resultStore),
+		WithUnsafe(true),
+		WithUpload("/upload", "s3cr3t"),
+	)
+	require.NoError(t, store.Put(context.Background(), "a.jpg", NewBlobFromBytes(buf)))
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/fit-in/100x100/a.jpg", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, resultStore.Map, "fit-in/100x100/a.jpg")
+
+	token, err := NewUploadTokenSigner("s3cr3t").Sign(UploadScope{}, time.Minute)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "https://example.com/upload/a.jpg", bytes.NewReader(buf))
+	r.Header.Set(UploadTokenHeader, token)
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	// purged in background
+	assert.Equal(t, "fit-in/100x100/a.jpg", <-resultStore.deleted)
+	assert.Equal(t, 0, store.DelCnt["a.jpg"], "uploaded source should be kept")
+}
+
+type deleteNotifyStore struct {
+	listMapStore
+	deleted chan string
+}
+
+func (s *deleteNotifyStore) Delete(ctx context.Context, key string) error {
+	err := s.listMapStore.Delete(ctx, key)
+	s.deleted <- key
+	return err
+}
@@ -0,0 +1,116 @@
+package imagor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadScope scope of a signed upload token
+type UploadScope struct {
+	// KeyPrefix allowed storage key prefix for upload. Empty allows any key
+	KeyPrefix string `json:"key_prefix,omitempty"`
+	// Params imagor params to be applied to the uploaded image e.g. fit-in/1000x1000
+	Params string `json:"params,omitempty"`
+	// MaxSize maximum upload size in bytes. 0 means no limit
+	MaxSize int64 `json:"max_size,omitempty"`
+	// Expires unix timestamp of token expiry
+	Expires int64 `json:"exp"`
+	// Nonce ensures token is single use
+	Nonce string `json:"nonce"`
+}
+
+// Allow checks if upload of key and size is within scope
+func (s *UploadScope) Allow(key string, size int64) error {
+	if s.KeyPrefix != "" && !strings.HasPrefix(strings.TrimPrefix(key, "/"), strings.TrimPrefix(s.KeyPrefix, "/")) {
+		return ErrUnauthorized
+	}
+	if s.MaxSize > 0 && size > s.MaxSize {
+		return ErrMaxSizeExceeded
+	}
+	return nil
+}
+
+// UploadTokenSigner mints and verifies short-lived, one-time upload tokens,
+// such that clients can upload directly without exposing the main secret.
+// Used nonces are kept in memory until expiry, not shared across instances
+type UploadTokenSigner struct {
+	secret []byte
+	used   map[string]int64
+	mu     sync.Mutex
+}
+
+// NewUploadTokenSigner create upload token signer with secret
+func NewUploadTokenSigner(secret string) *UploadTokenSigner {
+	return &UploadTokenSigner{
+		secret: []byte(secret),
+		used:   map[string]int64{},
+	}
+}
+
+// Sign mints upload token of scope valid for ttl
+func (s *UploadTokenSigner) Sign(scope UploadScope, ttl time.Duration) (string, error) {
+	scope.Expires = time.Now().Add(ttl).Unix()
+	if scope.Nonce == "" {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		scope.Nonce = hex.EncodeToString(buf)
+	}
+	payload, err := json.Marshal(scope)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + s.sign(enc), nil
+}
+
+// Verify verifies upload token for key of size and returns its scope.
+// Each token can only be verified successfully once,
+// such that it is consumed only if key and size are within scope
+func (s *UploadTokenSigner) Verify(token, key string, size int64) (*UploadScope, error) {
+	enc, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(enc))) {
+		return nil, ErrUnauthorized
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	var scope UploadScope
+	if err := json.Unmarshal(payload, &scope); err != nil {
+		return nil, ErrUnauthorized
+	}
+	now := time.Now().Unix()
+	if scope.Expires < now {
+		return nil, ErrExpired
+	}
+	if err := scope.Allow(key, size); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for nonce, exp := range s.used {
+		if exp < now {
+			delete(s.used, nonce)
+		}
+	}
+	if _, ok := s.used[scope.Nonce]; ok {
+		return nil, ErrUnauthorized
+	}
+	s.used[scope.Nonce] = scope.Expires
+	return &scope, nil
+}
+
+func (s *UploadTokenSigner) sign(payload string) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,46 @@
+package imagor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadToken(t *testing.T) {
+	signer := NewUploadTokenSigner("1234")
+	token, err := signer.Sign(UploadScope{
+		KeyPrefix: "users/1/",
+		Params:    "fit-in/1000x1000",
+		MaxSize:   1024,
+	}, time.Minute)
+	require.NoError(t, err)
+
+	_, err = NewUploadTokenSigner("abcd").Verify(token, "users/1/foo.jpg", 10)
+	assert.Equal(t, ErrUnauthorized, err, "should reject other secret")
+	_, err = signer.Verify(strings.Replace(token, ".", "a.", 1), "users/1/foo.jpg", 10)
+	assert.Equal(t, ErrUnauthorized, err, "should reject tampered payload")
+
+	_, err = signer.Verify(token, "users/2/foo.jpg", 10)
+	assert.Equal(t, ErrUnauthorized, err, "should reject key out of scope")
+	_, err = signer.Verify(token, "users/1/foo.jpg", 1025)
+	assert.Equal(t, ErrMaxSizeExceeded, err, "should reject size out of scope")
+
+	// token not consumed by rejected scope
+	scope, err := signer.Verify(token, "users/1/foo.jpg", -1)
+	require.NoError(t, err)
+	assert.Equal(t, "fit-in/1000x1000", scope.Params)
+	assert.NotEmpty(t, scope.Nonce)
+	assert.NoError(t, scope.Allow("users/1/foo.jpg", 1024))
+	assert.Equal(t, ErrUnauthorized, scope.Allow("users/2/foo.jpg", 10))
+	assert.Equal(t, ErrMaxSizeExceeded, scope.Allow("/users/1/foo.jpg", 1025))
+
+	_, err = signer.Verify(token, "users/1/foo.jpg", 10)
+	assert.Equal(t, ErrUnauthorized, err, "should reject token reuse")
+
+	token, err = signer.Sign(UploadScope{}, -time.Minute)
+	require.NoError(t, err)
+	_, err = signer.Verify(token, "foo.jpg", 10)
+	assert.Equal(t, ErrExpired, err)
+}
@@ -0,0 +1,161 @@
+package imagor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WebhookSignatureHeader header of webhook request body signature,
+// in format of sha256=<hex encoded HMAC-SHA256 of body>
+const WebhookSignatureHeader = "X-Imagor-Signature"
+
+const maxWebhookBodySize = 1 << 20
+
+// resultIndexDir result storage directory of result index for Purge
+const resultIndexDir = "imagor-index/"
+
+// WebhookPayload source change notification payload
+type WebhookPayload struct {
+	Images []string `json:"images"`
+}
+
+// SignWebhook signs webhook request body with secret
+func SignWebhook(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// serveWebhook handles source change notifications,
+// purges source and derived results then re-generates presets in background
+func (app *Imagor) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeJSON(w, r, ErrInvalid.Code, ErrInvalid)
+		return
+	}
+	if !hmac.Equal([]byte(r.Header.Get(WebhookSignatureHeader)), []byte(SignWebhook(app.WebhookSecret, body))) {
+		writeJSON(w, r, ErrUnauthorized.Code, ErrUnauthorized)
+		return
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || len(payload.Images) == 0 {
+		writeJSON(w, r, ErrInvalid.Code, ErrInvalid)
+		return
+	}
+	var images []string
+	for _, image := range payload.Images {
+		if image = strings.Trim(image, "/"); image != "" {
+			images = append(images, image)
+		}
+	}
+	go func() {
+		ctx := context.Background()
+		for _, image := range images {
+			app.Purge(ctx, image)
+		}
+		for _, image := range images {
+			for _, preset := range app.WebhookPresets {
+				app.regenerate(strings.Trim(preset+"/"+image, "/"))
+			}
+		}
+	}()
+	writeJSON(w, r, http.StatusAccepted, payload)
+}
+
+// resultIndexKey returns index key of result derived from source image.
+// Index keys are laid out under a source image prefix within result key namespace,
+// such that derived results are listed by prefix regardless of ResultKey
+func (app *Imagor) resultIndexKey(image, resultKey string) string {
+	return app.resultIndexPrefix(image) + resultKey
+}
+
+func (app *Imagor) resultIndexPrefix(image string) string {
+	h := sha1.Sum([]byte(image))
+	prefix := resultIndexDir + hex.EncodeToString(h[:]) + "/"
+	if app.ResultKeyNamespace != "" {
+		prefix = app.ResultKeyNamespace + "/" + prefix
+	}
+	return prefix
+}
+
+// indexResult records result key derived from source image
+// in storages that implement Lister, for Purge
+func (app *Imagor) indexResult(ctx context.Context, storages []Storage, image, resultKey string) {
+	for _, storage := range storages {
+		if _, ok := storage.(Lister); !ok {
+			continue
+		}
+		key := app.resultIndexKey(image, resultKey)
+		if err := storage.Put(ctx, key, NewBlobFromBytes([]byte(image))); err != nil {
+			app.Logger.Warn("index", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// isPurgeable whether results are indexed for Purge
+func (app *Imagor) isPurgeable() bool {
+	return app.WebhookSecret != "" || app.UploadSigner != nil
+}
+
+// Purge deletes source image from storages, and its derived results
+// from result storages that implement Lister, by the result index of image.
+// Results are only indexed with webhook or upload enabled
+func (app *Imagor) Purge(ctx context.Context, image string) {
+	app.del(ctx, app.Storages, image)
+	app.purgeResults(ctx, image)
+}
+
+func (app *Imagor) purgeResults(ctx context.Context, image string) {
+	prefix := app.resultIndexPrefix(image)
+	for _, storage := range append(app.ResultStorages, app.MetaStorages...) {
+		lister, ok := storage.(Lister)
+		if !ok {
+			continue
+		}
+		var keys []string
+		if err := lister.List(ctx, prefix, func(key string) error {
+			keys = append(keys, key)
+			return nil
+		}); err != nil {
+			app.Logger.Warn("purge", zap.String("image", image), zap.Error(err))
+		}
+		for _, key := range keys {
+			if err := storage.Delete(ctx, strings.TrimPrefix(key, prefix)); err != nil {
+				app.Logger.Warn("purge", zap.String("key", key), zap.Error(err))
+			}
+			if err := storage.Delete(ctx, key); err != nil {
+				app.Logger.Warn("purge", zap.String("key", key), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (app *Imagor) regenerate(path string) {
+	r, err := http.NewRequest(http.MethodGet, "", nil)
+	if err != nil {
+		return
+	}
+	p := imagorpath.Parse(path)
+	if app.Signer != nil {
+		p.Hash = app.Signer.Sign(p.Path)
+	}
+	if _, err := app.Do(r, p); err != nil {
+		app.Logger.Warn("regenerate", zap.String("path", path), zap.Error(err))
+	} else if app.Debug {
+		app.Logger.Debug("regenerated", zap.String("path", path))
+	}
+}
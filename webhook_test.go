@@ -0,0 +1,118 @@
+package imagor
+
+import (
+	"bytes"
+	"context"
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type listMapStore struct {
+	*mapStore
+}
+
+func (s listMapStore) List(ctx context.Context, prefix string, fn func(key string) error) error {
+	var keys []string
+	for key := range s.Map {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWebhook(t *testing.T) {
+	store := newMapStore()
+	resultStore := listMapStore{newMapStore()}
+	regenerated := make(chan string, 1)
+	app := New(
+		WithStorages(store),
+		WithResultStorages(resultStore),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			if p.Path == "fit-in/10x10/foo" {
+				regenerated <- p.Path
+			}
+			return blob, nil
+		})),
+		WithUnsafe(true),
+		WithWebhook("/webhook/", "s3cr3t", "fit-in/10x10", " "),
+	)
+	assert.Equal(t, "/webhook", app.WebhookPath)
+	assert.Equal(t, []string{"fit-in/10x10"}, app.WebhookPresets)
+
+	for _, path := range []string{"/unsafe/foo", "/unsafe/fit-in/100x100/foo", "/unsafe/bar"} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil))
+		assert.Equal(t, 200, w.Code)
+	}
+	// results and their index entries
+	assert.Equal(t, 6, len(resultStore.Map))
+	assert.Equal(t, []byte("foo"), resultStore.Map[app.resultIndexKey("foo", "fit-in/100x100/foo")].Sniff())
+
+	body := []byte(`{"images":["foo"]}`)
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/webhook", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "https://example.com/webhook", bytes.NewReader(body))
+	r.Header.Set(WebhookSignatureHeader, SignWebhook("wrong", body))
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 6, len(resultStore.Map))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "https://example.com/webhook", bytes.NewReader(body))
+	r.Header.Set(WebhookSignatureHeader, SignWebhook("s3cr3t", body))
+	app.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	// purged in background before presets regenerated
+	assert.Equal(t, "fit-in/10x10/foo", <-regenerated)
+	assert.Equal(t, 1, store.DelCnt["foo"])
+	assert.Equal(t, 1, resultStore.DelCnt["foo"])
+	assert.Equal(t, 1, resultStore.DelCnt["fit-in/100x100/foo"])
+	assert.Equal(t, 1, resultStore.DelCnt[app.resultIndexKey("foo", "fit-in/100x100/foo")])
+	assert.Equal(t, 0, resultStore.DelCnt["bar"])
+}
+
+func TestWebhookResultKey(t *testing.T) {
+	resultStore := listMapStore{newMapStore()}
+	app := New(
+		WithResultStorages(resultStore),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithResultKey(resultKeyFunc(func(p imagorpath.Params) string {
+			return "prefix:" + strings.ReplaceAll(p.Path, "/", "_")
+		})),
+		WithResultKeyNamespace("v1"),
+		WithUnsafe(true),
+		WithWebhook("/webhook", "s3cr3t"),
+	)
+	for _, path := range []string{"/unsafe/fit-in/100x100/foo/bar.jpg", "/unsafe/foo/bar.jpg/baz.jpg"} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil))
+		assert.Equal(t, 200, w.Code)
+	}
+	assert.Contains(t, resultStore.Map, app.resultIndexKey("foo/bar.jpg", "v1/prefix:fit-in_100x100_foo_bar.jpg"))
+	assert.Regexp(t, "^v1/imagor-index/[0-9a-f]{40}/v1/prefix:", app.resultIndexKey("foo/bar.jpg", "v1/prefix:fit-in_100x100_foo_bar.jpg"))
+	app.Purge(context.Background(), "foo/bar.jpg")
+	assert.Equal(t, 1, resultStore.DelCnt["v1/prefix:fit-in_100x100_foo_bar.jpg"])
+	assert.Equal(t, 0, resultStore.DelCnt["v1/prefix:foo_bar.jpg_baz.jpg"])
+	assert.Equal(t, 2, len(resultStore.Map))
+}